@@ -4,17 +4,27 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services"
 )
 
+// main exits with the exit code of the error of the command, which tells what
+// failed (see services.NodeExitCode)
 func main() {
-	logLevel := os.Getenv("CARTESI_LOG_LEVEL")
-	_, enableTimestamp := os.LookupEnv("CARTESI_LOG_ENABLE_TIMESTAMP")
-	logger.Init(logLevel, enableTimestamp)
+	config, err := logger.ConfigFromEnv()
+	if err == nil {
+		err = logger.Configure(config)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	if err := rootCmd.Execute(); err != nil {
-		logger.Error.Panic(err)
+		logger.Error.Println(err)
+		os.Exit(services.NodeExitCode(err))
 	}
 }
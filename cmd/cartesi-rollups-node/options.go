@@ -0,0 +1,618 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services"
+)
+
+// defaultStartupTimeout is how long the node waits for its services to become ready
+const defaultStartupTimeout = 5 * time.Minute
+
+// runOptions reads the supervisor configuration from the environment. The versions of the
+// binaries of the services are always logged at startup. The flags are read by [envFlag].
+//
+// CARTESI_SERVICES_STOP_TIMEOUT: how long to wait for the services to stop, in the format
+// accepted by [time.ParseDuration] (e.g. 30s).
+// CARTESI_SERVICES_STARTUP_TIMEOUT: how long to wait for all the services to become ready before
+// stopping the node, in the format accepted by [time.ParseDuration]. The default is five
+// minutes, and zero waits forever.
+// CARTESI_SERVICES_ADMIN: a flag that enables the admin server, which serves the status of the
+// services over HTTP.
+// CARTESI_SERVICES_ADMIN_ADDRESS: the address of the admin server, which also enables it. The
+// default only accepts local connections.
+// CARTESI_SERVICES_SKIP_VALIDATION: a flag that skips checking that the binaries of the services
+// exist before starting them, for setups where they only appear after the node starts.
+// CARTESI_SERVICES_START_STAGGER: how long to wait between two launches of services, in the
+// format accepted by [time.ParseDuration] (e.g. 500ms). By default, there is no wait.
+// CARTESI_SERVICES_MAX_STARTING: how many services may be starting at once. Zero, the default,
+// means there is no limit.
+// CARTESI_SERVICES_USAGE_INTERVAL: how often to sample the resident memory of the services, in
+// the format accepted by [time.ParseDuration] (e.g. 10s). By default, it is not sampled.
+// CARTESI_SERVICES_HEARTBEAT: a flag that enables the heartbeat, which logs a summary of the
+// states of the services every 5 minutes.
+// CARTESI_SERVICES_HEARTBEAT_INTERVAL: how often to log the heartbeat, in the format accepted by
+// [time.ParseDuration] (e.g. 1m), which also enables it.
+// CARTESI_SERVICES_JOURNAL: the path of a file where the events of the services are recorded,
+// one JSON object per line, to investigate a crash of the node. By default, there is none.
+// CARTESI_SERVICES_JOURNAL_MAX_SIZE: the size in bytes after which the journal is rotated. The
+// default is 10 MiB.
+// CARTESI_SERVICES_JOURNAL_MAX_FILES: how many rotated journals are kept. The default is 3.
+// CARTESI_SERVICES_INSTANCE_LOCK: a flag that makes the node hold a lock while it runs, so a
+// second node fails to start instead of running the same services. The lock is at
+// $XDG_RUNTIME_DIR/cartesi-rollups-node.lock, or in the temporary directory.
+// CARTESI_SERVICES_INSTANCE_LOCK_PATH: the path of the lock, which also enables it.
+// CARTESI_SERVICES_READY_MARKER: a flag that makes the node create a file while its services are
+// ready, for the healthchecks that test that a file exists. The file is at
+// $TMPDIR/cartesi-rollups-node.ready.
+// CARTESI_SERVICES_READY_MARKER_PATH: the path of the file, which also enables it.
+// CARTESI_SERVICES_RESTART_ON_FAILURE: a flag that restarts the services that fail in place,
+// keeping the other services running, instead of stopping the node. The node still stops when a
+// fatal service exits (see CARTESI_SERVICES_FATAL) or when a service crash loops.
+func runOptions() ([]services.RunOption, error) {
+	opts := []services.RunOption{services.WithBinaryVersions(0)}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_STOP_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_STOP_TIMEOUT: %w", err)
+		}
+		opts = append(opts, services.WithStopTimeout(timeout))
+	}
+	startupTimeout := defaultStartupTimeout
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_STARTUP_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_STARTUP_TIMEOUT: %w", err)
+		}
+		startupTimeout = timeout
+	}
+	opts = append(opts, services.WithStartupTimeout(startupTimeout))
+	address, admin, err := builtinServiceAddress("ADMIN")
+	if err != nil {
+		return nil, err
+	}
+	if admin {
+		opts = append(opts, services.WithAdminServer(address))
+	}
+	skipValidation, err := envFlag("CARTESI_SERVICES_SKIP_VALIDATION")
+	if err != nil {
+		return nil, err
+	}
+	if skipValidation {
+		opts = append(opts, services.WithoutValidation())
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_START_STAGGER"); ok {
+		stagger, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_START_STAGGER: %w", err)
+		}
+		opts = append(opts, services.WithStartStagger(stagger))
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_MAX_STARTING"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_MAX_STARTING: %w", err)
+		}
+		opts = append(opts, services.WithMaxStarting(limit))
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_USAGE_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_USAGE_INTERVAL: %w", err)
+		}
+		opts = append(opts, services.WithUsageSampling(interval))
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_HEARTBEAT_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_HEARTBEAT_INTERVAL: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_HEARTBEAT_INTERVAL: must be positive")
+		}
+		opts = append(opts, services.WithHeartbeat(interval))
+	} else if heartbeat, err := envFlag("CARTESI_SERVICES_HEARTBEAT"); err != nil {
+		return nil, err
+	} else if heartbeat {
+		opts = append(opts, services.WithHeartbeat(0))
+	}
+	if path, ok := os.LookupEnv("CARTESI_SERVICES_JOURNAL"); ok {
+		config := services.JournalConfig{Path: path}
+		if value, ok := os.LookupEnv("CARTESI_SERVICES_JOURNAL_MAX_SIZE"); ok {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CARTESI_SERVICES_JOURNAL_MAX_SIZE: %w", err)
+			}
+			config.MaxSize = size
+		}
+		if value, ok := os.LookupEnv("CARTESI_SERVICES_JOURNAL_MAX_FILES"); ok {
+			files, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CARTESI_SERVICES_JOURNAL_MAX_FILES: %w", err)
+			}
+			config.MaxFiles = files
+		}
+		opts = append(opts, services.WithJournal(config))
+	}
+	if path, ok := os.LookupEnv("CARTESI_SERVICES_INSTANCE_LOCK_PATH"); ok {
+		opts = append(opts, services.WithInstanceLock(path))
+	} else if lock, err := envFlag("CARTESI_SERVICES_INSTANCE_LOCK"); err != nil {
+		return nil, err
+	} else if lock {
+		opts = append(opts, services.WithInstanceLock(""))
+	}
+	if path, ok := os.LookupEnv("CARTESI_SERVICES_READY_MARKER_PATH"); ok {
+		opts = append(opts, services.WithReadyMarker(path))
+	} else if marker, err := envFlag("CARTESI_SERVICES_READY_MARKER"); err != nil {
+		return nil, err
+	} else if marker {
+		opts = append(opts, services.WithReadyMarker(""))
+	}
+	restart, err := envFlag("CARTESI_SERVICES_RESTART_ON_FAILURE")
+	if err != nil {
+		return nil, err
+	}
+	if restart {
+		opts = append(opts, services.WithRestartOnFailure(services.DefaultBackoff))
+	}
+	return opts, nil
+}
+
+// builtinServiceAddress reads from the environment whether a built-in server of the node is
+// enabled and its address: CARTESI_SERVICES_<NAME> is a flag that enables it with the default
+// address, and CARTESI_SERVICES_<NAME>_ADDRESS both enables it and sets the address.
+func builtinServiceAddress(name string) (string, bool, error) {
+	enabled, err := envFlag("CARTESI_SERVICES_" + name)
+	if err != nil {
+		return "", false, err
+	}
+	address, ok := os.LookupEnv("CARTESI_SERVICES_" + name + "_ADDRESS")
+	return address, enabled || ok, nil
+}
+
+// withBuiltinServices appends the built-in services that are enabled in the environment to the
+// list of services.
+//
+// CARTESI_SERVICES_HEALTH: a flag that enables the health service, which serves /healthz and
+// /readyz for the healthchecks of the node.
+// CARTESI_SERVICES_HEALTH_ADDRESS: the address of the health service, which also enables it.
+// The default only accepts local connections.
+// CARTESI_SERVICES_METRICS: a flag that enables the metrics service, which serves the metrics of
+// the services at /metrics for Prometheus.
+// CARTESI_SERVICES_METRICS_ADDRESS: the address of the metrics service, which also enables it.
+// The default only accepts local connections.
+// CARTESI_SERVICES_DEBUG: a flag that enables the debug service, which serves the profiles of the
+// node at /debug/pprof/ and its variables at /debug/vars.
+// CARTESI_SERVICES_DEBUG_ADDRESS: the address of the debug service, which also enables it.
+// The default only accepts local connections.
+// CARTESI_SERVICES_DEBUG_ALLOW_REMOTE: a flag that allows the debug service to listen on an
+// address that accepts remote connections.
+func withBuiltinServices(list []services.Service) ([]services.Service, error) {
+	for _, name := range []string{"HEALTH", "METRICS", "DEBUG", "PROXY"} {
+		address, enabled, err := builtinServiceAddress(name)
+		if err != nil {
+			return nil, err
+		}
+		if !enabled {
+			continue
+		}
+		switch name {
+		case "HEALTH":
+			list = append(list, services.NewHealthService(address))
+		case "METRICS":
+			list = append(list, services.NewMetricsService(address))
+		case "DEBUG":
+			allowRemote, err := envFlag("CARTESI_SERVICES_DEBUG_ALLOW_REMOTE")
+			if err != nil {
+				return nil, err
+			}
+			config := services.DebugConfig{Address: address, AllowRemote: allowRemote}
+			list = append(list, services.NewDebugService(config))
+		case "PROXY":
+			config := services.ProxyConfig{Address: address}
+			list = append(list, services.NewProxyService(config))
+		}
+	}
+	return list, nil
+}
+
+// disabledAliases maps the short names accepted by CARTESI_FEATURE_DISABLE_<SERVICE> to the names
+// of the services
+var disabledAliases = map[string]string{
+	"graphql": "graphql-server",
+}
+
+// withMonitors appends the monitors of the external dependencies of the node that are enabled in
+// the environment to the list of services. The monitors log when their dependency becomes
+// unreachable and report it in the status of the services and in the metrics.
+//
+// CARTESI_SERVICES_MONITOR_POSTGRES: a flag that monitors the database at
+// CARTESI_POSTGRES_ENDPOINT, as the postgres-monitor service.
+// CARTESI_SERVICES_MONITOR_BLOCKCHAIN_ADDRESS: the host and port of the JSON-RPC provider of the
+// blockchain (e.g. eth.example.com:8545), which are monitored as the blockchain-monitor service.
+// CARTESI_SERVICES_MONITOR_INTERVAL: how often the monitors check their dependency, in the format
+// accepted by [time.ParseDuration]. The default is ten seconds.
+// CARTESI_SERVICES_MONITOR_CRITICAL_AFTER: how long a dependency may be unreachable before the
+// node stops, in the format accepted by [time.ParseDuration] (e.g. 5m). The monitors never stop the
+// node when it is not set.
+func withMonitors(list []services.Service) ([]services.Service, error) {
+	var config services.MonitorConfig
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_MONITOR_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_MONITOR_INTERVAL: %w", err)
+		}
+		config.Interval = interval
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_MONITOR_CRITICAL_AFTER"); ok {
+		outage, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_MONITOR_CRITICAL_AFTER: %w", err)
+		}
+		config.Critical, config.Outage = true, outage
+	}
+	monitorPostgres, err := envFlag("CARTESI_SERVICES_MONITOR_POSTGRES")
+	if err != nil {
+		return nil, err
+	}
+	if monitorPostgres {
+		endpoint, ok := os.LookupEnv("CARTESI_POSTGRES_ENDPOINT")
+		if !ok {
+			return nil, fmt.Errorf(
+				"CARTESI_SERVICES_MONITOR_POSTGRES requires CARTESI_POSTGRES_ENDPOINT")
+		}
+		postgres := config
+		postgres.Check = services.PostgresProbe{URL: endpoint}
+		list = append(list, services.NewMonitorService("postgres-monitor", postgres))
+	}
+	if address, ok := os.LookupEnv("CARTESI_SERVICES_MONITOR_BLOCKCHAIN_ADDRESS"); ok {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_MONITOR_BLOCKCHAIN_ADDRESS: %w", err)
+		}
+		number, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_MONITOR_BLOCKCHAIN_ADDRESS: %w", err)
+		}
+		blockchain := config
+		blockchain.Check = services.TcpPortProbe{Host: host, Port: number}
+		list = append(list, services.NewMonitorService("blockchain-monitor", blockchain))
+	}
+	return list, nil
+}
+
+// withServicesFile appends the services defined in a file, such as sidecars, to the list of
+// services, after all the others.
+//
+// CARTESI_SERVICES_FILE: the path of a TOML file that defines extra services, each in a
+// [[service]] table with its name, binary, args, env, dir, stop_signal, stop_timeout, restart,
+// and probe (see services.ServicesFile). Their names cannot be the names of other services.
+func withServicesFile(list []services.Service) ([]services.Service, error) {
+	path, ok := os.LookupEnv("CARTESI_SERVICES_FILE")
+	if !ok {
+		return list, nil
+	}
+	return services.LoadServicesFile(path, list)
+}
+
+// withFatalServices marks the services whose exit stops the node even when the services that fail
+// are restarted in place, such as the ones the others cannot run without.
+//
+// CARTESI_SERVICES_FATAL: the names of the fatal services, separated by commas
+// (e.g. postgres,advance-runner).
+func withFatalServices(list []services.Service) ([]services.Service, error) {
+	value, ok := os.LookupEnv("CARTESI_SERVICES_FATAL")
+	if !ok {
+		return list, nil
+	}
+	result := append([]services.Service(nil), list...)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		found := false
+		for i, service := range result {
+			if service.String() == name {
+				result[i] = services.Fatal(service)
+				found = true
+			}
+		}
+		if !found && name != "" {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_FATAL: unknown service '%v'", name)
+		}
+	}
+	return result, nil
+}
+
+// nodeConfig reads the configuration of the services of the node from the environment.
+//
+// CARTESI_FEATURE_HOST_MODE: a flag that runs the application on the host, with the host-runner
+// in place of the server-manager and without snapshots.
+// CARTESI_SNAPSHOT_DIR: the directory of the snapshots of the machine, where the symlink named
+// latest points to the latest of them. It is required unless the node runs in host mode or
+// without a backend.
+// CARTESI_FEATURE_NO_BACKEND: a flag that runs the node without an application, so only the
+// state-server, the dispatcher, the indexer and the graphql-server run. It is the default when
+// neither the host mode nor the directory of the snapshots is set.
+// CARTESI_FEATURE_DISABLE_<SERVICE>: a flag that disables the service, where SERVICE is its name
+// in upper case with dashes replaced by underscores (e.g.
+// CARTESI_FEATURE_DISABLE_GRAPHQL_SERVER=true), or GRAPHQL for the graphql-server. A service that
+// an enabled service depends on cannot be disabled.
+// CARTESI_SERVICES_START_RETRY: how long to retry the start of the services while their binaries
+// are missing, such as on a volume that is mounted after the node starts, in the format accepted
+// by [time.ParseDuration]. The start is not retried by default.
+func nodeConfig() (services.NodeConfig, error) {
+	hostMode, err := envFlag("CARTESI_FEATURE_HOST_MODE")
+	if err != nil {
+		return services.NodeConfig{}, err
+	}
+	noBackend, err := envFlag("CARTESI_FEATURE_NO_BACKEND")
+	if err != nil {
+		return services.NodeConfig{}, err
+	}
+	snapshotDir := os.Getenv("CARTESI_SNAPSHOT_DIR")
+	output, err := outputConfig()
+	if err != nil {
+		return services.NodeConfig{}, err
+	}
+	gate, err := postgresGateConfig()
+	if err != nil {
+		return services.NodeConfig{}, err
+	}
+	config := services.NodeConfig{
+		HostMode:           hostMode,
+		NoBackend:          noBackend || (!hostMode && snapshotDir == ""),
+		MachineSnapshotDir: snapshotDir,
+		PostgresGate:       gate,
+		ProcessConfig:      services.ProcessConfig{Output: output},
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_START_RETRY"); ok {
+		retry, err := time.ParseDuration(value)
+		if err != nil {
+			return services.NodeConfig{},
+				fmt.Errorf("invalid CARTESI_SERVICES_START_RETRY: %w", err)
+		}
+		config.StartRetry = retry
+	}
+	const prefix = "CARTESI_FEATURE_DISABLE_"
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		disabled, err := envFlag(key)
+		if err != nil {
+			return services.NodeConfig{}, err
+		}
+		if disabled {
+			name := strings.ToLower(strings.ReplaceAll(key[len(prefix):], "_", "-"))
+			if alias, ok := disabledAliases[name]; ok {
+				name = alias
+			}
+			config.Disabled = append(config.Disabled, name)
+		}
+	}
+	return config, nil
+}
+
+// envFlag reads a boolean flag from the environment, which is false when it is not set and true
+// when it is set without a value. Otherwise, its value is parsed by [strconv.ParseBool], so
+// false and 0 turn it off, and any other value that is not a boolean is an error. Every flag of
+// the node is read with it.
+func envFlag(key string) (bool, error) {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return false, nil
+	}
+	if value == "" {
+		return true, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v: %w", key, err)
+	}
+	return flag, nil
+}
+
+// postgresGateConfig reads from the environment the configuration of the gate that waits for the
+// database, which is nil when the gate is not enabled. With the gate, the services that use the
+// database only start once it accepts connections.
+//
+// CARTESI_SERVICES_POSTGRES_GATE: a flag that enables the gate.
+// CARTESI_POSTGRES_ENDPOINT: the URL of the database (e.g. postgres://user:password@db:5432/db),
+// which the gate requires. Its password is never logged.
+// CARTESI_SERVICES_POSTGRES_GATE_TIMEOUT: how long to wait for the database, in the format accepted
+// by [time.ParseDuration] (e.g. 2m). The default is one minute.
+func postgresGateConfig() (*services.PostgresGateConfig, error) {
+	gate, err := envFlag("CARTESI_SERVICES_POSTGRES_GATE")
+	if err != nil || !gate {
+		return nil, err
+	}
+	endpoint, ok := os.LookupEnv("CARTESI_POSTGRES_ENDPOINT")
+	if !ok {
+		return nil, fmt.Errorf("CARTESI_SERVICES_POSTGRES_GATE requires CARTESI_POSTGRES_ENDPOINT")
+	}
+	config := &services.PostgresGateConfig{URL: endpoint}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_POSTGRES_GATE_TIMEOUT"); ok {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_POSTGRES_GATE_TIMEOUT: %w", err)
+		}
+		config.Timeout = timeout
+	}
+	return config, nil
+}
+
+// withServiceLogLevels sets the log level of the services from the environment.
+//
+// CARTESI_LOG_LEVEL_<SERVICE>: the minimum log level of the entries about the service, where
+// SERVICE is its name in upper case with dashes replaced by underscores
+// (e.g. CARTESI_LOG_LEVEL_GRAPHQL_SERVER=warning).
+func withServiceLogLevels(list []services.Service) ([]services.Service, error) {
+	result := make([]services.Service, len(list))
+	for i, service := range list {
+		result[i] = service
+		name := strings.ToUpper(strings.ReplaceAll(service.String(), "-", "_"))
+		key := "CARTESI_LOG_LEVEL_" + name
+		if value, ok := os.LookupEnv(key); ok {
+			level, err := logger.ParseLevel(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v: %w", key, err)
+			}
+			result[i] = services.LogLevel(service, level)
+		}
+	}
+	return result, nil
+}
+
+// logFileConfig reads the configuration of the log files of the services from the environment.
+// The services only write to log files when the directory is set.
+//
+// CARTESI_SERVICES_LOG_DIR: the directory of the log files, which are named after the services.
+// CARTESI_SERVICES_LOG_MAX_SIZE: the size in bytes after which a log file is rotated.
+// CARTESI_SERVICES_LOG_MAX_FILES: how many rotated log files are kept for each service.
+// CARTESI_SERVICES_LOG_CONSOLE: a flag that also writes the output of the services to the console.
+func logFileConfig() (*services.LogFileConfig, error) {
+	dir, ok := os.LookupEnv("CARTESI_SERVICES_LOG_DIR")
+	if !ok {
+		return nil, nil
+	}
+	config := &services.LogFileConfig{Dir: dir}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_MAX_SIZE"); ok {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_MAX_SIZE: %w", err)
+		}
+		config.MaxSize = size
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_MAX_FILES"); ok {
+		files, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_MAX_FILES: %w", err)
+		}
+		config.MaxFiles = files
+	}
+	console, err := envFlag("CARTESI_SERVICES_LOG_CONSOLE")
+	if err != nil {
+		return nil, err
+	}
+	config.Console = console
+	return config, nil
+}
+
+// outputConfig reads the configuration of the output of the services from the environment.
+//
+// CARTESI_SERVICES_RAW_OUTPUT: a flag that writes the output of the services straight to the
+// stdout and stderr of the node, for when it is collected by another log shipper.
+// CARTESI_SERVICES_LOG_CAPTURE_TIMESTAMP: the precision of the time, in UTC, added to each line
+// of output of the services when the node reads it (e.g. 1ms), to put the lines of different
+// services in order. By default, no time is added.
+func outputConfig() (services.OutputConfig, error) {
+	raw, err := envFlag("CARTESI_SERVICES_RAW_OUTPUT")
+	if err != nil {
+		return services.OutputConfig{}, err
+	}
+	var precision time.Duration
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_CAPTURE_TIMESTAMP"); ok {
+		precision, err = time.ParseDuration(value)
+		if err != nil {
+			return services.OutputConfig{}, fmt.Errorf(
+				"invalid CARTESI_SERVICES_LOG_CAPTURE_TIMESTAMP: %w", err)
+		}
+		if precision <= 0 {
+			return services.OutputConfig{}, fmt.Errorf(
+				"invalid CARTESI_SERVICES_LOG_CAPTURE_TIMESTAMP: must be positive")
+		}
+	}
+	logFile, err := logFileConfig()
+	if err != nil {
+		return services.OutputConfig{}, err
+	}
+	limit, err := repeatLimit()
+	if err != nil {
+		return services.OutputConfig{}, err
+	}
+	outputLimit, err := outputLimit()
+	if err != nil {
+		return services.OutputConfig{}, err
+	}
+	return services.OutputConfig{Raw: raw, LogFile: logFile, RepeatLimit: limit,
+		OutputLimit: outputLimit, CaptureTimestamps: precision}, nil
+}
+
+// outputLimit reads from the environment how the output of each service is bounded. Lines are
+// truncated after 64 KiB and all of them are logged unless the limits are set.
+//
+// CARTESI_SERVICES_LOG_MAX_LINE_SIZE: the size in bytes after which a line of output is
+// truncated.
+// CARTESI_SERVICES_LOG_RATE_LIMIT: how many bytes of output of each service are logged per
+// second. The lines over it are dropped, and how many bytes were dropped is logged instead.
+func outputLimit() (*services.OutputLimit, error) {
+	var limit services.OutputLimit
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_MAX_LINE_SIZE"); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_MAX_LINE_SIZE: %w", err)
+		}
+		if size < 1 {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_MAX_LINE_SIZE: must be positive")
+		}
+		limit.MaxLineSize = size
+	}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_RATE_LIMIT"); ok {
+		rate, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_RATE_LIMIT: %w", err)
+		}
+		if rate < 1 {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_RATE_LIMIT: must be positive")
+		}
+		limit.BytesPerSecond = rate
+	}
+	if limit == (services.OutputLimit{}) {
+		return nil, nil
+	}
+	return &limit, nil
+}
+
+// repeatLimit reads from the environment how the repeated lines of output are suppressed. No
+// lines are suppressed unless the window is set.
+//
+// CARTESI_SERVICES_LOG_REPEAT_WINDOW: how long a line counts as repeated after it is logged
+// (e.g. 10s). The number of suppressed repetitions is logged once it elapses.
+// CARTESI_SERVICES_LOG_REPEAT_THRESHOLD: how many times in a row the same line is logged within
+// the window before it is suppressed. The default is 1.
+func repeatLimit() (*services.RepeatLimit, error) {
+	value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_REPEAT_WINDOW")
+	if !ok {
+		return nil, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_REPEAT_WINDOW: %w", err)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf(
+			"invalid CARTESI_SERVICES_LOG_REPEAT_WINDOW: must be positive")
+	}
+	limit := &services.RepeatLimit{Window: window}
+	if value, ok := os.LookupEnv("CARTESI_SERVICES_LOG_REPEAT_THRESHOLD"); ok {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CARTESI_SERVICES_LOG_REPEAT_THRESHOLD: %w", err)
+		}
+		if threshold < 1 {
+			return nil, fmt.Errorf(
+				"invalid CARTESI_SERVICES_LOG_REPEAT_THRESHOLD: must be positive")
+		}
+		limit.Threshold = threshold
+	}
+	return limit, nil
+}
@@ -0,0 +1,141 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/services"
+)
+
+func TestBuiltinServices(t *testing.T) {
+
+	t.Run("it keeps the debug service on loopback when remote is not allowed", func(t *testing.T) {
+		for _, value := range []string{"false", "0"} {
+			t.Setenv("CARTESI_SERVICES_DEBUG_ADDRESS", "0.0.0.0:0")
+			t.Setenv("CARTESI_SERVICES_DEBUG_ALLOW_REMOTE", value)
+			list, err := withBuiltinServices(nil)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(list) != 1 {
+				t.Fatalf("expected the debug service, got %v", list)
+			}
+			err = list[0].Start(context.Background())
+			if err == nil || !strings.Contains(err.Error(), "not a loopback address") {
+				t.Fatalf("expected the address to be refused with %q, got %v", value, err)
+			}
+		}
+	})
+
+	t.Run("it fails when the flag of the debug service is invalid", func(t *testing.T) {
+		t.Setenv("CARTESI_SERVICES_DEBUG_ADDRESS", "0.0.0.0:0")
+		t.Setenv("CARTESI_SERVICES_DEBUG_ALLOW_REMOTE", "maybe")
+		_, err := withBuiltinServices(nil)
+		if err == nil || !strings.Contains(err.Error(), "CARTESI_SERVICES_DEBUG_ALLOW_REMOTE") {
+			t.Fatalf("expected the flag to be refused, got %v", err)
+		}
+	})
+}
+
+func TestEnvFlag(t *testing.T) {
+
+	t.Run("it turns the flags off with false values", func(t *testing.T) {
+		for _, value := range []string{"false", "0"} {
+			t.Setenv("CARTESI_SERVICES_HEALTH", value)
+			t.Setenv("CARTESI_SERVICES_POSTGRES_GATE", value)
+			t.Setenv("CARTESI_SERVICES_RAW_OUTPUT", value)
+			t.Setenv("CARTESI_SERVICES_LOG_DIR", t.TempDir())
+			t.Setenv("CARTESI_SERVICES_LOG_CONSOLE", value)
+			if _, enabled, err := builtinServiceAddress("HEALTH"); err != nil || enabled {
+				t.Errorf("expected the health service to be disabled with %q, got %v %v",
+					value, enabled, err)
+			}
+			if gate, err := postgresGateConfig(); err != nil || gate != nil {
+				t.Errorf("expected no gate with %q, got %v %v", value, gate, err)
+			}
+			output, err := outputConfig()
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if output.Raw || output.LogFile == nil || output.LogFile.Console {
+				t.Errorf("expected the output flags to be off with %q, got %+v", value, output)
+			}
+		}
+	})
+
+	t.Run("it turns the flags on when they are set without a value", func(t *testing.T) {
+		t.Setenv("CARTESI_SERVICES_HEALTH", "")
+		if _, enabled, err := builtinServiceAddress("HEALTH"); err != nil || !enabled {
+			t.Fatalf("expected the health service to be enabled, got %v %v", enabled, err)
+		}
+	})
+
+	t.Run("it fails when a flag is not a boolean", func(t *testing.T) {
+		for _, key := range []string{
+			"CARTESI_SERVICES_SKIP_VALIDATION",
+			"CARTESI_SERVICES_HEARTBEAT",
+			"CARTESI_SERVICES_INSTANCE_LOCK",
+			"CARTESI_SERVICES_READY_MARKER",
+			"CARTESI_SERVICES_ADMIN",
+		} {
+			t.Run(key, func(t *testing.T) {
+				t.Setenv(key, "maybe")
+				_, err := runOptions()
+				if err == nil || !strings.Contains(err.Error(), "invalid "+key) {
+					t.Fatalf("expected the flag to be refused, got %v", err)
+				}
+			})
+		}
+	})
+}
+
+func TestNodeConfig(t *testing.T) {
+
+	t.Run("it runs the graphql-server and the indexer by default", func(t *testing.T) {
+		config, err := nodeConfig()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		list, err := services.NewNodeServices(config)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var names []string
+		for _, service := range list {
+			names = append(names, service.String())
+		}
+		for _, name := range []string{"graphql-server", "indexer"} {
+			if !slices.Contains(names, name) {
+				t.Errorf("expected %v to run, got %v", name, names)
+			}
+		}
+	})
+
+	t.Run("it maps the disable flags to the names of the services", func(t *testing.T) {
+		tests := map[string]string{
+			"CARTESI_FEATURE_DISABLE_GRAPHQL_SERVER": "graphql-server",
+			"CARTESI_FEATURE_DISABLE_GRAPHQL":        "graphql-server",
+			"CARTESI_FEATURE_DISABLE_INDEXER":        "indexer",
+		}
+		for key, name := range tests {
+			t.Run(key, func(t *testing.T) {
+				t.Setenv(key, "true")
+				config, err := nodeConfig()
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				if !slices.Equal(config.Disabled, []string{name}) {
+					t.Fatalf("expected %v to be disabled, got %v", name, config.Disabled)
+				}
+				if _, err := services.NewNodeServices(config); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			})
+		}
+	})
+}
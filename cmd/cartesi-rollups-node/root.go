@@ -9,10 +9,13 @@ var rootCmd = &cobra.Command{
 	Use:                   "cartesi-rollups-node",
 	CompletionOptions:     cobra.CompletionOptions{HiddenDefaultCmd: true},
 	DisableFlagsInUseLine: true,
+	SilenceErrors:         true,
+	SilenceUsage:          true,
 }
 
 func init() {
 	rootCmd.AddCommand(reader)
 	rootCmd.AddCommand(validator)
 	rootCmd.AddCommand(noBackend)
+	rootCmd.AddCommand(servicesCmd)
 }
@@ -0,0 +1,90 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/cartesi/rollups-node/internal/services"
+	"github.com/spf13/cobra"
+)
+
+var servicesCmd = &cobra.Command{
+	Use:   "services",
+	Short: "Inspects the services of a running node",
+}
+
+var servicesStatus = &cobra.Command{
+	Use:   "status",
+	Short: "Prints the status of the services of a running node",
+	Long: "Prints the status of the services of a running node, which must enable its admin " +
+		"server with CARTESI_SERVICES_ADMIN or CARTESI_SERVICES_ADMIN_ADDRESS. It fails when " +
+		"the node is not running.",
+	Args: cobra.NoArgs,
+	RunE: runServicesStatus,
+}
+
+var (
+	servicesAddress string
+	servicesJSON    bool
+)
+
+func init() {
+	address, ok := os.LookupEnv("CARTESI_SERVICES_ADMIN_ADDRESS")
+	if !ok {
+		address = services.DefaultAdminAddress
+	}
+	servicesStatus.Flags().StringVar(&servicesAddress, "address", address,
+		"address of the admin server of the node")
+	servicesStatus.Flags().BoolVar(&servicesJSON, "json", false,
+		"print the status in JSON, in the versioned schema of the admin server")
+	servicesCmd.AddCommand(servicesStatus)
+}
+
+func runServicesStatus(cmd *cobra.Command, args []string) error {
+	status, err := services.FetchAdminStatus(cmd.Context(), servicesAddress)
+	if err != nil {
+		return err
+	}
+	if servicesJSON {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(status)
+	}
+	return printStatusTable(cmd.OutOrStdout(), status.Services)
+}
+
+// printStatusTable prints a row for each service, followed by the members of
+// the groups
+func printStatusTable(out io.Writer, statuses []services.StatusResponse) error {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSTATE\tPID\tUPTIME\tRESTARTS\tLAST ERROR")
+	var printRows func(statuses []services.StatusResponse, indent string)
+	printRows = func(statuses []services.StatusResponse, indent string) {
+		for _, status := range statuses {
+			pid := "-"
+			if status.PID != 0 {
+				pid = strconv.Itoa(status.PID)
+			}
+			fmt.Fprintf(table, "%v%v\t%v\t%v\t%v\t%v\t%v\n", indent, status.Name, status.State,
+				pid, orDash(status.Uptime), status.Restarts, orDash(status.LastError))
+			printRows(status.Members, indent+"  ")
+		}
+	}
+	printRows(statuses, "")
+	return table.Flush()
+}
+
+// orDash returns the value, or a dash if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
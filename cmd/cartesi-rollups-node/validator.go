@@ -4,6 +4,9 @@
 package main
 
 import (
+	"context"
+
+	"github.com/cartesi/rollups-node/internal/logger"
 	"github.com/cartesi/rollups-node/internal/services"
 	"github.com/spf13/cobra"
 )
@@ -12,14 +15,55 @@ var validator = &cobra.Command{
 	Use:                   "validator",
 	Short:                 "Starts the node in validator mode",
 	DisableFlagsInUseLine: true,
-	Run:                   runValidatorNode,
+	RunE:                  runValidatorNode,
 }
 
-func runValidatorNode(cmd *cobra.Command, args []string) {
-	validatorServices := []services.Service{
-		services.GraphQLServer,
-		services.Indexer,
-	}
+var validatorDryRun bool
+
+func init() {
+	validator.Flags().BoolVar(&validatorDryRun, "dry-run", false,
+		"verify the configuration of the services without starting them")
+}
 
-	services.Run(validatorServices)
+func runValidatorNode(cmd *cobra.Command, args []string) error {
+	config, err := nodeConfig()
+	if err != nil {
+		return err
+	}
+	validatorServices, err := services.NewNodeServices(config)
+	if err != nil {
+		return err
+	}
+	validatorServices, err = withBuiltinServices(validatorServices)
+	if err != nil {
+		return err
+	}
+	validatorServices, err = withMonitors(validatorServices)
+	if err != nil {
+		return err
+	}
+	validatorServices, err = withServicesFile(validatorServices)
+	if err != nil {
+		return err
+	}
+	validatorServices, err = withServiceLogLevels(validatorServices)
+	if err != nil {
+		return err
+	}
+	validatorServices, err = withFatalServices(validatorServices)
+	if err != nil {
+		return err
+	}
+	opts, err := runOptions()
+	if err != nil {
+		return err
+	}
+	if validatorDryRun {
+		if err := services.Verify(validatorServices); err != nil {
+			return err
+		}
+		logger.Info.Println("the configuration of the services is valid")
+		return nil
+	}
+	return services.Run(context.Background(), validatorServices, opts...)
 }
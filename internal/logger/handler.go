@@ -0,0 +1,156 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// splitHandler sends the errors and warnings to one handler and the other
+// entries to another, so they go to stderr and stdout respectively
+type splitHandler struct {
+	out slog.Handler
+	err slog.Handler
+}
+
+func (h splitHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.out.Enabled(ctx, level)
+}
+
+func (h splitHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level >= slog.LevelWarn {
+		return h.err.Handle(ctx, record)
+	}
+	return h.out.Handle(ctx, record)
+}
+
+func (h splitHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return splitHandler{out: h.out.WithAttrs(attrs), err: h.err.WithAttrs(attrs)}
+}
+
+func (h splitHandler) WithGroup(name string) slog.Handler {
+	return splitHandler{out: h.out.WithGroup(name), err: h.err.WithGroup(name)}
+}
+
+// textOptions configures a textHandler
+type textOptions struct {
+	level    slog.Level
+	layout   string // of the time; no time is written when empty
+	caller   bool
+	longFile bool
+}
+
+// textHandler writes the entries in the format of the [log.Logger] of the
+// package before it moved to slog: the level, followed by the time, the
+// caller, and the message. Attributes follow the message as key=value
+type textHandler struct {
+	mutex   *sync.Mutex
+	out     io.Writer
+	options textOptions
+	attrs   string
+	group   string
+}
+
+func newTextHandler(out io.Writer, options textOptions) *textHandler {
+	return &textHandler{mutex: &sync.Mutex{}, out: out, options: options}
+}
+
+var levelPrefixes = map[slog.Level]string{
+	slog.LevelError: "ERROR ",
+	slog.LevelWarn:  "WARN ",
+	slog.LevelInfo:  "INFO ",
+	slog.LevelDebug: "DEBUG ",
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.options.level
+}
+
+func (h *textHandler) Handle(_ context.Context, record slog.Record) error {
+	buffer := make([]byte, 0, 128)
+	prefix, ok := levelPrefixes[record.Level]
+	if !ok {
+		prefix = record.Level.String() + " "
+	}
+	buffer = append(buffer, prefix...)
+	if h.options.layout != "" {
+		buffer = record.Time.AppendFormat(buffer, h.options.layout)
+		buffer = append(buffer, ' ')
+	}
+	if h.options.caller && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		file := frame.File
+		if !h.options.longFile {
+			file = filepath.Base(file)
+		}
+		buffer = append(buffer, file...)
+		buffer = append(buffer, ':')
+		buffer = strconv.AppendInt(buffer, int64(frame.Line), 10)
+		buffer = append(buffer, ": "...)
+	}
+	buffer = append(buffer, record.Message...)
+	buffer = append(buffer, h.attrs...)
+	record.Attrs(func(attr slog.Attr) bool {
+		buffer = appendAttr(buffer, h.group, attr)
+		return true
+	})
+	buffer = append(buffer, '\n')
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := h.out.Write(buffer)
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	buffer := []byte(h.attrs)
+	for _, attr := range attrs {
+		buffer = appendAttr(buffer, h.group, attr)
+	}
+	clone.attrs = string(buffer)
+	return &clone
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.group = h.group + name + "."
+	return &clone
+}
+
+// appendAttr appends the attribute as key=value, quoting the value if needed
+func appendAttr(buffer []byte, group string, attr slog.Attr) []byte {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return buffer
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			group += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			buffer = appendAttr(buffer, group, member)
+		}
+		return buffer
+	}
+	buffer = append(buffer, ' ')
+	buffer = append(buffer, group...)
+	buffer = append(buffer, attr.Key...)
+	buffer = append(buffer, '=')
+	value := attr.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		value = strconv.Quote(value)
+	}
+	return append(buffer, value...)
+}
@@ -1,24 +1,122 @@
 // (c) Cartesi and individual authors (see AUTHORS)
 // SPDX-License-Identifier: Apache-2.0 (see LICENSE)
 
-// Package logger provides different log levels by wrapping the default [log.Logger]. There are
+// Package logger provides different log levels on top of a shared [slog.Handler]. There are
 // four levels, in decreasing order of priority: Error, Warning, Info, and Debug.
 // Error and Warning write to [os.Stderr] and Info and Debug write to [os.Stdout]. If Debug is set
 // as the default level, all logs include file and line number data.
 //
-// The package can be configured with two environment variables:
+// The Error, Warning, Info, and Debug loggers are [log.Logger] shims of the handler, and
+// [Default] and [With] return a [slog.Logger] that writes to the same handler.
+//
+// The package can be configured with the following environment variables:
 //
 // CARTESI_LOG_LEVEL: defines the main log level. [Info] is the default.
 // CARTESI_LOG_ENABLE_TIMESTAMP: a flag that adds date and time information to the log entries.
 // It is disabled by default.
+// CARTESI_LOG_FORMAT: either text, the default, or json. In the JSON format each entry is an
+// object with the time, level, message, and the fields passed to [Log].
+// CARTESI_LOG_TIMESTAMP: the format of the time of the text entries, one of none, datetime,
+// micro, rfc3339, and rfc3339nano. It overrides CARTESI_LOG_ENABLE_TIMESTAMP, which is the same
+// as datetime.
+// CARTESI_LOG_CALLER: a flag that adds the short file name and line number of the caller to the
+// log entries.
+// CARTESI_LOG_COLOR: a flag that colors the console output in the text format, which is the
+// default when stdout is a terminal. The console is never colored when NO_COLOR is set or stdout
+// is not a terminal, such as when it is piped.
 package logger
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// Formats of the log entries
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Formats of the time of the text entries
+const (
+	TimestampNone        = "none"
+	TimestampDateTime    = "datetime"
+	TimestampMicro       = "micro"
+	TimestampRFC3339     = "rfc3339"
+	TimestampRFC3339Nano = "rfc3339nano"
+)
+
+// Config of the loggers. The zero values keep the defaults
+type Config struct {
+	Level     string
+	Format    string
+	Timestamp string
+	Caller    bool
+
+	// Color colors the console output in the text format. See [Colored]
+	Color bool
+}
+
+// Level of the entries. The zero Level means that no level was set
+type Level int
+
+// Levels in decreasing order of priority
+const (
+	ErrorLevel Level = iota + 1
+	WarningLevel
+	InfoLevel
+	DebugLevel
 )
 
+var levelNames = map[Level]string{
+	ErrorLevel:   "error",
+	WarningLevel: "warning",
+	InfoLevel:    "info",
+	DebugLevel:   "debug",
+}
+
+var slogLevels = map[Level]slog.Level{
+	ErrorLevel:   slog.LevelError,
+	WarningLevel: slog.LevelWarn,
+	InfoLevel:    slog.LevelInfo,
+	DebugLevel:   slog.LevelDebug,
+}
+
+// ParseLevel parses the name of a level as accepted by CARTESI_LOG_LEVEL
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q", name)
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// LevelOf returns the level of one of the loggers of the package
+func LevelOf(l *log.Logger) Level {
+	switch l {
+	case Error:
+		return ErrorLevel
+	case Warning:
+		return WarningLevel
+	case Debug:
+		return DebugLevel
+	default:
+		return InfoLevel
+	}
+}
+
 var (
 	Error   *log.Logger
 	Warning *log.Logger
@@ -26,33 +124,175 @@ var (
 	Debug   *log.Logger
 )
 
+var (
+	handler       slog.Handler
+	defaultLogger *slog.Logger
+	jsonFormat    bool
+	colored       bool
+
+	// shims maps the loggers created by Configure to their levels, so Log can
+	// write records with fields to the handler
+	shims map[*log.Logger]slog.Level
+)
+
+func init() {
+	_ = Configure(Config{})
+}
+
+// Default returns the logger that writes to the handler of the package
+func Default() *slog.Logger {
+	return defaultLogger
+}
+
+// Colored reports whether the console output is colored, so the callers may add escape
+// sequences to the messages
+func Colored() bool {
+	return colored
+}
+
+// IsJSON reports whether the entries are written in the JSON format, where the fields passed to
+// [Log] are kept
+func IsJSON() bool {
+	return jsonFormat
+}
+
+// With returns a logger that adds the attributes in args to its entries
+func With(args ...any) *slog.Logger {
+	return defaultLogger.With(args...)
+}
+
+// Init configures the loggers with the given level, adding the date and time to the entries if
+// enableTimestamp is set. It panics if the level is invalid
 func Init(logLevel string, enableTimestamp bool) {
-	var flags int
+	config := Config{Level: logLevel}
 	if enableTimestamp {
-		flags |= log.Ldate | log.Ltime
-	}
-
-	Error = log.New(os.Stderr, "ERROR ", flags)
-	Warning = log.New(os.Stderr, "WARN ", flags)
-	Info = log.New(os.Stdout, "INFO ", flags)
-	Debug = log.New(os.Stdout, "DEBUG ", flags)
-
-	switch logLevel {
-	case "error":
-		Warning.SetOutput(io.Discard)
-		fallthrough
-	case "warning":
-		Info.SetOutput(io.Discard)
-		fallthrough
-	case "info":
-		Debug.SetOutput(io.Discard)
-	case "debug":
-		flags |= log.Llongfile
-		Error.SetFlags(flags)
-		Warning.SetFlags(flags)
-		Info.SetFlags(flags)
-		Debug.SetFlags(flags)
+		config.Timestamp = TimestampDateTime
+	}
+	if err := Configure(config); err != nil {
+		panic(err)
+	}
+}
+
+// ConfigFromEnv reads the configuration of the loggers from the environment variables described
+// in the package documentation
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Level:     os.Getenv("CARTESI_LOG_LEVEL"),
+		Format:    os.Getenv("CARTESI_LOG_FORMAT"),
+		Timestamp: os.Getenv("CARTESI_LOG_TIMESTAMP"),
+	}
+	if _, ok := os.LookupEnv("CARTESI_LOG_ENABLE_TIMESTAMP"); ok && config.Timestamp == "" {
+		config.Timestamp = TimestampDateTime
+	}
+	if value, ok := os.LookupEnv("CARTESI_LOG_CALLER"); ok {
+		caller, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CARTESI_LOG_CALLER: %w", err)
+		}
+		config.Caller = caller
+	}
+	config.Color = os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	if value, ok := os.LookupEnv("CARTESI_LOG_COLOR"); ok {
+		color, err := strconv.ParseBool(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CARTESI_LOG_COLOR: %w", err)
+		}
+		config.Color = config.Color && color
+	}
+	return config, nil
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Configure sets up the handler and the loggers. The JSON format always includes the time of
+// the entries
+func Configure(config Config) error {
+	return configure(config, os.Stdout, os.Stderr)
+}
+
+func configure(config Config, stdout io.Writer, stderr io.Writer) error {
+	level := InfoLevel
+	if config.Level != "" {
+		var err error
+		if level, err = ParseLevel(config.Level); err != nil {
+			return err
+		}
+	}
+
+	var out, errOut slog.Handler
+	switch config.Format {
+	case TextFormat, "":
+		options := textOptions{
+			level:    slogLevels[level],
+			longFile: level == DebugLevel && !config.Caller,
+			caller:   config.Caller || level == DebugLevel,
+		}
+		switch config.Timestamp {
+		case TimestampNone, "":
+		case TimestampDateTime:
+			options.layout = "2006/01/02 15:04:05"
+		case TimestampMicro:
+			options.layout = "2006/01/02 15:04:05.000000"
+		case TimestampRFC3339:
+			options.layout = time.RFC3339
+		case TimestampRFC3339Nano:
+			options.layout = time.RFC3339Nano
+		default:
+			return fmt.Errorf("invalid log timestamp %q", config.Timestamp)
+		}
+		out = newTextHandler(stdout, options)
+		errOut = newTextHandler(stderr, options)
+	case JSONFormat:
+		options := &slog.HandlerOptions{Level: slogLevels[level], AddSource: config.Caller}
+		out = slog.NewJSONHandler(stdout, options)
+		errOut = slog.NewJSONHandler(stderr, options)
 	default:
-		panic("Invalid log level")
+		return fmt.Errorf("invalid log format %q", config.Format)
+	}
+
+	handler = splitHandler{out: out, err: errOut}
+	defaultLogger = slog.New(handler)
+	jsonFormat = config.Format == JSONFormat
+	colored = config.Color && !jsonFormat
+	Error = slog.NewLogLogger(handler, slog.LevelError)
+	Warning = slog.NewLogLogger(handler, slog.LevelWarn)
+	Info = slog.NewLogLogger(handler, slog.LevelInfo)
+	Debug = slog.NewLogLogger(handler, slog.LevelDebug)
+	shims = map[*log.Logger]slog.Level{
+		Error:   slog.LevelError,
+		Warning: slog.LevelWarn,
+		Info:    slog.LevelInfo,
+		Debug:   slog.LevelDebug,
+	}
+	return nil
+}
+
+// Log writes msg to l. In the JSON format, the key/value pairs in args are added to the entry as
+// fields. The text format only writes the message, so it must be complete on its own.
+func Log(l *log.Logger, msg string, args ...any) {
+	LogDepth(l, 1, msg, args...)
+}
+
+// LogDepth is like [Log] but reports the caller that is depth frames above the caller of
+// LogDepth, for helpers that wrap it
+func LogDepth(l *log.Logger, depth int, msg string, args ...any) {
+	level, ok := shims[l]
+	if !ok {
+		_ = l.Output(depth+2, msg)
+		return
+	}
+	if !handler.Enabled(context.Background(), level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(depth+2, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	if jsonFormat {
+		record.Add(args...)
 	}
+	_ = handler.Handle(context.Background(), record)
 }
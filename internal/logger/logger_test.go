@@ -0,0 +1,208 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// capture configures the loggers to write to buffers for the rest of the test
+func capture(t *testing.T, config Config) (stdout *bytes.Buffer, stderr *bytes.Buffer) {
+	stdout, stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	if err := configure(config, stdout, stderr); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	t.Cleanup(func() { _ = Configure(Config{}) })
+	return stdout, stderr
+}
+
+func TestTextFormat(t *testing.T) {
+
+	t.Run("it keeps the shape of the entries", func(t *testing.T) {
+		stdout, stderr := capture(t, Config{})
+
+		Info.Printf("main: %v\n", "all services are ready")
+		Error.Println("main: service 'indexer' exited")
+
+		if stdout.String() != "INFO main: all services are ready\n" {
+			t.Errorf("unexpected stdout %q", stdout.String())
+		}
+		if stderr.String() != "ERROR main: service 'indexer' exited\n" {
+			t.Errorf("unexpected stderr %q", stderr.String())
+		}
+	})
+
+	t.Run("it filters the entries below the level", func(t *testing.T) {
+		stdout, stderr := capture(t, Config{Level: "warning"})
+
+		Debug.Println("debug")
+		Info.Println("info")
+		Warning.Println("warning")
+		Default().Info("structured info")
+
+		if stdout.Len() != 0 {
+			t.Errorf("expected no entries on stdout, got %q", stdout.String())
+		}
+		if stderr.String() != "WARN warning\n" {
+			t.Errorf("unexpected stderr %q", stderr.String())
+		}
+	})
+
+	t.Run("it writes only the message of Log", func(t *testing.T) {
+		_, stderr := capture(t, Config{})
+
+		Log(Error, "main: service 'indexer' exited", "service", "indexer", "event", "exited")
+
+		if stderr.String() != "ERROR main: service 'indexer' exited\n" {
+			t.Errorf("unexpected entry %q", stderr.String())
+		}
+	})
+
+	t.Run("it renders the attributes of the structured loggers", func(t *testing.T) {
+		stdout, _ := capture(t, Config{})
+
+		With("service", "indexer").WithGroup("probe").Info("ready", "elapsed", "1.5s",
+			"url", "http://localhost:4000/graphql", "detail", "all good")
+
+		expected := "INFO ready service=indexer probe.elapsed=1.5s " +
+			"probe.url=http://localhost:4000/graphql probe.detail=\"all good\"\n"
+		if stdout.String() != expected {
+			t.Errorf("expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("it adds the time and the caller", func(t *testing.T) {
+		_, stderr := capture(t, Config{Timestamp: TimestampRFC3339Nano, Caller: true})
+
+		Warning.Println("main: slow shutdown")
+		Log(Warning, "main: slow shutdown")
+
+		pattern := regexp.MustCompile(`^WARN \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?` +
+			`(Z|[+-]\d{2}:\d{2}) logger_test.go:\d+: main: slow shutdown$`)
+		for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+			if !pattern.MatchString(line) {
+				t.Errorf("unexpected entry %q", line)
+			}
+		}
+	})
+
+	t.Run("it uses the date and time format of the log package", func(t *testing.T) {
+		stdout, _ := capture(t, Config{Timestamp: TimestampDateTime})
+
+		Info.Println("main: starting")
+
+		pattern := `^INFO \d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2} main: starting\n$`
+		if !regexp.MustCompile(pattern).MatchString(stdout.String()) {
+			t.Errorf("unexpected entry %q", stdout.String())
+		}
+	})
+}
+
+func TestJSONFormat(t *testing.T) {
+
+	t.Run("it writes the fields of Log", func(t *testing.T) {
+		_, stderr := capture(t, Config{Format: JSONFormat})
+
+		Log(Error, "main: service 'indexer' exited", "service", "indexer",
+			"error", errors.New("boom"))
+
+		entry := decode(t, stderr.String())
+		expected := map[string]any{
+			"level":   "ERROR",
+			"msg":     "main: service 'indexer' exited",
+			"service": "indexer",
+			"error":   "boom",
+		}
+		for key, value := range expected {
+			if entry[key] != value {
+				t.Errorf("expected %v to be %v, got %v", key, value, entry[key])
+			}
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("expected the entry to have a time")
+		}
+	})
+
+	t.Run("it turns printed entries into JSON objects", func(t *testing.T) {
+		stdout, _ := capture(t, Config{Format: JSONFormat})
+
+		Info.Printf("main: %v\n", "all services are ready")
+
+		entry := decode(t, stdout.String())
+		if entry["msg"] != "main: all services are ready" || entry["level"] != "INFO" {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	})
+
+	t.Run("it reports the caller", func(t *testing.T) {
+		stdout, _ := capture(t, Config{Format: JSONFormat, Caller: true})
+
+		Log(Info, "main: logged")
+		Info.Println("main: printed")
+		Default().Info("main: structured")
+
+		for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+			source, _ := decode(t, line)["source"].(map[string]any)
+			if file, _ := source["file"].(string); !strings.HasSuffix(file, "logger_test.go") {
+				t.Errorf("expected the caller to be the test, got %v", source)
+			}
+		}
+	})
+}
+
+func TestConfigure(t *testing.T) {
+	for _, config := range []Config{
+		{Level: "verbose"},
+		{Format: "xml"},
+		{Timestamp: "unix"},
+	} {
+		if err := Configure(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestColored(t *testing.T) {
+
+	t.Run("it colors only the text format", func(t *testing.T) {
+		capture(t, Config{Color: true})
+		if !Colored() {
+			t.Error("expected the text format to be colored")
+		}
+		capture(t, Config{Format: JSONFormat, Color: true})
+		if Colored() {
+			t.Error("expected the JSON format to not be colored")
+		}
+	})
+
+	t.Run("it does not color a stdout that is not a terminal", func(t *testing.T) {
+		t.Setenv("CARTESI_LOG_COLOR", "true")
+		// the tests write to a pipe
+		config, err := ConfigFromEnv()
+		if err != nil || config.Color {
+			t.Errorf("expected the piped stdout to not be colored, got %+v (%v)", config, err)
+		}
+	})
+
+	t.Run("it rejects an invalid flag", func(t *testing.T) {
+		t.Setenv("CARTESI_LOG_COLOR", "sometimes")
+		if _, err := ConfigFromEnv(); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
+
+func decode(t *testing.T, line string) map[string]any {
+	t.Helper()
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("invalid JSON entry %q: %v", line, err)
+	}
+	return entry
+}
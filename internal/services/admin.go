@@ -0,0 +1,355 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultAdminAddress is the address of the admin server by default. It only
+// accepts local connections
+const DefaultAdminAddress = "127.0.0.1:10010"
+
+// AdminStatusVersion is the version of the schema of [AdminStatus]. It only
+// changes when a field is removed or changes its meaning, so the clients can
+// rely on the fields of their version
+const AdminStatusVersion = 1
+
+// adminService serves the status of the services of a supervisor over HTTP
+type adminService struct {
+	httpServer
+	status func() []ServiceStatus
+
+	// restart restarts a service and rollingRestart restarts all of them, if
+	// the server belongs to a supervisor
+	restart        func(ctx context.Context, name string) (ServiceStatus, error)
+	rollingRestart func(ctx context.Context) ([]ServiceRestart, error)
+
+	// signal sends a signal to a service, if the server belongs to a
+	// supervisor
+	signal func(ctx context.Context, name string, sig os.Signal) error
+}
+
+// NewAdminService creates the service of the admin server, which listens on
+// the address and serves the statuses returned by the function:
+//
+//	GET /status returns the [AdminStatus] of all services
+//	GET /services returns the status of all services
+//	GET /services/{name} returns the status of a single service
+//
+// The admin server started by Run also serves POST /services/{name}/restart,
+// which restarts the service (see [Supervisor.RestartService]) and returns its
+// new status, or 409 when a restart is already in progress, and POST
+// /services/restart, which restarts all services one at a time (see
+// [Supervisor.RollingRestart]) and returns a [RollingRestartResponse]. It
+// also serves POST /services/{name}/signal?signal=QUIT, which sends the signal
+// to the service (see [Supervisor.SignalService]) if [ParseServiceSignal]
+// allows it, and returns its status. See [WithAdminServer] to have Run start
+// it
+func NewAdminService(address string, status func() []ServiceStatus) Service {
+	return newAdminService(address, status)
+}
+
+func newAdminService(address string, status func() []ServiceStatus) *adminService {
+	if address == "" {
+		address = DefaultAdminAddress
+	}
+	return &adminService{
+		httpServer: newHttpServer("admin", address, 0),
+		status:     status,
+	}
+}
+
+// Start serves the requests until the context is canceled
+func (s *adminService) Start(ctx context.Context) error {
+	return s.serve(ctx, s.handler())
+}
+
+func (s *adminService) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, newAdminStatus(s.status()))
+	})
+	mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+		writeJSON(w, http.StatusOK, newAdminStatus(s.status()).Services)
+	})
+	mux.HandleFunc("/services/restart", s.restartServices)
+	mux.HandleFunc("/services/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/services/")
+		if name, ok := strings.CutSuffix(name, "/restart"); ok {
+			s.restartService(w, r, name)
+			return
+		}
+		if name, ok := strings.CutSuffix(name, "/signal"); ok {
+			s.signalService(w, r, name)
+			return
+		}
+		if !allowGet(w, r) {
+			return
+		}
+		for _, status := range s.status() {
+			if status.Name == name {
+				writeJSON(w, http.StatusOK, newStatusResponse(status))
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Sprintf("service '%v' not found", name))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v not found", r.URL.Path))
+	})
+	return mux
+}
+
+// restartService restarts the service and writes its new status
+func (s *adminService) restartService(w http.ResponseWriter, r *http.Request, name string) {
+	if s.restart == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", r.Method))
+		return
+	}
+	status, err := s.restart(r.Context(), name)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, newStatusResponse(status))
+	case errors.Is(err, ErrServiceNotFound):
+		writeError(w, http.StatusNotFound, fmt.Sprintf("service '%v' not found", name))
+	case errors.Is(err, ErrRestartInProgress), errors.Is(err, errNotStarted):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrStopped):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// signalService sends the signal of the request to the service and writes
+// its status
+func (s *adminService) signalService(w http.ResponseWriter, r *http.Request, name string) {
+	if s.signal == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", r.Method))
+		return
+	}
+	sig, err := ParseServiceSignal(r.FormValue("signal"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.signal(r.Context(), name, sig); err != nil {
+		switch {
+		case errors.Is(err, ErrServiceNotFound):
+			writeError(w, http.StatusNotFound, fmt.Sprintf("service '%v' not found", name))
+		case errors.Is(err, errNotRunning), errors.Is(err, errNotSignaler):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, ErrStopped):
+			writeError(w, http.StatusServiceUnavailable, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	for _, status := range s.status() {
+		if status.Name == name {
+			writeJSON(w, http.StatusOK, newStatusResponse(status))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("service '%v' not found", name))
+}
+
+// restartServices restarts all services and writes the outcome
+func (s *adminService) restartServices(w http.ResponseWriter, r *http.Request) {
+	if s.rollingRestart == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%v not found", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", r.Method))
+		return
+	}
+	restarts, err := s.rollingRestart(r.Context())
+	response := RollingRestartResponse{Services: make([]ServiceRestartResponse, len(restarts))}
+	for i, restart := range restarts {
+		response.Services[i] = ServiceRestartResponse{
+			Name:     restart.Name,
+			Duration: restart.Duration.Round(time.Millisecond).String(),
+		}
+	}
+	code := http.StatusOK
+	if err != nil {
+		response.Error = err.Error()
+		switch {
+		case errors.Is(err, ErrRestartInProgress):
+			code = http.StatusConflict
+		case errors.Is(err, ErrStopped):
+			code = http.StatusServiceUnavailable
+		default:
+			code = http.StatusInternalServerError
+		}
+	}
+	writeJSON(w, code, response)
+}
+
+// RollingRestartResponse is the JSON representation of the outcome of a
+// rolling restart, which POST /services/restart returns. Services are the
+// services that were restarted, in order, and Error is why the rolling
+// restart stopped, if it failed
+type RollingRestartResponse struct {
+	Services []ServiceRestartResponse `json:"services"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// ServiceRestartResponse is the JSON representation of a ServiceRestart
+type ServiceRestartResponse struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"`
+}
+
+// AdminStatus is the JSON representation of the status of the services of a
+// node, which GET /status returns
+type AdminStatus struct {
+	// Version is the version of the schema, AdminStatusVersion
+	Version  int              `json:"version"`
+	Services []StatusResponse `json:"services"`
+}
+
+func newAdminStatus(statuses []ServiceStatus) AdminStatus {
+	body := AdminStatus{
+		Version:  AdminStatusVersion,
+		Services: make([]StatusResponse, len(statuses)),
+	}
+	for i, status := range statuses {
+		body.Services[i] = newStatusResponse(status)
+	}
+	return body
+}
+
+// StatusResponse is the JSON representation of a ServiceStatus
+type StatusResponse struct {
+	Name             string              `json:"name"`
+	State            ServiceState        `json:"state"`
+	Optional         bool                `json:"optional,omitempty"`
+	Fatal            bool                `json:"fatal,omitempty"`
+	Since            time.Time           `json:"since"`
+	PID              int                 `json:"pid,omitempty"`
+	RSS              int64               `json:"rss_bytes,omitempty"`
+	Usage            *UsageResponse      `json:"last_exit_usage,omitempty"`
+	Ports            map[string]int      `json:"ports,omitempty"`
+	Address          string              `json:"address,omitempty"`
+	Binary           string              `json:"binary,omitempty"`
+	Version          string              `json:"version,omitempty"`
+	Uptime           string              `json:"uptime,omitempty"`
+	Restarts         int                 `json:"restarts"`
+	Restart          string              `json:"restart"`
+	Restarting       bool                `json:"restarting,omitempty"`
+	Degraded         string              `json:"degraded,omitempty"`
+	LastError        string              `json:"last_error,omitempty"`
+	ExitReason       ExitReason          `json:"exit_reason,omitempty"`
+	StopError        string              `json:"stop_error,omitempty"`
+	LivenessFailures int                 `json:"liveness_failures,omitempty"`
+	Unresponsive     int                 `json:"unresponsive,omitempty"`
+	Triggered        bool                `json:"triggered_shutdown,omitempty"`
+	Dependency       *DependencyResponse `json:"dependency,omitempty"`
+	Members          []StatusResponse    `json:"members,omitempty"`
+}
+
+// DependencyResponse is the JSON representation of a DependencyStatus
+type DependencyResponse struct {
+	Reachable bool      `json:"reachable"`
+	Since     time.Time `json:"since"`
+	Checks    int64     `json:"checks"`
+	Failures  int64     `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// UsageResponse is the JSON representation of a ResourceUsage
+type UsageResponse struct {
+	UserTime   string `json:"user_time"`
+	SystemTime string `json:"system_time"`
+	MaxRSS     int64  `json:"max_rss_bytes,omitempty"`
+}
+
+func newStatusResponse(status ServiceStatus) StatusResponse {
+	response := StatusResponse{
+		Name:             status.Name,
+		State:            status.State,
+		Optional:         status.Optional,
+		Fatal:            status.Fatal,
+		Since:            status.Since,
+		PID:              status.PID,
+		RSS:              status.RSS,
+		Address:          status.Address,
+		Binary:           status.Binary,
+		Version:          status.Version,
+		Restarts:         status.Restarts,
+		Restart:          status.Restart.String(),
+		Restarting:       status.Restarting,
+		ExitReason:       status.ExitReason,
+		LivenessFailures: status.LivenessFailures,
+		Unresponsive:     status.Unresponsive,
+		Triggered:        status.TriggeredShutdown,
+	}
+	if !status.StartedAt.IsZero() && status.State != StatePending && !status.State.done() {
+		response.Uptime = time.Since(status.StartedAt).Round(time.Millisecond).String()
+	}
+	if status.LastError != nil {
+		response.LastError = status.LastError.Error()
+	}
+	if status.StopError != nil {
+		response.StopError = status.StopError.Error()
+	}
+	if status.Degraded > 0 {
+		response.Degraded = status.Degraded.Round(time.Millisecond).String()
+	}
+	if usage := status.Usage; usage != nil {
+		response.Usage = &UsageResponse{
+			UserTime:   usage.UserTime.String(),
+			SystemTime: usage.SystemTime.String(),
+			MaxRSS:     usage.MaxRSS,
+		}
+	}
+	if dependency := status.Dependency; dependency != nil {
+		response.Dependency = &DependencyResponse{
+			Reachable: dependency.Reachable,
+			Since:     dependency.Since,
+			Checks:    dependency.Checks,
+			Failures:  dependency.Failures,
+		}
+		if dependency.LastError != nil {
+			response.Dependency.LastError = dependency.LastError.Error()
+		}
+	}
+	for _, port := range status.Ports {
+		if response.Ports == nil {
+			response.Ports = make(map[string]int, len(status.Ports))
+		}
+		response.Ports[port.Name] = port.Number
+	}
+	for _, member := range status.Members {
+		response.Members = append(response.Members, newStatusResponse(member))
+	}
+	return response
+}
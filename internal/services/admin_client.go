@@ -0,0 +1,58 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// ErrNodeNotRunning is returned by [FetchAdminStatus] when no admin server
+// accepts connections at the address
+var ErrNodeNotRunning = errors.New("the node is not running")
+
+// FetchAdminStatus returns the status of the services of the node whose admin
+// server listens on the address (see [WithAdminServer]). It returns
+// [ErrNodeNotRunning] when the server cannot be reached, and an error when it
+// answers with a version of the schema other than AdminStatusVersion
+func FetchAdminStatus(ctx context.Context, address string) (AdminStatus, error) {
+	if address == "" {
+		address = DefaultAdminAddress
+	}
+	var status AdminStatus
+	url := fmt.Sprintf("http://%v/status", address)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return status, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return status, fmt.Errorf("%w: no admin server at %v", ErrNodeNotRunning, address)
+		}
+		return status, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		return status, fmt.Errorf("the admin server at %v answered %v: %v", address,
+			response.Status, body.Error)
+	}
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("invalid status from the admin server at %v: %w", address, err)
+	}
+	if status.Version != AdminStatusVersion {
+		return status, fmt.Errorf("unsupported version %v of the status from the admin server "+
+			"at %v, expected %v", status.Version, address, AdminStatusVersion)
+	}
+	return status, nil
+}
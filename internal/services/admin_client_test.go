@@ -0,0 +1,61 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchAdminStatus(t *testing.T) {
+	statuses := []ServiceStatus{{Name: "indexer", State: StateReady, Since: time.Now(), PID: 42}}
+	admin := NewAdminService("", func() []ServiceStatus { return statuses })
+	server := httptest.NewServer(admin.(*adminService).handler())
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	t.Run("it fetches the status of the services", func(t *testing.T) {
+		status, err := FetchAdminStatus(context.Background(), address)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(status.Services) != 1 || status.Services[0].PID != 42 {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("it reports that the node is not running", func(t *testing.T) {
+		_, err := FetchAdminStatus(context.Background(), freeAddress(t))
+		if !errors.Is(err, ErrNodeNotRunning) {
+			t.Fatalf("expected ErrNodeNotRunning, got %v", err)
+		}
+	})
+
+	t.Run("it rejects other versions of the schema", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, AdminStatus{Version: AdminStatusVersion + 1})
+		}))
+		defer other.Close()
+		_, err := FetchAdminStatus(context.Background(), strings.TrimPrefix(other.URL, "http://"))
+		if err == nil || !strings.Contains(err.Error(), "unsupported version 2") {
+			t.Fatalf("expected the version to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("it returns the errors of the server", func(t *testing.T) {
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusInternalServerError, "boom")
+		}))
+		defer other.Close()
+		_, err := FetchAdminStatus(context.Background(), strings.TrimPrefix(other.URL, "http://"))
+		if err == nil || !strings.Contains(err.Error(), "500 Internal Server Error: boom") {
+			t.Fatalf("expected the error of the server, got %v", err)
+		}
+	})
+}
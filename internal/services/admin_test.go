@@ -0,0 +1,256 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAdminService(t *testing.T) {
+	now := time.Now()
+	statuses := []ServiceStatus{
+		{
+			Name:      "indexer",
+			State:     StateReady,
+			Since:     now,
+			StartedAt: now.Add(-time.Minute),
+			PID:       42,
+			Restarts:  1,
+			LastError: errors.New("exit status 1"),
+		},
+		{Name: "graphql-server", State: StatePending, Since: now},
+	}
+	service := NewAdminService("", func() []ServiceStatus { return statuses })
+	handler := service.(*adminService).handler()
+
+	get := func(t *testing.T, method string, path string, body any) int {
+		t.Helper()
+		request := httptest.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("expected a JSON response, got %v", recorder.Header())
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+		return recorder.Code
+	}
+
+	t.Run("it listens on localhost by default", func(t *testing.T) {
+		if address := service.(*adminService).address(); address != DefaultAdminAddress {
+			t.Fatalf("expected the default address, got %v", address)
+		}
+	})
+
+	t.Run("it serves the status of all services", func(t *testing.T) {
+		var body []map[string]any
+		if code := get(t, http.MethodGet, "/services", &body); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %v", code)
+		}
+		if len(body) != 2 {
+			t.Fatalf("expected 2 services, got %v", body)
+		}
+		indexer := body[0]
+		expected := map[string]any{
+			"name":       "indexer",
+			"state":      "ready",
+			"pid":        42.0,
+			"restarts":   1.0,
+			"last_error": "exit status 1",
+		}
+		for key, value := range expected {
+			if indexer[key] != value {
+				t.Errorf("expected %v to be %v, got %v", key, value, indexer[key])
+			}
+		}
+		uptime, err := time.ParseDuration(fmt.Sprint(indexer["uptime"]))
+		if err != nil || uptime < time.Minute {
+			t.Errorf("expected an uptime of at least a minute, got %v", indexer["uptime"])
+		}
+		if _, ok := body[1]["uptime"]; ok {
+			t.Errorf("expected no uptime for a pending service, got %v", body[1])
+		}
+	})
+
+	t.Run("it serves the versioned status", func(t *testing.T) {
+		var body AdminStatus
+		if code := get(t, http.MethodGet, "/status", &body); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %v", code)
+		}
+		if body.Version != AdminStatusVersion || len(body.Services) != 2 {
+			t.Fatalf("unexpected status %+v", body)
+		}
+		if indexer := body.Services[0]; indexer.Name != "indexer" || indexer.PID != 42 {
+			t.Fatalf("unexpected status of the indexer %+v", indexer)
+		}
+	})
+
+	t.Run("it serves the status of a single service", func(t *testing.T) {
+		var body map[string]any
+		code := get(t, http.MethodGet, "/services/graphql-server", &body)
+		if code != http.StatusOK || body["name"] != "graphql-server" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it returns 404 for unknown services", func(t *testing.T) {
+		var body map[string]any
+		code := get(t, http.MethodGet, "/services/unknown", &body)
+		if code != http.StatusNotFound || body["error"] != "service 'unknown' not found" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it only accepts GET", func(t *testing.T) {
+		var body map[string]any
+		code := get(t, http.MethodPost, "/services", &body)
+		if code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected status 405, got %v", code)
+		}
+	})
+
+	t.Run("it does not restart the services without a supervisor", func(t *testing.T) {
+		var body map[string]any
+		code := get(t, http.MethodPost, "/services/indexer/restart", &body)
+		if code != http.StatusNotFound {
+			t.Fatalf("expected status 404, got %v", code)
+		}
+	})
+}
+
+func TestAdminRestart(t *testing.T) {
+	admin := newAdminService("", nil)
+	admin.restart = func(ctx context.Context, name string) (ServiceStatus, error) {
+		switch name {
+		case "indexer":
+			return ServiceStatus{Name: name, State: StateReady, Restarts: 1}, nil
+		case "graphql-server":
+			return ServiceStatus{}, fmt.Errorf("%w for service '%v'", ErrRestartInProgress, name)
+		default:
+			return ServiceStatus{}, fmt.Errorf("%w: '%v'", ErrServiceNotFound, name)
+		}
+	}
+	admin.rollingRestart = func(ctx context.Context) ([]ServiceRestart, error) {
+		restarts := []ServiceRestart{{Name: "database", Duration: 1500 * time.Millisecond}}
+		return restarts, errors.New("the rolling restart stopped at service 'indexer'")
+	}
+	handler := admin.handler()
+
+	post := func(t *testing.T, method string, name string) (int, map[string]any) {
+		t.Helper()
+		path := "/services/restart"
+		if name != "" {
+			path = "/services/" + name + "/restart"
+		}
+		request := httptest.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var body map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+		return recorder.Code, body
+	}
+
+	t.Run("it returns the new status of the service", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "indexer")
+		if code != http.StatusOK || body["state"] != "ready" || body["restarts"] != 1.0 {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it returns 409 while a restart is in progress", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "graphql-server")
+		expected := "a restart is already in progress for service 'graphql-server'"
+		if code != http.StatusConflict || body["error"] != expected {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it returns 404 for unknown services", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "unknown")
+		if code != http.StatusNotFound || body["error"] != "service 'unknown' not found" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it only accepts POST", func(t *testing.T) {
+		if code, _ := post(t, http.MethodGet, "indexer"); code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected status 405, got %v", code)
+		}
+	})
+
+	t.Run("it returns the outcome of a rolling restart", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "")
+		expected := map[string]any{
+			"services": []any{map[string]any{"name": "database", "duration": "1.5s"}},
+			"error":    "the rolling restart stopped at service 'indexer'",
+		}
+		if code != http.StatusInternalServerError || !reflect.DeepEqual(body, expected) {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+}
+
+func TestRunAdminServer(t *testing.T) {
+	setup()
+	address := freeAddress(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}
+
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, []Service{indexer}, WithAdminServer(address),
+			WithOnAllReady(func() {
+				defer cancel()
+				response, err := http.Get("http://" + address + "/services/indexer")
+				if err != nil {
+					t.Errorf("failed to get the status: %v", err)
+					return
+				}
+				defer response.Body.Close()
+				var body map[string]any
+				_ = json.NewDecoder(response.Body).Decode(&body)
+				if body["state"] != string(StateReady) {
+					t.Errorf("expected the indexer to be ready, got %v", body)
+				}
+			}))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return before the timeout")
+	}
+	if _, err := net.Dial("tcp", address); err == nil {
+		t.Fatal("expected the admin server to be stopped")
+	}
+}
+
+// freeAddress returns a local address with a port that is not in use
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
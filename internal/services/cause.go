@@ -0,0 +1,100 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ShutdownReason is what began the shutdown of the services
+type ShutdownReason string
+
+const (
+	// ReasonFailed means a critical service exited with an error
+	ReasonFailed ShutdownReason = "failed"
+
+	// ReasonExited means a critical service exited successfully, which also
+	// stops the node
+	ReasonExited ShutdownReason = "exited"
+
+	// ReasonNotReady means a service did not become ready in time
+	ReasonNotReady ShutdownReason = "not_ready"
+
+	// ReasonStartupTimeout means the services did not all become ready
+	// before the startup timeout (see [WithStartupTimeout])
+	ReasonStartupTimeout ShutdownReason = "startup_timeout"
+
+	// ReasonSignaled means the node received SIGINT or SIGTERM
+	ReasonSignaled ShutdownReason = "signaled"
+
+	// ReasonStopped means [Supervisor.Stop] was called
+	ReasonStopped ShutdownReason = "stopped"
+
+	// ReasonCanceled means the context given to Run was canceled
+	ReasonCanceled ShutdownReason = "canceled"
+)
+
+// ShutdownCause describes what began the shutdown. It is captured before any
+// service is stopped, so the services that exit because they were stopped are
+// never taken for the cause
+type ShutdownCause struct {
+	Reason ShutdownReason
+
+	// Service is the name of the service that began the shutdown, for the
+	// reasons about a service
+	Service string
+
+	// Err is the error of the service or of the context, if any
+	Err error
+
+	// Time is when the shutdown began
+	Time time.Time
+}
+
+// String describes the cause as in "indexer (exit status 1)"
+func (c ShutdownCause) String() string {
+	switch c.Reason {
+	case ReasonFailed:
+		var exitErr *ExitError
+		switch {
+		case errors.As(c.Err, &exitErr) && exitErr.Signal != nil:
+			return fmt.Sprintf("%v (signal %v)", c.Service, exitErr.Signal)
+		case errors.As(c.Err, &exitErr):
+			return fmt.Sprintf("%v (exit status %v)", c.Service, exitErr.ExitCode)
+		}
+		return fmt.Sprintf("%v (%v)", c.Service, c.Err)
+	case ReasonExited:
+		return fmt.Sprintf("%v (exited successfully)", c.Service)
+	case ReasonNotReady:
+		return fmt.Sprintf("%v (not ready: %v)", c.Service, c.Err)
+	case ReasonStartupTimeout:
+		return fmt.Sprintf("startup timeout (%v)", c.Err)
+	case ReasonSignaled:
+		return "termination signal"
+	case ReasonStopped:
+		return "stop request"
+	case ReasonCanceled:
+		return fmt.Sprintf("context (%v)", c.Err)
+	default:
+		return string(c.Reason)
+	}
+}
+
+// ShutdownError is returned by Run when services failed. Its message is the
+// one of the errors of the services, which it wraps, and it tells what began
+// the shutdown
+type ShutdownError struct {
+	Cause ShutdownCause
+	Err   error
+}
+
+func (e *ShutdownError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ShutdownError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,184 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestShutdownCause(t *testing.T) {
+
+	// lastLine returns the last line of the log
+	lastLine := func(out *lockedBuffer) string {
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		return lines[len(lines)-1]
+	}
+
+	t.Run("it blames the first service to exit", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Error = log.New(&out, "ERROR ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		logger.Info = log.New(&out, "INFO ", 0)
+		// the database fails when it is stopped, after the indexer exited
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return errors.New("connection closed")
+		}}
+		exit := make(chan struct{})
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-exit
+			return &ExitError{Service: "indexer", ExitCode: 1}
+		}}
+		supervisor := NewSupervisor([]Service{database, indexer})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cause := supervisor.ShutdownCause(); cause != nil {
+			t.Fatalf("expected no cause before the shutdown, got %+v", cause)
+		}
+		close(exit)
+		err := supervisor.Wait()
+
+		var shutdownErr *ShutdownError
+		if !errors.As(err, &shutdownErr) {
+			t.Fatalf("expected a shutdown error, got %v", err)
+		}
+		cause := shutdownErr.Cause
+		if cause.Reason != ReasonFailed || cause.Service != "indexer" || cause.Time.IsZero() {
+			t.Fatalf("expected the indexer to be the cause, got %+v", cause)
+		}
+		var exitErr *ExitError
+		if !errors.As(cause.Err, &exitErr) || !errors.As(err, &exitErr) {
+			t.Fatalf("expected the exit error of the indexer, got %v", cause.Err)
+		}
+		expected := "service 'database' exited with error: connection closed; service " +
+			"'indexer' exited with code 1 after running for 0s"
+		if err.Error() != expected {
+			t.Fatalf("expected the errors of the services, got %q", err.Error())
+		}
+		if last := lastLine(&out); last != "ERROR main: shutdown initiated by: indexer (exit "+
+			"status 1)" {
+			t.Fatalf("expected the cause to be logged last, got %q", out.String())
+		}
+		if cause := supervisor.ShutdownCause(); cause == nil || cause.Service != "indexer" {
+			t.Fatalf("expected the supervisor to report the indexer, got %+v", cause)
+		}
+		statuses := supervisor.Status()
+		if statuses[0].TriggeredShutdown || !statuses[1].TriggeredShutdown {
+			t.Fatalf("expected only the indexer to be flagged, got %+v", statuses)
+		}
+	})
+
+	t.Run("it tells a clean exit from a failure", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		quiet := testService{name: "quiet", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		done := testService{name: "done", start: func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}}
+		supervisor := NewSupervisor([]Service{quiet, done})
+		events := supervisor.Events()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cause := supervisor.ShutdownCause(); cause == nil || cause.Reason != ReasonExited {
+			t.Fatalf("expected the clean exit to be the cause, got %+v", cause)
+		}
+		if last := lastLine(&out); last != "WARN main: shutdown initiated by: done (exited "+
+			"successfully)" {
+			t.Fatalf("expected the cause to be logged, got %q", out.String())
+		}
+		for event := range events {
+			if event.Kind == EventShutdownStarted && event.Service != "done" {
+				t.Fatalf("expected the shutdown event to name the service, got %+v", event)
+			}
+		}
+	})
+
+	t.Run("it blames the node when it is asked to stop", func(t *testing.T) {
+		causes := map[ShutdownReason]func(supervisor *Supervisor, cancel context.CancelFunc){
+			ReasonStopped: func(supervisor *Supervisor, cancel context.CancelFunc) {
+				_ = supervisor.Stop(context.Background())
+			},
+			ReasonCanceled: func(supervisor *Supervisor, cancel context.CancelFunc) {
+				cancel()
+			},
+		}
+		messages := map[ShutdownReason]string{
+			ReasonStopped:  "INFO main: shutdown initiated by: stop request",
+			ReasonCanceled: "INFO main: shutdown initiated by: context (context canceled)",
+		}
+		for reason, stop := range causes {
+			setup()
+			var out lockedBuffer
+			logger.Info = log.New(&out, "INFO ", 0)
+			// the service fails once it is stopped, which does not make it the cause
+			service := testService{name: "indexer", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return errors.New("interrupted")
+			}}
+			ctx, cancel := context.WithCancel(context.Background())
+			supervisor := NewSupervisor([]Service{service})
+			if err := supervisor.Start(ctx); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			stop(supervisor, cancel)
+			err := supervisor.Wait()
+			cancel()
+			var shutdownErr *ShutdownError
+			if !errors.As(err, &shutdownErr) || shutdownErr.Cause.Reason != reason ||
+				shutdownErr.Cause.Service != "" {
+				t.Fatalf("expected the %v reason, got %v", reason, err)
+			}
+			if supervisor.Status()[0].TriggeredShutdown {
+				t.Fatalf("expected the service to not be flagged when %v", reason)
+			}
+			if last := lastLine(&out); last != messages[reason] {
+				t.Fatalf("expected %q to be logged last, got %q", messages[reason], out.String())
+			}
+		}
+	})
+
+	t.Run("it blames the services that do not become ready", func(t *testing.T) {
+		setup()
+		notReady := errors.New("still loading")
+		slow := readyTestService{
+			testService: testService{name: "slow", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			ready: func(ctx context.Context) error {
+				return notReady
+			},
+		}
+		err := Run(context.Background(), []Service{slow}, WithReadyTimeout(50*time.Millisecond))
+		var shutdownErr *ShutdownError
+		if !errors.As(err, &shutdownErr) {
+			t.Fatalf("expected a shutdown error, got %v", err)
+		}
+		cause := shutdownErr.Cause
+		if cause.Reason != ReasonNotReady || cause.Service != "slow" {
+			t.Fatalf("expected the slow service to be the cause, got %+v", cause)
+		}
+		if !errors.Is(cause.Err, ErrReadyTimeout) || !errors.Is(cause.Err, notReady) {
+			t.Fatalf("expected the readiness error, got %v", cause.Err)
+		}
+	})
+}
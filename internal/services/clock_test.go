@@ -0,0 +1,147 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+// clockStopper is a fake service with its own shutdown protocol, which
+// reports the time it was given to stop
+type clockStopper struct {
+	*servicestest.FakeService
+	budgets chan<- time.Duration
+}
+
+func (s clockStopper) Stop(ctx context.Context) error {
+	deadline, _ := ctx.Deadline()
+	s.budgets <- time.Until(deadline)
+	return nil
+}
+
+func TestWithClock(t *testing.T) {
+
+	// start starts the supervisor and makes the fake services ready
+	start := func(t *testing.T, supervisor *Supervisor, fakes ...*servicestest.FakeService) {
+		t.Helper()
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		for _, fake := range fakes {
+			fake.WaitForStarts(t, 1)
+			fake.BecomeReady()
+		}
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	t.Run("it times out the shutdown on the clock", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		quick := servicestest.NewFakeService("quick")
+		stuck := servicestest.NewFakeService("stuck")
+		stuck.IgnoreStop()
+		supervisor := NewSupervisor([]Service{quick, stuck}, WithClock(clock),
+			WithStopTimeout(time.Minute), WithStopStepTimeout(10*time.Second),
+			WithStopProgressInterval(0))
+		start(t, supervisor, quick, stuck)
+
+		stopped := make(chan error)
+		go func() {
+			stopped <- supervisor.Stop(context.Background())
+		}()
+		// the stuck service depends on the quick one, so it is stopped first
+		<-stuck.Canceled()
+		clock.WaitFor(t, 10*time.Second)
+		if !quick.Running() {
+			t.Fatal("expected the quick service to wait for the stuck one")
+		}
+		clock.Advance(10 * time.Second)
+		quick.WaitForExit(t)
+		clock.WaitFor(t, time.Minute)
+		clock.Advance(50*time.Second - time.Nanosecond)
+		select {
+		case err := <-stopped:
+			t.Fatalf("expected the shutdown to wait for the timeout, got %v", err)
+		default:
+		}
+		clock.Advance(time.Nanosecond)
+		err := <-stopped
+		if !errors.Is(err, ErrStopTimeout) || err.Error() != "service 'stuck' did not stop "+
+			"in time (1m0s)" {
+			t.Fatalf("expected the stuck service to time out, got %v", err)
+		}
+		stuck.ExitCleanly()
+		waitForLog(t, &out, "service 'stuck' exited after the shutdown timeout")
+	})
+
+	t.Run("it gives Stop what is left of the shutdown on the clock", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		budgets := make(chan time.Duration, 1)
+		writer := clockStopper{servicestest.NewFakeService("writer"), budgets}
+		reader := servicestest.NewFakeService("reader")
+		reader.IgnoreStop()
+		supervisor := NewSupervisor([]Service{writer, reader}, WithClock(clock),
+			WithStopTimeout(time.Minute), WithStopStepTimeout(time.Hour),
+			WithStopProgressInterval(0))
+		start(t, supervisor, writer.FakeService, reader)
+
+		stopped := make(chan error)
+		go func() {
+			stopped <- supervisor.Stop(context.Background())
+		}()
+		// the reader depends on the writer, so it is stopped first
+		<-reader.Canceled()
+		clock.WaitFor(t, time.Minute)
+		clock.Advance(40 * time.Second)
+		reader.ExitCleanly()
+		if budget := <-budgets; budget > 20*time.Second || budget < 10*time.Second {
+			t.Fatalf("expected Stop to have the 20s left of the shutdown, got %v", budget)
+		}
+		if err := <-stopped; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it waits for the backoff on the clock", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		flaky := servicestest.NewFakeService("flaky")
+		backoff := Backoff{Initial: time.Second, Max: 2 * time.Second, Reset: time.Hour}
+		supervisor := NewSupervisor([]Service{flaky}, WithClock(clock),
+			WithRestartOnFailure(backoff))
+		start(t, supervisor, flaky)
+
+		for i, delay := range []time.Duration{time.Second, 2 * time.Second, 2 * time.Second} {
+			flaky.Fail(errors.New("boom"))
+			flaky.WaitForExit(t)
+			clock.WaitFor(t, delay)
+			clock.Advance(delay - time.Nanosecond)
+			if status := supervisor.Status()[0]; !status.Restarting || flaky.Starts() != i+1 {
+				t.Fatalf("expected the restart to wait for %v, got %+v", delay, status)
+			}
+			clock.Advance(time.Nanosecond)
+			flaky.WaitForStarts(t, i+2)
+			flaky.BecomeReady()
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if starts := flaky.Starts(); starts != 4 {
+			t.Fatalf("expected 4 starts, got %v", starts)
+		}
+	})
+}
@@ -0,0 +1,351 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Defaults of the binaries of the node, which the probes use when the
+// configuration keeps them
+const (
+	DefaultHealthcheckPort      = 8080
+	DefaultServerManagerPort    = 5001
+	DefaultHostInspectPort      = 5002
+	DefaultRollupServerPort     = 5004
+	DefaultStateServerAddress   = "127.0.0.1:50051"
+	DefaultInspectServerAddress = "127.0.0.1:5005"
+	DefaultServerManagerAddress = "127.0.0.1:5001"
+	DefaultSessionID            = "default_rollups_id"
+)
+
+// ServerManagerConfig configures the server-manager, which runs the machine
+// of the application
+type ServerManagerConfig struct {
+	// Address is where the gRPC server listens. The default is
+	// DefaultServerManagerAddress
+	Address string
+
+	ProcessConfig
+}
+
+// NewServerManager creates the service that runs the server-manager, which
+// is ready once its gRPC health checking service reports SERVING
+func NewServerManager(config ServerManagerConfig) Service {
+	address := valueOr(config.Address, DefaultServerManagerAddress)
+	opts := []CommandOption{
+		WithArgs("--manager-address=" + address),
+		WithGracePeriod(5 * time.Second),
+		WithProbe(&GrpcHealthProbe{Address: probeHostPort(address)}),
+	}
+	if port := addressPort(address); port != 0 {
+		opts = append(opts, WithPort("grpc", port, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("server-manager", "server-manager", opts...)
+}
+
+// StateServerConfig configures the state-server, whose environment configures
+// the blockchain and the state-fold
+type StateServerConfig struct {
+	// Address is where the gRPC server listens. The default is
+	// DefaultStateServerAddress
+	Address string
+
+	ProcessConfig
+}
+
+// NewStateServer creates the service that runs the state-server, which is
+// ready once its gRPC health checking service reports SERVING
+func NewStateServer(config StateServerConfig) Service {
+	address := config.Address
+	if address == "" {
+		address = DefaultStateServerAddress
+	}
+	opts := []CommandOption{
+		WithArgs("--ss-server-address", address),
+		WithGracePeriod(5 * time.Second),
+		WithProbe(&GrpcHealthProbe{Address: probeHostPort(address)}),
+	}
+	if port := addressPort(address); port != 0 {
+		opts = append(opts, WithPort("grpc", port, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("state-server", "cartesi-rollups-state-server", opts...)
+}
+
+// DispatcherConfig configures the dispatcher, whose environment configures
+// the blockchain, the broker and the state-server. Zero values keep the
+// defaults of the binary
+type DispatcherConfig struct {
+	// HttpServerPort is the port of the endpoints /healthz and /metrics
+	HttpServerPort int
+
+	ProcessConfig
+}
+
+// NewDispatcher creates the service that runs the dispatcher, which is ready
+// once its /healthz endpoint answers
+func NewDispatcher(config DispatcherConfig) Service {
+	port := DefaultHealthcheckPort
+	var args []string
+	if config.HttpServerPort != 0 {
+		port = config.HttpServerPort
+		args = append(args, "--http-server-port", strconv.Itoa(config.HttpServerPort))
+	}
+	opts := []CommandOption{
+		WithArgs(args...),
+		WithProbe(healthzProbe(port)),
+	}
+	if config.HttpServerPort != 0 {
+		opts = append(opts, WithPort("http", config.HttpServerPort, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("dispatcher", "cartesi-rollups-dispatcher", opts...)
+}
+
+// AdvanceRunnerConfig configures the advance-runner, whose environment
+// configures the broker and the snapshots. Zero values keep the defaults of
+// the binary
+type AdvanceRunnerConfig struct {
+	// ServerManagerEndpoint is the URL of the gRPC endpoint of the
+	// server-manager, such as http://127.0.0.1:5001
+	ServerManagerEndpoint string
+
+	// SessionID is the session of the server-manager
+	SessionID string
+
+	// SnapshotDir is the directory of the snapshots of the machine, and
+	// SnapshotLatest is the symlink to the latest of them
+	SnapshotDir    string
+	SnapshotLatest string
+
+	// DisableSnapshots runs the advance-runner without snapshots, such as when
+	// the application runs on the host
+	DisableSnapshots bool
+
+	HealthcheckPort int
+
+	ProcessConfig
+}
+
+// NewAdvanceRunner creates the service that runs the advance-runner, which is
+// ready once its /healthz endpoint answers. It is given more time to stop, so
+// it can finish the input it is processing
+func NewAdvanceRunner(config AdvanceRunnerConfig) Service {
+	port := DefaultHealthcheckPort
+	snapshotDir, snapshotLatest := config.SnapshotDir, config.SnapshotLatest
+	if config.DisableSnapshots {
+		// the binary only reads whether the snapshots are enabled from the
+		// environment, and still requires their paths, which it ignores
+		config.Env = mergeEnv(config.Env, map[string]string{"SNAPSHOT_ENABLED": "false"})
+		snapshotDir = valueOr(snapshotDir, os.DevNull)
+		snapshotLatest = valueOr(snapshotLatest, os.DevNull)
+	}
+	var args []string
+	if config.ServerManagerEndpoint != "" {
+		args = append(args, "--server-manager-endpoint", config.ServerManagerEndpoint)
+	}
+	if config.SessionID != "" {
+		args = append(args, "--session-id", config.SessionID)
+	}
+	if snapshotDir != "" {
+		args = append(args, "--snapshot-dir", snapshotDir)
+	}
+	if snapshotLatest != "" {
+		args = append(args, "--snapshot-latest", snapshotLatest)
+	}
+	if config.HealthcheckPort != 0 {
+		port = config.HealthcheckPort
+		args = append(args, "--healthcheck-port", strconv.Itoa(config.HealthcheckPort))
+	}
+	opts := []CommandOption{
+		WithArgs(args...),
+		WithGracePeriod(DefaultServiceTimeout),
+		WithProbe(healthzProbe(port)),
+	}
+	if config.HealthcheckPort != 0 {
+		opts = append(opts, WithPort("healthcheck", config.HealthcheckPort, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("advance-runner", "cartesi-rollups-advance-runner", opts...)
+}
+
+// InspectServerConfig configures the inspect-server. The binary has no
+// defaults for the addresses and the session, so the zero values use the
+// defaults of this package
+type InspectServerConfig struct {
+	// Address is where the HTTP server listens. The default is
+	// DefaultInspectServerAddress
+	Address string
+
+	// ServerManagerAddress is the gRPC address of the server-manager. The
+	// default is DefaultServerManagerAddress
+	ServerManagerAddress string
+
+	// SessionID is the session of the server-manager. The default is
+	// DefaultSessionID
+	SessionID string
+
+	HealthcheckPort int
+
+	ProcessConfig
+}
+
+// NewInspectServer creates the service that runs the inspect-server, which is
+// ready once its HTTP server accepts connections
+func NewInspectServer(config InspectServerConfig) Service {
+	address := valueOr(config.Address, DefaultInspectServerAddress)
+	args := []string{
+		"--inspect-server-address", address,
+		"--server-manager-address",
+		valueOr(config.ServerManagerAddress, DefaultServerManagerAddress),
+		"--session-id", valueOr(config.SessionID, DefaultSessionID),
+	}
+	if config.HealthcheckPort != 0 {
+		args = append(args, "--healthcheck-port", strconv.Itoa(config.HealthcheckPort))
+	}
+	host, _, _ := net.SplitHostPort(address)
+	port := addressPort(address)
+	opts := []CommandOption{
+		WithArgs(args...),
+		WithGracePeriod(5 * time.Second),
+		WithProbe(TcpPortProbe{Host: probeHost(host), Port: port}),
+	}
+	if port != 0 {
+		opts = append(opts, WithPort("http", port, ""))
+	}
+	if config.HealthcheckPort != 0 {
+		opts = append(opts, WithPort("healthcheck", config.HealthcheckPort, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("inspect-server", "cartesi-rollups-inspect-server", opts...)
+}
+
+// HostRunnerConfig configures the host-runner, which replaces the
+// server-manager when the application runs on the host instead of inside a
+// machine. Zero values keep the defaults of the binary
+type HostRunnerConfig struct {
+	// ServerManagerPort is the port of the gRPC endpoint that replaces the
+	// server-manager. The default is DefaultServerManagerPort
+	ServerManagerPort int
+
+	// InspectPort is the port of the HTTP inspect endpoint. The default is
+	// DefaultHostInspectPort
+	InspectPort int
+
+	// RollupServerPort is the port of the HTTP endpoint that the application
+	// talks to. The default is DefaultRollupServerPort
+	RollupServerPort int
+
+	HealthcheckPort int
+
+	ProcessConfig
+}
+
+// NewHostRunner creates the service that runs the host-runner, which is ready
+// once its gRPC health checking service reports SERVING
+func NewHostRunner(config HostRunnerConfig) Service {
+	serverManagerPort := DefaultServerManagerPort
+	var args []string
+	var ports []CommandOption
+	for _, port := range []struct {
+		name   string
+		flag   string
+		number int
+	}{
+		{"server-manager", "--grpc-server-manager-port", config.ServerManagerPort},
+		{"inspect", "--http-inspect-port", config.InspectPort},
+		{"rollup-server", "--http-rollup-server-port", config.RollupServerPort},
+		{"healthcheck", "--healthcheck-port", config.HealthcheckPort},
+	} {
+		if port.number != 0 {
+			args = append(args, port.flag, strconv.Itoa(port.number))
+			ports = append(ports, WithPort(port.name, port.number, ""))
+		}
+	}
+	if config.ServerManagerPort != 0 {
+		serverManagerPort = config.ServerManagerPort
+	}
+	opts := []CommandOption{
+		WithArgs(args...),
+		WithGracePeriod(5 * time.Second),
+		WithProbe(&GrpcHealthProbe{Address: probeAddress("127.0.0.1", serverManagerPort)}),
+	}
+	opts = append(opts, ports...)
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("host-runner", "cartesi-rollups-host-runner", opts...)
+}
+
+// healthzProbe returns the probe of the /healthz endpoint of the binaries on
+// the port
+func healthzProbe(port int) HttpProbe {
+	return HttpProbe{URL: fmt.Sprintf("http://%v/healthz", probeAddress("127.0.0.1", port))}
+}
+
+// probeHost returns the host used to probe a server listening on the host.
+// Servers listening on all interfaces are probed on loopback
+func probeHost(host string) string {
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// probeHostPort returns the address used to probe a server listening on the
+// address, which is left as is when it is not a host and a port
+func probeHostPort(address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return net.JoinHostPort(probeHost(host), port)
+}
+
+// addressPort returns the port of the address, or zero when it has none
+func addressPort(address string) int {
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return 0
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// mergeEnv returns the variables of env with the ones of extra, which take
+// precedence, without changing env
+func mergeEnv(env map[string]string, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(env)+len(extra))
+	for key, value := range env {
+		merged[key] = value
+	}
+	for key, value := range extra {
+		merged[key] = value
+	}
+	return merged
+}
+
+// propagatedEnvOr returns the prefixes, or DefaultPropagatedEnv when they are
+// nil
+func propagatedEnvOr(prefixes []string) []string {
+	if prefixes == nil {
+		return DefaultPropagatedEnv
+	}
+	return prefixes
+}
+
+// valueOr returns the value, or the default when it is empty
+func valueOr(value string, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
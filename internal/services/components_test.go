@@ -0,0 +1,149 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestComponents(t *testing.T) {
+	env := map[string]string{"CHAIN_ID": "31337"}
+	cases := []struct {
+		service     Service
+		name        string
+		args        []string
+		probe       string
+		ports       []Port
+		stopTimeout time.Duration
+	}{{
+		service: NewServerManager(ServerManagerConfig{
+			Address:       "127.0.0.1:6001",
+			ProcessConfig: ProcessConfig{Env: env},
+		}),
+		name:        "server-manager",
+		args:        []string{"server-manager", "--manager-address=127.0.0.1:6001"},
+		probe:       `the gRPC health of service "" at 127.0.0.1:6001 (timeout 0s)`,
+		ports:       []Port{{Name: "grpc", Number: 6001}},
+		stopTimeout: 5 * time.Second,
+	}, {
+		service: NewStateServer(StateServerConfig{
+			Address:       "0.0.0.0:50051",
+			ProcessConfig: ProcessConfig{Env: env},
+		}),
+		name: "state-server",
+		args: []string{"cartesi-rollups-state-server",
+			"--ss-server-address", "0.0.0.0:50051"},
+		probe:       `the gRPC health of service "" at 127.0.0.1:50051 (timeout 0s)`,
+		ports:       []Port{{Name: "grpc", Number: 50051}},
+		stopTimeout: 5 * time.Second,
+	}, {
+		service: NewDispatcher(DispatcherConfig{
+			HttpServerPort: 8081,
+			ProcessConfig:  ProcessConfig{Env: env},
+		}),
+		name:  "dispatcher",
+		args:  []string{"cartesi-rollups-dispatcher", "--http-server-port", "8081"},
+		probe: "http://127.0.0.1:8081/healthz",
+		ports: []Port{{Name: "http", Number: 8081}},
+	}, {
+		service: NewAdvanceRunner(AdvanceRunnerConfig{
+			ServerManagerEndpoint: "http://server-manager:5001",
+			SessionID:             "rollup",
+			HealthcheckPort:       8082,
+			ProcessConfig:         ProcessConfig{Env: env},
+		}),
+		name: "advance-runner",
+		args: []string{"cartesi-rollups-advance-runner",
+			"--server-manager-endpoint", "http://server-manager:5001",
+			"--session-id", "rollup",
+			"--healthcheck-port", "8082"},
+		probe:       "http://127.0.0.1:8082/healthz",
+		ports:       []Port{{Name: "healthcheck", Number: 8082}},
+		stopTimeout: DefaultServiceTimeout,
+	}, {
+		service: NewInspectServer(InspectServerConfig{ProcessConfig: ProcessConfig{Env: env}}),
+		name:    "inspect-server",
+		args: []string{"cartesi-rollups-inspect-server",
+			"--inspect-server-address", DefaultInspectServerAddress,
+			"--server-manager-address", DefaultServerManagerAddress,
+			"--session-id", DefaultSessionID},
+		probe:       "127.0.0.1:5005",
+		ports:       []Port{{Name: "http", Number: 5005}},
+		stopTimeout: 5 * time.Second,
+	}, {
+		service: NewHostRunner(HostRunnerConfig{
+			ServerManagerPort: 6001,
+			HealthcheckPort:   8083,
+			ProcessConfig:     ProcessConfig{Env: env},
+		}),
+		name: "host-runner",
+		args: []string{"cartesi-rollups-host-runner",
+			"--grpc-server-manager-port", "6001",
+			"--healthcheck-port", "8083"},
+		probe: `the gRPC health of service "" at 127.0.0.1:6001 (timeout 0s)`,
+		ports: []Port{
+			{Name: "server-manager", Number: 6001},
+			{Name: "healthcheck", Number: 8083},
+		},
+		stopTimeout: 5 * time.Second,
+	}}
+	for _, c := range cases {
+		t.Run("it configures the "+c.name, func(t *testing.T) {
+			service := c.service.(*simpleService)
+			if name := service.String(); name != c.name {
+				t.Errorf("expected the name %v, got %v", c.name, name)
+			}
+			cmd := service.command()
+			if !reflect.DeepEqual(cmd.Args, c.args) {
+				t.Errorf("expected the args %v, got %v", c.args, cmd.Args)
+			}
+			if !slices.Contains(cmd.Env, "CHAIN_ID=31337") {
+				t.Errorf("expected the env to be passed, got %v", cmd.Env)
+			}
+			var probe string
+			switch p := service.probe.(type) {
+			case HttpProbe:
+				probe = p.URL
+			case TcpPortProbe:
+				probe = probeAddress(p.Host, p.Port)
+			case *GrpcHealthProbe:
+				probe = p.String()
+			}
+			if probe != c.probe {
+				t.Errorf("expected the probe %v, got %v", c.probe, probe)
+			}
+			if ports := service.Ports(); !reflect.DeepEqual(ports, c.ports) {
+				t.Errorf("expected the ports %v, got %v", c.ports, ports)
+			}
+			if service.stopTimeout != c.stopTimeout {
+				t.Errorf("expected the stop timeout %v, got %v", c.stopTimeout,
+					service.stopTimeout)
+			}
+			if err := service.probe.(Validator).Validate(); err != nil {
+				t.Errorf("expected the probe to be valid, got %v", err)
+			}
+		})
+	}
+
+	t.Run("it keeps the defaults of the binaries", func(t *testing.T) {
+		dispatcher := NewDispatcher(DispatcherConfig{}).(*simpleService)
+		if args := dispatcher.command().Args; len(args) != 1 {
+			t.Errorf("expected no arguments, got %v", args)
+		}
+		if ports := dispatcher.Ports(); len(ports) != 0 {
+			t.Errorf("expected no ports, got %v", ports)
+		}
+		if probe := dispatcher.probe.(HttpProbe); probe.URL != "http://127.0.0.1:8080/healthz" {
+			t.Errorf("unexpected probe URL %v", probe.URL)
+		}
+		hostRunner := NewHostRunner(HostRunnerConfig{}).(*simpleService)
+		probe := hostRunner.probe.(*GrpcHealthProbe)
+		if probe.Address != "127.0.0.1:5001" {
+			t.Errorf("unexpected probe address %v", probe.Address)
+		}
+	})
+}
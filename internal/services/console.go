@@ -0,0 +1,68 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// serviceColors are the ANSI colors of the names of the services, picked by
+// the index of the service, so each service keeps its color between runs.
+// Red is left out for the errors
+var serviceColors = []string{"36", "32", "33", "35", "34", "96", "92", "93", "95", "94"}
+
+// highlightColor is the ANSI style of the milestones of the supervisor
+const highlightColor = "1"
+
+// colorize wraps the text in the escape sequences of the color
+func colorize(text string, color string) string {
+	return "\x1b[" + color + "m" + text + "\x1b[0m"
+}
+
+// serviceColor returns the color of the service at index i
+func serviceColor(i int) string {
+	return serviceColors[i%len(serviceColors)]
+}
+
+// highlight makes the message of a milestone of the supervisor, such as the
+// beginning of the shutdown, stand out when the console is colored
+func highlight(msg string) string {
+	if !logger.Colored() {
+		return msg
+	}
+	return colorize(msg, highlightColor)
+}
+
+// colorOutput makes the writers that log the output of a process color the
+// name of the service started with ctx, when the console is colored
+func colorOutput(ctx context.Context, writers ...io.Writer) {
+	status, ok := ctx.Value(serviceStatusKey{}).(serviceStatus)
+	if !ok || !logger.Colored() {
+		return
+	}
+	for _, writer := range writers {
+		if w := lineWriterOf(writer); w != nil {
+			w.color = serviceColor(status.index)
+		}
+	}
+}
+
+// logLegend logs the names of the services in their colors, so their output
+// can be told apart, when the console is colored
+func (s *supervisor) logLegend() {
+	if s.config.group || !logger.Colored() {
+		return
+	}
+	names := make([]string, len(s.specs))
+	for i, spec := range s.specs {
+		names[i] = colorize(spec.String(), serviceColor(i))
+	}
+	logger.Log(logger.Info, fmt.Sprintf("main: services: %v", strings.Join(names, " ")),
+		"event", "legend")
+}
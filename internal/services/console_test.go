@@ -0,0 +1,122 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestConsoleColors(t *testing.T) {
+
+	// colored makes the console colored until the next setup
+	colored := func(t *testing.T) {
+		t.Helper()
+		if err := logger.Configure(logger.Config{Level: "warning", Color: true}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	t.Run("it gives each service index a stable color", func(t *testing.T) {
+		expected := []string{
+			"\x1b[36mindexer\x1b[0m | ",
+			"\x1b[32mindexer\x1b[0m | ",
+			"\x1b[33mindexer\x1b[0m | ",
+			"\x1b[35mindexer\x1b[0m | ",
+			"\x1b[34mindexer\x1b[0m | ",
+			"\x1b[96mindexer\x1b[0m | ",
+			"\x1b[92mindexer\x1b[0m | ",
+			"\x1b[93mindexer\x1b[0m | ",
+			"\x1b[95mindexer\x1b[0m | ",
+			"\x1b[94mindexer\x1b[0m | ",
+			"\x1b[36mindexer\x1b[0m | ",
+			"\x1b[32mindexer\x1b[0m | ",
+		}
+		for i, prefix := range expected {
+			w := newLineWriter(logger.Info, "indexer")
+			w.color = serviceColor(i)
+			if w.prefix() != prefix {
+				t.Errorf("expected the prefix %q for index %v, got %q", prefix, i, w.prefix())
+			}
+		}
+	})
+
+	t.Run("it colors the name of the service of the output", func(t *testing.T) {
+		setup()
+		colored(t)
+		defer setup()
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		ctx := withServiceStatus(context.Background(), serviceStatus{index: 2})
+		colorOutput(ctx, w)
+
+		fmt.Fprintln(w, "processing input 7")
+
+		if out.String() != "\x1b[33mindexer\x1b[0m | processing input 7\n" {
+			t.Fatalf("expected the colored prefix, got %q", out.String())
+		}
+	})
+
+	t.Run("it does not color the output when the console is not colored", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		ctx := withServiceStatus(context.Background(), serviceStatus{index: 2})
+		colorOutput(ctx, w)
+
+		fmt.Fprintln(w, "processing input 7")
+
+		if out.String() != "indexer | processing input 7\n" {
+			t.Fatalf("expected no escape sequences, got %q", out.String())
+		}
+		if msg := highlight("main: all services were shutdown"); strings.Contains(msg, "\x1b") {
+			t.Fatalf("expected the message to not be highlighted, got %q", msg)
+		}
+	})
+
+	t.Run("it prints a legend and highlights the milestones", func(t *testing.T) {
+		setup()
+		colored(t)
+		defer setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		service := func(name string) Service {
+			return testService{name: name, start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}}
+		}
+		supervisor := NewSupervisor([]Service{service("database"), service("indexer")})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		legend := "INFO main: services: \x1b[36mdatabase\x1b[0m \x1b[32mindexer\x1b[0m"
+		if lines[0] != legend {
+			t.Fatalf("expected the legend first, got %q", lines[0])
+		}
+		for _, milestone := range []string{
+			"INFO \x1b[1mmain: all services are ready in ",
+			"INFO \x1b[1mmain: shutdown initiated by: stop request\x1b[0m",
+			"INFO \x1b[1mmain: all services were shutdown\x1b[0m",
+		} {
+			if !strings.Contains(out.String(), milestone) {
+				t.Errorf("expected %q to be highlighted, got %q", milestone, out.String())
+			}
+		}
+		if strings.Count(out.String(), "main: services:") != 1 {
+			t.Fatalf("expected the legend to be printed once, got %q", out.String())
+		}
+	})
+}
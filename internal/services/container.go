@@ -0,0 +1,273 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// A ContainerEngine runs the containers of the container services. The
+// default one talks to a Docker engine (see [NewDockerEngine]), and tests or
+// other runtimes may provide their own
+type ContainerEngine interface {
+	// Create creates a container for the service and returns its id. It pulls
+	// the image if it is missing
+	Create(ctx context.Context, name string, config ContainerConfig) (string, error)
+
+	// Start starts the container
+	Start(ctx context.Context, id string) error
+
+	// Logs writes the output of the container until it exits
+	Logs(ctx context.Context, id string, stdout, stderr io.Writer) error
+
+	// Wait waits for the container to exit and returns its exit code
+	Wait(ctx context.Context, id string) (int, error)
+
+	// Stop sends the stop signal to the container and kills it if it does
+	// not exit before the timeout
+	Stop(ctx context.Context, id string, timeout time.Duration) error
+
+	// Remove removes the container
+	Remove(ctx context.Context, id string) error
+}
+
+// ContainerMount mounts a path of the host in the container
+type ContainerMount struct {
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+// ContainerPort publishes a port of the container on the host. The protocol
+// is tcp by default, and the port is bound on every interface of the host
+// unless HostIP is set
+type ContainerPort struct {
+	Container int
+	Host      int
+	HostIP    string
+	Protocol  string
+}
+
+// ContainerConfig configures a container service. Only the image is required
+type ContainerConfig struct {
+	Image string
+
+	// Cmd overrides the command of the image
+	Cmd []string
+
+	Env    map[string]string
+	Mounts []ContainerMount
+	Ports  []ContainerPort
+
+	// Network is the network the container joins, such as host or the name
+	// of a user-defined network. The engine picks it by default
+	Network string
+
+	// GracePeriod is how long the container may take to exit after the stop
+	// signal before it is killed. It defaults to DefaultStopTimeout
+	GracePeriod time.Duration
+
+	// Probe checks whether the container is ready, usually through one of its
+	// published ports. The container is ready as soon as it starts when there
+	// is no probe
+	Probe Readiness
+
+	// OutputLimit bounds the output of the container that is logged when it
+	// is set
+	OutputLimit *OutputLimit
+
+	// CaptureTimestamps is the precision of the time added to each line of
+	// output when it is read (see [WithCaptureTimestamps]). No time is added
+	// when it is zero
+	CaptureTimestamps time.Duration
+
+	// Engine runs the container. The default is a Docker engine at
+	// DOCKER_HOST (see [NewDockerEngine])
+	Engine ContainerEngine
+}
+
+// ContainerService runs a service in a container, so the supervisor owns its
+// lifecycle like the one of the command services. The container is created
+// when the service starts and removed when it exits, its output is logged
+// with the name of the service, and it is stopped with its grace period when
+// the context is canceled
+type ContainerService struct {
+	name   string
+	config ContainerConfig
+
+	engineOnce sync.Once
+	engine     ContainerEngine
+	engineErr  error
+
+	running atomic.Bool
+}
+
+// NewContainerService creates a service that runs a container of the image
+func NewContainerService(name string, config ContainerConfig) *ContainerService {
+	return &ContainerService{name: name, config: config}
+}
+
+// containerEngine returns the engine of the config or the default one
+func (s *ContainerService) containerEngine() (ContainerEngine, error) {
+	s.engineOnce.Do(func() {
+		if s.config.Engine != nil {
+			s.engine = s.config.Engine
+			return
+		}
+		s.engine, s.engineErr = NewDockerEngine("")
+	})
+	return s.engine, s.engineErr
+}
+
+func (s *ContainerService) Start(ctx context.Context) error {
+	// do not create the container when the node is already shutting down
+	if err := ctx.Err(); err != nil {
+		return nil
+	}
+	engine, err := s.containerEngine()
+	if err != nil {
+		return err
+	}
+	filter := logFilterFrom(ctx)
+	// the container must be stopped and removed after the context is done
+	background := context.WithoutCancel(ctx)
+	id, err := engine.Create(background, s.name, s.config)
+	if err != nil {
+		return fmt.Errorf("failed to create the container: %w", err)
+	}
+	defer func() {
+		if err := engine.Remove(background, id); err != nil {
+			msg := fmt.Sprintf("%v: failed to remove the container %v: %v", s.String(), id, err)
+			filter.log(logger.Warning, msg)
+		}
+	}()
+	filter.log(logger.Debug, fmt.Sprintf("%v: starting the container %v of %v", s.String(),
+		id, s.config.Image))
+	if err := engine.Start(background, id); err != nil {
+		return fmt.Errorf("failed to start the container: %w", err)
+	}
+	startedAt := time.Now()
+	s.running.Store(true)
+	defer s.running.Store(false)
+
+	stdout := newLineWriter(logger.Info, s.name)
+	stderr := newLineWriter(logger.Warning, s.name)
+	if s.config.OutputLimit != nil {
+		limitOutput(*s.config.OutputLimit, realClock{}, stdout, stderr)
+	}
+	if s.config.CaptureTimestamps > 0 {
+		captureTimestamps(s.config.CaptureTimestamps, realClock{}, stdout, stderr)
+	}
+	filterOutput(filter, stdout, stderr)
+	colorOutput(ctx, stdout, stderr)
+	logsCtx, stopLogs := context.WithCancel(background)
+	defer stopLogs()
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		if err := engine.Logs(logsCtx, id, stdout, stderr); err != nil && logsCtx.Err() == nil {
+			msg := fmt.Sprintf("%v: failed to read the output of the container: %v",
+				s.String(), err)
+			filter.log(logger.Warning, msg)
+		}
+	}()
+
+	// the goroutine that stops the container must never outlive it
+	exited := make(chan struct{})
+	stopperDone := make(chan struct{})
+	var stopped atomic.Bool
+	go func() {
+		defer close(stopperDone)
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
+		}
+		gracePeriod := s.config.GracePeriod
+		if gracePeriod == 0 {
+			gracePeriod = DefaultStopTimeout
+		}
+		stopped.Store(true)
+		filter.log(logger.Debug, fmt.Sprintf("%v: stopping the container %v", s.String(), id),
+			"service", s.String(), "event", "signaled")
+		if err := engine.Stop(background, id, gracePeriod); err != nil {
+			msg := fmt.Sprintf("%v: failed to stop the container %v: %v", s.String(), id, err)
+			filter.log(logger.Error, msg)
+		}
+	}()
+
+	code, err := engine.Wait(background, id)
+	close(exited)
+	<-stopperDone
+	select {
+	case <-logsDone:
+	case <-time.After(outputWaitDelay):
+		stopLogs()
+		<-logsDone
+	}
+	flushOutput(stdout, stderr)
+	if err != nil {
+		return fmt.Errorf("failed to wait for the container: %w", err)
+	}
+	if code == 0 || stopped.Load() {
+		return nil
+	}
+	return &ExitError{Service: s.name, ExitCode: code, Duration: time.Since(startedAt)}
+}
+
+// Ready only checks the probe once the container is running
+func (s *ContainerService) Ready(ctx context.Context) error {
+	if !s.running.Load() {
+		return errors.New("container is not running")
+	}
+	if s.config.Probe == nil {
+		return nil
+	}
+	return s.config.Probe.Ready(ctx)
+}
+
+// Validate checks that the config has an image and valid ports, that the
+// engine can be reached at the configured address, and that the probe is
+// well-formed
+func (s *ContainerService) Validate() error {
+	var problems []error
+	if s.config.Image == "" {
+		problems = append(problems, errors.New("missing image"))
+	}
+	for _, port := range s.config.Ports {
+		if port.Container <= 0 || port.Container > 65535 || port.Host < 0 || port.Host > 65535 {
+			problems = append(problems, fmt.Errorf("invalid port %v:%v", port.Host,
+				port.Container))
+		}
+	}
+	if _, err := s.containerEngine(); err != nil {
+		problems = append(problems, err)
+	}
+	if validator, ok := s.config.Probe.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid probe: %w", err))
+		}
+	}
+	return joinProblems(problems)
+}
+
+func (s *ContainerService) String() string {
+	return s.name
+}
+
+// Fingerprint describes the image and the settings of the container
+func (s *ContainerService) Fingerprint() string {
+	return fmt.Sprintf("%q %q %q %v %+v %+v %q %v %T %+v %+v %v %T", s.name, s.config.Image,
+		s.config.Cmd, s.config.Env, s.config.Mounts, s.config.Ports, s.config.Network,
+		s.config.GracePeriod, s.config.Probe, s.config.Probe, s.config.OutputLimit,
+		s.config.CaptureTimestamps, s.config.Engine)
+}
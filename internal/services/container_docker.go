@@ -0,0 +1,328 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultDockerHost is the address of the Docker engine when DOCKER_HOST is
+// not set
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// DockerEngine runs containers through the HTTP API of a Docker engine, so
+// the node does not depend on the Docker client libraries
+type DockerEngine struct {
+	client *http.Client
+	base   string
+}
+
+// NewDockerEngine creates an engine that talks to the Docker engine at the
+// host, which is either unix://path, tcp://host:port, or an HTTP URL. The
+// default is DOCKER_HOST, or DefaultDockerHost if it is not set
+func NewDockerEngine(host string) (*DockerEngine, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultDockerHost
+	}
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %v: %w", host, err)
+	}
+	switch parsed.Scheme {
+	case "unix":
+		path := parsed.Path
+		dialer := net.Dialer{}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "unix", path)
+			},
+		}
+		return &DockerEngine{client: &http.Client{Transport: transport}, base: "http://docker"},
+			nil
+	case "tcp":
+		return &DockerEngine{client: &http.Client{}, base: "http://" + parsed.Host}, nil
+	case "http", "https":
+		return &DockerEngine{client: &http.Client{}, base: strings.TrimSuffix(host, "/")}, nil
+	default:
+		return nil, fmt.Errorf("invalid docker host %v: the scheme must be unix, tcp, or http",
+			host)
+	}
+}
+
+// dockerError is an error response of the engine
+type dockerError struct {
+	status  int
+	message string
+}
+
+func (e *dockerError) Error() string {
+	return fmt.Sprintf("docker: %v (%v)", e.message, http.StatusText(e.status))
+}
+
+// do sends a request to the engine, encoding the body as JSON, and returns
+// the response if it succeeded
+func (e *DockerEngine) do(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	body any,
+) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	target := e.base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 399 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var message struct {
+		Message string `json:"message"`
+	}
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if json.Unmarshal(content, &message) != nil || message.Message == "" {
+		message.Message = strings.TrimSpace(string(content))
+	}
+	return nil, &dockerError{status: resp.StatusCode, message: message.Message}
+}
+
+// call sends a request and decodes the response into result, if it is set
+func (e *DockerEngine) call(
+	ctx context.Context,
+	method string,
+	path string,
+	query url.Values,
+	body any,
+	result any,
+) error {
+	resp, err := e.do(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// dockerCreateRequest is the body of the request that creates a container
+type dockerCreateRequest struct {
+	Image        string
+	Cmd          []string            `json:",omitempty"`
+	Env          []string            `json:",omitempty"`
+	ExposedPorts map[string]struct{} `json:",omitempty"`
+	HostConfig   dockerHostConfig
+}
+
+type dockerHostConfig struct {
+	Mounts       []dockerMount                  `json:",omitempty"`
+	NetworkMode  string                         `json:",omitempty"`
+	PortBindings map[string][]dockerPortBinding `json:",omitempty"`
+}
+
+type dockerMount struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+type dockerPortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string
+}
+
+// createRequest translates the config to the request of the engine
+func createRequest(config ContainerConfig) dockerCreateRequest {
+	request := dockerCreateRequest{
+		Image:      config.Image,
+		Cmd:        config.Cmd,
+		HostConfig: dockerHostConfig{NetworkMode: config.Network},
+	}
+	for key, value := range config.Env {
+		request.Env = append(request.Env, key+"="+value)
+	}
+	sort.Strings(request.Env)
+	for _, mount := range config.Mounts {
+		request.HostConfig.Mounts = append(request.HostConfig.Mounts, dockerMount{
+			Type:     "bind",
+			Source:   mount.Source,
+			Target:   mount.Target,
+			ReadOnly: mount.ReadOnly,
+		})
+	}
+	for _, port := range config.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		key := fmt.Sprintf("%v/%v", port.Container, protocol)
+		if request.ExposedPorts == nil {
+			request.ExposedPorts = map[string]struct{}{}
+			request.HostConfig.PortBindings = map[string][]dockerPortBinding{}
+		}
+		request.ExposedPorts[key] = struct{}{}
+		binding := dockerPortBinding{HostIP: port.HostIP}
+		if port.Host != 0 {
+			binding.HostPort = strconv.Itoa(port.Host)
+		}
+		request.HostConfig.PortBindings[key] = append(request.HostConfig.PortBindings[key],
+			binding)
+	}
+	return request
+}
+
+// Create creates the container, pulling its image first if the engine does
+// not have it
+func (e *DockerEngine) Create(
+	ctx context.Context,
+	name string,
+	config ContainerConfig,
+) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	request := createRequest(config)
+	err := e.call(ctx, http.MethodPost, "/containers/create", nil, request, &created)
+	var dockerErr *dockerError
+	if errors.As(err, &dockerErr) && dockerErr.status == http.StatusNotFound {
+		msg := fmt.Sprintf("%v: pulling %v", name, config.Image)
+		logFilterFrom(ctx).log(logger.Info, msg, "service", name, "event", "pulling",
+			"image", config.Image)
+		if err := e.pull(ctx, config.Image); err != nil {
+			return "", fmt.Errorf("failed to pull %v: %w", config.Image, err)
+		}
+		err = e.call(ctx, http.MethodPost, "/containers/create", nil, request, &created)
+	}
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// pull pulls the image, which fails in the progress stream of the response
+func (e *DockerEngine) pull(ctx context.Context, image string) error {
+	query := url.Values{"fromImage": {image}}
+	resp, err := e.do(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if progress.Error != "" {
+			return errors.New(progress.Error)
+		}
+	}
+}
+
+func (e *DockerEngine) Start(ctx context.Context, id string) error {
+	return e.call(ctx, http.MethodPost, "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// Logs follows the output of the container, which the engine multiplexes in
+// frames with a header naming the stream of each one
+func (e *DockerEngine) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	query := url.Values{"follow": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	resp, err := e.do(ctx, http.MethodGet, "/containers/"+id+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(resp.Body, header[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		out := stdout
+		if header[0] == 2 {
+			out = stderr
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, resp.Body, size); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *DockerEngine) Wait(ctx context.Context, id string) (int, error) {
+	var result struct {
+		StatusCode int
+		Error      *struct {
+			Message string
+		}
+	}
+	err := e.call(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, nil, &result)
+	if err != nil {
+		return 0, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return 0, errors.New(result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// Stop stops the container, giving it the timeout rounded up to seconds
+func (e *DockerEngine) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	seconds := int(math.Ceil(timeout.Seconds()))
+	query := url.Values{"t": {strconv.Itoa(seconds)}}
+	return e.call(ctx, http.MethodPost, "/containers/"+id+"/stop", query, nil, nil)
+}
+
+// Remove removes the container and its anonymous volumes
+func (e *DockerEngine) Remove(ctx context.Context, id string) error {
+	query := url.Values{"force": {"1"}, "v": {"1"}}
+	return e.call(ctx, http.MethodDelete, "/containers/"+id, query, nil, nil)
+}
@@ -0,0 +1,355 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestContainerService(t *testing.T) {
+
+	t.Run("it logs the output and reports the exit code", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		engine := newFakeEngine()
+		service := NewContainerService("web", ContainerConfig{Image: "nginx", Engine: engine})
+		if err := service.Ready(context.Background()); err == nil {
+			t.Fatal("expected the service to not be ready before the container starts")
+		}
+		exit := make(chan error)
+		go func() {
+			exit <- service.Start(context.Background())
+		}()
+		waitForLog(t, &out, "INFO web | hello\n")
+		waitForLog(t, &out, "WARN web | oops\n")
+		if err := service.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the service to be ready, got %v", err)
+		}
+		engine.exit <- 3
+		err := <-exit
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 || exitErr.Service != "web" {
+			t.Fatalf("expected the exit code 3, got %v", err)
+		}
+		if code := exitCode(err); code != 3 {
+			t.Fatalf("expected the status to have the exit code 3, got %v", code)
+		}
+		expected := []string{"create web nginx", "start c1", "wait c1", "remove c1"}
+		if calls := engine.recorded(); !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("expected the calls %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("it stops the container when the context is canceled", func(t *testing.T) {
+		setup()
+		engine := newFakeEngine()
+		service := NewContainerService("web", ContainerConfig{
+			Image:       "nginx",
+			GracePeriod: 100 * time.Millisecond,
+			Engine:      engine,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+		engine.waitForCall(t, "start c1")
+		cancel()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected the stopped container to exit without error, got %v", err)
+		}
+		expected := []string{"create web nginx", "start c1", "stop c1 100ms", "wait c1",
+			"remove c1"}
+		if calls := engine.recorded(); !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("expected the calls %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("it fails when the container cannot be created", func(t *testing.T) {
+		setup()
+		engine := newFakeEngine()
+		engine.createErr = errors.New("no space left on device")
+		service := NewContainerService("web", ContainerConfig{Image: "nginx", Engine: engine})
+		err := service.Start(context.Background())
+		if err == nil || err.Error() != "failed to create the container: no space left on device" {
+			t.Fatalf("expected the error of the engine, got %v", err)
+		}
+		if calls := engine.recorded(); !reflect.DeepEqual(calls, []string{"create web nginx"}) {
+			t.Fatalf("expected only the creation, got %v", calls)
+		}
+	})
+
+	t.Run("it validates its config", func(t *testing.T) {
+		t.Setenv("DOCKER_HOST", "ftp://127.0.0.1")
+		service := NewContainerService("web", ContainerConfig{
+			Ports: []ContainerPort{{Container: 0, Host: 8080}},
+			Probe: HttpProbe{URL: "127.0.0.1:8080"},
+		})
+		err := service.Validate()
+		for _, expected := range []string{"missing image", "invalid port 8080:0",
+			"invalid docker host ftp://127.0.0.1", "invalid probe"} {
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected the error %q, got %v", expected, err)
+			}
+		}
+	})
+}
+
+func TestDockerEngine(t *testing.T) {
+
+	// frame multiplexes the output like the engine
+	frame := func(stream byte, text string) []byte {
+		header := []byte{stream, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[4:], uint32(len(text)))
+		return append(header, text...)
+	}
+
+	t.Run("it runs a container through the API", func(t *testing.T) {
+		var mutex sync.Mutex
+		var requests []string
+		var created dockerCreateRequest
+		pulled := false
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				requests = append(requests, r.Method+" "+r.URL.RequestURI())
+				switch r.URL.Path {
+				case "/containers/create":
+					if !pulled {
+						w.WriteHeader(http.StatusNotFound)
+						fmt.Fprint(w, `{"message": "No such image: nginx"}`)
+						return
+					}
+					_ = json.NewDecoder(r.Body).Decode(&created)
+					w.WriteHeader(http.StatusCreated)
+					fmt.Fprint(w, `{"Id": "abc"}`)
+				case "/images/create":
+					pulled = true
+					fmt.Fprint(w, `{"status": "Pulling"}`+"\n"+`{"status": "Done"}`)
+				case "/containers/abc/logs":
+					_, _ = w.Write(append(frame(1, "hello\n"), frame(2, "oops\n")...))
+				case "/containers/abc/wait":
+					fmt.Fprint(w, `{"StatusCode": 3}`)
+				default:
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+		defer server.Close()
+		engine, err := NewDockerEngine(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx := context.Background()
+
+		id, err := engine.Create(ctx, "web", ContainerConfig{
+			Image:   "nginx",
+			Cmd:     []string{"nginx", "-g", "daemon off;"},
+			Env:     map[string]string{"B": "2", "A": "1"},
+			Mounts:  []ContainerMount{{Source: "/srv", Target: "/usr/share/nginx", ReadOnly: true}},
+			Ports:   []ContainerPort{{Container: 80, Host: 8080, HostIP: "127.0.0.1"}},
+			Network: "host",
+		})
+		if err != nil || id != "abc" {
+			t.Fatalf("expected the container abc, got %v and %v", id, err)
+		}
+		if err := engine.Start(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		var stdout, stderr bytes.Buffer
+		if err := engine.Logs(ctx, id, &stdout, &stderr); err != nil {
+			t.Fatal(err)
+		}
+		if stdout.String() != "hello\n" || stderr.String() != "oops\n" {
+			t.Fatalf("expected the output to be split, got %q and %q", stdout.String(),
+				stderr.String())
+		}
+		if code, err := engine.Wait(ctx, id); err != nil || code != 3 {
+			t.Fatalf("expected the exit code 3, got %v and %v", code, err)
+		}
+		if err := engine.Stop(ctx, id, 100*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Remove(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		expected := []string{
+			"POST /containers/create",
+			"POST /images/create?fromImage=nginx",
+			"POST /containers/create",
+			"POST /containers/abc/start",
+			"GET /containers/abc/logs?follow=1&stderr=1&stdout=1",
+			"POST /containers/abc/wait",
+			"POST /containers/abc/stop?t=1",
+			"DELETE /containers/abc?force=1&v=1",
+		}
+		if !reflect.DeepEqual(requests, expected) {
+			t.Fatalf("expected the requests %v, got %v", expected, requests)
+		}
+		request := dockerCreateRequest{
+			Image:        "nginx",
+			Cmd:          []string{"nginx", "-g", "daemon off;"},
+			Env:          []string{"A=1", "B=2"},
+			ExposedPorts: map[string]struct{}{"80/tcp": {}},
+			HostConfig: dockerHostConfig{
+				Mounts: []dockerMount{{Type: "bind", Source: "/srv",
+					Target: "/usr/share/nginx", ReadOnly: true}},
+				NetworkMode: "host",
+				PortBindings: map[string][]dockerPortBinding{
+					"80/tcp": {{HostIP: "127.0.0.1", HostPort: "8080"}},
+				},
+			},
+		}
+		if !reflect.DeepEqual(created, request) {
+			t.Fatalf("expected the container %+v, got %+v", request, created)
+		}
+	})
+
+	t.Run("it reports the errors of the engine", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/containers/create":
+					w.WriteHeader(http.StatusNotFound)
+					fmt.Fprint(w, `{"message": "No such image: private"}`)
+				case "/images/create":
+					fmt.Fprint(w, `{"error": "pull access denied for private"}`)
+				default:
+					w.WriteHeader(http.StatusConflict)
+					fmt.Fprint(w, `{"message": "container is not running"}`)
+				}
+			}))
+		defer server.Close()
+		engine, err := NewDockerEngine(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = engine.Create(context.Background(), "web", ContainerConfig{Image: "private"})
+		if err == nil || err.Error() != "failed to pull private: pull access denied for private" {
+			t.Fatalf("expected the pull to fail, got %v", err)
+		}
+		err = engine.Stop(context.Background(), "abc", time.Second)
+		if err == nil || err.Error() != "docker: container is not running (Conflict)" {
+			t.Fatalf("expected the message of the engine, got %v", err)
+		}
+	})
+
+	t.Run("it accepts the addresses of the engine", func(t *testing.T) {
+		cases := map[string]string{
+			"unix:///run/docker.sock": "http://docker",
+			"tcp://127.0.0.1:2375":    "http://127.0.0.1:2375",
+			"https://docker.local/":   "https://docker.local",
+		}
+		for host, base := range cases {
+			engine, err := NewDockerEngine(host)
+			if err != nil || engine.base != base {
+				t.Errorf("expected %v to be reached at %v, got %+v and %v", host, base, engine,
+					err)
+			}
+		}
+		if _, err := NewDockerEngine("npipe:////./pipe/docker_engine"); err == nil {
+			t.Error("expected an error for an unsupported address")
+		}
+	})
+}
+
+// fakeEngine records the calls of a container service and exits the
+// container with the codes sent to exit
+type fakeEngine struct {
+	mutex     sync.Mutex
+	calls     []string
+	createErr error
+	exit      chan int
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{exit: make(chan int, 1)}
+}
+
+func (e *fakeEngine) record(call string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.calls = append(e.calls, call)
+}
+
+func (e *fakeEngine) recorded() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]string(nil), e.calls...)
+}
+
+// waitForCall waits for the service to make the call
+func (e *fakeEngine) waitForCall(t *testing.T, call string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		for _, recorded := range e.recorded() {
+			if recorded == call {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the call %v, got %v", call, e.recorded())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (e *fakeEngine) Create(
+	ctx context.Context,
+	name string,
+	config ContainerConfig,
+) (string, error) {
+	e.record("create " + name + " " + config.Image)
+	return "c1", e.createErr
+}
+
+func (e *fakeEngine) Start(ctx context.Context, id string) error {
+	e.record("start " + id)
+	return nil
+}
+
+func (e *fakeEngine) Logs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	fmt.Fprintln(stdout, "hello")
+	fmt.Fprintln(stderr, "oops")
+	return nil
+}
+
+func (e *fakeEngine) Wait(ctx context.Context, id string) (int, error) {
+	code := <-e.exit
+	e.record("wait " + id)
+	return code, nil
+}
+
+func (e *fakeEngine) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	e.record(fmt.Sprintf("stop %v %v", id, timeout))
+	e.exit <- 143
+	return nil
+}
+
+func (e *fakeEngine) Remove(ctx context.Context, id string) error {
+	e.record("remove " + id)
+	return nil
+}
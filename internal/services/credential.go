@@ -0,0 +1,93 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+)
+
+// credential is the user and group a process runs as, given either by their
+// ids or by the name of the user
+type credential struct {
+	uid  uint32
+	gid  uint32
+	user string
+}
+
+// WithCredential runs the process as the user and group with the given ids,
+// so the node can run as root while its services do not. The node needs to
+// run as root to switch to another user. The pipes and the log files that
+// carry the output of the process are still created by the node, so they stay
+// readable by it. It is not supported on Windows
+func WithCredential(uid, gid uint32) CommandOption {
+	return func(s *simpleService) {
+		s.credential = &credential{uid: uid, gid: gid}
+	}
+}
+
+// WithUser runs the process as the user with the given name and its primary
+// group, like [WithCredential]. The user is looked up when the service is
+// validated and again whenever it starts
+func WithUser(name string) CommandOption {
+	return func(s *simpleService) {
+		s.credential = &credential{user: name}
+	}
+}
+
+// resolve returns the ids of the user and group, looking up the user if the
+// credential names one
+func (c credential) resolve() (uint32, uint32, error) {
+	if c.user == "" {
+		return c.uid, c.gid, nil
+	}
+	u, err := user.Lookup(c.user)
+	if err != nil {
+		return 0, 0, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("user %v has no numeric uid: %v", c.user, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("user %v has no numeric gid: %v", c.user, u.Gid)
+	}
+	return uint32(uid), uint32(gid), nil
+}
+
+func (c credential) String() string {
+	if c.user != "" {
+		return "user " + c.user
+	}
+	return fmt.Sprintf("uid %v and gid %v", c.uid, c.gid)
+}
+
+// setCredential makes the command run as the user of the service, if it has
+// one
+func (s *simpleService) setCredential(cmd *exec.Cmd) error {
+	if s.credential == nil {
+		return nil
+	}
+	uid, gid, err := s.credential.resolve()
+	if err != nil {
+		return fmt.Errorf("failed to resolve the %v: %w", s.credential, err)
+	}
+	return setCredential(cmd, uid, gid)
+}
+
+// checkCredential checks that the user of the service exists and that the
+// node may run processes as it
+func (s *simpleService) checkCredential() error {
+	if s.credential == nil {
+		return nil
+	}
+	uid, gid, err := s.credential.resolve()
+	if err != nil {
+		return fmt.Errorf("unknown %v: %w", s.credential, err)
+	}
+	return checkCredential(uid, gid)
+}
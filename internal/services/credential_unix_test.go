@@ -0,0 +1,112 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredential(t *testing.T) {
+
+	// command creates a command service with the options
+	command := func(opts ...CommandOption) *simpleService {
+		return NewCommandService("indexer", "cartesi-rollups-indexer", opts...).(*simpleService)
+	}
+
+	t.Run("it runs the process as the user in its process group", func(t *testing.T) {
+		s := command(WithCredential(1000, 1001))
+		cmd := s.command()
+		if err := s.setCredential(cmd); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		attr := cmd.SysProcAttr
+		if !attr.Setpgid {
+			t.Fatalf("expected the process to lead its process group")
+		}
+		if attr.Credential == nil || attr.Credential.Uid != 1000 || attr.Credential.Gid != 1001 {
+			t.Fatalf("expected the credential of uid 1000 and gid 1001, got %+v", attr.Credential)
+		}
+	})
+
+	t.Run("it runs the process as the user without a process group", func(t *testing.T) {
+		s := command(WithCredential(1000, 1000), WithoutProcessGroup())
+		cmd := s.command()
+		if err := s.setCredential(cmd); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cmd.SysProcAttr.Setpgid || cmd.SysProcAttr.Credential == nil {
+			t.Fatalf("expected only the credential, got %+v", cmd.SysProcAttr)
+		}
+	})
+
+	t.Run("it looks up the user by name", func(t *testing.T) {
+		s := command(WithUser("root"))
+		cmd := s.command()
+		if err := s.setCredential(cmd); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if credential := cmd.SysProcAttr.Credential; credential.Uid != 0 || credential.Gid != 0 {
+			t.Fatalf("expected the ids of root, got %+v", credential)
+		}
+	})
+
+	t.Run("it fails the validation of an unknown user", func(t *testing.T) {
+		s := command(WithUser("cartesi-missing-user"))
+		err := s.checkCredential()
+		if err == nil || !strings.Contains(err.Error(), "unknown user cartesi-missing-user") {
+			t.Fatalf("expected the unknown user to fail the validation, got %v", err)
+		}
+	})
+
+	t.Run("it fails the validation without the permission to switch users", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root may run processes as any user")
+		}
+		uid, gid := uint32(os.Geteuid()), uint32(os.Getegid())
+		if err := command(WithCredential(uid, gid)).checkCredential(); err != nil {
+			t.Fatalf("expected the user of the node to be allowed, got %v", err)
+		}
+		err := command(WithCredential(uid+1, uid+1)).checkCredential()
+		if err == nil || !strings.Contains(err.Error(), "must run as root") {
+			t.Fatalf("expected the validation to fail, got %v", err)
+		}
+	})
+
+	t.Run("it runs the process as the user", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("the test needs to run as root")
+		}
+		setup()
+		check := `test "$(id -u):$(id -g):$(id -G)" = 65534:65534:65534`
+		service := NewCommandService("nobody", "/bin/sh", WithArgs("-c", check),
+			WithCredential(65534, 65534))
+		if err := Run(context.Background(), []Service{OneShot(service)}); err != nil {
+			t.Fatalf("expected the process to run as the user, got %v", err)
+		}
+	})
+
+	t.Run("it stops the process of the user", func(t *testing.T) {
+		if os.Geteuid() != 0 {
+			t.Skip("the test needs to run as root")
+		}
+		setup()
+		service := NewCommandService("nobody", "/bin/sh", WithArgs("-c", "sleep 30"),
+			WithCredential(65534, 65534), WithGracePeriod(time.Second))
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		startedAt := time.Now()
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected the process to stop, got %v", err)
+		}
+		if elapsed := time.Since(startedAt); elapsed > time.Second {
+			t.Fatalf("expected the process to stop on the stop signal, took %v", elapsed)
+		}
+	})
+}
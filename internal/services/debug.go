@@ -0,0 +1,93 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// DefaultDebugAddress is the address of the debug server by default. It only
+// accepts local connections
+const DefaultDebugAddress = "127.0.0.1:6060"
+
+// debugDrainTimeout is how long the debug server waits for the pending
+// requests when it stops. It is short because profiles and traces can take as
+// long as the client asks for, and they must not hold up the shutdown
+const debugDrainTimeout = time.Second
+
+// DebugConfig is the configuration of the debug server
+type DebugConfig struct {
+	// Address is where the server listens. The default is DefaultDebugAddress
+	Address string
+
+	// AllowRemote allows the server to listen on an address that is not a
+	// loopback one, which exposes the profiles of the node to the network
+	AllowRemote bool
+}
+
+// debugService serves the profiles and the variables of the node
+type debugService struct {
+	httpServer
+	allowRemote bool
+}
+
+// NewDebugService creates a service that serves the profiles of the node with
+// net/http/pprof at /debug/pprof/ and its variables with expvar at
+// /debug/vars. It refuses to listen on addresses that accept remote
+// connections unless they are allowed by the configuration
+func NewDebugService(config DebugConfig) Service {
+	address := config.Address
+	if address == "" {
+		address = DefaultDebugAddress
+	}
+	return &debugService{
+		httpServer:  newHttpServer("debug", address, debugDrainTimeout),
+		allowRemote: config.AllowRemote,
+	}
+}
+
+// Fingerprint describes the configuration of the server
+func (s *debugService) Fingerprint() string {
+	return fmt.Sprintf("%v %v", s.httpServer.Fingerprint(), s.allowRemote)
+}
+
+// Start serves the requests until the context is canceled
+func (s *debugService) Start(ctx context.Context) error {
+	if !s.allowRemote && !isLoopback(s.address()) {
+		return fmt.Errorf("refusing to serve the debug server on %v, which is not a "+
+			"loopback address", s.address())
+	}
+	return s.serve(ctx, debugHandler())
+}
+
+func debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// isLoopback reports whether the address only accepts local connections. An
+// address without a host listens on all interfaces
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
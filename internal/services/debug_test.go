@@ -0,0 +1,120 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugService(t *testing.T) {
+
+	t.Run("it listens on localhost by default", func(t *testing.T) {
+		service := NewDebugService(DebugConfig{})
+		if address := service.(*debugService).address(); address != DefaultDebugAddress {
+			t.Fatalf("expected the default address, got %v", address)
+		}
+	})
+
+	t.Run("it serves the profiles and the variables", func(t *testing.T) {
+		handler := debugHandler()
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+		body := recorder.Body.String()
+		if recorder.Code != http.StatusOK || !strings.Contains(body, "goroutine") {
+			t.Fatalf("expected the index of the profiles, got %v %q", recorder.Code, body)
+		}
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+		var vars map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &vars); err != nil {
+			t.Fatalf("invalid variables %q: %v", recorder.Body.String(), err)
+		}
+		if _, ok := vars["memstats"]; !ok {
+			t.Fatalf("expected the memory stats, got %v", vars)
+		}
+	})
+
+	t.Run("it only accepts loopback addresses", func(t *testing.T) {
+		for address, expected := range map[string]bool{
+			"127.0.0.1:6060": true,
+			"[::1]:6060":     true,
+			"localhost:6060": true,
+			":6060":          false,
+			"0.0.0.0:6060":   false,
+			"10.0.0.1:6060":  false,
+			"6060":           false,
+		} {
+			if isLoopback(address) != expected {
+				t.Errorf("expected isLoopback(%q) to be %v", address, expected)
+			}
+		}
+	})
+
+	t.Run("it refuses to serve on remote addresses", func(t *testing.T) {
+		setup()
+		service := NewDebugService(DebugConfig{Address: "0.0.0.0:0"})
+		err := service.Start(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "not a loopback address") {
+			t.Fatalf("expected the address to be refused, got %v", err)
+		}
+	})
+
+	t.Run("it serves on remote addresses when allowed", func(t *testing.T) {
+		setup()
+		service := NewDebugService(DebugConfig{Address: "0.0.0.0:0", AllowRemote: true})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() { done <- service.Start(ctx) }()
+		deadline := time.Now().Add(time.Second)
+		for service.(*debugService).Ready(ctx) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the debug server to listen")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it stops before the timeout of the supervisor", func(t *testing.T) {
+		setup()
+		address := freeAddress(t)
+		stopTimeout := 10 * time.Second
+		supervisor := NewSupervisor([]Service{NewDebugService(DebugConfig{Address: address})},
+			WithStopTimeout(stopTimeout))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// a CPU profile keeps its request pending for as long as it runs
+		profiling := make(chan struct{})
+		go func() {
+			defer close(profiling)
+			response, err := http.Get("http://" + address + "/debug/pprof/profile?seconds=30")
+			if err == nil {
+				response.Body.Close()
+			}
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		start := time.Now()
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= stopTimeout/2 {
+			t.Fatalf("expected the debug server to stop after draining, took %v", elapsed)
+		}
+		<-profiling
+	})
+}
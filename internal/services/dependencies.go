@@ -0,0 +1,99 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDependencyCycle is returned when services depend on each other
+var ErrDependencyCycle = errors.New("dependency cycle")
+
+// resolveDependencies returns the indexes of the dependencies of each service.
+// When no service declares dependencies, each service depends on the previous
+// one, so they are started in the order they were given
+func resolveDependencies(specs []ServiceSpec) ([][]int, error) {
+	deps := make([][]int, len(specs))
+	declared := false
+	for _, spec := range specs {
+		declared = declared || len(spec.DependsOn) > 0
+	}
+	if !declared {
+		for i := 1; i < len(specs); i++ {
+			deps[i] = []int{i - 1}
+		}
+		return deps, nil
+	}
+
+	indexes := make(map[string]int, len(specs))
+	for i, spec := range specs {
+		name := spec.String()
+		if _, ok := indexes[name]; ok {
+			return nil, &DuplicateNameError{Name: name}
+		}
+		indexes[name] = i
+	}
+	for i, spec := range specs {
+		for _, name := range spec.DependsOn {
+			dep, ok := indexes[name]
+			if !ok {
+				msg := "service '%v' depends on unknown service '%v'"
+				return nil, fmt.Errorf(msg, spec.String(), name)
+			}
+			deps[i] = append(deps[i], dep)
+		}
+	}
+	if cycle := findCycle(deps); cycle != nil {
+		names := make([]string, len(cycle))
+		for i, index := range cycle {
+			names[i] = specs[index].String()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrDependencyCycle, strings.Join(names, " -> "))
+	}
+	return deps, nil
+}
+
+// findCycle returns the indexes of the services in a dependency cycle, with
+// the first one repeated at the end, or nil if there are no cycles
+func findCycle(deps [][]int) []int {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(deps))
+	var path []int
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+		for _, dep := range deps[i] {
+			switch state[dep] {
+			case visiting:
+				for start, index := range path {
+					if index == dep {
+						return append(append([]int(nil), path[start:]...), dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range deps {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveDependencies(t *testing.T) {
+	service := func(name string, deps ...string) ServiceSpec {
+		return specOf(DependsOn(testService{name: name}, deps...))
+	}
+
+	t.Run("it starts the services in order by default", func(t *testing.T) {
+		specs := []ServiceSpec{
+			specOf(testService{name: "a"}),
+			specOf(testService{name: "b"}),
+			specOf(testService{name: "c"}),
+		}
+		deps, err := resolveDependencies(specs)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := [][]int{nil, {0}, {1}}
+		if !reflect.DeepEqual(deps, expected) {
+			t.Fatalf("expected %v, got %v", expected, deps)
+		}
+	})
+
+	t.Run("it resolves the declared dependencies", func(t *testing.T) {
+		specs := []ServiceSpec{
+			service("dispatcher", "state-server"),
+			service("state-server"),
+			service("inspect-server", "state-server", "dispatcher"),
+		}
+		deps, err := resolveDependencies(specs)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := [][]int{{1}, nil, {1, 0}}
+		if !reflect.DeepEqual(deps, expected) {
+			t.Fatalf("expected %v, got %v", expected, deps)
+		}
+	})
+
+	t.Run("it rejects unknown dependencies", func(t *testing.T) {
+		_, err := resolveDependencies([]ServiceSpec{service("a", "b")})
+		if err == nil || !strings.Contains(err.Error(), "unknown service 'b'") {
+			t.Fatalf("expected an unknown service error, got %v", err)
+		}
+	})
+
+	t.Run("it rejects cycles", func(t *testing.T) {
+		specs := []ServiceSpec{
+			service("a"),
+			service("b", "c"),
+			service("c", "d"),
+			service("d", "b"),
+		}
+		_, err := resolveDependencies(specs)
+		cycle := "b -> c -> d -> b"
+		if !errors.Is(err, ErrDependencyCycle) || !strings.Contains(err.Error(), cycle) {
+			t.Fatalf("expected a dependency cycle error, got %v", err)
+		}
+	})
+}
+
+func TestRunDependencies(t *testing.T) {
+
+	t.Run("it starts independent services concurrently", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		var events []string
+		record := func(event string) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, event)
+		}
+		var branches sync.WaitGroup
+		branches.Add(2)
+		branch := func(name string) Service {
+			return DependsOn(testService{
+				name: name,
+				start: func(ctx context.Context) error {
+					record("start " + name)
+					// both branches must be running at the same time
+					branches.Done()
+					branches.Wait()
+					cancel()
+					<-ctx.Done()
+					record("stop " + name)
+					return nil
+				},
+			}, "state-server")
+		}
+		stateServer := testService{
+			name: "state-server",
+			start: func(ctx context.Context) error {
+				record("start state-server")
+				<-ctx.Done()
+				record("stop state-server")
+				return nil
+			},
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- Run(ctx, []Service{branch("dispatcher"), branch("inspect"), stateServer})
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("the branches were not started concurrently")
+		}
+		if events[0] != "start state-server" || events[len(events)-1] != "stop state-server" {
+			t.Fatalf("expected the state server to start first and stop last, got %v", events)
+		}
+	})
+
+	t.Run("it does not start anything when there is a cycle", func(t *testing.T) {
+		setup()
+		started := false
+		service := func(name string, dep string) Service {
+			return DependsOn(testService{
+				name: name,
+				start: func(ctx context.Context) error {
+					started = true
+					return nil
+				},
+			}, dep)
+		}
+		err := Run(context.Background(), []Service{service("a", "b"), service("b", "a")})
+		if !errors.Is(err, ErrDependencyCycle) {
+			t.Fatalf("expected a dependency cycle error, got %v", err)
+		}
+		if started {
+			t.Fatal("expected no service to be started")
+		}
+	})
+}
@@ -0,0 +1,206 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultEventBuffer is how many events the channel returned by
+// [Supervisor.Events] holds before the oldest ones are dropped
+const DefaultEventBuffer = 256
+
+// EventKind is what happened in a [ServiceEvent]
+type EventKind string
+
+const (
+	// EventStarted is sent when a service is started
+	EventStarted EventKind = "started"
+
+	// EventReady is sent when a service becomes ready
+	EventReady EventKind = "ready"
+
+	// EventStopping is sent when a service is asked to stop
+	EventStopping EventKind = "stopping"
+
+	// EventExited is sent when a service exits, successfully or not
+	EventExited EventKind = "exited"
+
+	// EventRestartScheduled is sent when a service that failed will be
+	// restarted after a delay
+	EventRestartScheduled EventKind = "restart_scheduled"
+
+	// EventRestarted is sent when a service that failed is restarted
+	EventRestarted EventKind = "restarted"
+
+	// EventRestartRequested is sent when a service is asked to restart
+	// through [Supervisor.RestartService], before it is stopped
+	EventRestartRequested EventKind = "restart_requested"
+
+	// EventSignalSent is sent when the supervisor sends a signal to a
+	// service, to stop it or to forward a signal of the node, with the signal
+	EventSignalSent EventKind = "signal_sent"
+
+	// EventLivenessFailed is sent when a service fails a liveness check,
+	// with its error (see [Liveness])
+	EventLivenessFailed EventKind = "liveness_failed"
+
+	// EventUnresponsive is sent when a service is stopped because it failed
+	// too many liveness checks in a row
+	EventUnresponsive EventKind = "unresponsive"
+
+	// EventReloadStarted is sent when the supervisor begins to reload its
+	// services. It has no service
+	EventReloadStarted EventKind = "reload_started"
+
+	// EventAdded is sent when a reload adds a service, before it is started
+	EventAdded EventKind = "added"
+
+	// EventReplaced is sent when a reload changes the definition of a
+	// service, before it is stopped to be started again
+	EventReplaced EventKind = "replaced"
+
+	// EventRemoved is sent when a service left out of a reload has stopped
+	EventRemoved EventKind = "removed"
+
+	// EventReloadCompleted is sent when a reload finishes, with its error if
+	// it failed. It has no service
+	EventReloadCompleted EventKind = "reload_completed"
+
+	// EventRollingRestartStarted is sent when the supervisor begins to
+	// restart all services (see [Supervisor.RollingRestart]). It has no
+	// service
+	EventRollingRestartStarted EventKind = "rolling_restart_started"
+
+	// EventRollingRestartCompleted is sent when a rolling restart finishes,
+	// with its error if it failed. It has no service
+	EventRollingRestartCompleted EventKind = "rolling_restart_completed"
+
+	// EventShutdownStarted is sent when the supervisor begins to stop the
+	// services. Its service and error are the ones of the service that began
+	// the shutdown, if a service did (see [ShutdownCause])
+	EventShutdownStarted EventKind = "shutdown_started"
+
+	// EventShutdownCompleted is sent when the supervisor finishes, with the
+	// error it returns. It has no service and is the last event
+	EventShutdownCompleted EventKind = "shutdown_completed"
+)
+
+// ServiceEvent describes a transition of a service supervised by a
+// [Supervisor], or of the supervisor itself when Service is empty
+type ServiceEvent struct {
+	// Service is the name of the service
+	Service string
+
+	Kind EventKind
+
+	// From and To are the states of the service before and after the event.
+	// They are the same for events that do not change the state
+	From ServiceState
+	To   ServiceState
+
+	// Time is when the event happened
+	Time time.Time
+
+	// Err is the error of the service, or of the supervisor for
+	// [EventShutdownCompleted], if any
+	Err error
+
+	// Signal is the signal of [EventSignalSent]
+	Signal os.Signal
+
+	// ExitReason classifies the exit of [EventExited]
+	ExitReason ExitReason
+}
+
+// eventKinds are the kinds of the events sent when a service enters each
+// state
+var eventKinds = map[ServiceState]EventKind{
+	StateStarting: EventStarted,
+	StateReady:    EventReady,
+	StateRunning:  EventRestarted,
+	StateStopping: EventStopping,
+	StateExited:   EventExited,
+	StateFailed:   EventExited,
+}
+
+// eventStream is a buffered channel of events that never blocks the
+// publishers. When the buffer is full, the oldest event is dropped to make
+// room for the new one. The events are also recorded in the journal, if there
+// is one. Its methods do nothing when it is nil
+type eventStream struct {
+	mutex   sync.Mutex
+	events  chan ServiceEvent
+	journal *journal
+	dropped uint64
+	closed  bool
+}
+
+func newEventStream(size int) *eventStream {
+	return &eventStream{events: make(chan ServiceEvent, size)}
+}
+
+func (s *eventStream) publish(event ServiceEvent) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	s.journal.record(event)
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-s.events:
+			s.dropped++
+		default:
+		}
+	}
+}
+
+// record makes the stream record the events it publishes from now on in the
+// journal
+func (s *eventStream) record(journal *journal) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.journal = journal
+}
+
+// close closes the channel, so the consumers know no more events will be
+// sent, and then the journal
+func (s *eventStream) close() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	journal := s.journal
+	if !s.closed {
+		s.closed = true
+		close(s.events)
+	}
+	s.journal = nil
+	s.mutex.Unlock()
+	journal.close()
+}
+
+// droppedEvents returns how many events were dropped
+func (s *eventStream) droppedEvents() uint64 {
+	if s == nil {
+		return 0
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,116 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+
+	t.Run("it sends the transitions of a crash and a shutdown", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		crash := make(chan struct{})
+		var attempts atomic.Int32
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			if attempts.Add(1) == 1 {
+				<-crash
+				return boom
+			}
+			<-ctx.Done()
+			return nil
+		}}
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{database, indexer}, WithRestartOnFailure(backoff))
+		events := supervisor.Events()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		close(crash)
+		waitForStates(t, supervisor, StateReady, StateRunning)
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		type transition struct {
+			service  string
+			kind     EventKind
+			from, to ServiceState
+			err      error
+		}
+		var got []transition
+		for event := range events {
+			if event.Time.IsZero() {
+				t.Errorf("expected the event to have a time, got %+v", event)
+			}
+			got = append(got,
+				transition{event.Service, event.Kind, event.From, event.To, event.Err})
+		}
+		expected := []transition{
+			{"database", EventStarted, StatePending, StateStarting, nil},
+			{"database", EventReady, StateStarting, StateReady, nil},
+			{"indexer", EventStarted, StatePending, StateStarting, nil},
+			{"indexer", EventReady, StateStarting, StateReady, nil},
+			{"indexer", EventExited, StateReady, StateFailed, boom},
+			{"indexer", EventRestartScheduled, StateFailed, StateFailed, boom},
+			{"indexer", EventRestarted, StateFailed, StateRunning, nil},
+			{"", EventShutdownStarted, "", "", nil},
+			{"indexer", EventStopping, StateRunning, StateStopping, nil},
+			{"indexer", EventExited, StateStopping, StateExited, nil},
+			{"database", EventStopping, StateReady, StateStopping, nil},
+			{"database", EventExited, StateStopping, StateExited, nil},
+			{"", EventShutdownCompleted, "", "", nil},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected\n%v\ngot\n%v", expected, got)
+		}
+		if dropped := supervisor.DroppedEvents(); dropped != 0 {
+			t.Fatalf("expected no dropped events, got %v", dropped)
+		}
+	})
+
+	t.Run("it drops the oldest events when the consumer falls behind", func(t *testing.T) {
+		stream := newEventStream(2)
+		for _, name := range []string{"first", "second", "third"} {
+			stream.publish(ServiceEvent{Service: name})
+		}
+		stream.close()
+		stream.publish(ServiceEvent{Service: "closed"})
+
+		var names []string
+		for event := range stream.events {
+			names = append(names, event.Service)
+		}
+		if !reflect.DeepEqual(names, []string{"second", "third"}) {
+			t.Fatalf("expected the newest events, got %v", names)
+		}
+		if dropped := stream.droppedEvents(); dropped != 1 {
+			t.Fatalf("expected 1 dropped event, got %v", dropped)
+		}
+	})
+
+	t.Run("it closes the channel when stopped before starting", func(t *testing.T) {
+		supervisor := NewSupervisor([]Service{testService{name: "first"}})
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		event, ok := <-supervisor.Events()
+		if !ok || event.Kind != EventShutdownCompleted {
+			t.Fatalf("expected the shutdown to be completed, got %+v", event)
+		}
+		if _, ok := <-supervisor.Events(); ok {
+			t.Fatal("expected the channel to be closed")
+		}
+	})
+}
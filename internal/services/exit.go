@@ -0,0 +1,142 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ExitError is returned by command services whose process exited with an
+// error. It wraps the [exec.ExitError] of the process
+type ExitError struct {
+	// Service is the name of the service
+	Service string
+
+	// ExitCode is the exit code of the process, or -1 if it was terminated by
+	// a signal
+	ExitCode int
+
+	// Signal is the signal that terminated the process, if any
+	Signal os.Signal
+
+	// Duration is how long the process ran
+	Duration time.Duration
+
+	// Err is the error returned when waiting for the process
+	Err error
+}
+
+func (e *ExitError) Error() string {
+	duration := e.Duration.Round(time.Millisecond)
+	if e.Signal != nil {
+		return fmt.Sprintf("service '%v' was terminated by signal %v after running for %v",
+			e.Service, e.Signal, duration)
+	}
+	return fmt.Sprintf("service '%v' exited with code %v after running for %v", e.Service,
+		e.ExitCode, duration)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// newExitError describes the exit of the process of the service if err comes
+// from the process exiting, and returns err unchanged otherwise
+func newExitError(
+	service string,
+	state *os.ProcessState,
+	duration time.Duration,
+	err error,
+) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	return &ExitError{
+		Service:  service,
+		ExitCode: state.ExitCode(),
+		Signal:   terminatingSignal(state),
+		Duration: duration,
+		Err:      err,
+	}
+}
+
+// serviceError returns the error of the service that exited, which names the
+// service unless the error already does
+func serviceError(name string, err error) error {
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && exitErr.Service == name {
+		return err
+	}
+	return fmt.Errorf("service '%v' exited with error: %w", name, err)
+}
+
+// Exit codes of the node, which tell the tools that restart it what failed
+// (see [NodeExitCode])
+const (
+	// ExitFailure is the exit code of any other error, such as an invalid
+	// configuration of the node
+	ExitFailure = 1
+
+	// ExitNotStarted is the exit code of a node that did not start any
+	// service, because they are invalid (see [ErrInvalidServices] and
+	// [ErrNoServices]) or another node is running (see [ErrInstanceLocked])
+	ExitNotStarted = 2
+
+	// ExitStopTimeout is the exit code of a node that abandoned services that
+	// did not stop in time (see [ErrStopTimeout]), which may still be running
+	ExitStopTimeout = 3
+
+	// ExitForced is the exit code of a node that received a second signal
+	// during its shutdown and exited without waiting for its services
+	ExitForced = 4
+
+	// ExitStartupTimeout is the exit code of a node whose services did not
+	// all become ready before the startup timeout (see [ErrStartupTimeout])
+	ExitStartupTimeout = 5
+
+	// ExitServiceFailed is the exit code of a node shut down by the failure
+	// of a critical service that is not one of the services of the node. The
+	// failure of a service of the node adds one plus its position in
+	// nodeServices, from 11 for postgres to 19 for graphql-server
+	ExitServiceFailed = 10
+)
+
+// NodeExitCode returns the exit code of a node whose supervisor returned err.
+// It is zero for a clean shutdown. A shutdown that timed out takes precedence
+// over the failure of the service that began it, since the processes of the
+// abandoned services may still be running
+func NodeExitCode(err error) int {
+	var shutdownErr *ShutdownError
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, ErrStopTimeout):
+		return ExitStopTimeout
+	case errors.Is(err, ErrStartupTimeout):
+		return ExitStartupTimeout
+	case errors.As(err, &shutdownErr) && (shutdownErr.Cause.Reason == ReasonFailed ||
+		shutdownErr.Cause.Reason == ReasonNotReady):
+		return serviceExitCode(shutdownErr.Cause.Service)
+	case errors.Is(err, ErrInvalidServices) || errors.Is(err, ErrNoServices) ||
+		errors.Is(err, ErrInstanceLocked):
+		return ExitNotStarted
+	default:
+		return ExitFailure
+	}
+}
+
+// serviceExitCode returns the exit code of the failure of the service
+func serviceExitCode(name string) int {
+	for i, service := range nodeServices {
+		if service == name {
+			return ExitServiceFailed + 1 + i
+		}
+	}
+	return ExitServiceFailed
+}
@@ -0,0 +1,52 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import "errors"
+
+// ExitReason classifies why a service exited
+type ExitReason string
+
+const (
+	// ExitReasonCanceled services exited after the supervisor asked them to
+	// stop, for the shutdown, a restart, or a reload
+	ExitReasonCanceled ExitReason = "canceled"
+
+	// ExitReasonCompleted services finished their work and exited
+	// successfully on their own
+	ExitReasonCompleted ExitReason = "completed"
+
+	// ExitReasonFailed services exited with an error on their own
+	ExitReasonFailed ExitReason = "failed"
+
+	// ExitReasonKilled services were killed, either with SIGKILL once they
+	// did not stop in time or by a signal the supervisor did not send, such
+	// as the one of the OOM killer or of a crash
+	ExitReasonKilled ExitReason = "killed"
+)
+
+// classifyExit returns the reason of an exit with err. Canceled tells whether
+// the supervisor asked the service to stop before it exited, and killed
+// whether it sent SIGKILL to it. The processes that exit on their stop signal
+// exit without an error, so any terminating signal in err was not sent by the
+// supervisor and makes the exit killed.
+//
+// The service is asked to stop when its context is canceled, which happens
+// before its stop signal is sent. A service that exits with an error in
+// between, even if it crashed before receiving the signal, is classified as
+// canceled, since the supervisor cannot tell the crash from a service that
+// fails to stop cleanly. Its error is still kept in its status
+func classifyExit(canceled bool, killed bool, err error) ExitReason {
+	var exitErr *ExitError
+	switch {
+	case killed, errors.As(err, &exitErr) && exitErr.Signal != nil:
+		return ExitReasonKilled
+	case canceled:
+		return ExitReasonCanceled
+	case err == nil:
+		return ExitReasonCompleted
+	default:
+		return ExitReasonFailed
+	}
+}
@@ -0,0 +1,131 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestClassifyExit(t *testing.T) {
+	boom := errors.New("boom")
+	crashed := &ExitError{Service: "indexer", ExitCode: -1, Signal: syscall.SIGSEGV}
+	for _, test := range []struct {
+		name     string
+		canceled bool
+		killed   bool
+		err      error
+		expected ExitReason
+	}{
+		{"it completes without an error", false, false, nil, ExitReasonCompleted},
+		{"it fails with an error", false, false, boom, ExitReasonFailed},
+		{"it is canceled without an error", true, false, nil, ExitReasonCanceled},
+		{"it is canceled when it fails after the cancel", true, false, boom, ExitReasonCanceled},
+		{"it is killed on the escalation", true, true, nil, ExitReasonKilled},
+		{"it is killed by a signal", false, false, crashed, ExitReasonKilled},
+		{"it is killed by a signal after the cancel", true, false, crashed, ExitReasonKilled},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			reason := classifyExit(test.canceled, test.killed, test.err)
+			if reason != test.expected {
+				t.Fatalf("expected %v, got %v", test.expected, reason)
+			}
+		})
+	}
+}
+
+func TestExitReason(t *testing.T) {
+
+	// reasons returns the exit reason of each service
+	reasons := func(supervisor *Supervisor) map[string]ExitReason {
+		reasons := make(map[string]ExitReason)
+		for _, status := range supervisor.Status() {
+			reasons[status.Name] = status.ExitReason
+		}
+		return reasons
+	}
+
+	t.Run("it classifies the exits of the services", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		boom := errors.New("boom")
+		failed := make(chan struct{})
+		migrate := OneShot(testService{name: "migrate", start: func(ctx context.Context) error {
+			return nil
+		}})
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-failed
+			return boom
+		}}
+		supervisor := NewSupervisor([]Service{migrate, database, indexer})
+		events := supervisor.Events()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		close(failed)
+		if err := supervisor.Wait(); !errors.Is(err, boom) {
+			t.Fatalf("expected the indexer to fail, got %v", err)
+		}
+
+		expected := map[string]ExitReason{
+			"migrate":  ExitReasonCompleted,
+			"database": ExitReasonCanceled,
+			"indexer":  ExitReasonFailed,
+		}
+		got := reasons(supervisor)
+		for name, reason := range expected {
+			if got[name] != reason {
+				t.Errorf("expected %v to be %v, got %v", name, reason, got[name])
+			}
+		}
+		exits := make(map[string]ExitReason)
+		for event := range events {
+			if event.Kind == EventExited {
+				exits[event.Service] = event.ExitReason
+			}
+		}
+		for name, reason := range expected {
+			if exits[name] != reason {
+				t.Errorf("expected the exit event of %v to be %v, got %v", name, reason,
+					exits[name])
+			}
+		}
+		summary := "main: exits of the services: migrate completed, database canceled, " +
+			"indexer failed"
+		if !strings.Contains(out.String(), summary) {
+			t.Fatalf("expected the summary of the exits, got %q", out.String())
+		}
+	})
+
+	t.Run("it classifies a failure after the cancel as canceled", func(t *testing.T) {
+		setup()
+		boom := errors.New("crashed before the stop signal")
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return boom
+		}}
+		supervisor := NewSupervisor([]Service{indexer})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); !errors.Is(err, boom) {
+			t.Fatalf("expected the error of the indexer, got %v", err)
+		}
+		status := supervisor.Status()[0]
+		if status.ExitReason != ExitReasonCanceled || !errors.Is(status.LastError, boom) {
+			t.Fatalf("expected a canceled exit that keeps its error, got %+v", status)
+		}
+	})
+}
@@ -0,0 +1,197 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExitError(t *testing.T) {
+
+	t.Run("it describes processes that exit with a code", func(t *testing.T) {
+		setup()
+		service := &simpleService{serviceName: "crasher", binaryName: writeScript(t, "exit 2")}
+		err := service.Start(context.Background())
+
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("expected an ExitError, got %v", err)
+		}
+		if exitErr.Service != "crasher" || exitErr.ExitCode != 2 || exitErr.Signal != nil ||
+			exitErr.Duration <= 0 {
+			t.Fatalf("unexpected exit %+v", exitErr)
+		}
+		prefix := "service 'crasher' exited with code 2 after running for "
+		if !strings.HasPrefix(err.Error(), prefix) {
+			t.Fatalf("expected %q to start with %q", err.Error(), prefix)
+		}
+		var cmdErr *exec.ExitError
+		if !errors.As(err, &cmdErr) {
+			t.Fatalf("expected the error of the process to be wrapped, got %v", err)
+		}
+	})
+
+	t.Run("it describes processes terminated by a signal", func(t *testing.T) {
+		setup()
+		service := &simpleService{
+			serviceName: "crasher",
+			binaryName:  writeScript(t, "kill -KILL $$"),
+		}
+		err := service.Start(context.Background())
+
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("expected an ExitError, got %v", err)
+		}
+		if exitErr.Signal != syscall.SIGKILL || exitErr.ExitCode != -1 {
+			t.Fatalf("unexpected exit %+v", exitErr)
+		}
+		if !strings.Contains(err.Error(), "was terminated by signal killed") {
+			t.Fatalf("expected the signal to be described, got %v", err)
+		}
+	})
+
+	t.Run("it does not fail on clean exits", func(t *testing.T) {
+		setup()
+		service := &simpleService{serviceName: "done", binaryName: writeScript(t, "exit 0")}
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it does not take exit code 15 for the stop signal", func(t *testing.T) {
+		setup()
+		service := &simpleService{
+			serviceName: "stubborn",
+			binaryName:  writeScript(t, "trap 'exit 15' TERM; while true; do sleep 0.1; done"),
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+		deadline := time.Now().Add(time.Second)
+		for service.PID() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		// give the shell time to install the trap
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+
+		var exitErr *ExitError
+		if err := <-exit; !errors.As(err, &exitErr) || exitErr.ExitCode != 15 {
+			t.Fatalf("expected exit code 15, got %v", err)
+		}
+	})
+
+	t.Run("it names the service once in the error of Run", func(t *testing.T) {
+		setup()
+		failing := &simpleService{serviceName: "failing", binaryName: writeScript(t, "exit 3")}
+		err := Run(context.Background(), []Service{failing})
+
+		prefix := "service 'failing' exited with code 3"
+		if err == nil || !strings.HasPrefix(err.Error(), prefix) {
+			t.Fatalf("expected %v to start with %q", err, prefix)
+		}
+	})
+
+	t.Run("it names the service in other errors", func(t *testing.T) {
+		boom := errors.New("boom")
+		err := serviceError("indexer", boom)
+		if !errors.Is(err, boom) || err.Error() != "service 'indexer' exited with error: boom" {
+			t.Fatalf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestNodeExitCode(t *testing.T) {
+
+	// running creates a service that runs until it is stopped
+	running := func(name string) Service {
+		return testService{name: name, start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+	}
+
+	// failing creates a service that fails once it is started
+	failing := func(name string) Service {
+		return testService{name: name, start: func(ctx context.Context) error {
+			return &ExitError{Service: name, ExitCode: 2}
+		}}
+	}
+
+	t.Run("it maps the shutdowns of the node to exit codes", func(t *testing.T) {
+		setup()
+		stubborn := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for _, test := range []struct {
+			name     string
+			services []Service
+			opts     []RunOption
+			expected int
+		}{
+			{"migrate", []Service{running("indexer"), failing("migrate")}, nil, ExitServiceFailed},
+			{"postgres", []Service{failing("postgres")}, nil, 11},
+			{"indexer", []Service{running("postgres"), failing("indexer")}, nil, 18},
+			{"graphql-server", []Service{failing("graphql-server")}, nil, 19},
+			{"invalid", []Service{running("indexer"), nil}, nil, ExitNotStarted},
+			{"stop timeout", []Service{stubborn, failing("dispatcher")},
+				[]RunOption{WithStopTimeout(10 * time.Millisecond)}, ExitStopTimeout},
+		} {
+			err := Run(context.Background(), test.services, test.opts...)
+			if code := NodeExitCode(err); code != test.expected {
+				t.Errorf("%v: expected the exit code %v, got %v (%v)", test.name, test.expected,
+					code, err)
+			}
+		}
+		if code := NodeExitCode(Run(ctx, []Service{running("indexer")})); code != 0 {
+			t.Errorf("expected a clean shutdown to exit successfully, got %v", code)
+		}
+	})
+
+	t.Run("it tells the failures of the services by their positions", func(t *testing.T) {
+		seen := make(map[int]string)
+		for _, name := range nodeServices {
+			code := serviceExitCode(name)
+			if code <= ExitServiceFailed || code > ExitServiceFailed+len(nodeServices) {
+				t.Errorf("expected the exit code of %v in the range, got %v", name, code)
+			}
+			if other, ok := seen[code]; ok {
+				t.Errorf("expected %v and %v to have different exit codes", name, other)
+			}
+			seen[code] = name
+		}
+		if code := serviceExitCode("exporter"); code != ExitServiceFailed {
+			t.Errorf("expected the other services to share an exit code, got %v", code)
+		}
+	})
+
+	t.Run("it maps the other errors to a failure", func(t *testing.T) {
+		locked := fmt.Errorf("%w: node.lock is held by the process 7", ErrInstanceLocked)
+		for err, expected := range map[error]int{
+			nil:                              0,
+			errors.New("invalid config"):     ExitFailure,
+			ErrNoServices:                    ExitNotStarted,
+			locked:                           ExitNotStarted,
+			fmt.Errorf("%w", ErrStopTimeout): ExitStopTimeout,
+		} {
+			if code := NodeExitCode(err); code != expected {
+				t.Errorf("expected the exit code %v for %v, got %v", expected, err, code)
+			}
+		}
+	})
+}
@@ -0,0 +1,61 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FuncService runs a Go function as a service, so in-process components can
+// be supervised alongside the binaries of the node
+type FuncService struct {
+	Name string
+
+	// Fn runs the service until ctx is canceled, returning promptly after
+	// that. Its error is the exit status of the service
+	Fn func(ctx context.Context) error
+
+	// StopFn, when it is set, asks Fn to return at the shutdown and waits
+	// until Fn is done or ctx is done, so Fn can finish its work before its
+	// context is canceled (see [Stopper]). Its error makes the supervisor
+	// fall back to canceling the context of Fn
+	StopFn func(ctx context.Context) error
+}
+
+// NewFuncService creates a service that runs fn
+func NewFuncService(name string, fn func(ctx context.Context) error) FuncService {
+	return FuncService{Name: name, Fn: fn}
+}
+
+func (s FuncService) String() string {
+	return s.Name
+}
+
+// Start calls the function of the service. A panic in the function is
+// recovered and returned as a [PanicError]. A service that
+// returns the cancelation of its context after being stopped exits
+// successfully, like a process that exits when it is signaled
+func (s FuncService) Start(ctx context.Context) (err error) {
+	if s.Fn == nil {
+		return fmt.Errorf("service '%v' has no function", s.Name)
+	}
+	defer recoverPanic(&err)
+	err = s.Fn(ctx)
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+	return err
+}
+
+// Stop calls the stop function of the service, if it has one. A panic in the
+// function is recovered and returned as a [PanicError]
+func (s FuncService) Stop(ctx context.Context) (err error) {
+	if s.StopFn == nil {
+		return nil
+	}
+	defer recoverPanic(&err)
+	return s.StopFn(ctx)
+}
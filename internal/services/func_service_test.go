@@ -0,0 +1,138 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestFuncService(t *testing.T) {
+
+	t.Run("it stops when the context is canceled", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		ticks := make(chan struct{}, 1)
+		poller := NewFuncService("poller", func(ctx context.Context) error {
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					select {
+					case ticks <- struct{}{}:
+					default:
+					}
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		})
+
+		go func() {
+			<-ticks
+			cancel()
+		}()
+		if err := Run(ctx, []Service{poller}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it exits with the error of the function", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		service := FuncService{
+			Name: "failing",
+			Fn:   func(ctx context.Context) error { return boom },
+		}
+
+		err := Run(context.Background(), []Service{service})
+		if !errors.Is(err, boom) || !strings.Contains(err.Error(), "failing") {
+			t.Fatalf("expected the error of the function, got %v", err)
+		}
+	})
+
+	t.Run("it recovers from a panic in the function", func(t *testing.T) {
+		setup()
+		stopped := false
+		sleeper := NewFuncService("sleeper", func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped = true
+			return nil
+		})
+		panicking := DependsOn(NewFuncService("panicking", func(ctx context.Context) error {
+			panic("nil map")
+		}), "sleeper")
+
+		err := Run(context.Background(), []Service{sleeper, panicking})
+		if !errors.Is(err, ErrPanic) || !strings.Contains(err.Error(), "nil map") {
+			t.Fatalf("expected the panic to be returned, got %v", err)
+		}
+		if !stopped {
+			t.Fatal("expected the other services to be stopped")
+		}
+	})
+
+	t.Run("it times out when the function ignores the cancelation", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		release := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		stubborn := NewFuncService("stubborn", func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+
+		err := Run(ctx, []Service{stubborn}, WithStopTimeout(50*time.Millisecond))
+		if err == nil || !strings.Contains(err.Error(), "stubborn") {
+			t.Fatalf("expected the service to time out, got %v", err)
+		}
+		close(release)
+		waitForLog(t, &out, "service 'stubborn' exited after the shutdown timeout")
+	})
+
+	t.Run("it calls the stop function at the shutdown", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		requests := make(chan struct{})
+		flushed := make(chan bool, 1)
+		done := make(chan struct{})
+		writer := FuncService{
+			Name: "writer",
+			Fn: func(fnCtx context.Context) error {
+				cancel()
+				<-requests
+				flushed <- fnCtx.Err() == nil
+				close(done)
+				return nil
+			},
+			StopFn: func(ctx context.Context) error {
+				close(requests)
+				<-done
+				return nil
+			},
+		}
+
+		if err := Run(ctx, []Service{writer}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !<-flushed {
+			t.Fatal("expected the function to return before its context is canceled")
+		}
+	})
+
+	t.Run("it fails without a function", func(t *testing.T) {
+		if err := (FuncService{Name: "empty"}).Start(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
@@ -0,0 +1,232 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// Group is a service that supervises other services, its members, which live
+// and die together: the group exits once one of its critical members exits,
+// and it is restarted as a whole when its restart policy allows. The members
+// are supervised like the services given to [Run], except that the group
+// leaves the signals and the service manager to the outer supervisor
+type Group struct {
+	name     string
+	services []Service
+	opts     []RunOption
+	restart  *Backoff
+
+	mutex      sync.Mutex
+	supervisor *Supervisor
+	restarts   int
+}
+
+// A GroupOption configures a group created by NewGroup
+type GroupOption func(*Group)
+
+// NewGroup creates a group that runs the services
+func NewGroup(name string, services []Service, opts ...GroupOption) *Group {
+	g := &Group{name: name, services: services}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// WithGroupOptions sets the options used to supervise the members of the
+// group, such as [WithStopTimeout]. The stop timeout of the group is cut short
+// when the outer supervisor has less time left to stop its services
+func WithGroupOptions(opts ...RunOption) GroupOption {
+	return func(g *Group) {
+		g.opts = append(g.opts, opts...)
+	}
+}
+
+// WithGroupRestart makes the group restart all of its members when one of
+// them fails, instead of exiting. The delay between restarts follows the
+// given backoff, and the group gives up once it is crash looping
+func WithGroupRestart(backoff Backoff) GroupOption {
+	return func(g *Group) {
+		g.restart = &backoff
+	}
+}
+
+func (g *Group) String() string {
+	return g.name
+}
+
+// Start runs the members of the group until one of them exits or ctx is
+// canceled, restarting them if the group has a restart policy
+func (g *Group) Start(ctx context.Context) error {
+	var backoff backoff
+	var detector crashLoopDetector
+	filter := logFilterFrom(ctx)
+	opts := append(append([]RunOption(nil), g.opts...), asGroup())
+	for attempt := 1; ; attempt++ {
+		startedAt := time.Now()
+		supervisor := NewSupervisor(g.services, opts...)
+		g.mutex.Lock()
+		g.supervisor = supervisor
+		g.mutex.Unlock()
+		err := supervisor.Start(ctx)
+		if err == nil {
+			err = supervisor.Wait()
+		}
+		if err == nil || g.restart == nil || ctx.Err() != nil {
+			return err
+		}
+
+		uptime := time.Since(startedAt)
+		if uptime >= g.restart.Reset {
+			detector.reset()
+		}
+		if !detector.allow(defaultCrashLoopLimit, time.Now()) {
+			msg := fmt.Sprintf("main: group '%v' is crash looping; giving up", g.name)
+			filter.log(logger.Error, msg, "service", g.name, "event", "crash_loop")
+			return fmt.Errorf("%w: restarted %v times in %v: %w", ErrCrashLoop,
+				defaultCrashLoopLimit.restarts, defaultCrashLoopLimit.window, err)
+		}
+		delay := backoff.next(*g.restart, uptime)
+		msg := "main: restarting group '%v' in %v (attempt %v): %v"
+		filter.log(logger.Warning, fmt.Sprintf(msg, g.name, delay, attempt+1, err),
+			"service", g.name, "event", "restart_scheduled", "delay", delay, "attempt", attempt+1)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		g.mutex.Lock()
+		g.restarts++
+		g.mutex.Unlock()
+	}
+}
+
+// Ready succeeds once all members of the current run of the group are ready
+func (g *Group) Ready(ctx context.Context) error {
+	g.mutex.Lock()
+	supervisor := g.supervisor
+	g.mutex.Unlock()
+	if supervisor == nil || !supervisor.ready() {
+		return errors.New("the members of the group are not ready")
+	}
+	return nil
+}
+
+// Validate checks the members of the group, like [Verify]
+func (g *Group) Validate() error {
+	return Verify(g.services)
+}
+
+// Status returns the status of the members of the current run of the group,
+// or nil before the group is started
+func (g *Group) Status() []ServiceStatus {
+	g.mutex.Lock()
+	supervisor := g.supervisor
+	g.mutex.Unlock()
+	if supervisor == nil {
+		return nil
+	}
+	return supervisor.Status()
+}
+
+// Signal forwards the signal to the members of the current run of the group,
+// like [Supervisor.Signal]
+func (g *Group) Signal(sig os.Signal) error {
+	g.mutex.Lock()
+	supervisor := g.supervisor
+	g.mutex.Unlock()
+	if supervisor == nil {
+		return errNotRunning
+	}
+	supervisor.Signal(sig)
+	return nil
+}
+
+// Fingerprint describes the members of the group and its restart policy
+func (g *Group) Fingerprint() string {
+	members := make([]string, len(g.services))
+	for i, service := range g.services {
+		members[i] = configHash(specOf(service))
+	}
+	return fmt.Sprintf("%v %v %+v %v", g.name, members, g.restart, len(g.opts))
+}
+
+// release releases the members of the group, which keep their resources
+// while the group restarts
+func (g *Group) release() {
+	specs := make([]ServiceSpec, len(g.services))
+	for i, service := range g.services {
+		specs[i] = specOf(service)
+	}
+	releaseServices(specs)
+}
+
+// Restarts returns how many times the members of the group were restarted
+// together
+func (g *Group) Restarts() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.restarts
+}
+
+// asGroup makes Run supervise the members of a group, leaving the signals and
+// the service manager to the outer supervisor
+func asGroup() RunOption {
+	return func(c *runConfig) {
+		c.group = true
+	}
+}
+
+// shutdownDeadline is when the services of a supervisor must be stopped by,
+// on the clock of the supervisor. Its zero value means the shutdown did not
+// begin
+type shutdownDeadline struct {
+	mutex    sync.Mutex
+	clock    Clock
+	deadline time.Time
+}
+
+// set starts the deadline, which is the timeout from now on the clock
+func (d *shutdownDeadline) set(clock Clock, timeout time.Duration) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clock = clock
+	d.deadline = clock.Now().Add(timeout)
+}
+
+// remaining returns how long is left until the deadline on its clock, if it
+// was set
+func (d *shutdownDeadline) remaining() (time.Duration, bool) {
+	if d == nil {
+		return 0, false
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.clock == nil {
+		return 0, false
+	}
+	return d.deadline.Sub(d.clock.Now()), true
+}
+
+type shutdownDeadlineKey struct{}
+
+// withShutdownDeadline returns a context that carries the deadline of the
+// shutdown of a supervisor, so the groups it runs can respect it
+func withShutdownDeadline(ctx context.Context, deadline *shutdownDeadline) context.Context {
+	return context.WithValue(ctx, shutdownDeadlineKey{}, deadline)
+}
+
+// shutdownDeadlineFrom returns the deadline carried by the context, if any
+func shutdownDeadlineFrom(ctx context.Context) *shutdownDeadline {
+	deadline, _ := ctx.Value(shutdownDeadlineKey{}).(*shutdownDeadline)
+	return deadline
+}
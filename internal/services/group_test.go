@@ -0,0 +1,160 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestGroup(t *testing.T) {
+
+	t.Run("it restarts the group without touching the other services", func(t *testing.T) {
+		setup()
+		var siblingStarts, runnerStarts, serverStarts atomic.Int32
+		sibling := testService{name: "indexer", start: func(ctx context.Context) error {
+			siblingStarts.Add(1)
+			<-ctx.Done()
+			return nil
+		}}
+		runner := testService{name: "host-runner", start: func(ctx context.Context) error {
+			if runnerStarts.Add(1) == 1 {
+				return errors.New("boom")
+			}
+			<-ctx.Done()
+			return nil
+		}}
+		server := testService{name: "server-manager", start: func(ctx context.Context) error {
+			serverStarts.Add(1)
+			<-ctx.Done()
+			return nil
+		}}
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+		group := NewGroup("host", []Service{server, runner}, WithGroupRestart(backoff))
+
+		supervisor := NewSupervisor([]Service{sibling, group})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for runnerStarts.Load() < 2 || !allStates(group.Status(), StateReady) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the group to be restarted, got %+v", group.Status())
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		statuses := supervisor.Status()
+		if statuses[0].State != StateReady || statuses[1].State != StateReady {
+			t.Fatalf("expected the services to be ready, got %+v", statuses)
+		}
+		if names := memberNames(statuses[1].Members); names != "server-manager host-runner" {
+			t.Fatalf("expected the status of the members, got %v", names)
+		}
+		if siblingStarts.Load() != 1 || serverStarts.Load() != 2 || group.Restarts() != 1 {
+			t.Fatalf("expected only the group to be restarted, got %v, %v, and %v restarts",
+				siblingStarts.Load(), serverStarts.Load(), group.Restarts())
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it stops the node when a group without restarts fails", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		var stopped atomic.Bool
+		sibling := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped.Store(true)
+			return nil
+		}}
+		group := NewGroup("host", []Service{
+			testService{name: "host-runner", start: func(ctx context.Context) error {
+				return boom
+			}},
+		})
+
+		err := Run(context.Background(), []Service{sibling, group})
+		if !errors.Is(err, boom) || !strings.HasPrefix(err.Error(), "service 'host' exited") {
+			t.Fatalf("expected the error of the group, got %v", err)
+		}
+		if !stopped.Load() {
+			t.Fatal("expected the other services to be stopped")
+		}
+	})
+
+	t.Run("it respects the stop timeout of the outer supervisor", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		release := make(chan struct{})
+		stubborn := testService{name: "host-runner", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			<-release
+			return nil
+		}}
+		group := NewGroup("host", []Service{stubborn},
+			WithGroupOptions(WithStopTimeout(time.Hour)))
+
+		supervisor := NewSupervisor([]Service{group}, WithStopTimeout(100*time.Millisecond))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		start := time.Now()
+		if err := supervisor.Stop(context.Background()); err == nil {
+			t.Fatal("expected the shutdown to time out")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the shutdown to take the outer timeout, but it took %v", elapsed)
+		}
+		close(release)
+		waitForLog(t, &out, "service 'host-runner' exited after the shutdown timeout")
+	})
+
+	t.Run("it validates the members", func(t *testing.T) {
+		group := NewGroup("host", []Service{
+			&simpleService{serviceName: "host-runner", binaryName: "cartesi-rollups-missing"},
+		})
+		err := Verify([]Service{group})
+		if !errors.Is(err, ErrInvalidServices) || !strings.Contains(err.Error(), "host-runner") {
+			t.Fatalf("expected the members to be invalid, got %v", err)
+		}
+	})
+}
+
+func TestGroupStatusResponse(t *testing.T) {
+	status := ServiceStatus{Name: "host", State: StateReady, Members: []ServiceStatus{
+		{Name: "host-runner", State: StateReady},
+	}}
+	response := newStatusResponse(status)
+	if len(response.Members) != 1 || response.Members[0].Name != "host-runner" {
+		t.Fatalf("expected the members to be served, got %+v", response)
+	}
+}
+
+// allStates reports whether all services are in the state
+func allStates(statuses []ServiceStatus, state ServiceState) bool {
+	for _, status := range statuses {
+		if status.State != state {
+			return false
+		}
+	}
+	return len(statuses) > 0
+}
+
+func memberNames(statuses []ServiceStatus) string {
+	var names []string
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	return strings.Join(names, " ")
+}
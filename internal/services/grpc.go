@@ -0,0 +1,122 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	grpcbackoff "google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcProbeBackoff bounds how long the connection of a gRPC probe waits to
+// reconnect, so a server that comes up is noticed by the next attempts
+var grpcProbeBackoff = grpcbackoff.Config{
+	BaseDelay:  readyPollInterval,
+	Multiplier: 1.6,
+	Jitter:     0.2,
+	MaxDelay:   time.Second,
+}
+
+// GrpcHealthProbe is a readiness probe that succeeds when the gRPC health
+// checking service of the server reports SERVING, which servers that load a
+// machine snapshot only do once it is loaded. The probe keeps one connection
+// across its attempts and closes it once the service is ready or the context
+// of the attempts is done, so it must be passed as a pointer
+type GrpcHealthProbe struct {
+	// Address of the server, such as localhost:5001
+	Address string
+
+	// ServiceName is the service whose health is checked. The default is the
+	// empty name, which is the health of the whole server
+	ServiceName string
+
+	// Timeout of each check. The default is DefaultProbeTimeout
+	Timeout time.Duration
+
+	mutex sync.Mutex
+	conn  *grpc.ClientConn
+	stop  func() bool
+}
+
+// Validate checks that the address has a host and a valid port
+func (p *GrpcHealthProbe) Validate() error {
+	_, port, err := net.SplitHostPort(p.Address)
+	if err != nil {
+		return fmt.Errorf("invalid address %v: %w", p.Address, err)
+	}
+	if number, err := strconv.Atoi(port); err != nil || number <= 0 || number > 65535 {
+		return fmt.Errorf("invalid address %v: invalid port %v", p.Address, port)
+	}
+	return nil
+}
+
+func (p *GrpcHealthProbe) Ready(ctx context.Context) error {
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return err
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	request := &healthpb.HealthCheckRequest{Service: p.ServiceName}
+	response, err := healthpb.NewHealthClient(conn).Check(checkCtx, request)
+	if err != nil {
+		return err
+	}
+	if response.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%v is %v", p, response.Status)
+	}
+	p.close()
+	return nil
+}
+
+// String describes what the probe checks. It also keeps the connection out
+// of the fingerprint of the service
+func (p *GrpcHealthProbe) String() string {
+	return fmt.Sprintf("the gRPC health of service %q at %v (timeout %v)", p.ServiceName,
+		p.Address, p.Timeout)
+}
+
+// connect returns the connection of the probe, creating it on the first
+// attempt. The connection is closed when the context is done
+func (p *GrpcHealthProbe) connect(ctx context.Context) (*grpc.ClientConn, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn != nil {
+		return p.conn, nil
+	}
+	conn, err := grpc.NewClient(p.Address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: grpcProbeBackoff}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %w", p.Address, err)
+	}
+	p.conn = conn
+	p.stop = context.AfterFunc(ctx, p.close)
+	return conn, nil
+}
+
+// close closes the connection of the probe, if it is open
+func (p *GrpcHealthProbe) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == nil {
+		return
+	}
+	p.stop()
+	_ = p.conn.Close()
+	p.conn = nil
+}
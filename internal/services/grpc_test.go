@@ -0,0 +1,167 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// countingListener counts the connections it accepts
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return conn, err
+}
+
+func TestGrpcHealthProbe(t *testing.T) {
+
+	// serve starts a gRPC server with the health checking service, which
+	// starts as NOT_SERVING
+	serve := func(t *testing.T) (*health.Server, *countingListener) {
+		t.Helper()
+		inner, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		listener := &countingListener{Listener: inner}
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		server := grpc.NewServer()
+		healthpb.RegisterHealthServer(server, healthServer)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+		t.Cleanup(server.Stop)
+		return healthServer, listener
+	}
+
+	// closed tells whether the probe closes its connection in time
+	closed := func(p *GrpcHealthProbe) bool {
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			p.mutex.Lock()
+			conn := p.conn
+			p.mutex.Unlock()
+			if conn == nil {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	t.Run("it succeeds once the server is serving", func(t *testing.T) {
+		healthServer, listener := serve(t)
+		probe := &GrpcHealthProbe{Address: listener.Addr().String()}
+		for i := 0; i < 3; i++ {
+			err := probe.Ready(context.Background())
+			if err == nil || !strings.Contains(err.Error(), "NOT_SERVING") {
+				t.Fatalf("expected the probe to fail while not serving, got %v", err)
+			}
+		}
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		if err := probe.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the probe to succeed, got %v", err)
+		}
+		if accepted := listener.accepted.Load(); accepted != 1 {
+			t.Fatalf("expected the probe to reuse one connection, got %v", accepted)
+		}
+		if !closed(probe) {
+			t.Fatalf("expected the connection to be closed once the server is serving")
+		}
+	})
+
+	t.Run("it checks the named service", func(t *testing.T) {
+		healthServer, listener := serve(t)
+		healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		probe := &GrpcHealthProbe{Address: listener.Addr().String(), ServiceName: "machine"}
+		if err := probe.Ready(context.Background()); err == nil {
+			t.Fatalf("expected the probe to fail for an unknown service")
+		}
+		healthServer.SetServingStatus("machine", healthpb.HealthCheckResponse_SERVING)
+		if err := probe.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the probe to succeed, got %v", err)
+		}
+	})
+
+	t.Run("it closes the connection when the readiness is abandoned", func(t *testing.T) {
+		_, listener := serve(t)
+		probe := &GrpcHealthProbe{Address: listener.Addr().String()}
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := probe.Ready(ctx); err == nil {
+			t.Fatalf("expected the probe to fail while not serving")
+		}
+		cancel()
+		if !closed(probe) {
+			t.Fatalf("expected the connection to be closed once the context is done")
+		}
+	})
+
+	t.Run("it times out slow checks", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		probe := &GrpcHealthProbe{
+			Address: listener.Addr().String(),
+			Timeout: 100 * time.Millisecond,
+		}
+		start := time.Now()
+		if err := probe.Ready(context.Background()); err == nil {
+			t.Fatalf("expected the probe to time out")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the probe to give up after its timeout, took %v", elapsed)
+		}
+		probe.close()
+	})
+
+	t.Run("it makes the command service ready", func(t *testing.T) {
+		setup()
+		healthServer, listener := serve(t)
+		probe := &GrpcHealthProbe{Address: listener.Addr().String()}
+		service := NewCommandService("server-manager", os.Args[0], WithProbe(probe),
+			WithArgs("-test.run=^TestHelperProcess$"),
+			WithEnv(map[string]string{"SERVICES_HELPER_PROCESS": "sleep"}),
+		)
+		supervisor := NewSupervisor([]Service{service})
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background())
+		if !closed(probe) {
+			t.Fatalf("expected the connection to be closed once the service is ready")
+		}
+	})
+
+	t.Run("it validates the address", func(t *testing.T) {
+		for _, address := range []string{"localhost", "localhost:0", "localhost:grpc"} {
+			if err := (&GrpcHealthProbe{Address: address}).Validate(); err == nil {
+				t.Errorf("expected %q to be invalid", address)
+			}
+		}
+	})
+}
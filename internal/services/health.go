@@ -0,0 +1,155 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// DefaultHealthAddress is the address of the health server by default. It
+// only accepts local connections, which is enough for the healthchecks of
+// Docker
+const DefaultHealthAddress = "127.0.0.1:10011"
+
+// healthService serves the health of the node, as given by the status of the
+// services of the supervisor that runs it
+type healthService struct {
+	httpServer
+}
+
+// NewHealthService creates a service that serves the health and the readiness
+// of the node on the address for healthchecks. It reports on the services run along with it
+// by [Run] or a [Supervisor], and only reads their status, so requests never
+// probe the services. An empty address means [DefaultHealthAddress].
+//
+// GET /healthz returns 200 when every critical service is ready or running:
+//
+//	{"status": "healthy"}
+//
+// Otherwise, it returns 503 with the critical services in the other states,
+// including the last error of the service when there is one:
+//
+//	{
+//	  "status": "unhealthy",
+//	  "unhealthy": [
+//	    {"name": "indexer", "state": "failed", "last_error": "exit status 1"}
+//	  ]
+//	}
+//
+// GET /readyz returns 503 until all services become ready for the first time,
+// with the services that are still pending or starting:
+//
+//	{"status": "not_ready", "waiting": ["indexer"]}
+//
+// After that, it always returns 200, since services that fail later are a
+// matter for /healthz:
+//
+//	{"status": "ready"}
+func NewHealthService(address string) Service {
+	if address == "" {
+		address = DefaultHealthAddress
+	}
+	return &healthService{newHttpServer("health", address, 0)}
+}
+
+// Start serves the requests until the context is canceled. It fails unless it
+// is run by a supervisor
+func (s *healthService) Start(ctx context.Context) error {
+	board := statusBoardFrom(ctx)
+	if board == nil {
+		return errors.New("the health service must be run by a supervisor")
+	}
+	// the health service is not ready while it handles its first requests, so
+	// it leaves itself out
+	handler := healthHandler(statusesWithout(board, s), board.isReady)
+	return s.serve(ctx, handler)
+}
+
+// statusesWithout returns a function that returns the status of the services
+// of the board other than the given one
+func statusesWithout(board *statusBoard, service Service) func() []ServiceStatus {
+	self := -1
+	for i, other := range board.services {
+		if other == service {
+			self = i
+		}
+	}
+	return func() []ServiceStatus {
+		statuses := board.snapshot()
+		if self >= 0 {
+			statuses = append(statuses[:self], statuses[self+1:]...)
+		}
+		return statuses
+	}
+}
+
+// healthResponse is the body of the responses of /healthz
+type healthResponse struct {
+	Status    string            `json:"status"`
+	Unhealthy []unhealthyStatus `json:"unhealthy,omitempty"`
+}
+
+type unhealthyStatus struct {
+	Name      string       `json:"name"`
+	State     ServiceState `json:"state"`
+	LastError string       `json:"last_error,omitempty"`
+}
+
+// readyResponse is the body of the responses of /readyz
+type readyResponse struct {
+	Status  string   `json:"status"`
+	Waiting []string `json:"waiting,omitempty"`
+}
+
+// healthy reports whether the service does not make the node unhealthy, which
+// is when it is optional, ready or running, or a one-shot that completed
+func healthy(status ServiceStatus) bool {
+	return status.Optional || status.State == StateReady || status.State == StateRunning ||
+		status.OneShot && status.State == StateExited
+}
+
+func healthHandler(status func() []ServiceStatus, ready func() bool) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+		response := healthResponse{Status: "healthy"}
+		for _, status := range status() {
+			if healthy(status) {
+				continue
+			}
+			unhealthy := unhealthyStatus{Name: status.Name, State: status.State}
+			if status.LastError != nil {
+				unhealthy.LastError = status.LastError.Error()
+			}
+			response.Unhealthy = append(response.Unhealthy, unhealthy)
+		}
+		if len(response.Unhealthy) > 0 {
+			response.Status = "unhealthy"
+			writeJSON(w, http.StatusServiceUnavailable, response)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !allowGet(w, r) {
+			return
+		}
+		if ready() {
+			writeJSON(w, http.StatusOK, readyResponse{Status: "ready"})
+			return
+		}
+		response := readyResponse{Status: "not_ready"}
+		for _, status := range status() {
+			if status.State == StatePending || status.State == StateStarting {
+				response.Waiting = append(response.Waiting, status.Name)
+			}
+		}
+		writeJSON(w, http.StatusServiceUnavailable, response)
+	})
+	return mux
+}
@@ -0,0 +1,209 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestHealthService(t *testing.T) {
+
+	check := func(t *testing.T, statuses []ServiceStatus) (int, healthResponse) {
+		t.Helper()
+		var response healthResponse
+		code := serveStatus(t, statuses, false, "/healthz", &response)
+		return code, response
+	}
+
+	t.Run("it is healthy when the critical services are up", func(t *testing.T) {
+		code, response := check(t, []ServiceStatus{
+			{Name: "graphql-server", State: StateReady},
+			{Name: "indexer", State: StateRunning},
+			{Name: "admin", State: StateFailed, Optional: true},
+		})
+		if code != http.StatusOK {
+			t.Fatalf("expected status 200, got %v", code)
+		}
+		if !reflect.DeepEqual(response, healthResponse{Status: "healthy"}) {
+			t.Fatalf("unexpected response %+v", response)
+		}
+	})
+
+	t.Run("it lists the critical services that are not up", func(t *testing.T) {
+		code, response := check(t, []ServiceStatus{
+			{Name: "graphql-server", State: StateReady},
+			{Name: "indexer", State: StateFailed, LastError: errors.New("exit status 1")},
+			{Name: "dispatcher", State: StateStarting},
+		})
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status 503, got %v", code)
+		}
+		expected := healthResponse{
+			Status: "unhealthy",
+			Unhealthy: []unhealthyStatus{
+				{Name: "indexer", State: StateFailed, LastError: "exit status 1"},
+				{Name: "dispatcher", State: StateStarting},
+			},
+		}
+		if !reflect.DeepEqual(response, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, response)
+		}
+	})
+
+	t.Run("it reports on the services of its supervisor", func(t *testing.T) {
+		setup()
+		address := freeAddress(t)
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		supervisor := NewSupervisor([]Service{indexer, NewHealthService(address)})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background())
+
+		response, err := http.Get("http://" + address + "/healthz")
+		if err != nil {
+			t.Fatalf("failed to get the health: %v", err)
+		}
+		defer response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200, got %v", response.StatusCode)
+		}
+	})
+
+	t.Run("it fails without a supervisor", func(t *testing.T) {
+		service := NewHealthService(freeAddress(t))
+		if err := service.Start(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestReadyEndpoint(t *testing.T) {
+
+	t.Run("it lists the services that are not ready yet", func(t *testing.T) {
+		var response readyResponse
+		code := serveStatus(t, []ServiceStatus{
+			{Name: "graphql-server", State: StateReady},
+			{Name: "indexer", State: StateStarting},
+			{Name: "dispatcher", State: StatePending},
+		}, false, "/readyz", &response)
+		if code != http.StatusServiceUnavailable {
+			t.Fatalf("expected status 503, got %v", code)
+		}
+		expected := readyResponse{Status: "not_ready", Waiting: []string{"indexer", "dispatcher"}}
+		if !reflect.DeepEqual(response, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, response)
+		}
+	})
+
+	t.Run("it stays ready when a service fails later", func(t *testing.T) {
+		var response readyResponse
+		code := serveStatus(t, []ServiceStatus{
+			{Name: "indexer", State: StateFailed},
+		}, true, "/readyz", &response)
+		if code != http.StatusOK || response.Status != "ready" {
+			t.Fatalf("unexpected response %v: %+v", code, response)
+		}
+	})
+
+	t.Run("it becomes ready when the slowest probe succeeds", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		address := freeAddress(t)
+		var caughtUp atomic.Bool
+		indexer := readyTestService{
+			testService: testService{name: "indexer", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			ready: func(ctx context.Context) error {
+				if !caughtUp.Load() {
+					return errors.New("catching up")
+				}
+				return nil
+			},
+		}
+		supervisor := NewSupervisor([]Service{NewHealthService(address), indexer})
+		go func() { _ = supervisor.Start(context.Background()) }()
+		defer supervisor.Stop(context.Background())
+
+		readyz := func() int {
+			response, err := http.Get("http://" + address + "/readyz")
+			if err != nil {
+				return 0
+			}
+			defer response.Body.Close()
+			return response.StatusCode
+		}
+		waitFor := func(code int) {
+			t.Helper()
+			deadline := time.Now().Add(time.Second)
+			for readyz() != code {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected /readyz to return %v, got %v", code, readyz())
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+
+		waitFor(http.StatusServiceUnavailable)
+		time.Sleep(2 * readyPollInterval)
+		if code := readyz(); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected /readyz to wait for the slow probe, got %v", code)
+		}
+		caughtUp.Store(true)
+		waitFor(http.StatusOK)
+
+		caughtUp.Store(false)
+		if code := readyz(); code != http.StatusOK {
+			t.Fatalf("expected /readyz to stay ready, got %v", code)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pattern := regexp.MustCompile(`main: all services are ready in \d+(\.\d+)?m?s`)
+		if matches := pattern.FindAllString(out.String(), -1); len(matches) != 1 {
+			t.Fatalf("expected the readiness to be logged once, got %q", out.String())
+		}
+	})
+}
+
+// serveStatus serves a request to the health handler with the given statuses
+// and decodes the response into body, returning the status code
+func serveStatus(
+	t *testing.T,
+	statuses []ServiceStatus,
+	ready bool,
+	path string,
+	body any,
+) int {
+	t.Helper()
+	handler := healthHandler(
+		func() []ServiceStatus { return statuses },
+		func() bool { return ready },
+	)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	if err := json.Unmarshal(recorder.Body.Bytes(), body); err != nil {
+		t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+	}
+	return recorder.Code
+}
@@ -0,0 +1,101 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultHeartbeatInterval is how often the heartbeat is logged by default
+// once it is enabled
+const DefaultHeartbeatInterval = 5 * time.Minute
+
+// WithHeartbeat makes Run log a summary of the states of the services and the
+// uptime of the node at the interval, so quiet nodes can be told apart from
+// wedged ones by their logs. The summary comes from the status of the services
+// kept by Run, so it does not probe them. The heartbeat stops when the
+// shutdown begins. The default interval is [DefaultHeartbeatInterval]
+func WithHeartbeat(interval time.Duration) RunOption {
+	return func(c *runConfig) {
+		if interval == 0 {
+			interval = DefaultHeartbeatInterval
+		}
+		c.heartbeat = interval
+	}
+}
+
+// heartbeatSummary counts the services in each stage of their lifecycle
+type heartbeatSummary struct {
+	running    int // starting, ready, running, or stopping
+	restarting int // failed and waiting to be restarted
+	failed     int
+	exited     int
+	pending    int
+}
+
+// summary counts the services that were not removed in each stage
+func (b *statusBoard) summary() heartbeatSummary {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	var summary heartbeatSummary
+	for i, status := range b.statuses {
+		switch {
+		case b.removed[i]:
+		case status.State == StatePending:
+			summary.pending++
+		case status.State == StateExited:
+			summary.exited++
+		case status.State == StateFailed && status.Restarting:
+			summary.restarting++
+		case status.State == StateFailed:
+			summary.failed++
+		default:
+			summary.running++
+		}
+	}
+	return summary
+}
+
+// heartbeat logs the summary of the services at the interval of the config,
+// if it is set. It returns a function that stops the heartbeat, which may be
+// called more than once
+func (s *supervisor) heartbeat() func() {
+	if s.config.heartbeat <= 0 || s.config.group {
+		return func() {}
+	}
+	clock := s.config.clock
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-clock.After(s.config.heartbeat):
+				s.logHeartbeat(clock.Now().Sub(s.startedAt))
+			case <-done:
+				return
+			}
+		}
+	}()
+	return sync.OnceFunc(func() {
+		close(done)
+		<-stopped
+	})
+}
+
+// logHeartbeat logs the summary of the services and the uptime of the node
+func (s *supervisor) logHeartbeat(uptime time.Duration) {
+	summary := s.status.summary()
+	uptime = uptime.Round(time.Second)
+	msg := fmt.Sprintf("main: up %v; services: %v running, %v restarting, %v failed, "+
+		"%v exited, %v pending", uptime, summary.running, summary.restarting, summary.failed,
+		summary.exited, summary.pending)
+	logger.Log(logger.Info, msg, "event", "heartbeat", "uptime", uptime,
+		"running", summary.running, "restarting", summary.restarting,
+		"failed", summary.failed, "exited", summary.exited, "pending", summary.pending)
+}
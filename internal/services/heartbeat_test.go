@@ -0,0 +1,86 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestHeartbeat(t *testing.T) {
+	setup()
+	var out lockedBuffer
+	logger.Info = log.New(&out, "INFO ", 0)
+	clock := servicestest.NewClock(time.Unix(0, 0))
+	quiet := testService{name: "quiet", start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}
+	flaky := testService{name: "flaky", start: func(ctx context.Context) error {
+		return errors.New("boom")
+	}}
+	broken := testService{name: "broken", start: func(ctx context.Context) error {
+		return errors.New("boom")
+	}}
+	backoff := Backoff{Initial: time.Hour, Max: time.Hour, Reset: time.Hour}
+	supervisor := NewSupervisor([]Service{
+		quiet,
+		Optional(Restart(flaky, RestartOnFailure)),
+		Optional(Restart(broken, RestartNever)),
+	}, WithHeartbeat(0), WithRestartOnFailure(backoff), WithClock(clock))
+	if err := supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		statuses := supervisor.Status()
+		if statuses[1].Restarting && statuses[2].State == StateFailed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a restarting and a failed service, got %+v", statuses)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	heartbeats := func() int {
+		return strings.Count(out.String(), "main: up ")
+	}
+
+	t.Run("it logs at the interval", func(t *testing.T) {
+		clock.WaitFor(t, DefaultHeartbeatInterval)
+		clock.Advance(DefaultHeartbeatInterval - time.Second)
+		time.Sleep(10 * time.Millisecond)
+		if count := heartbeats(); count != 0 {
+			t.Fatalf("expected no heartbeat before the interval, got %q", out.String())
+		}
+		clock.Advance(time.Second)
+		waitForLog(t, &out, "INFO main: up 5m0s; services: 1 running, 1 restarting, 1 failed, "+
+			"0 exited, 0 pending\n")
+		clock.WaitFor(t, DefaultHeartbeatInterval)
+		clock.Advance(DefaultHeartbeatInterval)
+		waitForLog(t, &out, "INFO main: up 10m0s; services: 1 running, 1 restarting, 1 failed")
+	})
+
+	t.Run("it stops at the shutdown", func(t *testing.T) {
+		// the flaky service is stopped while it waits for its restart
+		err := supervisor.Stop(context.Background())
+		if err == nil || err.Error() != "service 'flaky' exited with error: boom" {
+			t.Fatalf("expected the error of the flaky service, got %v", err)
+		}
+		before := heartbeats()
+		clock.Advance(DefaultHeartbeatInterval)
+		time.Sleep(10 * time.Millisecond)
+		if count := heartbeats(); count != before {
+			t.Fatalf("expected no heartbeat after the shutdown, got %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,121 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultHookTimeout is how long Run waits for each hook by default
+const DefaultHookTimeout = 5 * time.Second
+
+// Hooks are functions Run calls when a service changes state, such as to
+// register the service in a discovery system once it is ready. Any of them may
+// be nil. Run calls the hooks one at a time and waits for each one to return
+// or timeout before moving on (see [WithHookTimeout]). Panics in the hooks are
+// recovered and logged
+type Hooks struct {
+	// OnStart is called before the service is started
+	OnStart func(name string)
+
+	// OnReady is called once the service is ready
+	OnReady func(name string)
+
+	// OnExit is called after the service exits with the error it returned,
+	// which is nil if it exited successfully. Services restarted by Run only
+	// exit once they are not restarted anymore
+	OnExit func(name string, err error)
+}
+
+// WithHooks makes Run call the hooks for every service. Calling it more than
+// once adds more hooks, which are called in the order they were given
+func WithHooks(hooks Hooks) RunOption {
+	return func(c *runConfig) {
+		c.hooks = append(c.hooks, hooks)
+	}
+}
+
+// WithHookTimeout sets how long Run waits for each hook to return. Run moves
+// on after the timeout, so a slow hook cannot hold the startup or the
+// shutdown. The default is [DefaultHookTimeout]
+func WithHookTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.hookTimeout = timeout
+	}
+}
+
+// AddHooks makes Run call the hooks for the service only. They are called
+// before the hooks given to [WithHooks]
+func AddHooks(service Service, hooks Hooks) Service {
+	spec := specOf(service)
+	spec.Hooks = append(spec.Hooks, hooks)
+	return spec
+}
+
+// hooks returns the hooks of the service followed by the hooks of Run
+func (s *supervisor) hooks(i int) []Hooks {
+	hooks := append([]Hooks(nil), s.specs[i].Hooks...)
+	return append(hooks, s.config.hooks...)
+}
+
+func (s *supervisor) runStartHooks(i int) {
+	name := s.specs[i].String()
+	for _, hooks := range s.hooks(i) {
+		if hooks.OnStart != nil {
+			s.runHook(i, "OnStart", func() { hooks.OnStart(name) })
+		}
+	}
+}
+
+func (s *supervisor) runReadyHooks(i int) {
+	name := s.specs[i].String()
+	for _, hooks := range s.hooks(i) {
+		if hooks.OnReady != nil {
+			s.runHook(i, "OnReady", func() { hooks.OnReady(name) })
+		}
+	}
+}
+
+func (s *supervisor) runExitHooks(i int, err error) {
+	name := s.specs[i].String()
+	for _, hooks := range s.hooks(i) {
+		if hooks.OnExit != nil {
+			s.runHook(i, "OnExit", func() { hooks.OnExit(name, err) })
+		}
+	}
+}
+
+// runHook calls the hook of the service and waits for it to return or for the
+// hook timeout. A hook that times out keeps running in the background
+func (s *supervisor) runHook(i int, hook string, fn func()) {
+	name, filter := s.specs[i].String(), s.filters[i]
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := callHook(fn); err != nil {
+			msg := fmt.Sprintf("main: hook %v of service '%v' panicked: %v", hook, name, err)
+			filter.log(logger.Error, msg, "service", name, "event", "hook_panicked",
+				"hook", hook)
+		}
+	}()
+	timer := time.NewTimer(s.config.hookTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		msg := "main: hook %v of service '%v' did not return in %v; moving on"
+		filter.log(logger.Warning, fmt.Sprintf(msg, hook, name, s.config.hookTimeout),
+			"service", name, "event", "hook_timeout", "hook", hook)
+	}
+}
+
+// callHook calls the hook, turning a panic into an error
+func callHook(fn func()) (err error) {
+	defer recoverPanic(&err)
+	fn()
+	return nil
+}
@@ -0,0 +1,128 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestHooks(t *testing.T) {
+
+	t.Run("it calls the hooks around the start, readiness, and exit", func(t *testing.T) {
+		setup()
+		var mutex sync.Mutex
+		var events []string
+		record := func(format string, args ...any) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, fmt.Sprintf(format, args...))
+		}
+		boom := errors.New("boom")
+		started := make(chan struct{})
+		service := readyTestService{
+			testService: testService{name: "indexer", start: func(ctx context.Context) error {
+				record("started indexer")
+				close(started)
+				<-ctx.Done()
+				record("stopped indexer")
+				return boom
+			}},
+			ready: func(ctx context.Context) error {
+				select {
+				case <-started:
+					record("ready indexer")
+					return nil
+				default:
+					return errors.New("not started")
+				}
+			},
+		}
+		hooks := Hooks{
+			OnStart: func(name string) { record("OnStart %v", name) },
+			OnReady: func(name string) { record("OnReady %v", name) },
+			OnExit:  func(name string, err error) { record("OnExit %v: %v", name, err) },
+		}
+		own := Hooks{OnExit: func(name string, err error) { record("own OnExit %v", name) }}
+
+		supervisor := NewSupervisor([]Service{AddHooks(service, own)}, WithHooks(hooks))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); !errors.Is(err, boom) {
+			t.Fatalf("expected the error of the service, got %v", err)
+		}
+
+		expected := []string{
+			"OnStart indexer",
+			"started indexer",
+			"ready indexer",
+			"OnReady indexer",
+			"stopped indexer",
+			"own OnExit indexer",
+			"OnExit indexer: boom",
+		}
+		if !reflect.DeepEqual(events, expected) {
+			t.Fatalf("expected %q, got %q", expected, events)
+		}
+	})
+
+	t.Run("it does not wait for slow hooks", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		release := make(chan struct{})
+		returned := make(chan struct{})
+		hooks := Hooks{OnExit: func(name string, err error) {
+			defer close(returned)
+			<-release
+		}}
+		service := testService{name: "indexer", start: func(ctx context.Context) error {
+			return nil
+		}}
+
+		start := time.Now()
+		err := Run(context.Background(), []Service{service}, WithHooks(hooks),
+			WithHookTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected Run to not wait for the hook, but it took %v", elapsed)
+		}
+		waitForLog(t, &out, "hook OnExit of service 'indexer' did not return in 50ms")
+		close(release)
+		<-returned
+	})
+
+	t.Run("it recovers from panics in the hooks", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Error = log.New(&out, "ERROR ", 0)
+		var called []string
+		hooks := Hooks{
+			OnStart: func(name string) { panic("nil map") },
+			OnExit:  func(name string, err error) { called = append(called, name) },
+		}
+		service := testService{name: "indexer", start: func(ctx context.Context) error {
+			return nil
+		}}
+
+		if err := Run(context.Background(), []Service{service}, WithHooks(hooks)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForLog(t, &out, "hook OnStart of service 'indexer' panicked: service panicked: nil map")
+		if !reflect.DeepEqual(called, []string{"indexer"}) {
+			t.Fatalf("expected the other hooks to be called, got %v", called)
+		}
+	})
+}
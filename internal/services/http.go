@@ -0,0 +1,83 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// httpShutdownTimeout is how long the built-in servers wait for the pending
+// requests when they stop
+const httpShutdownTimeout = 5 * time.Second
+
+// httpServer is the server of a built-in service, which is an HttpService
+// whose handler is made by the service for each run
+type httpServer struct {
+	*HttpService
+}
+
+// newHttpServer creates the server of a built-in service, which waits for the
+// pending requests for the given drain when it stops. The default drain is
+// httpShutdownTimeout
+func newHttpServer(name, address string, drain time.Duration) httpServer {
+	if drain == 0 {
+		drain = httpShutdownTimeout
+	}
+	server := &http.Server{Addr: address, ReadHeaderTimeout: 5 * time.Second}
+	return httpServer{&HttpService{name: name, server: server, stopTimeout: drain}}
+}
+
+// Stop shuts the server down like [HttpService.Stop], but waits for the
+// pending requests no longer than the drain of the server. Requests that
+// outlast it are logged, and their connections are closed once the service
+// is canceled
+func (s httpServer) Stop(ctx context.Context) error {
+	drainCtx, cancel := context.WithTimeout(ctx, s.stopTimeout)
+	defer cancel()
+	err := s.HttpService.Stop(drainCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		msg := "%v: closing the pending requests after %v"
+		logFilterFrom(ctx).log(logger.Warning, fmt.Sprintf(msg, s.name, s.stopTimeout),
+			"service", s.name, "event", "drain_timeout")
+		return nil
+	}
+	return err
+}
+
+// address returns the address the server listens on by its configuration
+func (s httpServer) address() string {
+	return s.server.Addr
+}
+
+// Fingerprint describes the address and the configuration of the server
+func (s httpServer) Fingerprint() string {
+	return fmt.Sprintf("%v %v %v", s.name, s.address(), s.stopTimeout)
+}
+
+// allowGet writes an error unless the request uses the GET or HEAD methods
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%v not allowed", r.Method))
+		return false
+	}
+	return true
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,280 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// HttpService runs an http.Server of the node as a service, so in-process
+// endpoints are supervised without their own start and shutdown code
+type HttpService struct {
+	name        string
+	server      *http.Server
+	listener    net.Listener
+	stopTimeout time.Duration
+	onShutdown  []func()
+
+	mutex sync.Mutex
+	addr  net.Addr
+	run   *httpRun
+	// listened is whether the listener of WithHttpListener was served, which
+	// closed it
+	listened bool
+}
+
+// httpRun is the server of a run of an HttpService, which Stop shuts down
+type httpRun struct {
+	server *http.Server
+	once   sync.Once
+	err    error
+	// stopped is closed once Stop shut the server down or gave up
+	stopped chan struct{}
+}
+
+// addressReporter is a service that listens on an address, which is reported
+// in its status
+type addressReporter interface {
+	// Addr returns the address the service listens on, or nil if it is not
+	// listening
+	Addr() net.Addr
+}
+
+// HttpOption configures an HttpService
+type HttpOption func(s *HttpService)
+
+// WithHttpListener makes the service serve on the listener instead of
+// listening on the address of the server. The listener is closed when the
+// service stops, so the service fails if it is started again
+func WithHttpListener(listener net.Listener) HttpOption {
+	return func(s *HttpService) {
+		s.listener = listener
+	}
+}
+
+// WithHttpStopTimeout sets how long the service waits for the pending
+// requests when its context is canceled before closing their connections. It
+// does not bound Stop, which the supervisor calls at the shutdown. The default
+// is [DefaultStopTimeout]
+func WithHttpStopTimeout(timeout time.Duration) HttpOption {
+	return func(s *HttpService) {
+		s.stopTimeout = timeout
+	}
+}
+
+// WithHttpOnShutdown registers a function to call when the server of each run
+// shuts down, as srv.RegisterOnShutdown would for a single run
+func WithHttpOnShutdown(f func()) HttpOption {
+	return func(s *HttpService) {
+		s.onShutdown = append(s.onShutdown, f)
+	}
+}
+
+// NewHttpService creates a service that serves the requests of srv on the
+// address of srv, or on the listener given with [WithHttpListener], until it
+// is stopped. When it stops, it shuts the server down gracefully, waiting for
+// the pending requests for its stop timeout, and then closes the connections
+// that remain. A server that closes exits successfully, while a server that
+// cannot listen fails. The service is ready once it is listening, and the
+// address it listens on is in its status, which has the port picked by the
+// system for port 0. A server with a TLSConfig serves TLS with the
+// certificates of its configuration. At the shutdown, the supervisor drains
+// the requests with Stop, for the time left for the service, instead of the
+// stop timeout.
+//
+// Since an http.Server cannot serve again once it is shut down, each run
+// serves a new server with the configuration of srv. The copy leaves out what
+// http.Server does not expose to copy: the functions registered with
+// srv.RegisterOnShutdown, which must be given with [WithHttpOnShutdown]
+// instead, and the Protocols of servers built with Go 1.24 or later, so the
+// runs serve the default protocols
+func NewHttpService(name string, srv *http.Server, opts ...HttpOption) Service {
+	s := &HttpService{name: name, server: srv}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *HttpService) String() string {
+	return s.name
+}
+
+// Validate checks that the service has a server
+func (s *HttpService) Validate() error {
+	if s.server == nil {
+		return errors.New("missing server")
+	}
+	if s.stopTimeout < 0 {
+		return errors.New("negative stop timeout")
+	}
+	return nil
+}
+
+// Start serves the requests until the context is canceled, then waits for the
+// pending ones to drain before closing their connections
+func (s *HttpService) Start(ctx context.Context) error {
+	if s.server == nil {
+		return fmt.Errorf("service '%v' has no server", s.name)
+	}
+	return s.serve(ctx, s.server.Handler)
+}
+
+// serve serves the requests with the handler on a copy of the server until
+// the context is canceled, as described for Start
+func (s *HttpService) serve(ctx context.Context, handler http.Handler) error {
+	listener := s.listener
+	if listener != nil && !s.useListener() {
+		return fmt.Errorf("service '%v' cannot serve again on its listener, which "+
+			"closed when it stopped", s.name)
+	}
+	if listener == nil {
+		address := s.server.Addr
+		if address == "" {
+			address = ":http"
+		}
+		var err error
+		listener, err = net.Listen("tcp", address)
+		if err != nil {
+			return err
+		}
+	}
+	server := cloneServer(s.server)
+	server.Handler = handler
+	for _, f := range s.onShutdown {
+		server.RegisterOnShutdown(f)
+	}
+	run := &httpRun{server: server, stopped: make(chan struct{})}
+	s.setRun(listener.Addr(), run)
+	defer s.setRun(nil, nil)
+
+	served := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			// the certificates come from the configuration of the server
+			served <- server.ServeTLS(listener, "", "")
+			return
+		}
+		served <- server.Serve(listener)
+	}()
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		// the server only closes on its own when Stop shuts it down
+		select {
+		case <-run.stopped:
+			if run.err == nil {
+				return nil
+			}
+			<-ctx.Done()
+		case <-ctx.Done():
+		}
+		_ = server.Close()
+		return nil
+	case <-ctx.Done():
+	}
+	timeout := s.stopTimeout
+	if timeout == 0 {
+		timeout = DefaultStopTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		msg := "%v: closing the pending requests after %v"
+		logFilterFrom(ctx).log(logger.Warning, fmt.Sprintf(msg, s.name, timeout),
+			"service", s.name, "event", "drain_timeout")
+		_ = server.Close()
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Ready succeeds once the server is listening
+func (s *HttpService) Ready(ctx context.Context) error {
+	if s.Addr() == nil {
+		return fmt.Errorf("%v server is not listening", s.name)
+	}
+	return nil
+}
+
+// Stop shuts the server down gracefully, waiting for the pending requests
+// until ctx is done. When it fails, the connections that remain are closed
+// once the context of Start is canceled. It does nothing while the service
+// is not running
+func (s *HttpService) Stop(ctx context.Context) error {
+	s.mutex.Lock()
+	run := s.run
+	s.mutex.Unlock()
+	if run == nil {
+		return nil
+	}
+	err := run.server.Shutdown(ctx)
+	run.once.Do(func() {
+		run.err = err
+		close(run.stopped)
+	})
+	return err
+}
+
+// Addr returns the address the server listens on, or nil if it is not
+// running
+func (s *HttpService) Addr() net.Addr {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.addr
+}
+
+// useListener reports whether the listener of WithHttpListener was not served
+// yet, marking it as served
+func (s *HttpService) useListener() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.listened {
+		return false
+	}
+	s.listened = true
+	return true
+}
+
+func (s *HttpService) setRun(addr net.Addr, run *httpRun) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.addr = addr
+	s.run = run
+}
+
+// cloneServer returns a server with the configuration of srv that has not
+// served yet. It cannot copy the functions registered with RegisterOnShutdown,
+// which are not exported, nor Protocols, which is newer than the Go of the
+// module
+func cloneServer(srv *http.Server) *http.Server {
+	return &http.Server{
+		Addr:                         srv.Addr,
+		Handler:                      srv.Handler,
+		DisableGeneralOptionsHandler: srv.DisableGeneralOptionsHandler,
+		TLSConfig:                    srv.TLSConfig,
+		ReadTimeout:                  srv.ReadTimeout,
+		ReadHeaderTimeout:            srv.ReadHeaderTimeout,
+		WriteTimeout:                 srv.WriteTimeout,
+		IdleTimeout:                  srv.IdleTimeout,
+		MaxHeaderBytes:               srv.MaxHeaderBytes,
+		TLSNextProto:                 srv.TLSNextProto,
+		ConnState:                    srv.ConnState,
+		ErrorLog:                     srv.ErrorLog,
+		BaseContext:                  srv.BaseContext,
+		ConnContext:                  srv.ConnContext,
+	}
+}
@@ -0,0 +1,312 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHttpService(t *testing.T) {
+
+	// serve starts the service in the background, returning its exit once it
+	// is listening
+	serve := func(t *testing.T, service Service) (*HttpService, context.CancelFunc, chan error) {
+		t.Helper()
+		ctx, cancel := context.WithCancel(context.Background())
+		exited := make(chan error, 1)
+		go func() {
+			exited <- service.Start(ctx)
+		}()
+		httpService := service.(*HttpService)
+		deadline := time.Now().Add(2 * time.Second)
+		for httpService.Ready(ctx) != nil {
+			if time.Now().After(deadline) {
+				t.Fatal("expected the server to listen")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return httpService, cancel, exited
+	}
+
+	t.Run("it drains the pending requests when it stops", func(t *testing.T) {
+		received := make(chan struct{})
+		release := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			<-release
+			_, _ = io.WriteString(w, "drained")
+		})
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: handler}
+		service, cancel, exited := serve(t, NewHttpService("api", server))
+		responses := make(chan string, 1)
+		go func() {
+			response, err := http.Get("http://" + service.Addr().String())
+			if err != nil {
+				responses <- err.Error()
+				return
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+			responses <- string(body)
+		}()
+		<-received
+		cancel()
+		select {
+		case err := <-exited:
+			t.Fatalf("expected the service to wait for the request, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+		if body := <-responses; body != "drained" {
+			t.Fatalf("expected the pending request to complete, got %q", body)
+		}
+		if err := <-exited; err != nil {
+			t.Fatalf("expected the service to exit successfully, got %v", err)
+		}
+		if service.Addr() != nil {
+			t.Fatalf("expected no address once stopped, got %v", service.Addr())
+		}
+	})
+
+	t.Run("it closes the pending requests after the stop timeout", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: handler}
+		service, cancel, exited := serve(t, NewHttpService("api", server,
+			WithHttpStopTimeout(50*time.Millisecond)))
+		failed := make(chan error, 1)
+		go func() {
+			response, err := http.Get("http://" + service.Addr().String())
+			if err == nil {
+				response.Body.Close()
+			}
+			failed <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-exited:
+			if err != nil {
+				t.Fatalf("expected the service to exit successfully, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the service to stop after its stop timeout")
+		}
+		if err := <-failed; err == nil {
+			t.Fatal("expected the pending request to be closed")
+		}
+	})
+
+	t.Run("it drains the pending requests when it is stopped", func(t *testing.T) {
+		received := make(chan struct{})
+		release := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(received)
+			<-release
+			_, _ = io.WriteString(w, "drained")
+		})
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: handler}
+		service, cancel, exited := serve(t, NewHttpService("api", server))
+		defer cancel()
+		responses := make(chan string, 1)
+		go func() {
+			response, err := http.Get("http://" + service.Addr().String())
+			if err != nil {
+				responses <- err.Error()
+				return
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+			responses <- string(body)
+		}()
+		<-received
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- service.Stop(context.Background())
+		}()
+		select {
+		case err := <-exited:
+			t.Fatalf("expected the service to wait for the request, got %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(release)
+		if body := <-responses; body != "drained" {
+			t.Fatalf("expected the pending request to complete, got %q", body)
+		}
+		if err := <-stopped; err != nil {
+			t.Fatalf("expected Stop to succeed, got %v", err)
+		}
+		if err := <-exited; err != nil {
+			t.Fatalf("expected the service to exit successfully, got %v", err)
+		}
+	})
+
+	t.Run("it closes the pending requests once canceled after Stop fails", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: handler}
+		service, cancel, exited := serve(t, NewHttpService("api", server))
+		failed := make(chan error, 1)
+		go func() {
+			response, err := http.Get("http://" + service.Addr().String())
+			if err == nil {
+				response.Body.Close()
+			}
+			failed <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		ctx, cancelStop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancelStop()
+		if err := service.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected Stop to time out, got %v", err)
+		}
+		select {
+		case err := <-exited:
+			t.Fatalf("expected the service to wait for the cancelation, got %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+		cancel()
+		if err := <-exited; err != nil {
+			t.Fatalf("expected the service to exit successfully, got %v", err)
+		}
+		if err := <-failed; err == nil {
+			t.Fatal("expected the pending request to be closed")
+		}
+	})
+
+	t.Run("it fails when it cannot listen", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		server := &http.Server{Addr: listener.Addr().String()}
+		err = NewHttpService("api", server).Start(context.Background())
+		if err == nil {
+			t.Fatal("expected the service to fail to listen")
+		}
+	})
+
+	t.Run("it serves on the given listener", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		server := &http.Server{Handler: http.NotFoundHandler()}
+		service, cancel, exited := serve(t, NewHttpService("api", server,
+			WithHttpListener(listener)))
+		if service.Addr().String() != listener.Addr().String() {
+			t.Fatalf("expected the address of the listener, got %v", service.Addr())
+		}
+		cancel()
+		if err := <-exited; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		err = service.Start(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "cannot serve again on its listener") {
+			t.Fatalf("expected the closed listener to be refused, got %v", err)
+		}
+	})
+
+	t.Run("it calls the shutdown functions of each run", func(t *testing.T) {
+		shutdowns := make(chan struct{}, 2)
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+		httpService := NewHttpService("api", server, WithHttpOnShutdown(func() {
+			shutdowns <- struct{}{}
+		}))
+		for i := 0; i < 2; i++ {
+			_, cancel, exited := serve(t, httpService)
+			cancel()
+			if err := <-exited; err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			select {
+			case <-shutdowns:
+			case <-time.After(time.Second):
+				t.Fatalf("expected run %v to call the shutdown function", i)
+			}
+		}
+	})
+
+	t.Run("it serves TLS when the server has a TLS configuration", func(t *testing.T) {
+		certified := httptest.NewUnstartedServer(http.NotFoundHandler())
+		certified.StartTLS()
+		defer certified.Close()
+		server := &http.Server{
+			Addr:      "127.0.0.1:0",
+			Handler:   http.NotFoundHandler(),
+			TLSConfig: certified.TLS,
+		}
+		service, cancel, exited := serve(t, NewHttpService("api", server))
+		client := certified.Client()
+		response, err := client.Get("https://" + service.Addr().String())
+		if err != nil {
+			t.Fatalf("expected the server to serve TLS, got %v", err)
+		}
+		response.Body.Close()
+		if response.TLS == nil {
+			t.Fatal("expected a TLS connection")
+		}
+		cancel()
+		if err := <-exited; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it fails when the TLS configuration has no certificates", func(t *testing.T) {
+		server := &http.Server{Addr: "127.0.0.1:0", TLSConfig: &tls.Config{}}
+		err := NewHttpService("api", server).Start(context.Background())
+		if err == nil {
+			t.Fatal("expected the service to fail without certificates")
+		}
+	})
+
+	t.Run("it serves again after it stops", func(t *testing.T) {
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+		httpService := NewHttpService("api", server)
+		for i := 0; i < 2; i++ {
+			service, cancel, exited := serve(t, httpService)
+			response, err := http.Get("http://" + service.Addr().String())
+			if err != nil {
+				t.Fatalf("expected run %v to serve, got %v", i, err)
+			}
+			response.Body.Close()
+			cancel()
+			if err := <-exited; err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	})
+
+	t.Run("it reports the address in the status", func(t *testing.T) {
+		setup()
+		server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+		supervisor := NewSupervisor([]Service{NewHttpService("api", server)})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		status := supervisor.Status()[0]
+		if !strings.HasPrefix(status.Address, "127.0.0.1:") ||
+			status.Address == "127.0.0.1:0" {
+			t.Fatalf("expected the address picked by the system, got %q", status.Address)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status := supervisor.Status()[0]; status.Address != "" {
+			t.Fatalf("expected no address once stopped, got %q", status.Address)
+		}
+	})
+}
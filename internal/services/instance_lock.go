@@ -0,0 +1,116 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrInstanceLocked is returned by Run when another node holds its instance
+// lock (see [WithInstanceLock])
+var ErrInstanceLocked = errors.New("another node is running")
+
+// errLocked is returned by lockFile when the file is locked by another
+// process
+var errLocked = errors.New("the file is locked")
+
+// instanceLockName is the name of the default instance lock
+const instanceLockName = "cartesi-rollups-node.lock"
+
+// DefaultInstanceLockPath returns the path of the instance lock used when
+// WithInstanceLock is given no path, which is in XDG_RUNTIME_DIR or, when it
+// is not set, in the temporary directory
+func DefaultInstanceLockPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, instanceLockName)
+}
+
+// WithInstanceLock makes Run hold an exclusive lock on the file at path while
+// it runs, so that a second node started by mistake does not run the same
+// services against the same database. Before it starts any service, Run locks
+// the file and writes its PID to it, or fails with [ErrInstanceLocked], naming
+// the PID of the other node, when the file is locked. The lock is released
+// when Run returns. The lock is held by the open file itself, so the file left
+// behind by a node that crashed does not lock out the next one. The path is
+// DefaultInstanceLockPath when it is empty
+func WithInstanceLock(path string) RunOption {
+	return func(c *runConfig) {
+		if path == "" {
+			path = DefaultInstanceLockPath()
+		}
+		c.instanceLock = path
+	}
+}
+
+// instanceLock is the lock held by a running node
+type instanceLock struct {
+	path string
+	file *os.File
+}
+
+// acquireInstanceLock locks the file at path, creating it when it does not
+// exist, and writes the PID of the node to it
+func acquireInstanceLock(path string) (*instanceLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(file); err != nil {
+		_ = file.Close()
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("%w: %v is held by %v", ErrInstanceLocked, path,
+				lockHolder(path))
+		}
+		return nil, err
+	}
+	pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+	if err := file.Truncate(0); err == nil {
+		_, err = file.WriteAt(pid, 0)
+	}
+	if err != nil {
+		_ = unlockFile(file)
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to write the PID to %v: %w", path, err)
+	}
+	return &instanceLock{path: path, file: file}, nil
+}
+
+// lockHolder describes the process that holds the lock at path by the PID
+// written to the file, which may not have been written yet
+func lockHolder(path string) string {
+	content, err := os.ReadFile(path)
+	pid := strings.TrimSpace(string(content))
+	if err != nil || pid == "" {
+		return "another process"
+	}
+	return "the process " + pid
+}
+
+// release clears the PID of the file and unlocks it. The file is kept, since
+// removing it would let a node starting at the same time lock a file that
+// another node is about to create again
+func (l *instanceLock) release() error {
+	if l == nil {
+		return nil
+	}
+	err := l.file.Truncate(0)
+	if unlockErr := unlockFile(l.file); err == nil {
+		err = unlockErr
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
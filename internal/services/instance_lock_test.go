@@ -0,0 +1,111 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInstanceLock(t *testing.T) {
+
+	// indexer creates a service that runs until it is stopped and counts its
+	// starts
+	indexer := func(starts *atomic.Int32) Service {
+		return testService{name: "indexer", start: func(ctx context.Context) error {
+			starts.Add(1)
+			<-ctx.Done()
+			return nil
+		}}
+	}
+
+	t.Run("it refuses to start a second node", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "run", "node.lock")
+		var firstStarts, secondStarts atomic.Int32
+		first := NewSupervisor([]Service{indexer(&firstStarts)}, WithInstanceLock(path))
+		if err := first.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer first.Stop(context.Background()) //nolint:errcheck
+
+		second := NewSupervisor([]Service{indexer(&secondStarts)}, WithInstanceLock(path))
+		start := time.Now()
+		err := second.Start(context.Background())
+		if !errors.Is(err, ErrInstanceLocked) {
+			t.Fatalf("expected the lock to be held, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the second node to fail fast, took %v", elapsed)
+		}
+		expected := fmt.Sprintf("%v is held by the process %v", path, os.Getpid())
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the error to name the other node, got %v", err)
+		}
+		if secondStarts.Load() != 0 {
+			t.Fatal("expected the second node to not start its services")
+		}
+		if err := second.Wait(); !errors.Is(err, ErrInstanceLocked) {
+			t.Fatalf("expected Wait to return the error, got %v", err)
+		}
+	})
+
+	t.Run("it releases the lock when the node stops", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node.lock")
+		var starts atomic.Int32
+		for i := 0; i < 2; i++ {
+			supervisor := NewSupervisor([]Service{indexer(&starts)}, WithInstanceLock(path))
+			if err := supervisor.Start(context.Background()); err != nil {
+				t.Fatalf("expected node %v to start, got %v", i, err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil || strings.TrimSpace(string(content)) != fmt.Sprint(os.Getpid()) {
+				t.Fatalf("expected the PID in the lock, got %q (%v)", content, err)
+			}
+			if err := supervisor.Stop(context.Background()); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		if content, err := os.ReadFile(path); err != nil || len(content) != 0 {
+			t.Fatalf("expected the PID to be cleared, got %q (%v)", content, err)
+		}
+	})
+
+	t.Run("it takes over the lock left by a node that crashed", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node.lock")
+		if err := os.WriteFile(path, []byte("999999\n"), 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		service := testService{name: "migrate", start: func(ctx context.Context) error {
+			content, err := os.ReadFile(path)
+			if err != nil || string(content) != fmt.Sprintln(os.Getpid()) {
+				return fmt.Errorf("expected the PID of the node, got %q (%v)", content, err)
+			}
+			return nil
+		}}
+		if err := Run(context.Background(), []Service{service},
+			WithInstanceLock(path)); err != nil {
+			t.Fatalf("expected the stale lock to be taken over, got %v", err)
+		}
+	})
+
+	t.Run("it defaults to the runtime directory", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("XDG_RUNTIME_DIR", dir)
+		var config runConfig
+		WithInstanceLock("")(&config)
+		if config.instanceLock != filepath.Join(dir, "cartesi-rollups-node.lock") {
+			t.Fatalf("expected the lock in the runtime directory, got %v", config.instanceLock)
+		}
+	})
+}
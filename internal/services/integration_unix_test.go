@@ -0,0 +1,642 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// recorder is the helper binary built from testdata/recorder, compiled once
+// for all the integration tests
+var recorder struct {
+	once sync.Once
+	dir  string
+	path string
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if recorder.dir != "" {
+		_ = os.RemoveAll(recorder.dir)
+	}
+	os.Exit(code)
+}
+
+// recorderPath builds the recorder, or skips the test if there is no Go
+// toolchain to build it
+func recorderPath(t *testing.T) string {
+	t.Helper()
+	recorder.once.Do(func() {
+		goBinary, err := exec.LookPath("go")
+		if err != nil {
+			recorder.err = err
+			return
+		}
+		recorder.dir, recorder.err = os.MkdirTemp("", "recorder")
+		if recorder.err != nil {
+			return
+		}
+		recorder.path = filepath.Join(recorder.dir, "recorder")
+		build := exec.Command(goBinary, "build", "-o", recorder.path, "./testdata/recorder")
+		if output, err := build.CombinedOutput(); err != nil {
+			recorder.err = fmt.Errorf("%w: %s", err, output)
+		}
+	})
+	if errors.Is(recorder.err, exec.ErrNotFound) {
+		t.Skip("the test needs the go command to build the recorder")
+	}
+	if recorder.err != nil {
+		t.Fatalf("failed to build the recorder: %v", recorder.err)
+	}
+	return recorder.path
+}
+
+// integration runs the real supervisor against recorder processes, which
+// write what happens to them to a journal the test inspects
+type integration struct {
+	t       *testing.T
+	dir     string
+	journal string
+	binary  string
+}
+
+func newIntegration(t *testing.T) *integration {
+	dir := t.TempDir()
+	h := &integration{
+		t:       t,
+		dir:     dir,
+		journal: filepath.Join(dir, "journal"),
+		binary:  recorderPath(t),
+	}
+	// the recorders that outlive the test are killed
+	t.Cleanup(func() {
+		for _, entry := range h.entries() {
+			if entry.event == "start" {
+				_ = signalPID(entry.pid, syscall.SIGKILL)
+			}
+		}
+	})
+	return h
+}
+
+// recorderBehavior is what a recorder does besides recording its events
+type recorderBehavior struct {
+	// ExitAfter makes the recorder exit on its own, and ExitCode is the code
+	// of that exit and of the exit on SIGUSR1
+	ExitAfter time.Duration
+	ExitCode  int
+
+	// IgnoreTerm makes the recorder ignore the stop signal
+	IgnoreTerm bool
+
+	// StopDelay is how long the recorder takes to exit after the stop signal
+	StopDelay time.Duration
+}
+
+// service creates a command service that runs a recorder, which is ready once
+// it recorded its start and is able to record the signals
+func (h *integration) service(
+	name string,
+	behavior recorderBehavior,
+	opts ...CommandOption,
+) Service {
+	ready := filepath.Join(h.dir, name+".ready")
+	args := []string{
+		"-name", name,
+		"-journal", h.journal,
+		"-ready", ready,
+		"-exit-after", behavior.ExitAfter.String(),
+		"-exit-code", strconv.Itoa(behavior.ExitCode),
+		"-stop-delay", behavior.StopDelay.String(),
+		fmt.Sprintf("-ignore-term=%v", behavior.IgnoreTerm),
+	}
+	probe := readinessFunc(func(ctx context.Context) error {
+		_, err := os.Stat(ready)
+		return err
+	})
+	opts = append([]CommandOption{WithArgs(args...), WithProbe(probe)}, opts...)
+	return NewCommandService(name, h.binary, opts...)
+}
+
+// signal sends the signal to the last recorder of the service, which exits
+// with its exit code on SIGUSR1
+func (h *integration) signal(service string, sig syscall.Signal) {
+	h.t.Helper()
+	var pid int
+	for _, entry := range h.entries() {
+		if entry.event == "start" && entry.service == service {
+			pid = entry.pid
+		}
+	}
+	if pid == 0 {
+		h.t.Fatalf("expected %v to be started", service)
+	}
+	if err := signalPID(pid, sig); err != nil {
+		h.t.Fatalf("failed to signal %v: %v", service, err)
+	}
+}
+
+// journalEntry is an event recorded by a recorder
+type journalEntry struct {
+	time    time.Time
+	event   string
+	service string
+	pid     int
+	detail  string
+}
+
+func (e journalEntry) String() string {
+	if e.event == "start" {
+		return fmt.Sprintf("start %v", e.service)
+	}
+	return fmt.Sprintf("%v %v %v", e.event, e.service, e.detail)
+}
+
+// entries reads the journal in the order of the events
+func (h *integration) entries() []journalEntry {
+	content, err := os.ReadFile(h.journal)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		h.t.Fatalf("failed to read the journal: %v", err)
+	}
+	var entries []journalEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			h.t.Fatalf("malformed journal line %q", line)
+		}
+		nanos, _ := strconv.ParseInt(fields[0], 10, 64)
+		pid, _ := strconv.Atoi(fields[3])
+		entries = append(entries, journalEntry{
+			time:    time.Unix(0, nanos),
+			event:   fields[1],
+			service: fields[2],
+			pid:     pid,
+			detail:  fields[4],
+		})
+	}
+	return entries
+}
+
+// sequence returns the events of the kinds in the order they happened
+func (h *integration) sequence(events ...string) []string {
+	var sequence []string
+	for _, entry := range h.entries() {
+		for _, event := range events {
+			if entry.event == event {
+				sequence = append(sequence, entry.String())
+			}
+		}
+	}
+	return sequence
+}
+
+// find returns the first entry that matches the description, such as
+// "signal indexer TERM"
+func (h *integration) find(description string) (journalEntry, bool) {
+	for _, entry := range h.entries() {
+		if entry.String() == description {
+			return entry, true
+		}
+	}
+	return journalEntry{}, false
+}
+
+// waitFor waits until the journal has count entries of the event of the
+// service
+func (h *integration) waitFor(event string, service string, count int) {
+	h.t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		found := 0
+		for _, entry := range h.entries() {
+			if entry.event == event && entry.service == service {
+				found++
+			}
+		}
+		if found >= count {
+			return
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("expected %v %v events of %v, got %v", count, event, service,
+				h.sequence("start", "signal", "exit"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectSequence checks the events of the kinds in the journal
+func (h *integration) expectSequence(expected []string, events ...string) {
+	h.t.Helper()
+	if sequence := h.sequence(events...); !reflect.DeepEqual(sequence, expected) {
+		h.t.Fatalf("expected the events %q, got %q", expected, sequence)
+	}
+}
+
+func TestIntegration(t *testing.T) {
+
+	t.Run("it starts every service after the previous one is ready", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("indexer", recorderBehavior{}),
+			h.service("server", recorderBehavior{}),
+		})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.expectSequence([]string{"start database", "start indexer", "start server"}, "start")
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it stops the services in the reverse order", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("indexer", recorderBehavior{StopDelay: 50 * time.Millisecond}),
+			h.service("server", recorderBehavior{StopDelay: 50 * time.Millisecond}),
+		})
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.expectSequence([]string{
+			"signal server TERM", "exit server 0",
+			"signal indexer TERM", "exit indexer 0",
+			"signal database TERM", "exit database 0",
+		}, "signal", "exit")
+	})
+
+	t.Run("it stops the other services after the first exit", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("indexer", recorderBehavior{ExitCode: 3}),
+			h.service("server", recorderBehavior{}),
+		})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.signal("indexer", syscall.SIGUSR1)
+		err := supervisor.Wait()
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Service != "indexer" || exitErr.ExitCode != 3 {
+			t.Fatalf("expected the exit error of the indexer, got %v", err)
+		}
+		// the database and the server no longer depend on each other once the
+		// indexer between them exited, so they are stopped at once
+		sequence := h.sequence("signal", "exit")
+		if len(sequence) > 2 {
+			sort.Strings(sequence[2:])
+		}
+		expected := []string{
+			"signal indexer USR1", "exit indexer 3",
+			"exit database 0", "exit server 0",
+			"signal database TERM", "signal server TERM",
+		}
+		if !reflect.DeepEqual(sequence, expected) {
+			t.Fatalf("expected the events %q, got %q", expected, sequence)
+		}
+	})
+
+	t.Run("it kills the services after their grace period", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("stubborn", recorderBehavior{IgnoreTerm: true},
+				WithGracePeriod(200*time.Millisecond)),
+		})
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the stubborn service is killed, so it never records its exit
+		h.expectSequence([]string{
+			"signal stubborn TERM",
+			"signal database TERM", "exit database 0",
+		}, "signal", "exit")
+		signaled, _ := h.find("signal stubborn TERM")
+		next, _ := h.find("signal database TERM")
+		if elapsed := next.time.Sub(signaled.time); elapsed < 200*time.Millisecond {
+			t.Fatalf("expected the grace period before the kill, got %v", elapsed)
+		}
+	})
+
+	t.Run("it abandons the services after the stop timeout", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("stubborn", recorderBehavior{IgnoreTerm: true},
+				WithGracePeriod(time.Minute)),
+		}, WithStopTimeout(300*time.Millisecond), WithStopStepTimeout(100*time.Millisecond))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		start := time.Now()
+		cancel()
+		err := supervisor.Wait()
+		if !errors.Is(err, ErrStopTimeout) || !strings.Contains(err.Error(), "stubborn") {
+			t.Fatalf("expected the stubborn service to time out, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected the shutdown to stop at the timeout, took %v", elapsed)
+		}
+		// the next service is stopped once the step timeout expires
+		h.expectSequence([]string{
+			"signal stubborn TERM",
+			"signal database TERM", "exit database 0",
+		}, "signal", "exit")
+		h.signal("stubborn", syscall.SIGKILL)
+		waitForLog(t, &out, "service 'stubborn' exited after the shutdown timeout")
+	})
+
+	t.Run("it restarts the failing services", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		backoff := Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond,
+			Reset: time.Minute}
+		flaky := Restart(h.service("flaky", recorderBehavior{ExitAfter: 50 * time.Millisecond,
+			ExitCode: 1}), RestartOnFailure)
+		supervisor := NewSupervisor([]Service{h.service("database", recorderBehavior{}), flaky},
+			WithRestartOnFailure(backoff))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.waitFor("start", "flaky", 3)
+		cancel()
+		// the flaky service may fail on its own while it is stopped
+		var exitErr *ExitError
+		if err := supervisor.Wait(); err != nil && !errors.As(err, &exitErr) {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, entry := range h.entries() {
+			if entry.service == "database" && entry.event != "start" {
+				if entry.String() != "signal database TERM" && entry.String() != "exit database 0" {
+					t.Fatalf("expected the database to only be stopped, got %v", entry)
+				}
+			}
+		}
+		if _, ok := h.find("exit database 0"); !ok {
+			t.Fatalf("expected the database to be stopped, got %q",
+				h.sequence("start", "signal", "exit"))
+		}
+	})
+
+	t.Run("it keeps the node running while a service restarts in place", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		backoff := Backoff{Initial: 200 * time.Millisecond, Max: 200 * time.Millisecond,
+			Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{
+			Fatal(h.service("database", recorderBehavior{})),
+			h.service("inspect-server", recorderBehavior{ExitCode: 1}),
+			h.service("advance-runner", recorderBehavior{}),
+		}, WithRestartOnFailure(backoff))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.signal("inspect-server", syscall.SIGUSR1)
+		h.waitFor("start", "inspect-server", 2)
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the other services only see the shutdown
+		h.expectSequence([]string{
+			"start database", "start inspect-server", "start advance-runner",
+			"signal inspect-server USR1", "exit inspect-server 1", "start inspect-server",
+			"signal advance-runner TERM", "exit advance-runner 0",
+			"signal inspect-server TERM", "exit inspect-server 0",
+			"signal database TERM", "exit database 0",
+		}, "start", "signal", "exit")
+		status := supervisor.Status()[1]
+		if status.Restarts != 1 || status.Degraded < 200*time.Millisecond {
+			t.Fatalf("expected the degraded period in the status, got %+v", status)
+		}
+	})
+
+	t.Run("it stops the node when a fatal service fails in place", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		backoff := Backoff{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond,
+			Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{
+			Fatal(h.service("database", recorderBehavior{ExitCode: 3})),
+			h.service("inspect-server", recorderBehavior{}),
+		}, WithRestartOnFailure(backoff))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.signal("database", syscall.SIGUSR1)
+		err := supervisor.Wait()
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Service != "database" || exitErr.ExitCode != 3 {
+			t.Fatalf("expected the exit error of the database, got %v", err)
+		}
+		h.expectSequence([]string{
+			"start database", "start inspect-server",
+			"signal database USR1", "exit database 3",
+			"signal inspect-server TERM", "exit inspect-server 0",
+		}, "start", "signal", "exit")
+	})
+
+	t.Run("it stops the node promptly during a pending restart", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		backoff := Backoff{Initial: time.Minute, Max: time.Minute, Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("inspect-server", recorderBehavior{ExitCode: 1}),
+		}, WithRestartOnFailure(backoff))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.signal("inspect-server", syscall.SIGUSR1)
+		h.waitFor("exit", "inspect-server", 1)
+		waitForStates(t, supervisor, StateReady, StateFailed)
+		start := time.Now()
+		cancel()
+		var exitErr *ExitError
+		if err := supervisor.Wait(); !errors.As(err, &exitErr) ||
+			exitErr.Service != "inspect-server" {
+			t.Fatalf("expected the last exit of the inspect-server, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected the shutdown to skip the restart, took %v", elapsed)
+		}
+		h.expectSequence([]string{
+			"start database", "start inspect-server",
+			"signal inspect-server USR1", "exit inspect-server 1",
+			"signal database TERM", "exit database 0",
+		}, "start", "signal", "exit")
+	})
+
+	t.Run("it restarts a single service through the admin server", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		address := freeAddress(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("indexer", recorderBehavior{}),
+			h.service("server", recorderBehavior{}),
+		}, WithAdminServer(address))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		url := "http://" + address + "/services/indexer/restart"
+		response, err := http.Post(url, "application/json", nil)
+		if err != nil {
+			t.Fatalf("failed to restart the indexer: %v", err)
+		}
+		var body StatusResponse
+		_ = json.NewDecoder(response.Body).Decode(&body)
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK || body.Restarts != 1 {
+			t.Fatalf("expected the status of the restarted indexer, got %v: %+v",
+				response.Status, body)
+		}
+		h.expectSequence([]string{
+			"start database", "start indexer", "start server",
+			"signal indexer TERM", "exit indexer 0",
+			"start indexer",
+		}, "start", "signal", "exit")
+		if supervisor.ShutdownCause() != nil {
+			t.Fatalf("expected the node to keep running, got %v", supervisor.ShutdownCause())
+		}
+
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, service := range []string{"database", "server"} {
+			sequence := []string{}
+			for _, entry := range h.entries() {
+				if entry.service == service {
+					sequence = append(sequence, entry.String())
+				}
+			}
+			expected := []string{"start " + service, "signal " + service + " TERM",
+				"exit " + service + " 0"}
+			if !reflect.DeepEqual(sequence, expected) {
+				t.Fatalf("expected %v to be untouched, got %q", service, sequence)
+			}
+		}
+	})
+
+	t.Run("it dumps the goroutines of a service through the admin server", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		h := newIntegration(t)
+		address := freeAddress(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("indexer", recorderBehavior{}),
+		}, WithAdminServer(address))
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		url := "http://" + address + "/services/indexer/signal?signal=QUIT"
+		response, err := http.Post(url, "application/json", nil)
+		if err != nil {
+			t.Fatalf("failed to signal the indexer: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			t.Fatalf("expected the indexer to be signaled, got %v", response.Status)
+		}
+		h.waitFor("signal", "indexer", 1)
+		waitForLog(t, &out, "WARN indexer | SIGQUIT: goroutine dump of indexer")
+		waitForLog(t, &out, "WARN indexer | goroutine 1 [")
+
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		h.expectSequence([]string{
+			"start database", "start indexer",
+			"signal indexer QUIT",
+			"signal indexer TERM", "exit indexer 0",
+			"signal database TERM", "exit database 0",
+		}, "start", "signal", "exit")
+	})
+
+	t.Run("it classifies the services that were killed", func(t *testing.T) {
+		setup()
+		h := newIntegration(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		supervisor := NewSupervisor([]Service{
+			h.service("database", recorderBehavior{}),
+			h.service("stubborn", recorderBehavior{IgnoreTerm: true},
+				WithGracePeriod(100*time.Millisecond)),
+			Optional(h.service("victim", recorderBehavior{})),
+		})
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the victim is killed by someone else, like the OOM killer
+		h.signal("victim", syscall.SIGKILL)
+		waitForStates(t, supervisor, StateReady, StateReady, StateFailed)
+		cancel()
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := map[string]ExitReason{
+			"database": ExitReasonCanceled,
+			"stubborn": ExitReasonKilled,
+			"victim":   ExitReasonKilled,
+		}
+		for _, status := range supervisor.Status() {
+			if status.ExitReason != expected[status.Name] {
+				t.Errorf("expected %v to be %v, got %v", status.Name, expected[status.Name],
+					status.ExitReason)
+			}
+		}
+	})
+}
@@ -0,0 +1,253 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// Defaults of the journal of the supervisor
+const (
+	DefaultJournalMaxSize  = 10 * 1024 * 1024
+	DefaultJournalMaxFiles = 3
+)
+
+// journalBuffer is how many entries wait to be written before the new ones
+// are dropped
+const journalBuffer = 1024
+
+// journalCloseTimeout is how long the supervisor waits for the entries that
+// are left to be written when it finishes
+const journalCloseTimeout = time.Second
+
+// JournalConfig configures the file where the supervisor records the events
+// of the services (see [WithJournal])
+type JournalConfig struct {
+	// Path is the path of the file. Its directory is created if needed
+	Path string
+
+	// MaxSize is the size in bytes after which the file is rotated to
+	// Path.1. The default is DefaultJournalMaxSize
+	MaxSize int64
+
+	// MaxFiles is how many rotated files are kept besides the current one.
+	// The default is DefaultJournalMaxFiles
+	MaxFiles int
+}
+
+// WithJournal makes Run append every event of the services and of the
+// supervisor to a file, one JSON object per line (see [JournalEntry]), so what
+// happened before the node crashed can be reconstructed from the disk. Each
+// entry is written as soon as possible, but the journal never blocks the
+// supervision: entries are dropped when the disk cannot keep up, and the
+// journal is disabled after the first error, which is logged. Use
+// [ReadJournal] to read it back
+func WithJournal(config JournalConfig) RunOption {
+	return func(c *runConfig) {
+		c.journal = &config
+	}
+}
+
+// JournalEntry is a line of the journal, which is a [ServiceEvent] as JSON
+type JournalEntry struct {
+	Time    time.Time    `json:"time"`
+	Event   EventKind    `json:"event"`
+	Service string       `json:"service,omitempty"`
+	From    ServiceState `json:"from,omitempty"`
+	To      ServiceState `json:"to,omitempty"`
+
+	// ExitCode is the exit code of the service for [EventExited], or of the
+	// node for [EventShutdownCompleted], as a shell would report it
+	ExitCode *int `json:"exit_code,omitempty"`
+
+	// Signal is the name of the signal of [EventSignalSent], such as SIGTERM
+	Signal string `json:"signal,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// newJournalEntry converts the event to an entry of the journal
+func newJournalEntry(event ServiceEvent) JournalEntry {
+	entry := JournalEntry{
+		Time:    event.Time,
+		Event:   event.Kind,
+		Service: event.Service,
+		From:    event.From,
+		To:      event.To,
+	}
+	if event.Kind == EventExited || event.Kind == EventShutdownCompleted {
+		code := exitCode(event.Err)
+		entry.ExitCode = &code
+	}
+	if event.Signal != nil {
+		entry.Signal = signalName(event.Signal)
+	}
+	if event.Err != nil {
+		entry.Error = event.Err.Error()
+	}
+	return entry
+}
+
+// signalName returns the name of the signal, such as SIGTERM
+func signalName(sig os.Signal) string {
+	for name, signal := range stopSignals {
+		if signal == sig {
+			return name
+		}
+	}
+	return sig.String()
+}
+
+// journal writes the entries in the background, so the events are published
+// without waiting for the disk. Its methods do nothing when it is nil
+type journal struct {
+	file    *rotatingFile
+	entries chan JournalEntry
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	// disabled is set after the first write error
+	disabled atomic.Bool
+}
+
+// openJournal opens the journal, appending to it if it already exists
+func openJournal(config JournalConfig) (*journal, error) {
+	if config.Path == "" {
+		return nil, errors.New("the journal has no path")
+	}
+	maxSize, maxFiles := config.MaxSize, config.MaxFiles
+	if maxSize == 0 {
+		maxSize = DefaultJournalMaxSize
+	}
+	if maxFiles == 0 {
+		maxFiles = DefaultJournalMaxFiles
+	}
+	file, err := newRotatingFile(config.Path, maxSize, maxFiles)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{
+		file:    file,
+		entries: make(chan JournalEntry, journalBuffer),
+		done:    make(chan struct{}),
+	}
+	go j.write()
+	return j, nil
+}
+
+// record queues the event to be written, or drops it if the queue is full or
+// the journal is disabled
+func (j *journal) record(event ServiceEvent) {
+	if j == nil || j.disabled.Load() {
+		return
+	}
+	select {
+	case j.entries <- newJournalEntry(event):
+	default:
+		j.dropped.Add(1)
+	}
+}
+
+func (j *journal) write() {
+	defer close(j.done)
+	for entry := range j.entries {
+		if j.disabled.Load() {
+			continue
+		}
+		line, err := json.Marshal(entry)
+		if err == nil {
+			_, err = j.file.Write(append(line, '\n'))
+		}
+		if err != nil {
+			j.disabled.Store(true)
+			msg := fmt.Sprintf("main: failed to write to the journal %v: %v; disabling it",
+				j.file.path, err)
+			logger.Log(logger.Warning, msg, "event", "journal_error", "error", err)
+		}
+	}
+	if err := j.file.Close(); err != nil && !j.disabled.Load() {
+		msg := fmt.Sprintf("main: failed to close the journal %v: %v", j.file.path, err)
+		logger.Log(logger.Warning, msg, "event", "journal_error", "error", err)
+	}
+}
+
+// close waits for the queued entries to be written for a while and closes the
+// file. It must be called once, after the last entry was recorded
+func (j *journal) close() {
+	if j == nil {
+		return
+	}
+	close(j.entries)
+	select {
+	case <-j.done:
+	case <-time.After(journalCloseTimeout):
+		msg := fmt.Sprintf("main: the journal %v was not written in %v", j.file.path,
+			journalCloseTimeout)
+		logger.Log(logger.Warning, msg, "event", "journal_error")
+	}
+	if dropped := j.dropped.Load(); dropped > 0 {
+		msg := fmt.Sprintf("main: dropped %v entries of the journal %v", dropped, j.file.path)
+		logger.Log(logger.Warning, msg, "event", "journal_dropped", "dropped", dropped)
+	}
+}
+
+// ReadJournal reads the entries of the journal at path, including the ones of
+// its rotated files, from the oldest to the newest. A last line that was cut
+// short, as a crash of the node may leave it, is ignored
+func ReadJournal(path string) ([]JournalEntry, error) {
+	paths := []string{path}
+	for i := 1; ; i++ {
+		rotated := fmt.Sprintf("%v.%v", path, i)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		paths = append([]string{rotated}, paths...)
+	}
+	var entries []JournalEntry
+	for _, path := range paths {
+		read, err := readJournalFile(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	return entries, nil
+}
+
+func readJournalFile(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var entries []JournalEntry
+	for number := 1; ; number++ {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%v:%v: %w", path, number, err)
+		}
+		entries = append(entries, entry)
+	}
+}
@@ -0,0 +1,227 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestJournal(t *testing.T) {
+
+	// events returns the events of the entries as "event service" pairs
+	events := func(entries []JournalEntry) []string {
+		var events []string
+		for _, entry := range entries {
+			events = append(events, strings.TrimSpace(fmt.Sprintf("%v %v", entry.Event,
+				entry.Service)))
+		}
+		return events
+	}
+
+	t.Run("it records a crash so it can be replayed", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "journal", "events.jsonl")
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		crash := make(chan struct{})
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-crash
+			return &ExitError{Service: "indexer", ExitCode: 2}
+		}}
+		supervisor := NewSupervisor([]Service{database, indexer}, WithJournal(JournalConfig{
+			Path: path,
+		}))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		close(crash)
+		if err := supervisor.Wait(); err == nil {
+			t.Fatal("expected the crash to be returned")
+		}
+
+		entries, err := ReadJournal(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{
+			"started database", "ready database", "started indexer", "ready indexer",
+			"exited indexer", "shutdown_started indexer", "stopping database",
+			"exited database", "shutdown_completed",
+		}
+		if got := events(entries); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the events %v, got %v", expected, got)
+		}
+		crashed := entries[4]
+		if crashed.ExitCode == nil || *crashed.ExitCode != 2 || crashed.To != StateFailed ||
+			crashed.Error != "service 'indexer' exited with code 2 after running for 0s" {
+			t.Fatalf("expected the exit of the indexer, got %+v", crashed)
+		}
+		if stopped := entries[7]; stopped.ExitCode == nil || *stopped.ExitCode != 0 {
+			t.Fatalf("expected the database to exit successfully, got %+v", stopped)
+		}
+		completed := entries[8]
+		if completed.ExitCode == nil || *completed.ExitCode != 2 || completed.Error == "" {
+			t.Fatalf("expected the exit code of the node, got %+v", completed)
+		}
+		for i := 1; i < len(entries); i++ {
+			if entries[i].Time.Before(entries[i-1].Time) {
+				t.Fatalf("expected the entries in order, got %+v", entries)
+			}
+		}
+	})
+
+	t.Run("it appends to the journal of the previous runs", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "events.jsonl")
+		for i := 0; i < 2; i++ {
+			service := testService{name: "migrate", start: func(ctx context.Context) error {
+				return nil
+			}}
+			err := Run(context.Background(), []Service{service}, WithJournal(JournalConfig{
+				Path: path,
+			}))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		entries, err := ReadJournal(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		completed := 0
+		for _, entry := range entries {
+			if entry.Event == EventShutdownCompleted {
+				completed++
+			}
+		}
+		if completed != 2 {
+			t.Fatalf("expected the entries of both runs, got %v", events(entries))
+		}
+	})
+
+	t.Run("it rotates the journal and keeps the newest files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "events.jsonl")
+		journal, err := openJournal(JournalConfig{Path: path, MaxSize: 200, MaxFiles: 2})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			journal.record(ServiceEvent{Service: fmt.Sprint("service-", i), Kind: EventStarted,
+				Time: time.Unix(int64(i), 0)})
+		}
+		journal.close()
+
+		files, err := filepath.Glob(path + "*")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(files) != 3 {
+			t.Fatalf("expected the file and 2 rotated files, got %v", files)
+		}
+		for _, file := range files {
+			if info, err := os.Stat(file); err != nil || info.Size() > 200 {
+				t.Fatalf("expected %v to be at most 200 bytes, got %+v (%v)", file, info, err)
+			}
+		}
+		entries, err := ReadJournal(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(entries) == 0 || len(entries) >= 20 {
+			t.Fatalf("expected the oldest entries to be removed, got %v", events(entries))
+		}
+		for i, entry := range entries {
+			expected := fmt.Sprint("service-", 20-len(entries)+i)
+			if entry.Service != expected {
+				t.Fatalf("expected the newest entries in order, got %v", events(entries))
+			}
+		}
+	})
+
+	t.Run("it ignores a last line that was cut short", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "events.jsonl")
+		content := `{"time":"2024-01-01T00:00:00Z","event":"started","service":"indexer"}` +
+			"\n" + `{"time":"2024-01-01T00:00:01Z","event":"exi`
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		entries, err := ReadJournal(path)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := events(entries); !reflect.DeepEqual(got, []string{"started indexer"}) {
+			t.Fatalf("expected the complete line only, got %v", got)
+		}
+
+		corrupt := `{"event":` + "\n" + content
+		if err := os.WriteFile(path, []byte(corrupt), 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := ReadJournal(path); err == nil || !strings.Contains(err.Error(), ":1:") {
+			t.Fatalf("expected the corrupt line to be reported, got %v", err)
+		}
+	})
+
+	t.Run("it names the signals sent to the services", func(t *testing.T) {
+		entry := newJournalEntry(ServiceEvent{Service: "indexer", Kind: EventSignalSent,
+			Signal: syscall.SIGKILL})
+		if entry.Signal != "SIGKILL" || entry.ExitCode != nil {
+			t.Fatalf("expected the name of the signal, got %+v", entry)
+		}
+	})
+
+	t.Run("it disables the journal after the first write error", func(t *testing.T) {
+		if _, err := os.Stat("/dev/full"); err != nil {
+			t.Skip("there is no /dev/full to fail the writes")
+		}
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		service := testService{name: "migrate", start: func(ctx context.Context) error {
+			return nil
+		}}
+		err := Run(context.Background(), []Service{service}, WithJournal(JournalConfig{
+			Path: "/dev/full",
+		}))
+		if err != nil {
+			t.Fatalf("expected the node to run without the journal, got %v", err)
+		}
+		if count := strings.Count(out.String(), "failed to write to the journal"); count != 1 {
+			t.Fatalf("expected the error to be logged once, got %q", out.String())
+		}
+	})
+
+	t.Run("it does not start when the journal cannot be opened", func(t *testing.T) {
+		setup()
+		file := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(file, nil, 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		started := false
+		service := testService{name: "migrate", start: func(ctx context.Context) error {
+			started = true
+			return nil
+		}}
+		err := Run(context.Background(), []Service{service}, WithJournal(JournalConfig{
+			Path: filepath.Join(file, "events.jsonl"),
+		}))
+		if err == nil || !strings.HasPrefix(err.Error(), "failed to open the journal") || started {
+			t.Fatalf("expected the journal to stop the node, got %v", err)
+		}
+	})
+}
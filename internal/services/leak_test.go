@@ -0,0 +1,120 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestRunLeaks(t *testing.T) {
+
+	t.Run("it leaves nothing behind when the shutdown times out", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		before := goroutineIDs()
+		release := make(chan struct{})
+		quick := testService{name: "quick", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		late := testService{name: "late", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			<-release
+			return nil
+		}}
+
+		supervisor := NewSupervisor([]Service{quick, late}, WithStopTimeout(50*time.Millisecond))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		err := supervisor.Stop(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "late") {
+			t.Fatalf("expected the late service to time out, got %v", err)
+		}
+
+		close(release)
+		waitForLog(t, &out, "service 'late' exited after the shutdown timeout")
+		waitForLeaks(t, before)
+	})
+}
+
+// goroutineIDs returns the ids of the goroutines that are running
+func goroutineIDs() map[string]bool {
+	ids := make(map[string]bool)
+	for _, stack := range goroutineStacks() {
+		ids[strings.Fields(stack)[1]] = true
+	}
+	return ids
+}
+
+// goroutineStacks returns the stack of each goroutine that is running
+func goroutineStacks() []string {
+	buffer := make([]byte, 1<<20)
+	buffer = buffer[:runtime.Stack(buffer, true)]
+	return strings.Split(string(buffer), "\n\n")
+}
+
+// waitForLeaks waits for the goroutines of this package that were started
+// after the ids were taken to finish, failing the test after two seconds
+func waitForLeaks(t *testing.T, before map[string]bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var leaked []string
+		for _, stack := range goroutineStacks() {
+			id := strings.Fields(stack)[1]
+			if !before[id] && strings.Contains(stack, "rollups-node/internal/services.") {
+				leaked = append(leaked, stack)
+			}
+		}
+		if len(leaked) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("leaked %v goroutines:\n\n%v", len(leaked), strings.Join(leaked, "\n\n"))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForLog waits for the text to be logged to the buffer, failing the test
+// after two seconds
+func waitForLog(t *testing.T, out *lockedBuffer, text string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(out.String(), text) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q to be logged, got %q", text, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// lockedBuffer is a buffer that can be written and read concurrently
+type lockedBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
@@ -0,0 +1,46 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceLimits are the limits applied to the process of a command service,
+// so a runaway service fails on its own instead of dragging the others down.
+// The zero value of each limit means no limit. Limits are only supported on
+// Linux, and the services that set them fail their validation elsewhere
+type ResourceLimits struct {
+	// MaxMemory is the size of the address space of the process, in bytes
+	// (RLIMIT_AS). Allocations beyond it fail
+	MaxMemory uint64
+
+	// MaxOpenFiles is how many files the process may have open at once
+	// (RLIMIT_NOFILE)
+	MaxOpenFiles uint64
+}
+
+// WithLimits applies the resource limits to the process. They are in place
+// before the binary of the process begins to run
+func WithLimits(limits ResourceLimits) CommandOption {
+	return func(s *simpleService) {
+		s.limits = limits
+	}
+}
+
+func (l ResourceLimits) empty() bool {
+	return l == ResourceLimits{}
+}
+
+func (l ResourceLimits) String() string {
+	var limits []string
+	if l.MaxMemory != 0 {
+		limits = append(limits, fmt.Sprintf("memory to %v bytes", l.MaxMemory))
+	}
+	if l.MaxOpenFiles != 0 {
+		limits = append(limits, fmt.Sprintf("open files to %v", l.MaxOpenFiles))
+	}
+	return strings.Join(limits, ", ")
+}
@@ -0,0 +1,94 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build linux
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkLimits succeeds, since Linux supports all limits
+func checkLimits(limits ResourceLimits) error {
+	return nil
+}
+
+// startLimited starts the process with the limits. Go cannot run code in the
+// child between fork and exec, so the child is traced instead: the kernel stops
+// it right after the exec, before the binary runs, which is when the limits
+// are set with prlimit. The process is then detached and resumed. If the
+// limits cannot be applied, the process is left stopped, so the caller must
+// kill it
+func startLimited(cmd *exec.Cmd, limits ResourceLimits) error {
+	if limits.empty() {
+		return cmd.Start()
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	// the tracer is the thread that started the process
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if err := limitStopped(cmd.Process.Pid, limits); err != nil {
+		return fmt.Errorf("failed to limit the resources of the process: %w", err)
+	}
+	return nil
+}
+
+// limitStopped waits for the traced process to stop after its exec, then
+// applies the limits and resumes it
+func limitStopped(pid int, limits ResourceLimits) error {
+	var status unix.WaitStatus
+	for {
+		_, err := unix.Wait4(pid, &status, 0, nil)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, unix.EINTR) {
+			return fmt.Errorf("failed to wait for the exec: %w", err)
+		}
+	}
+	if !status.Stopped() {
+		return errors.New("the process exited before its limits were applied")
+	}
+	if err := applyLimits(pid, limits); err != nil {
+		return err
+	}
+	if err := unix.PtraceDetach(pid); err != nil {
+		return fmt.Errorf("failed to resume the process: %w", err)
+	}
+	return nil
+}
+
+// applyLimits sets the limits of the process with prlimit
+func applyLimits(pid int, limits ResourceLimits) error {
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    uint64
+	}{
+		{"memory", unix.RLIMIT_AS, limits.MaxMemory},
+		{"open files", unix.RLIMIT_NOFILE, limits.MaxOpenFiles},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+		rlimit := unix.Rlimit{Cur: limit.value, Max: limit.value}
+		if err := unix.Prlimit(pid, limit.resource, &rlimit, nil); err != nil {
+			return fmt.Errorf("failed to limit the %v: %w", limit.name, err)
+		}
+	}
+	return nil
+}
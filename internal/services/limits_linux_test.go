@@ -0,0 +1,69 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResourceLimits(t *testing.T) {
+
+	// hog creates a service that allocates a lot of memory
+	hog := func(opts ...CommandOption) Service {
+		opts = append(opts,
+			WithArgs("-test.run=^TestHelperProcess$"),
+			WithEnv(map[string]string{
+				"SERVICES_HELPER_PROCESS": "allocate",
+				"GOTRACEBACK":             "none",
+			}))
+		return OneShot(NewCommandService("hog", os.Args[0], opts...))
+	}
+
+	t.Run("it lets the process allocate without limits", func(t *testing.T) {
+		setup()
+		if err := Run(context.Background(), []Service{hog()}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it fails the service that goes over its memory limit", func(t *testing.T) {
+		setup()
+		if raceEnabled {
+			t.Skip("the race detector cannot run within the limit")
+		}
+		limits := WithLimits(ResourceLimits{MaxMemory: 64 << 20})
+		err := Run(context.Background(), []Service{hog(limits)})
+
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) || exitErr.Service != "hog" || exitErr.ExitCode == 0 {
+			t.Fatalf("expected the service to fail, got %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), "service 'hog' ") {
+			t.Fatalf("expected the error to name the service, got %v", err)
+		}
+	})
+
+	t.Run("it limits the open files", func(t *testing.T) {
+		setup()
+		script := writeScript(t, `test "$(ulimit -n)" = 16`)
+		limits := WithLimits(ResourceLimits{MaxOpenFiles: 16})
+		err := Run(context.Background(), []Service{OneShot(NewCommandService("files", script,
+			limits))})
+		if err != nil {
+			t.Fatalf("expected the limit to apply, got %v", err)
+		}
+	})
+
+	t.Run("it describes the limits", func(t *testing.T) {
+		limits := ResourceLimits{MaxMemory: 1 << 30, MaxOpenFiles: 1024}
+		expected := "memory to 1073741824 bytes, open files to 1024"
+		if limits.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, limits.String())
+		}
+	})
+}
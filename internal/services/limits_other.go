@@ -0,0 +1,33 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build !linux
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// checkLimits fails if any limit is set, since only Linux can limit the
+// resources of another process
+func checkLimits(limits ResourceLimits) error {
+	if limits.MaxMemory != 0 {
+		return fmt.Errorf("the memory limit is not supported on %v", runtime.GOOS)
+	}
+	if limits.MaxOpenFiles != 0 {
+		return fmt.Errorf("the open files limit is not supported on %v", runtime.GOOS)
+	}
+	return nil
+}
+
+// startLimited starts the process, or fails like checkLimits without starting
+// it if any limit is set
+func startLimited(cmd *exec.Cmd, limits ResourceLimits) error {
+	if err := checkLimits(limits); err != nil {
+		return err
+	}
+	return cmd.Start()
+}
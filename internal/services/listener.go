@@ -0,0 +1,216 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// listenFDsStart is the first file descriptor of the listeners passed to a
+// process, right after its stdin, stdout, and stderr
+const listenFDsStart = 3
+
+// WithListener makes the node bind the listener and pass it to the process,
+// so the address stays bound while the process restarts and no other process
+// can take it in between. The listener is bound when the service is validated,
+// so an address that is in use fails the startup, and it is closed once the
+// supervisor is done with the service.
+//
+// The listeners follow the socket activation convention of systemd: they are
+// passed in the order they are declared as the file descriptors starting at 3,
+// LISTEN_FDS is set to how many there are, and LISTEN_FDNAMES to their names
+// separated by colons. LISTEN_PID is not set, since the node cannot know the
+// pid of the process before it runs, so the binaries must not require it. A
+// binary adopts the convention by listening on the inherited file descriptor
+// when LISTEN_FDS is set, and binding the address itself otherwise. It is not
+// supported on Windows
+func WithListener(name string, network string, addr string) CommandOption {
+	return func(s *simpleService) {
+		s.listeners = append(s.listeners, listenerConfig{name: name, network: network, addr: addr})
+	}
+}
+
+// releaser is a service that holds resources across its runs, such as the
+// listeners it passes to its process, which the supervisor releases once it is
+// done with the service
+type releaser interface {
+	release()
+}
+
+// releaseServices releases the resources held by the services
+func releaseServices(specs []ServiceSpec) {
+	for _, spec := range specs {
+		if releaser, ok := spec.Service.(releaser); ok {
+			releaser.release()
+		}
+	}
+}
+
+// listenerConfig is a listener declared by WithListener
+type listenerConfig struct {
+	name    string
+	network string
+	addr    string
+}
+
+func (c listenerConfig) String() string {
+	return fmt.Sprintf("%v (%v %v)", c.name, c.network, c.addr)
+}
+
+// boundListener is the file of a bound listener, which is shared by the
+// definitions of a service that declare it, across a reload
+type boundListener struct {
+	mutex sync.Mutex
+	file  *os.File
+	addr  net.Addr
+	refs  int
+}
+
+// unref closes the listener once no service holds it
+func (l *boundListener) unref() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		l.file.Close()
+	}
+}
+
+// bind binds the listener
+func (c listenerConfig) bind() (*boundListener, error) {
+	listener, err := net.Listen(c.network, c.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+	filer, ok := listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("cannot pass a %v listener", c.network)
+	}
+	file, err := filer.File()
+	if err != nil {
+		return nil, err
+	}
+	return &boundListener{file: file, addr: listener.Addr(), refs: 1}, nil
+}
+
+// bindListeners binds the listeners of the service that are not bound yet
+func (s *simpleService) bindListeners() error {
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("passing listeners is not supported on windows")
+	}
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	if s.bound == nil {
+		s.bound = make([]*boundListener, len(s.listeners))
+	}
+	for i, config := range s.listeners {
+		if s.bound[i] != nil {
+			continue
+		}
+		bound, err := config.bind()
+		if err != nil {
+			return fmt.Errorf("failed to bind the listener %v: %w", config, err)
+		}
+		s.bound[i] = bound
+	}
+	return nil
+}
+
+// passListeners binds the listeners of the service, if they are not bound
+// yet, and passes them to the process
+func (s *simpleService) passListeners(cmd *exec.Cmd, filter *logFilter) error {
+	if len(s.listeners) == 0 {
+		return nil
+	}
+	if err := s.bindListeners(); err != nil {
+		return err
+	}
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	names := make([]string, len(s.listeners))
+	for i, config := range s.listeners {
+		names[i] = config.name
+		cmd.ExtraFiles = append(cmd.ExtraFiles, s.bound[i].file)
+		msg := fmt.Sprintf("%v: passing the listener %v on %v as fd %v", s.String(), config.name,
+			s.bound[i].addr, listenFDsStart+i)
+		filter.log(logger.Debug, msg)
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env,
+		"LISTEN_FDS="+strconv.Itoa(len(s.listeners)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"))
+	return nil
+}
+
+// listenerAddr returns the address the listener with the name is bound to, or
+// nil if it is not bound
+func (s *simpleService) listenerAddr(name string) net.Addr {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	for i, config := range s.listeners {
+		if config.name == name && i < len(s.bound) && s.bound[i] != nil {
+			return s.bound[i].addr
+		}
+	}
+	return nil
+}
+
+// adoptListeners makes the service share the listeners bound by the previous
+// definition of the service that it also declares, which are kept open for it
+// when the previous definition is released
+func (s *simpleService) adoptListeners(previous Service) {
+	old, ok := previous.(*simpleService)
+	if !ok || old == s || len(s.listeners) == 0 {
+		return
+	}
+	old.listenersMutex.Lock()
+	defer old.listenersMutex.Unlock()
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	if s.bound == nil {
+		s.bound = make([]*boundListener, len(s.listeners))
+	}
+	for i, config := range s.listeners {
+		for j, oldConfig := range old.listeners {
+			if s.bound[i] != nil || config != oldConfig || j >= len(old.bound) {
+				continue
+			}
+			if bound := old.bound[j]; bound != nil {
+				bound.mutex.Lock()
+				bound.refs++
+				bound.mutex.Unlock()
+				s.bound[i] = bound
+			}
+		}
+	}
+}
+
+// release closes the listeners of the service that no other definition of it
+// holds. They are bound again if the service is started again
+func (s *simpleService) release() {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+	for i, bound := range s.bound {
+		if bound != nil {
+			bound.unref()
+			s.bound[i] = nil
+		}
+	}
+}
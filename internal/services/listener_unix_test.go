@@ -0,0 +1,144 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListener(t *testing.T) {
+
+	// server creates a service that greets one connection on the listener it
+	// inherits
+	server := func() *simpleService {
+		return NewCommandService("graphql-server", os.Args[0],
+			WithListener("graphql", "tcp", "127.0.0.1:0"),
+			WithArgs("-test.run=^TestHelperProcess$"),
+			WithEnv(map[string]string{"SERVICES_HELPER_PROCESS": "accept"}),
+		).(*simpleService)
+	}
+
+	// bind binds the listener of the service and returns its address
+	bind := func(t *testing.T, s *simpleService) string {
+		t.Helper()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		addr := s.listenerAddr("graphql")
+		if addr == nil {
+			t.Fatalf("expected the listener to be bound")
+		}
+		return addr.String()
+	}
+
+	// greeting connects to the address and returns what the service says
+	greeting := func(addr string) string {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		data, err := io.ReadAll(conn)
+		if err != nil {
+			return err.Error()
+		}
+		return string(data)
+	}
+
+	t.Run("it passes the listener to the process", func(t *testing.T) {
+		setup()
+		s := server()
+		addr := bind(t, s)
+		done := make(chan error, 1)
+		go func() {
+			done <- Run(context.Background(), []Service{OneShot(s)})
+		}()
+		if got := greeting(addr); got != "graphql" {
+			t.Fatalf("expected the name of the listener, got %q", got)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it keeps the listener across restarts", func(t *testing.T) {
+		setup()
+		s := server()
+		defer s.release()
+		addr := bind(t, s)
+		for run := 1; run <= 2; run++ {
+			// the connection waits in the backlog for the process to start
+			conn := make(chan string, 1)
+			go func() {
+				conn <- greeting(addr)
+			}()
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatalf("expected run %v to succeed, got %v", run, err)
+			}
+			if got := <-conn; got != "graphql" {
+				t.Fatalf("expected run %v to greet the connection, got %q", run, got)
+			}
+		}
+	})
+
+	t.Run("it closes the listener once the supervisor is done", func(t *testing.T) {
+		setup()
+		s := server()
+		addr := bind(t, s)
+		go greeting(addr)
+		if err := Run(context.Background(), []Service{OneShot(s)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			t.Fatalf("expected the listener to be closed")
+		}
+	})
+
+	t.Run("it fails the validation when the address is in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		s := NewCommandService("graphql-server", os.Args[0],
+			WithListener("graphql", "tcp", listener.Addr().String())).(*simpleService)
+		err = Verify([]Service{s})
+		if err == nil || !strings.Contains(err.Error(), "failed to bind the listener graphql") {
+			t.Fatalf("expected the address in use to fail the validation, got %v", err)
+		}
+	})
+
+	t.Run("it hands the listener over to the new definition on a reload", func(t *testing.T) {
+		setup()
+		old, changed := server(), server()
+		addr := bind(t, old)
+		changed.args = append(changed.args, "-test.v")
+		changed.adoptListeners(old)
+		old.release()
+		if got := changed.listenerAddr("graphql"); got == nil || got.String() != addr {
+			t.Fatalf("expected the listener on %v, got %v", addr, got)
+		}
+		defer changed.release()
+		conn := make(chan string, 1)
+		go func() {
+			conn <- greeting(addr)
+		}()
+		if err := changed.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := <-conn; got != "graphql" {
+			t.Fatalf("expected the new definition to greet the connection, got %q", got)
+		}
+	})
+}
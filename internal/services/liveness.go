@@ -0,0 +1,139 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// ErrUnresponsive is the error of the services that were stopped because they
+// failed their liveness checks (see [Liveness])
+var ErrUnresponsive = errors.New("service is unresponsive")
+
+// DefaultLivenessInterval is how often the liveness of a service is checked
+// by default
+const DefaultLivenessInterval = 10 * time.Second
+
+// DefaultLivenessThreshold is how many consecutive liveness checks a service
+// must fail to be stopped by default
+const DefaultLivenessThreshold = 3
+
+// LivenessConfig configures the liveness checks of a service
+type LivenessConfig struct {
+	// Probe checks whether the service is alive. It may be any of the
+	// readiness probes, such as an [HttpProbe]
+	Probe Readiness
+
+	// Interval is the time between two checks. The default is
+	// DefaultLivenessInterval
+	Interval time.Duration
+
+	// Timeout bounds each check. The default is DefaultProbeTimeout
+	Timeout time.Duration
+
+	// FailureThreshold is how many consecutive checks must fail for the
+	// service to be stopped. The default is DefaultLivenessThreshold
+	FailureThreshold int
+}
+
+// Liveness makes Run check that a service is still alive at the interval of
+// the config, once it is ready. When the service fails the checks too many
+// times in a row, Run logs their errors and stops the service like in the
+// shutdown, with its stop signal and its grace period. The service then exits
+// with [ErrUnresponsive], so its restart policy decides whether it is started
+// again, and the node stops unless it is restarted or optional. Each failed
+// check is sent as [EventLivenessFailed] and each stop as [EventUnresponsive],
+// and both show up in the status of the service
+func Liveness(service Service, config LivenessConfig) Service {
+	spec := specOf(service)
+	spec.Liveness = &config
+	return spec
+}
+
+// watchLiveness checks the liveness of the service while the context is not
+// done and calls stop once the service fails too many checks. It returns a
+// function that waits for the checks to finish and returns the error that
+// stopped the service, if any
+func watchLiveness(
+	ctx context.Context,
+	config *LivenessConfig,
+	clock Clock,
+	status serviceStatus,
+	name string,
+	stop func(),
+) func() error {
+	if config == nil || config.Probe == nil {
+		return func() error { return nil }
+	}
+	interval := config.Interval
+	if interval <= 0 {
+		interval = DefaultLivenessInterval
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	threshold := config.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultLivenessThreshold
+	}
+	filter := logFilterFrom(ctx)
+	done := make(chan error, 1)
+	go func() {
+		var failures []error
+		for {
+			select {
+			case <-clock.After(interval):
+			case <-ctx.Done():
+				done <- nil
+				return
+			}
+			// the service is only checked once it is ready
+			if state := status.state(); state != StateReady && state != StateRunning {
+				continue
+			}
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := config.Probe.Ready(checkCtx)
+			cancel()
+			if ctx.Err() != nil {
+				done <- nil
+				return
+			}
+			if err == nil {
+				if len(failures) > 0 {
+					status.livenessFailed(0, nil)
+				}
+				failures = failures[:0]
+				continue
+			}
+			failures = append(failures, err)
+			status.livenessFailed(len(failures), err)
+			msg := fmt.Sprintf("main: liveness check %v/%v of service '%v' failed: %v",
+				len(failures), threshold, name, err)
+			filter.log(logger.Warning, msg, "service", name, "event", "liveness_failed",
+				"failures", len(failures), "error", err)
+			if len(failures) < threshold {
+				continue
+			}
+			unresponsive := fmt.Errorf("%w: failed %v liveness checks in a row: %w",
+				ErrUnresponsive, len(failures), joinProblems(failures))
+			status.unresponsive(unresponsive)
+			msg = fmt.Sprintf("main: service '%v' is unresponsive; stopping it: %v", name,
+				joinProblems(failures))
+			filter.log(logger.Error, msg, "service", name, "event", "unresponsive",
+				"failures", len(failures))
+			stop()
+			done <- unresponsive
+			return
+		}
+	}()
+	return func() error {
+		return <-done
+	}
+}
@@ -0,0 +1,165 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLiveness(t *testing.T) {
+	setup()
+	var out lockedBuffer
+	logger.Warning = log.New(&out, "WARN ", 0)
+	logger.Error = log.New(&out, "ERROR ", 0)
+	clock := servicestest.NewClock(time.Unix(0, 0))
+	var healthy atomic.Bool
+	healthy.Store(true)
+	var checks, starts atomic.Int32
+	probe := readinessFunc(func(ctx context.Context) error {
+		checks.Add(1)
+		if healthy.Load() {
+			return nil
+		}
+		// an unhealthy service hangs until the check times out
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	service := testService{name: "alive", start: func(ctx context.Context) error {
+		starts.Add(1)
+		<-ctx.Done()
+		return nil
+	}}
+	config := LivenessConfig{
+		Probe:            probe,
+		Interval:         time.Second,
+		Timeout:          10 * time.Millisecond,
+		FailureThreshold: 2,
+	}
+	backoff := Backoff{Initial: time.Minute, Max: time.Minute, Reset: time.Hour}
+	supervisor := NewSupervisor([]Service{Restart(Liveness(service, config), RestartOnFailure)},
+		WithRestartOnFailure(backoff), WithClock(clock))
+	events := supervisor.Events()
+	if err := supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	waitForChecks := func(t *testing.T, count int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for checks.Load() < count {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v checks, got %v", count, checks.Load())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	check := func(t *testing.T) {
+		t.Helper()
+		clock.WaitFor(t, time.Second)
+		count := checks.Load()
+		clock.Advance(time.Second)
+		waitForChecks(t, count+1)
+	}
+
+	t.Run("it checks the liveness at the interval", func(t *testing.T) {
+		check(t)
+		check(t)
+		if failures := supervisor.Status()[0].LivenessFailures; failures != 0 {
+			t.Fatalf("expected no failures, got %v", failures)
+		}
+	})
+
+	t.Run("it resets the failures after a successful check", func(t *testing.T) {
+		healthy.Store(false)
+		check(t)
+		waitForLog(t, &out, "WARN main: liveness check 1/2 of service 'alive' failed: "+
+			"context deadline exceeded\n")
+		if failures := supervisor.Status()[0].LivenessFailures; failures != 1 {
+			t.Fatalf("expected a failure, got %v", failures)
+		}
+		healthy.Store(true)
+		check(t)
+		clock.WaitFor(t, time.Second)
+		if failures := supervisor.Status()[0].LivenessFailures; failures != 0 {
+			t.Fatalf("expected the failures to be reset, got %v", failures)
+		}
+	})
+
+	t.Run("it stops the service after too many failures", func(t *testing.T) {
+		healthy.Store(false)
+		check(t)
+		check(t)
+		waitForLog(t, &out, "ERROR main: service 'alive' is unresponsive; stopping it: "+
+			"context deadline exceeded; context deadline exceeded")
+		healthy.Store(true)
+		clock.WaitFor(t, time.Minute)
+		status := supervisor.Status()[0]
+		if status.State != StateFailed || !status.Restarting {
+			t.Fatalf("expected the service to wait for its restart, got %+v", status)
+		}
+		if !errors.Is(status.LastError, ErrUnresponsive) || status.Unresponsive != 1 {
+			t.Fatalf("expected the service to be unresponsive, got %+v", status)
+		}
+		expected := `
+# HELP rollups_service_unresponsive_total How many times the service was found unresponsive.
+# TYPE rollups_service_unresponsive_total counter
+rollups_service_unresponsive_total{service="alive"} 1
+`
+		collector := statusCollector{status: supervisor.Status}
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+			"rollups_service_unresponsive_total")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("it lets the restart policy restart the service", func(t *testing.T) {
+		clock.Advance(time.Minute)
+		waitForStates(t, supervisor, StateRunning)
+		if count := starts.Load(); count != 2 {
+			t.Fatalf("expected the service to be started twice, got %v", count)
+		}
+		check(t)
+		status := supervisor.Status()[0]
+		if status.Restarts != 1 || status.LivenessFailures != 0 {
+			t.Fatalf("expected a restarted and healthy service, got %+v", status)
+		}
+	})
+
+	t.Run("it sends the failures as events", func(t *testing.T) {
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var kinds []EventKind
+		for event := range events {
+			switch event.Kind {
+			case EventLivenessFailed, EventUnresponsive:
+				if event.Err == nil {
+					t.Errorf("expected the event to have an error, got %+v", event)
+				}
+				kinds = append(kinds, event.Kind)
+			}
+		}
+		expected := []EventKind{EventLivenessFailed, EventLivenessFailed, EventLivenessFailed,
+			EventUnresponsive}
+		if len(kinds) != len(expected) {
+			t.Fatalf("expected %v, got %v", expected, kinds)
+		}
+		for i := range expected {
+			if kinds[i] != expected[i] {
+				t.Fatalf("expected %v, got %v", expected, kinds)
+			}
+		}
+	})
+}
@@ -0,0 +1,165 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// Defaults of the log files of the services
+const (
+	DefaultLogFileMaxSize  = 100 * 1024 * 1024
+	DefaultLogFileMaxFiles = 5
+)
+
+// LogFileConfig configures the file where a service writes its output
+type LogFileConfig struct {
+	// Dir is the directory of the file, which is named after the service,
+	// such as indexer.log
+	Dir string
+
+	// MaxSize is the size in bytes after which the file is rotated. The
+	// default is DefaultLogFileMaxSize
+	MaxSize int64
+
+	// MaxFiles is how many rotated files are kept besides the current one.
+	// The default is DefaultLogFileMaxFiles
+	MaxFiles int
+
+	// Console also writes the output to the console, as it is without a
+	// log file
+	Console bool
+}
+
+// rotatingFile is a log file that is renamed to name.1 when it exceeds its
+// maximum size, shifting older files up to name.MaxFiles. Writes go straight
+// to the file, so nothing is lost when the process crashes
+type rotatingFile struct {
+	mutex    sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+
+	// failed is set after the first write error is logged
+	failed atomic.Bool
+}
+
+// openRotatingFile opens the log file of the service, appending to it if it
+// already exists
+func openRotatingFile(config LogFileConfig, service string) (*rotatingFile, error) {
+	maxSize, maxFiles := config.MaxSize, config.MaxFiles
+	if maxSize == 0 {
+		maxSize = DefaultLogFileMaxSize
+	}
+	if maxFiles == 0 {
+		maxFiles = DefaultLogFileMaxFiles
+	}
+	return newRotatingFile(filepath.Join(config.Dir, service+".log"), maxSize, maxFiles)
+}
+
+// newRotatingFile opens the file at path and creates its directory, appending
+// to the file if it already exists
+func newRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate closes the current file and shifts it and the older files by one,
+// removing the oldest
+func (f *rotatingFile) rotate() error {
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	for i := f.maxFiles - 1; i > 0; i-- {
+		err := os.Rename(f.rotatedPath(i), f.rotatedPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, f.rotatedPath(1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%v.%v", f.path, i)
+}
+
+// Close syncs the file to disk before closing it
+func (f *rotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.closeFile()
+}
+
+func (f *rotatingFile) closeFile() error {
+	if err := f.file.Sync(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// teeWriter writes the output of a process to its log file and, if it is not
+// nil, to the console. Failing to write to the file does not block the
+// process
+type teeWriter struct {
+	console io.Writer
+	file    *rotatingFile
+}
+
+func (w teeWriter) Write(p []byte) (int, error) {
+	if _, err := w.file.Write(p); err != nil && !w.file.failed.Swap(true) {
+		msg := fmt.Sprintf("main: failed to write to %v: %v", w.file.path, err)
+		logger.Log(logger.Warning, msg, "event", "log_file_error", "error", err)
+	}
+	if w.console != nil {
+		return w.console.Write(p)
+	}
+	return len(p), nil
+}
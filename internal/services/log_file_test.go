@@ -0,0 +1,136 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestRotatingFile(t *testing.T) {
+
+	t.Run("it appends to an existing file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "indexer.log")
+		if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := openRotatingFile(LogFileConfig{Dir: dir}, "indexer")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		fmt.Fprintln(file, "new")
+		if err := file.Close(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		assertFileContent(t, path, "old\nnew\n")
+	})
+
+	t.Run("it rotates the file when it exceeds the maximum size", func(t *testing.T) {
+		dir := t.TempDir()
+		config := LogFileConfig{Dir: dir, MaxSize: 10, MaxFiles: 2}
+		file, err := openRotatingFile(config, "indexer")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for i := 1; i <= 4; i++ {
+			fmt.Fprintf(file, "line %v\n", i)
+		}
+		_ = file.Close()
+
+		path := filepath.Join(dir, "indexer.log")
+		assertFileContent(t, path, "line 4\n")
+		assertFileContent(t, path+".1", "line 3\n")
+		assertFileContent(t, path+".2", "line 2\n")
+		if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+			t.Errorf("expected only 2 rotated files to be kept, got %v", err)
+		}
+	})
+
+	t.Run("it can be written concurrently", func(t *testing.T) {
+		dir := t.TempDir()
+		file, err := openRotatingFile(LogFileConfig{Dir: dir, MaxSize: 100}, "indexer")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					fmt.Fprintln(file, "a line of output")
+				}
+			}()
+		}
+		wg.Wait()
+		if err := file.Close(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestCommandServiceLogFile(t *testing.T) {
+
+	t.Run("it writes the output to the log file", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		dir := t.TempDir()
+		service := NewCommandService("talker", writeScript(t, "echo hello; echo oops >&2"),
+			WithLogFile(LogFileConfig{Dir: dir}))
+
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		content, _ := os.ReadFile(filepath.Join(dir, "talker.log"))
+		if !strings.Contains(string(content), "hello\n") ||
+			!strings.Contains(string(content), "oops\n") {
+			t.Errorf("expected the output in the log file, got %q", content)
+		}
+		if out.Len() != 0 {
+			t.Errorf("expected no output on the console, got %q", out.String())
+		}
+	})
+
+	t.Run("it can also write the output to the console", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		dir := t.TempDir()
+		service := NewCommandService("talker", writeScript(t, "echo hello"),
+			WithLogFile(LogFileConfig{Dir: dir, Console: true}))
+
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		assertFileContent(t, filepath.Join(dir, "talker.log"), "hello\n")
+		if out.String() != "INFO talker | hello\n" {
+			t.Errorf("expected the output on the console, got %q", out.String())
+		}
+	})
+}
+
+func assertFileContent(t *testing.T, path string, expected string) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("failed to read %v: %v", path, err)
+	} else if string(content) != expected {
+		t.Errorf("expected %v to be %q, got %q", path, expected, content)
+	}
+}
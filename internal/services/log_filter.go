@@ -0,0 +1,78 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// logSummaryInterval is how often Run logs the number of entries that were
+// dropped because of the log level of each service
+var logSummaryInterval = time.Minute
+
+// logFilter drops the entries about a service that are below its log level.
+// It counts them, so the summary shows that the service did not go silent
+type logFilter struct {
+	service string
+	level   logger.Level
+	dropped atomic.Int64
+}
+
+// newLogFilter returns nil, which writes every entry, if the level is not set
+func newLogFilter(service string, level logger.Level) *logFilter {
+	if level == 0 {
+		return nil
+	}
+	return &logFilter{service: service, level: level}
+}
+
+// log writes the entry to l unless it is below the level of the filter
+func (f *logFilter) log(l *log.Logger, msg string, args ...any) {
+	if f != nil && logger.LevelOf(l) > f.level {
+		f.dropped.Add(1)
+		return
+	}
+	logger.LogDepth(l, 1, msg, args...)
+}
+
+// report logs how many entries were dropped since the last report
+func (f *logFilter) report() {
+	if f == nil {
+		return
+	}
+	if dropped := f.dropped.Swap(0); dropped > 0 {
+		msg := fmt.Sprintf("main: dropped %v lines below %v for %v", dropped, f.level, f.service)
+		logger.Log(logger.Info, msg, "service", f.service, "event", "dropped", "count", dropped)
+	}
+}
+
+type logFilterKey struct{}
+
+// withLogFilter returns a context whose services log through the filter
+func withLogFilter(ctx context.Context, filter *logFilter) context.Context {
+	return context.WithValue(ctx, logFilterKey{}, filter)
+}
+
+// logFilterFrom returns the filter of the service started with the context
+func logFilterFrom(ctx context.Context) *logFilter {
+	filter, _ := ctx.Value(logFilterKey{}).(*logFilter)
+	return filter
+}
+
+// filterOutput makes the writers that log the output of a process go through
+// the filter
+func filterOutput(filter *logFilter, writers ...io.Writer) {
+	for _, writer := range writers {
+		if w := lineWriterOf(writer); w != nil {
+			w.filter = filter
+		}
+	}
+}
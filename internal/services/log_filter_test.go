@@ -0,0 +1,89 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestLogFilter(t *testing.T) {
+
+	t.Run("it drops the entries below its level", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		filter := newLogFilter("indexer", logger.WarningLevel)
+
+		filter.log(logger.Info, "indexer | polling")
+		filter.log(logger.Warning, "indexer | slow query")
+
+		if out.String() != "WARN indexer | slow query\n" {
+			t.Fatalf("unexpected output %q", out.String())
+		}
+	})
+
+	t.Run("it reports how many entries were dropped", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		filter := newLogFilter("indexer", logger.ErrorLevel)
+		for i := 0; i < 3; i++ {
+			filter.log(logger.Info, "indexer | polling")
+		}
+		out.Reset()
+
+		filter.report()
+		filter.report()
+
+		if out.String() != "INFO main: dropped 3 lines below error for indexer\n" {
+			t.Fatalf("unexpected output %q", out.String())
+		}
+	})
+
+	t.Run("it writes every entry when the level is not set", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Debug = log.New(&out, "DEBUG ", 0)
+		filter := newLogFilter("indexer", 0)
+
+		filter.log(logger.Debug, "indexer | polling")
+		filter.report()
+
+		if out.String() != "DEBUG indexer | polling\n" {
+			t.Fatalf("unexpected output %q", out.String())
+		}
+	})
+}
+
+func TestRunLogLevel(t *testing.T) {
+	setup()
+	var out bytes.Buffer
+	logger.Info = log.New(&out, "INFO ", 0)
+	talker := &simpleService{
+		serviceName: "talker",
+		binaryName:  writeScript(t, "echo hello"),
+	}
+
+	err := Run(context.Background(), []Service{LogLevel(talker, logger.WarningLevel)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if strings.Contains(out.String(), "talker | hello") {
+		t.Errorf("expected the output of the service to be dropped, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "lines below warning for talker") {
+		t.Errorf("expected a summary of the dropped lines, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "main: all services were shutdown") {
+		t.Errorf("expected the entries of the node to be kept, got %q", out.String())
+	}
+}
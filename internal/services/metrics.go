@@ -0,0 +1,210 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultMetricsAddress is the address of the metrics server by default. It
+// only accepts local connections
+const DefaultMetricsAddress = "127.0.0.1:10012"
+
+// readyBuckets are the buckets of the histogram of the time to ready, in
+// seconds
+var readyBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300}
+
+var (
+	upDesc = prometheus.NewDesc("rollups_service_up",
+		"Whether the service is running.", []string{"service"}, nil)
+	restartsDesc = prometheus.NewDesc("rollups_service_restarts_total",
+		"How many times the service was restarted after failing.", []string{"service"}, nil)
+	exitCodeDesc = prometheus.NewDesc("rollups_service_last_exit_code",
+		"The exit code of the last time the service exited.", []string{"service", "reason"},
+		nil)
+	restartingDesc = prometheus.NewDesc("rollups_service_restarting",
+		"Whether the service waits to be restarted.", []string{"service"}, nil)
+	degradedDesc = prometheus.NewDesc("rollups_service_degraded_seconds_total",
+		"How long the service waited to be restarted.", []string{"service"}, nil)
+	livenessDesc = prometheus.NewDesc("rollups_service_liveness_failures",
+		"How many liveness checks the service failed in a row.", []string{"service"}, nil)
+	unresponsiveDesc = prometheus.NewDesc("rollups_service_unresponsive_total",
+		"How many times the service was found unresponsive.", []string{"service"}, nil)
+	reachableDesc = prometheus.NewDesc("rollups_dependency_reachable",
+		"Whether the dependency was reachable in the last check.", []string{"service"}, nil)
+	dependencyFailuresDesc = prometheus.NewDesc("rollups_dependency_check_failures_total",
+		"How many checks of the dependency of the monitor failed.", []string{"service"}, nil)
+	readyDesc = prometheus.NewDesc("rollups_service_time_to_ready_seconds",
+		"How long the service took to become ready.", []string{"service"}, nil)
+	rssDesc = prometheus.NewDesc("rollups_service_resident_memory_bytes",
+		"The resident memory of the service, as last sampled.", []string{"service"}, nil)
+	cpuDesc = prometheus.NewDesc("rollups_service_last_exit_cpu_seconds",
+		"The CPU time of the last run of the service.", []string{"service", "mode"}, nil)
+	maxRSSDesc = prometheus.NewDesc("rollups_service_last_exit_max_resident_memory_bytes",
+		"The peak resident memory of the last run.", []string{"service"}, nil)
+)
+
+// metricsService exports the metrics of the services of the supervisor that
+// runs it in the Prometheus format
+type metricsService struct {
+	httpServer
+}
+
+// NewMetricsService creates a service that serves the metrics of the node at
+// /metrics on the address, for Prometheus. Like [NewHealthService], it
+// reports on the services run along with it and only reads their status. An
+// empty address means [DefaultMetricsAddress].
+//
+// Besides the metrics of the Go runtime and of the process of the node, it
+// exports the following metrics with a service label:
+//
+//	rollups_service_up                    gauge, 1 while the service runs
+//	rollups_service_restarts_total        counter of the restarts after failures
+//	rollups_service_last_exit_code        gauge, once the service exited
+//	rollups_service_time_to_ready_seconds histogram, once the service is ready
+//
+// The exit code also has a reason label, with the [ExitReason] of the exit.
+//
+// For the services that are restarted (see [RestartPolicy]), it also exports:
+//
+//	rollups_service_restarting             gauge, 1 while it waits to be restarted
+//	rollups_service_degraded_seconds_total counter of the time it waited
+//
+// For the services with liveness checks (see [Liveness]), it also exports:
+//
+//	rollups_service_liveness_failures  gauge of the checks failed in a row
+//	rollups_service_unresponsive_total counter of the stops for failing them
+//
+// For the monitors (see [MonitorService]), once they checked their dependency,
+// it also exports:
+//
+//	rollups_dependency_reachable            gauge of the last check
+//	rollups_dependency_check_failures_total counter of the failed checks
+//
+// For the services backed by processes, it also exports:
+//
+//	rollups_service_resident_memory_bytes               gauge, while sampled
+//	rollups_service_last_exit_cpu_seconds               gauge by mode, user or system
+//	rollups_service_last_exit_max_resident_memory_bytes gauge, once the process exited
+func NewMetricsService(address string) Service {
+	if address == "" {
+		address = DefaultMetricsAddress
+	}
+	return &metricsService{newHttpServer("metrics", address, 0)}
+}
+
+// Start serves the metrics until the context is canceled. It fails unless it
+// is run by a supervisor
+func (s *metricsService) Start(ctx context.Context) error {
+	board := statusBoardFrom(ctx)
+	if board == nil {
+		return errors.New("the metrics service must be run by a supervisor")
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		statusCollector{status: board.snapshot},
+	)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return s.serve(ctx, mux)
+}
+
+// statusCollector turns a snapshot of the status of the services into metrics
+// on every scrape
+type statusCollector struct {
+	status func() []ServiceStatus
+}
+
+func (c statusCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- upDesc
+	descs <- restartsDesc
+	descs <- exitCodeDesc
+	descs <- restartingDesc
+	descs <- degradedDesc
+	descs <- livenessDesc
+	descs <- unresponsiveDesc
+	descs <- reachableDesc
+	descs <- dependencyFailuresDesc
+	descs <- readyDesc
+	descs <- rssDesc
+	descs <- cpuDesc
+	descs <- maxRSSDesc
+}
+
+func (c statusCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, status := range c.status() {
+		up := 0.0
+		if status.State != StatePending && !status.State.done() {
+			up = 1
+		}
+		metrics <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up,
+			status.Name)
+		metrics <- prometheus.MustNewConstMetric(restartsDesc, prometheus.CounterValue,
+			float64(status.Restarts), status.Name)
+		if status.Exited {
+			metrics <- prometheus.MustNewConstMetric(exitCodeDesc, prometheus.GaugeValue,
+				float64(status.ExitCode), status.Name, string(status.ExitReason))
+		}
+		if status.Restart == RestartOnFailure || status.Restart == RestartAlways {
+			restarting := 0.0
+			if status.Restarting {
+				restarting = 1
+			}
+			metrics <- prometheus.MustNewConstMetric(restartingDesc, prometheus.GaugeValue,
+				restarting, status.Name)
+			metrics <- prometheus.MustNewConstMetric(degradedDesc, prometheus.CounterValue,
+				status.Degraded.Seconds(), status.Name)
+		}
+		if status.Liveness {
+			metrics <- prometheus.MustNewConstMetric(livenessDesc, prometheus.GaugeValue,
+				float64(status.LivenessFailures), status.Name)
+			metrics <- prometheus.MustNewConstMetric(unresponsiveDesc, prometheus.CounterValue,
+				float64(status.Unresponsive), status.Name)
+		}
+		if dependency := status.Dependency; dependency != nil {
+			reachable := 0.0
+			if dependency.Reachable {
+				reachable = 1
+			}
+			metrics <- prometheus.MustNewConstMetric(reachableDesc, prometheus.GaugeValue,
+				reachable, status.Name)
+			metrics <- prometheus.MustNewConstMetric(dependencyFailuresDesc,
+				prometheus.CounterValue, float64(dependency.Failures), status.Name)
+		}
+		if status.ReadyAfter > 0 {
+			seconds := status.ReadyAfter.Seconds()
+			buckets := make(map[float64]uint64, len(readyBuckets))
+			for _, bound := range readyBuckets {
+				buckets[bound] = 0
+				if seconds <= bound {
+					buckets[bound] = 1
+				}
+			}
+			metrics <- prometheus.MustNewConstHistogram(readyDesc, 1, seconds, buckets,
+				status.Name)
+		}
+		if status.RSS > 0 {
+			metrics <- prometheus.MustNewConstMetric(rssDesc, prometheus.GaugeValue,
+				float64(status.RSS), status.Name)
+		}
+		if usage := status.Usage; usage != nil {
+			metrics <- prometheus.MustNewConstMetric(cpuDesc, prometheus.GaugeValue,
+				usage.UserTime.Seconds(), status.Name, "user")
+			metrics <- prometheus.MustNewConstMetric(cpuDesc, prometheus.GaugeValue,
+				usage.SystemTime.Seconds(), status.Name, "system")
+			if usage.MaxRSS > 0 {
+				metrics <- prometheus.MustNewConstMetric(maxRSSDesc, prometheus.GaugeValue,
+					float64(usage.MaxRSS), status.Name)
+			}
+		}
+	}
+}
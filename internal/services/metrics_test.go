@@ -0,0 +1,96 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatusCollector(t *testing.T) {
+	collector := statusCollector{status: func() []ServiceStatus {
+		return []ServiceStatus{
+			{Name: "graphql-server", State: StateReady, ReadyAfter: 2 * time.Second},
+			{Name: "indexer", State: StateRunning, Restarts: 3, Exited: true, ExitCode: 137,
+				ExitReason: ExitReasonKilled, Restart: RestartOnFailure,
+				Degraded: 1500 * time.Millisecond},
+			{Name: "dispatcher", State: StatePending},
+		}
+	}}
+
+	expected := `
+# HELP rollups_service_degraded_seconds_total How long the service waited to be restarted.
+# TYPE rollups_service_degraded_seconds_total counter
+rollups_service_degraded_seconds_total{service="indexer"} 1.5
+# HELP rollups_service_last_exit_code The exit code of the last time the service exited.
+# TYPE rollups_service_last_exit_code gauge
+rollups_service_last_exit_code{reason="killed",service="indexer"} 137
+# HELP rollups_service_restarting Whether the service waits to be restarted.
+# TYPE rollups_service_restarting gauge
+rollups_service_restarting{service="indexer"} 0
+# HELP rollups_service_restarts_total How many times the service was restarted after failing.
+# TYPE rollups_service_restarts_total counter
+rollups_service_restarts_total{service="dispatcher"} 0
+rollups_service_restarts_total{service="graphql-server"} 0
+rollups_service_restarts_total{service="indexer"} 3
+# HELP rollups_service_time_to_ready_seconds How long the service took to become ready.
+# TYPE rollups_service_time_to_ready_seconds histogram
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="0.1"} 0
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="0.5"} 0
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="1"} 0
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="5"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="10"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="30"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="60"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="120"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="300"} 1
+rollups_service_time_to_ready_seconds_bucket{service="graphql-server",le="+Inf"} 1
+rollups_service_time_to_ready_seconds_sum{service="graphql-server"} 2
+rollups_service_time_to_ready_seconds_count{service="graphql-server"} 1
+# HELP rollups_service_up Whether the service is running.
+# TYPE rollups_service_up gauge
+rollups_service_up{service="dispatcher"} 0
+rollups_service_up{service="graphql-server"} 1
+rollups_service_up{service="indexer"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetricsService(t *testing.T) {
+	setup()
+	address := freeAddress(t)
+	indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}
+	supervisor := NewSupervisor([]Service{indexer, NewMetricsService(address)})
+	if err := supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer supervisor.Stop(context.Background())
+
+	response, err := http.Get("http://" + address + "/metrics")
+	if err != nil {
+		t.Fatalf("failed to get the metrics: %v", err)
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	for _, metric := range []string{
+		`rollups_service_up{service="indexer"} 1`,
+		`rollups_service_restarts_total{service="indexer"} 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), metric) {
+			t.Errorf("expected the metrics to contain %v, got %s", metric, body)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultMonitorInterval is how often a monitor checks its dependency by
+// default
+const DefaultMonitorInterval = 10 * time.Second
+
+// DefaultMonitorOutage is how long the dependency of a critical monitor may be
+// unreachable by default
+const DefaultMonitorOutage = time.Minute
+
+// ErrDependencyUnreachable is returned by a critical monitor whose dependency
+// stayed unreachable for longer than its outage allows
+var ErrDependencyUnreachable = errors.New("dependency is unreachable")
+
+// MonitorConfig configures a service created by [NewMonitorService]
+type MonitorConfig struct {
+	// Check tells whether the dependency is reachable. It may be any of the
+	// readiness probes, such as a [TcpPortProbe], an [HttpProbe], or a
+	// [PostgresProbe]
+	Check Readiness
+
+	// Interval is the time between two checks. The default is
+	// DefaultMonitorInterval
+	Interval time.Duration
+
+	// Timeout bounds each check. The default is DefaultProbeTimeout
+	Timeout time.Duration
+
+	// Critical makes the monitor exit with [ErrDependencyUnreachable] once
+	// the dependency is unreachable for longer than the outage, which stops
+	// the node unless the monitor is optional or restarted
+	Critical bool
+
+	// Outage is how long the dependency of a critical monitor may be
+	// unreachable. The default is DefaultMonitorOutage
+	Outage time.Duration
+}
+
+// DependencyStatus describes what a monitor knows about its dependency
+type DependencyStatus struct {
+	// Reachable is set if the last check succeeded
+	Reachable bool
+
+	// Since is when the dependency became reachable or unreachable
+	Since time.Time
+
+	// Checks and Failures count the checks and the failed ones
+	Checks   int64
+	Failures int64
+
+	// LastError is the error of the last check that failed
+	LastError error
+}
+
+// MonitorService checks that an external dependency of the node, such as the
+// database or the blockchain provider, is reachable, so an outage is logged
+// once instead of as a cascade of errors of the other services. It logs the
+// transitions between reachable and unreachable and reports the dependency in
+// its status. It never restarts the other services and, unless it is
+// critical, it only exits when it is stopped
+type MonitorService struct {
+	name   string
+	config MonitorConfig
+
+	mutex  sync.Mutex
+	status *DependencyStatus
+}
+
+// NewMonitorService creates a service that checks the dependency at the
+// interval of the config, starting as soon as it starts
+func NewMonitorService(name string, config MonitorConfig) *MonitorService {
+	return &MonitorService{name: name, config: config}
+}
+
+func (s *MonitorService) String() string {
+	return s.name
+}
+
+// Fingerprint describes the check and the settings of the monitor
+func (s *MonitorService) Fingerprint() string {
+	return fmt.Sprintf("%v %T %+v %v %v %v %v", s.name, s.config.Check, s.config.Check,
+		s.config.Interval, s.config.Timeout, s.config.Critical, s.config.Outage)
+}
+
+// Validate checks that the monitor has a well-formed check
+func (s *MonitorService) Validate() error {
+	if s.config.Check == nil {
+		return errors.New("missing check")
+	}
+	if s.config.Interval < 0 || s.config.Timeout < 0 || s.config.Outage < 0 {
+		return errors.New("negative interval, timeout, or outage")
+	}
+	if validator, ok := s.config.Check.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid check: %w", err)
+		}
+	}
+	return nil
+}
+
+// Dependency returns the status of the dependency, or nil before the first
+// check
+func (s *MonitorService) Dependency() *DependencyStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	status := *s.status
+	return &status
+}
+
+func (s *MonitorService) Start(ctx context.Context) error {
+	interval := s.config.Interval
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	filter := logFilterFrom(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.check(ctx, filter); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// check checks the dependency once and logs whether it changed. It returns
+// an error if a critical dependency was unreachable for too long
+func (s *MonitorService) check(ctx context.Context, filter *logFilter) error {
+	timeout := s.config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := s.config.Check.Ready(checkCtx)
+	cancel()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	previous := s.status
+	status := &DependencyStatus{Reachable: err == nil, Since: now}
+	if previous != nil {
+		*status = *previous
+		if previous.Reachable != (err == nil) {
+			status.Reachable, status.Since = err == nil, now
+		}
+	}
+	status.Checks++
+	if err != nil {
+		status.Failures++
+		status.LastError = err
+	}
+	s.status = status
+	s.mutex.Unlock()
+
+	switch {
+	case err == nil && previous == nil:
+		msg := fmt.Sprintf("%v: the dependency is reachable", s.String())
+		filter.log(logger.Info, msg, "service", s.String(), "event", "reachable")
+	case err == nil && !previous.Reachable:
+		outage := now.Sub(previous.Since).Round(time.Millisecond)
+		msg := fmt.Sprintf("%v: the dependency is reachable again after %v", s.String(), outage)
+		filter.log(logger.Info, msg, "service", s.String(), "event", "reachable",
+			"outage", outage)
+	case err != nil && (previous == nil || previous.Reachable):
+		msg := fmt.Sprintf("%v: the dependency is unreachable: %v", s.String(), err)
+		filter.log(logger.Warning, msg, "service", s.String(), "event", "unreachable",
+			"error", err)
+	}
+
+	outage := s.config.Outage
+	if outage <= 0 {
+		outage = DefaultMonitorOutage
+	}
+	if down := now.Sub(status.Since); s.config.Critical && err != nil && down >= outage {
+		return fmt.Errorf("%w for %v: %w", ErrDependencyUnreachable, down.Round(time.Millisecond),
+			err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMonitorService(t *testing.T) {
+	refused := errors.New("connection refused")
+
+	// dependency returns a check that fails while the dependency is down
+	dependency := func(down *atomic.Bool) Readiness {
+		return readinessFunc(func(ctx context.Context) error {
+			if down.Load() {
+				return refused
+			}
+			return nil
+		})
+	}
+
+	// waitForChecks waits for the monitor to check its dependency count more
+	// times
+	waitForChecks := func(t *testing.T, monitor *MonitorService, count int64) {
+		t.Helper()
+		var before int64
+		if status := monitor.Dependency(); status != nil {
+			before = status.Checks
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if status := monitor.Dependency(); status != nil && status.Checks >= before+count {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v more checks, got %+v", count, monitor.Dependency())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("it logs the transitions of the dependency", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		var down atomic.Bool
+		monitor := NewMonitorService("database-monitor", MonitorConfig{
+			Check:    dependency(&down),
+			Interval: time.Millisecond,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- monitor.Start(ctx)
+		}()
+		waitForLog(t, &out, "INFO database-monitor: the dependency is reachable\n")
+		down.Store(true)
+		waitForLog(t, &out, "WARN database-monitor: the dependency is unreachable: "+
+			"connection refused\n")
+		waitForChecks(t, monitor, 3)
+		if count := strings.Count(out.String(), "unreachable"); count != 1 {
+			t.Fatalf("expected the outage to be logged once, got %q", out.String())
+		}
+		status := monitor.Dependency()
+		if status.Reachable || status.Failures < 3 || status.LastError != refused {
+			t.Fatalf("expected an unreachable dependency, got %+v", status)
+		}
+		down.Store(false)
+		waitForLog(t, &out, "INFO database-monitor: the dependency is reachable again after ")
+		cancel()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status := monitor.Dependency(); !status.Reachable || status.LastError != refused {
+			t.Fatalf("expected a reachable dependency with its last error, got %+v", status)
+		}
+	})
+
+	t.Run("it stops promptly during a check", func(t *testing.T) {
+		setup()
+		checking := make(chan struct{})
+		monitor := NewMonitorService("rpc-monitor", MonitorConfig{
+			Check: readinessFunc(func(ctx context.Context) error {
+				close(checking)
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			Timeout: time.Hour,
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- monitor.Start(ctx)
+		}()
+		<-checking
+		cancel()
+		select {
+		case err := <-exit:
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the monitor to stop during the check")
+		}
+		if status := monitor.Dependency(); status != nil {
+			t.Fatalf("expected the canceled check to not count, got %+v", status)
+		}
+	})
+
+	t.Run("it only observes the dependency unless it is critical", func(t *testing.T) {
+		setup()
+		var down atomic.Bool
+		down.Store(true)
+		monitor := NewMonitorService("database-monitor", MonitorConfig{
+			Check:    dependency(&down),
+			Interval: time.Millisecond,
+			Outage:   time.Millisecond,
+		})
+		supervisor := NewSupervisor([]Service{monitor})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForChecks(t, monitor, 10)
+		status := supervisor.Status()[0]
+		if status.State != StateReady || status.Dependency == nil || status.Dependency.Reachable {
+			t.Fatalf("expected a running monitor of an unreachable dependency, got %+v", status)
+		}
+		expected := `
+# HELP rollups_dependency_reachable Whether the dependency was reachable in the last check.
+# TYPE rollups_dependency_reachable gauge
+rollups_dependency_reachable{service="database-monitor"} 0
+`
+		collector := statusCollector{status: supervisor.Status}
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+			"rollups_dependency_reachable")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it stops the node after a sustained outage when critical", func(t *testing.T) {
+		setup()
+		var down atomic.Bool
+		monitor := NewMonitorService("database-monitor", MonitorConfig{
+			Check:    dependency(&down),
+			Interval: time.Millisecond,
+			Critical: true,
+			Outage:   50 * time.Millisecond,
+		})
+		quiet := testService{name: "quiet", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		supervisor := NewSupervisor([]Service{monitor, quiet})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForChecks(t, monitor, 10)
+		down.Store(true)
+		start := time.Now()
+		err := supervisor.Wait()
+		if !errors.Is(err, ErrDependencyUnreachable) || !errors.Is(err, refused) {
+			t.Fatalf("expected the dependency to be unreachable, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Fatalf("expected the node to wait for the outage, stopped after %v", elapsed)
+		}
+	})
+
+	t.Run("it rejects the malformed checks", func(t *testing.T) {
+		cases := map[string]MonitorConfig{
+			"missing check": {},
+			"negative interval": {Check: TcpPortProbe{Host: "127.0.0.1", Port: 5432},
+				Interval: -time.Second},
+			"invalid check": {Check: HttpProbe{URL: "127.0.0.1:8545"}},
+		}
+		for expected, config := range cases {
+			err := NewMonitorService("monitor", config).Validate()
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected the error %q, got %v", expected, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,264 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// ErrInvalidNodeConfig is returned by [NewNodeServices] when the
+// configuration of the node is inconsistent
+var ErrInvalidNodeConfig = errors.New("invalid node configuration")
+
+// NodeConfig configures the services of a node
+type NodeConfig struct {
+	// HostMode runs the application on the host instead of inside a machine,
+	// with the host-runner in place of the server-manager and without
+	// snapshots. It is meant for the development of the application
+	HostMode bool
+
+	// NoBackend runs the node without an application, so it neither runs the
+	// server-manager nor advances or inspects the state of the application
+	NoBackend bool
+
+	// MachineSnapshotDir is the directory of the snapshots of the machine,
+	// where the symlink named latest points to the latest of them. It is
+	// required unless the node runs in host mode or without a backend
+	MachineSnapshotDir string
+
+	// SessionID is the session of the server-manager. The default is
+	// DefaultSessionID
+	SessionID string
+
+	// HealthcheckPort is the first of the ports of the healthcheck endpoints
+	// of the services, which would all bind the same port otherwise. Each
+	// service takes the port at its offset in healthcheckOffsets, whatever the
+	// mode. The default is DefaultHealthcheckPort
+	HealthcheckPort int
+
+	// Disabled lists the names of the services that must not run, such as
+	// graphql-server for the deployments that only use the inspect-server. A
+	// service that an enabled service depends on cannot be disabled
+	Disabled []string
+
+	// PostgresGate makes the services that use the database wait for it to
+	// accept connections when it is set (see [NewPostgresGate])
+	PostgresGate *PostgresGateConfig
+
+	// ProcessConfig configures the processes of all the services, where the
+	// references to the Variables are written as ${NAME}
+	ProcessConfig
+}
+
+// healthcheckOffsets are the offsets of the healthcheck ports of the services
+// from NodeConfig.HealthcheckPort
+var healthcheckOffsets = map[string]int{
+	"graphql-server": 0,
+	"indexer":        1,
+	"dispatcher":     2,
+	"advance-runner": 3,
+	"inspect-server": 4,
+	"host-runner":    5,
+}
+
+// healthcheckPort returns the port of the healthcheck endpoint of the service
+func (c NodeConfig) healthcheckPort(name string) int {
+	base := c.HealthcheckPort
+	if base == 0 {
+		base = DefaultHealthcheckPort
+	}
+	return base + healthcheckOffsets[name]
+}
+
+// nodeServices are the names of the services a node may run. Their positions
+// are part of the exit codes of the node (see [NodeExitCode]), so new services
+// go at the end
+var nodeServices = []string{"postgres", "server-manager", "host-runner", "advance-runner",
+	"inspect-server", "state-server", "dispatcher", "indexer", "graphql-server"}
+
+// dependencies returns the services of the node that each service depends on
+// in the mode of the configuration
+func (c NodeConfig) dependencies() map[string][]string {
+	backend := "server-manager"
+	if c.HostMode {
+		backend = "host-runner"
+	}
+	dependencies := map[string][]string{
+		"advance-runner": {backend},
+		"inspect-server": {backend},
+		"dispatcher":     {"state-server"},
+	}
+	if c.PostgresGate != nil {
+		dependencies["indexer"] = []string{"postgres"}
+		dependencies["graphql-server"] = []string{"postgres"}
+	}
+	return dependencies
+}
+
+// validate returns the problems of the configuration
+func (c NodeConfig) validate() error {
+	var problems []error
+	disabled := make(map[string]bool)
+	for _, name := range c.Disabled {
+		if !slices.Contains(nodeServices, name) {
+			problems = append(problems, fmt.Errorf("cannot disable unknown service '%v'", name))
+		}
+		disabled[name] = true
+	}
+	skipped := c.skipped()
+	for _, name := range nodeServices {
+		if _, ok := skipped[name]; ok {
+			continue
+		}
+		for _, dependency := range c.dependencies()[name] {
+			if disabled[dependency] {
+				problems = append(problems, fmt.Errorf("service '%v' depends on service '%v', "+
+					"which is disabled", name, dependency))
+			}
+		}
+	}
+	if c.HostMode && c.NoBackend {
+		problems = append(problems, errors.New("host mode runs the application on the host, "+
+			"so it cannot run without a backend"))
+	}
+	if c.HostMode && c.MachineSnapshotDir != "" {
+		problems = append(problems, fmt.Errorf("host mode runs the application on the host, "+
+			"so it does not load the machine snapshot at %v", c.MachineSnapshotDir))
+	}
+	if c.NoBackend && c.MachineSnapshotDir != "" {
+		problems = append(problems, fmt.Errorf("the node runs without a backend, so it does "+
+			"not load the machine snapshot at %v", c.MachineSnapshotDir))
+	}
+	if !c.HostMode && !c.NoBackend && c.MachineSnapshotDir == "" {
+		problems = append(problems, errors.New("machine mode requires the directory of the "+
+			"machine snapshots"))
+	}
+	if err := joinProblems(problems); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidNodeConfig, err)
+	}
+	return nil
+}
+
+// skipped returns why each service that the node may run is not part of the
+// mode of the configuration or is disabled, by name
+func (c NodeConfig) skipped() map[string]string {
+	reasons := make(map[string]string)
+	switch {
+	case c.NoBackend:
+		for _, name := range []string{"server-manager", "host-runner", "advance-runner",
+			"inspect-server"} {
+			reasons[name] = "the node runs without a backend"
+		}
+	case c.HostMode:
+		reasons["server-manager"] = "the host-runner replaces it in host mode"
+	default:
+		reasons["host-runner"] = "it only runs in host mode"
+	}
+	if c.PostgresGate == nil {
+		reasons["postgres"] = "the gate of the database is not enabled"
+	}
+	for _, name := range c.Disabled {
+		if _, ok := reasons[name]; !ok {
+			reasons[name] = "it is disabled"
+		}
+	}
+	return reasons
+}
+
+// NewNodeServices returns the services of a node: the gate of the database,
+// the backend that runs the application, the state-server and the
+// dispatcher, and the indexer and the graphql-server. In machine mode the
+// backend is the server-manager and the advance-runner, with its snapshots,
+// and in host mode it is the host-runner and the advance-runner, without
+// snapshots. The inspect-server is part of the backend in both modes. Each
+// service declares the services it depends on (see [DependsOn]), so the
+// others start in parallel: the advance-runner and the inspect-server once
+// the server-manager or the host-runner is ready, the dispatcher once the
+// state-server is, and the indexer and the graphql-server once the gate of
+// the database opened. The services added to the list start in parallel
+// with them unless they declare their own dependencies. The services that do
+// not run are logged with the reason. It returns [ErrInvalidNodeConfig] when
+// the configuration is inconsistent
+func NewNodeServices(config NodeConfig) ([]Service, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	list := config.services()
+	skipped := config.skipped()
+	dependencies := config.dependencies()
+	enabled := make([]Service, 0, len(list))
+	for _, service := range list {
+		name := service.String()
+		if _, ok := skipped[name]; !ok {
+			enabled = append(enabled, DependsOn(service, dependencies[name]...))
+		}
+	}
+	for _, name := range nodeServices {
+		if reason, ok := skipped[name]; ok {
+			logger.Log(logger.Info, fmt.Sprintf("main: skipping %v: %v", name, reason),
+				"service", name, "event", "skipped", "reason", reason)
+		}
+	}
+	return enabled, nil
+}
+
+// services returns the services of the mode of the configuration
+func (c NodeConfig) services() []Service {
+	sessionID := valueOr(c.SessionID, DefaultSessionID)
+	var list []Service
+	if c.PostgresGate != nil {
+		list = append(list, NewPostgresGate(*c.PostgresGate))
+	}
+	if !c.NoBackend {
+		advanceRunner := AdvanceRunnerConfig{
+			SessionID:       sessionID,
+			HealthcheckPort: c.healthcheckPort("advance-runner"),
+			ProcessConfig:   c.ProcessConfig,
+		}
+		if c.HostMode {
+			list = append(list, NewHostRunner(HostRunnerConfig{
+				HealthcheckPort: c.healthcheckPort("host-runner"),
+				ProcessConfig:   c.ProcessConfig,
+			}))
+			advanceRunner.DisableSnapshots = true
+		} else {
+			list = append(list, NewServerManager(ServerManagerConfig{
+				ProcessConfig: c.ProcessConfig,
+			}))
+			advanceRunner.SnapshotDir = c.MachineSnapshotDir
+			advanceRunner.SnapshotLatest = filepath.Join(c.MachineSnapshotDir, "latest")
+		}
+		list = append(list,
+			NewAdvanceRunner(advanceRunner),
+			NewInspectServer(InspectServerConfig{
+				SessionID:       sessionID,
+				HealthcheckPort: c.healthcheckPort("inspect-server"),
+				ProcessConfig:   c.ProcessConfig,
+			}),
+		)
+	}
+	list = append(list,
+		NewStateServer(StateServerConfig{
+			ProcessConfig: c.ProcessConfig,
+		}),
+		NewDispatcher(DispatcherConfig{
+			HttpServerPort: c.healthcheckPort("dispatcher"),
+			ProcessConfig:  c.ProcessConfig,
+		}),
+		NewIndexer(IndexerConfig{
+			HealthcheckPort: c.healthcheckPort("indexer"),
+			ProcessConfig:   c.ProcessConfig,
+		}),
+		NewGraphQLServer(GraphQLServerConfig{
+			HealthcheckPort: c.healthcheckPort("graphql-server"),
+			ProcessConfig:   c.ProcessConfig,
+		}),
+	)
+	return list
+}
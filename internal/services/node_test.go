@@ -0,0 +1,253 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestNewNodeServices(t *testing.T) {
+
+	// names returns the names of the services, in order
+	names := func(list []Service) []string {
+		result := make([]string, len(list))
+		for i, service := range list {
+			result[i] = service.String()
+		}
+		return result
+	}
+
+	// find returns the command service with the name
+	find := func(t *testing.T, list []Service, name string) *simpleService {
+		t.Helper()
+		for _, service := range list {
+			if service.String() == name {
+				return specOf(service).Service.(*simpleService)
+			}
+		}
+		t.Fatalf("expected service %v in %v", name, names(list))
+		return nil
+	}
+
+	t.Run("it runs the server-manager in machine mode", func(t *testing.T) {
+		list, err := NewNodeServices(NodeConfig{MachineSnapshotDir: "/var/opt/cartesi/snapshots"})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"server-manager", "advance-runner", "inspect-server", "state-server",
+			"dispatcher", "indexer", "graphql-server"}
+		if got := names(list); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		args := find(t, list, "advance-runner").command().Args
+		if !slices.Contains(args, "/var/opt/cartesi/snapshots/latest") {
+			t.Fatalf("expected the advance-runner to load the latest snapshot, got %v", args)
+		}
+	})
+
+	t.Run("it runs the host-runner in host mode", func(t *testing.T) {
+		list, err := NewNodeServices(NodeConfig{HostMode: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"host-runner", "advance-runner", "inspect-server", "state-server",
+			"dispatcher", "indexer", "graphql-server"}
+		if got := names(list); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		env := find(t, list, "advance-runner").command().Env
+		if !slices.Contains(env, "SNAPSHOT_ENABLED=false") {
+			t.Fatalf("expected the snapshots to be disabled, got %v", env)
+		}
+	})
+
+	t.Run("it runs no backend", func(t *testing.T) {
+		list, err := NewNodeServices(NodeConfig{NoBackend: true})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"state-server", "dispatcher", "indexer", "graphql-server"}
+		if got := names(list); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("it puts the gate of the database first", func(t *testing.T) {
+		list, err := NewNodeServices(NodeConfig{
+			HostMode:     true,
+			PostgresGate: &PostgresGateConfig{URL: "postgres://db/rollups"},
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if got := names(list); got[0] != "postgres" || !specOf(list[0]).OneShot {
+			t.Fatalf("expected the one-shot gate first, got %v", got)
+		}
+	})
+
+	t.Run("it gives each service its own healthcheck port", func(t *testing.T) {
+		for _, config := range []NodeConfig{
+			{HostMode: true, HealthcheckPort: 9000},
+			{MachineSnapshotDir: "/snapshots"},
+		} {
+			list, err := NewNodeServices(config)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			specs := make([]ServiceSpec, len(list))
+			for i, service := range list {
+				specs[i] = specOf(service)
+			}
+			problems := &validationError{}
+			problems.checkPorts(specs, heldPorts(specs))
+			if err := problems.orNil(); err != nil {
+				t.Fatalf("expected no port to be claimed twice, got %v", err)
+			}
+		}
+		list, _ := NewNodeServices(NodeConfig{HostMode: true, HealthcheckPort: 9000})
+		args := find(t, list, "indexer").command().Args
+		if !reflect.DeepEqual(args[1:], []string{"--healthcheck-port", "9001"}) {
+			t.Fatalf("expected the indexer on the healthcheck port 9001, got %v", args)
+		}
+	})
+
+	t.Run("it rejects inconsistent configurations", func(t *testing.T) {
+		cases := map[string]NodeConfig{
+			"cannot run without a backend":          {HostMode: true, NoBackend: true},
+			"does not load the machine snapshot at": {HostMode: true, MachineSnapshotDir: "/s"},
+			"requires the directory of the machine": {},
+			"not load the machine snapshot at /s":   {NoBackend: true, MachineSnapshotDir: "/s"},
+		}
+		for expected, config := range cases {
+			_, err := NewNodeServices(config)
+			if !errors.Is(err, ErrInvalidNodeConfig) || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected %+v to be rejected with %q, got %v", config, expected, err)
+			}
+		}
+	})
+
+	t.Run("it checks the dependencies of the disabled services", func(t *testing.T) {
+		machine := "/snapshots"
+		gate := &PostgresGateConfig{URL: "postgres://db/rollups"}
+		cases := []struct {
+			description string
+			config      NodeConfig
+			expected    []string
+			err         string
+		}{{
+			description: "graphql-server disabled",
+			config: NodeConfig{MachineSnapshotDir: machine,
+				Disabled: []string{"graphql-server"}},
+			expected: []string{"server-manager", "advance-runner", "inspect-server",
+				"state-server", "dispatcher", "indexer"},
+		}, {
+			description: "state-server disabled with the dispatcher",
+			config: NodeConfig{NoBackend: true,
+				Disabled: []string{"state-server", "dispatcher"}},
+			expected: []string{"indexer", "graphql-server"},
+		}, {
+			description: "state-server disabled without the dispatcher",
+			config:      NodeConfig{NoBackend: true, Disabled: []string{"state-server"}},
+			err:         "service 'dispatcher' depends on service 'state-server'",
+		}, {
+			description: "server-manager disabled in machine mode",
+			config: NodeConfig{MachineSnapshotDir: machine,
+				Disabled: []string{"server-manager"}},
+			err: "service 'advance-runner' depends on service 'server-manager', which is " +
+				"disabled; service 'inspect-server' depends on service 'server-manager'",
+		}, {
+			description: "server-manager disabled in host mode",
+			config:      NodeConfig{HostMode: true, Disabled: []string{"server-manager"}},
+			expected: []string{"host-runner", "advance-runner", "inspect-server",
+				"state-server", "dispatcher", "indexer", "graphql-server"},
+		}, {
+			description: "backend disabled in host mode",
+			config: NodeConfig{HostMode: true,
+				Disabled: []string{"host-runner", "advance-runner", "inspect-server"}},
+			expected: []string{"state-server", "dispatcher", "indexer", "graphql-server"},
+		}, {
+			description: "gate disabled",
+			config: NodeConfig{NoBackend: true, PostgresGate: gate,
+				Disabled: []string{"postgres", "graphql-server"}},
+			err: "service 'indexer' depends on service 'postgres', which is disabled",
+		}, {
+			description: "unknown service disabled",
+			config:      NodeConfig{NoBackend: true, Disabled: []string{"graphql"}},
+			err:         "cannot disable unknown service 'graphql'",
+		}}
+		for _, c := range cases {
+			list, err := NewNodeServices(c.config)
+			if c.err != "" {
+				if !errors.Is(err, ErrInvalidNodeConfig) || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("%v: expected the error %q, got %v", c.description, c.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", c.description, err)
+			} else if got := names(list); !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("%v: expected %v, got %v", c.description, c.expected, got)
+			}
+		}
+	})
+
+	t.Run("it logs the skipped services", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		_, err := NewNodeServices(NodeConfig{HostMode: true, Disabled: []string{"graphql-server"}})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, expected := range []string{
+			"main: skipping server-manager: the host-runner replaces it in host mode",
+			"main: skipping graphql-server: it is disabled",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q in the log, got %q", expected, out.String())
+			}
+		}
+	})
+
+	t.Run("it declares the dependencies of the services", func(t *testing.T) {
+		gate := &PostgresGateConfig{URL: "postgres://db/rollups"}
+		list, err := NewNodeServices(NodeConfig{HostMode: true, PostgresGate: gate})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		specs := make([]ServiceSpec, len(list))
+		for i, service := range list {
+			specs[i] = specOf(service)
+		}
+		deps, err := resolveDependencies(specs)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		dependencies := make(map[string][]string)
+		for i, indexes := range deps {
+			for _, index := range indexes {
+				name := specs[i].String()
+				dependencies[name] = append(dependencies[name], specs[index].String())
+			}
+		}
+		expected := map[string][]string{
+			"advance-runner": {"host-runner"},
+			"inspect-server": {"host-runner"},
+			"dispatcher":     {"state-server"},
+			"indexer":        {"postgres"},
+			"graphql-server": {"postgres"},
+		}
+		if !reflect.DeepEqual(dependencies, expected) {
+			t.Fatalf("expected %v, got %v", expected, dependencies)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build !race
+
+package services
+
+// raceEnabled is set when the tests run with the race detector
+const raceEnabled = false
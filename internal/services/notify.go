@@ -0,0 +1,107 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifier sends notifications to the service manager of the node, following
+// the sd_notify protocol of systemd. A nil notifier does nothing
+type notifier struct {
+	conn *net.UnixConn
+
+	// watchdog is how often the service manager expects the node to ping it,
+	// or zero if the watchdog is disabled
+	watchdog time.Duration
+}
+
+// newNotifier creates a notifier for the socket in NOTIFY_SOCKET. It returns
+// nil when the variable is not set, which means the node was not started by a
+// service manager that expects notifications
+func newNotifier() (*notifier, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil, nil
+	}
+	// a leading @ stands for the abstract namespace of Linux
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the notify socket: %w", err)
+	}
+	watchdog, err := watchdogInterval()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &notifier{conn: conn, watchdog: watchdog}, nil
+}
+
+// watchdogInterval returns the interval of the watchdog in WATCHDOG_USEC, or
+// zero when it is not set or is meant for another process
+func watchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	usec, err := strconv.ParseUint(value, 10, 63)
+	if err != nil || usec == 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC: %q", value)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// notify sends the assignments, such as READY=1, in a single datagram
+func (n *notifier) notify(assignments ...string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(strings.Join(assignments, "\n")))
+	return err
+}
+
+// close closes the socket
+func (n *notifier) close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
+
+// notifyStates are the states in the order they are summarized
+var notifyStates = []ServiceState{
+	StateReady, StateRunning, StateStarting, StatePending, StateStopping, StateExited,
+	StateFailed,
+}
+
+// statusSummary summarizes the states of the services for the STATUS
+// notification, such as "2/3 services up: 2 ready, 1 starting"
+func statusSummary(statuses []ServiceStatus) string {
+	counts := make(map[ServiceState]int)
+	up := 0
+	for _, status := range statuses {
+		counts[status.State]++
+		if status.State == StateReady || status.State == StateRunning {
+			up++
+		}
+	}
+	var parts []string
+	for _, state := range notifyStates {
+		if counts[state] > 0 {
+			parts = append(parts, fmt.Sprintf("%v %v", counts[state], state))
+		}
+	}
+	return fmt.Sprintf("%v/%v services up: %v", up, len(statuses), strings.Join(parts, ", "))
+}
@@ -0,0 +1,169 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+
+	t.Run("it does nothing without a notify socket", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", "")
+		notifier, err := newNotifier()
+		if notifier != nil || err != nil {
+			t.Fatalf("expected no notifier, got %v %v", notifier, err)
+		}
+		if err := notifier.notify("READY=1"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it sends the assignments in a datagram", func(t *testing.T) {
+		socket := listenNotify(t)
+		notifier, err := newNotifier()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer notifier.close()
+		if err := notifier.notify("READY=1", "STATUS=ok"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if message := readNotify(t, socket); message != "READY=1\nSTATUS=ok" {
+			t.Fatalf("unexpected message %q", message)
+		}
+	})
+
+	t.Run("it supports abstract sockets", func(t *testing.T) {
+		name := "@rollups-node-test-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+		address := &net.UnixAddr{Name: "\x00" + name[1:], Net: "unixgram"}
+		socket, err := net.ListenUnixgram("unixgram", address)
+		if err != nil {
+			t.Skipf("abstract sockets are not supported: %v", err)
+		}
+		defer socket.Close()
+		t.Setenv("NOTIFY_SOCKET", name)
+		t.Setenv("WATCHDOG_USEC", "")
+		notifier, err := newNotifier()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer notifier.close()
+		_ = notifier.notify("READY=1")
+		if message := readNotify(t, socket); message != "READY=1" {
+			t.Fatalf("unexpected message %q", message)
+		}
+	})
+
+	t.Run("it fails when the socket does not exist", func(t *testing.T) {
+		t.Setenv("NOTIFY_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+		if _, err := newNotifier(); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("it reads the interval of the watchdog", func(t *testing.T) {
+		pid := strconv.Itoa(os.Getpid())
+		for _, test := range []struct {
+			usec     string
+			pid      string
+			expected time.Duration
+			fails    bool
+		}{
+			{usec: "", expected: 0},
+			{usec: "30000000", expected: 30 * time.Second},
+			{usec: "30000000", pid: pid, expected: 30 * time.Second},
+			{usec: "30000000", pid: "1", expected: 0},
+			{usec: "0", fails: true},
+			{usec: "soon", fails: true},
+		} {
+			t.Setenv("WATCHDOG_USEC", test.usec)
+			t.Setenv("WATCHDOG_PID", test.pid)
+			interval, err := watchdogInterval()
+			if (err != nil) != test.fails || interval != test.expected {
+				t.Errorf("expected %v for %+v, got %v %v", test.expected, test, interval, err)
+			}
+		}
+	})
+
+	t.Run("it summarizes the states of the services", func(t *testing.T) {
+		summary := statusSummary([]ServiceStatus{
+			{Name: "a", State: StateReady},
+			{Name: "b", State: StateStarting},
+			{Name: "c", State: StateReady},
+			{Name: "d", State: StatePending},
+		})
+		if summary != "2/4 services up: 2 ready, 1 starting, 1 pending" {
+			t.Fatalf("unexpected summary %q", summary)
+		}
+	})
+}
+
+func TestRunNotify(t *testing.T) {
+	setup()
+	socket := listenNotify(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	service := testService{name: "indexer", start: func(ctx context.Context) error {
+		<-ctx.Done()
+		return nil
+	}}
+	supervisor := NewSupervisor([]Service{service})
+	if err := supervisor.Start(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expect := func(assignment string) string {
+		t.Helper()
+		for {
+			message := readNotify(t, socket)
+			if strings.HasPrefix(message, assignment+"\n") {
+				return message
+			}
+		}
+	}
+	message := expect("READY=1")
+	if !strings.Contains(message, "STATUS=1/1 services up: 1 ready") {
+		t.Errorf("expected the status of the services, got %q", message)
+	}
+	expect("WATCHDOG=1")
+
+	if err := supervisor.Stop(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expect("STOPPING=1")
+}
+
+// listenNotify listens on a fake notify socket and sets NOTIFY_SOCKET to it
+func listenNotify(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen on the notify socket: %v", err)
+	}
+	t.Cleanup(func() { socket.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "")
+	return socket
+}
+
+// readNotify reads a message from the fake notify socket, failing the test
+// after a second
+func readNotify(t *testing.T, socket *net.UnixConn) string {
+	t.Helper()
+	buffer := make([]byte, 4096)
+	_ = socket.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := socket.Read(buffer)
+	if err != nil {
+		t.Fatalf("failed to read a notification: %v", err)
+	}
+	return string(buffer[:n])
+}
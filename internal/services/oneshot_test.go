@@ -0,0 +1,100 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOneShot(t *testing.T) {
+
+	t.Run("it starts the dependents after the one-shot succeeds", func(t *testing.T) {
+		setup()
+		var migrated atomic.Bool
+		migrate := OneShot(testService{name: "migrate", start: func(ctx context.Context) error {
+			time.Sleep(10 * time.Millisecond)
+			migrated.Store(true)
+			return nil
+		}})
+		startedAfter := make(chan bool, 1)
+		indexer := DependsOn(testService{name: "indexer", start: func(ctx context.Context) error {
+			startedAfter <- migrated.Load()
+			<-ctx.Done()
+			return nil
+		}}, "migrate")
+
+		supervisor := NewSupervisor([]Service{migrate, indexer})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForStates(t, supervisor, StateExited, StateReady)
+		if !<-startedAfter {
+			t.Fatal("expected the indexer to start after the migrations")
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it aborts the startup when the one-shot fails", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		var attempts atomic.Int32
+		migrate := OneShot(testService{name: "migrate", start: func(ctx context.Context) error {
+			attempts.Add(1)
+			return boom
+		}})
+		indexer := DependsOn(testService{name: "indexer", start: func(ctx context.Context) error {
+			t.Error("expected the indexer to not be started")
+			return nil
+		}}, "migrate")
+
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+		err := Run(context.Background(), []Service{migrate, indexer},
+			WithRestartOnFailure(backoff))
+		if !errors.Is(err, boom) || err.Error() != "service 'migrate' exited with error: boom" {
+			t.Fatalf("expected the error of the one-shot, got %v", err)
+		}
+		if attempts.Load() != 1 {
+			t.Fatalf("expected the one-shot to not be restarted, got %v attempts", attempts.Load())
+		}
+	})
+
+	t.Run("it stops a one-shot that is canceled while it runs", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		migrate := OneShot(testService{name: "migrate", start: func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return nil
+		}})
+		indexer := DependsOn(testService{name: "indexer", start: func(ctx context.Context) error {
+			t.Error("expected the indexer to not be started")
+			return nil
+		}}, "migrate")
+
+		if err := Run(ctx, []Service{migrate, indexer}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it runs one-shot commands with their arguments", func(t *testing.T) {
+		setup()
+		migrations := NewOneShotCommand("migrations", writeScript(t, `test "$1" = up`), "up")
+		failing := NewOneShotCommand("migrations", writeScript(t, `test "$1" = up`), "down")
+
+		if err := Run(context.Background(), []Service{migrations}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var exitErr *ExitError
+		err := Run(context.Background(), []Service{failing})
+		if !errors.As(err, &exitErr) || exitErr.ExitCode != 1 {
+			t.Fatalf("expected the command to fail, got %v", err)
+		}
+	})
+}
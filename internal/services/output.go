@@ -0,0 +1,344 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultMaxLineSize is the size in bytes after which a line of output is
+// truncated by default, so a process that writes huge lines or never writes
+// newlines cannot make the buffer grow forever
+const DefaultMaxLineSize = 64 * 1024
+
+// truncatedMarker is appended to the lines that were truncated
+const truncatedMarker = " [truncated]"
+
+// outputWaitDelay is how long to wait for the output of a process to be
+// closed after it exits. Children that inherited the output of the process
+// may keep it open
+const outputWaitDelay = time.Second
+
+// lineWriter logs each line written by a process, prefixed with the service
+// name. Loggers serialize their entries, so lines written at the same time by
+// different processes are never mixed
+type lineWriter struct {
+	out     *log.Logger
+	name    string
+	filter  *logFilter
+	repeats *repeatFilter
+	budget  *outputBudget
+	maxLine int
+	buffer  []byte
+
+	// color is the color of the name of the service, if the console is
+	// colored
+	color string
+
+	// timeLayout is the format of the time each line is read, which is
+	// added to the line when it is set
+	timeLayout string
+	clock      Clock
+
+	// truncating is set while the rest of a truncated line is dropped
+	truncating bool
+}
+
+func newLineWriter(out *log.Logger, name string) *lineWriter {
+	return &lineWriter{out: out, name: name, maxLine: DefaultMaxLineSize}
+}
+
+// limitOutput makes the writers truncate long lines and share the budget of the
+// limit, if it has one
+func limitOutput(limit OutputLimit, clock Clock, writers ...*lineWriter) {
+	var budget *outputBudget
+	if limit.BytesPerSecond > 0 {
+		budget = &outputBudget{limit: limit.BytesPerSecond, clock: clock}
+	}
+	for _, w := range writers {
+		if limit.MaxLineSize > 0 {
+			w.maxLine = limit.MaxLineSize
+		}
+		w.budget = budget
+	}
+}
+
+// captureTimestamps makes the writers add to each line the time the line was
+// read, in UTC with the precision
+func captureTimestamps(precision time.Duration, clock Clock, writers ...*lineWriter) {
+	layout := "2006-01-02T15:04:05"
+	switch {
+	case precision >= time.Second:
+	case precision >= time.Millisecond:
+		layout += ".000"
+	case precision >= time.Microsecond:
+		layout += ".000000"
+	default:
+		layout += ".000000000"
+	}
+	for _, w := range writers {
+		w.timeLayout, w.clock = layout+"Z07:00", clock
+	}
+}
+
+// Write buffers partial lines until their newline is written. The buffer
+// never holds more than the maximum size of a line: the rest of a longer line
+// is dropped until its newline
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		end := bytes.IndexByte(p, '\n')
+		if w.truncating {
+			if end == -1 {
+				break
+			}
+			w.truncating = false
+			p = p[end+1:]
+			continue
+		}
+		room := w.maxLine - len(w.buffer)
+		switch {
+		case end != -1 && end <= room:
+			w.buffer = append(w.buffer, p[:end+1]...)
+			w.writeLine(w.buffer)
+			w.buffer = w.buffer[:0]
+			p = p[end+1:]
+		case end == -1 && len(p) <= room:
+			w.buffer = append(w.buffer, p...)
+			p = nil
+		default:
+			w.buffer = append(w.buffer, p[:room]...)
+			w.writeLine(append(truncateLine(w.buffer), truncatedMarker...))
+			w.buffer = w.buffer[:0]
+			w.truncating = true
+			p = p[room:]
+		}
+	}
+	return n, nil
+}
+
+// truncateLine drops the bytes at the end of the line that belong to a rune
+// cut short by the truncation, so the line is still valid UTF-8
+func truncateLine(line []byte) []byte {
+	for i := len(line) - 1; i >= 0 && i >= len(line)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(line[i]) {
+			if !utf8.FullRune(line[i:]) {
+				return line[:i]
+			}
+			break
+		}
+	}
+	return line
+}
+
+// Flush writes the partial line left by a process that exited without
+// writing its last newline
+func (w *lineWriter) Flush() error {
+	if len(w.buffer) > 0 {
+		w.writeLine(w.buffer)
+		w.buffer = w.buffer[:0]
+	}
+	w.truncating = false
+	w.reportRepeats()
+	w.reportDropped()
+	return nil
+}
+
+func (w *lineWriter) writeLine(line []byte) {
+	var captured string
+	if w.timeLayout != "" {
+		captured = w.clock.Now().UTC().Format(w.timeLayout)
+	}
+	text := string(bytes.TrimSuffix(line, []byte("\n")))
+	if w.repeats != nil {
+		allowed, suppressed := w.repeats.check(text)
+		w.logRepeats(suppressed)
+		if !allowed {
+			return
+		}
+	}
+	if w.budget != nil {
+		allowed, dropped := w.budget.take(len(text))
+		w.logDropped(dropped)
+		if !allowed {
+			return
+		}
+	}
+	msg, args := w.prefix()+text, []any{"service", w.name}
+	if captured != "" && logger.IsJSON() {
+		args = append(args, "captured_at", captured)
+	} else if captured != "" {
+		msg = captured + " " + msg
+	}
+	w.filter.log(w.out, msg, args...)
+}
+
+// prefix returns the name of the service that begins each line
+func (w *lineWriter) prefix() string {
+	if w.color != "" {
+		return colorize(w.name, w.color) + " | "
+	}
+	return w.name + " | "
+}
+
+// reportDropped logs how many bytes were dropped since the last report
+func (w *lineWriter) reportDropped() {
+	if w.budget != nil {
+		w.logDropped(w.budget.takeDropped())
+	}
+}
+
+func (w *lineWriter) logDropped(dropped int) {
+	if dropped > 0 {
+		msg := fmt.Sprintf("%v%v bytes dropped over the limit of %v bytes per second",
+			w.prefix(), dropped, w.budget.limit)
+		w.filter.log(w.out, msg, "service", w.name, "event", "output_dropped", "bytes", dropped)
+	}
+}
+
+// reportRepeats logs how many times the last line was suppressed
+func (w *lineWriter) reportRepeats() {
+	if w.repeats != nil {
+		w.logRepeats(w.repeats.takeSuppressed())
+	}
+}
+
+func (w *lineWriter) logRepeats(suppressed int) {
+	if suppressed > 0 {
+		msg := fmt.Sprintf("%vlast message repeated %v times", w.prefix(), suppressed)
+		w.filter.log(w.out, msg, "service", w.name, "event", "repeated", "count", suppressed)
+	}
+}
+
+// RepeatLimit limits how many times in a row the same line of a service is
+// logged
+type RepeatLimit struct {
+	// Window is how long a line counts as repeated after it is logged. Once
+	// it elapses, the number of suppressed repetitions is logged
+	Window time.Duration
+
+	// Threshold is how many times in a row the same line is logged within
+	// the window before it is suppressed. The default is 1
+	Threshold int
+}
+
+// repeatFilter suppresses a line that repeats the previous one within the
+// window of its limit
+type repeatFilter struct {
+	limit      RepeatLimit
+	clock      Clock
+	last       string
+	since      time.Time
+	count      int
+	suppressed int
+}
+
+func newRepeatFilter(limit RepeatLimit, clock Clock) *repeatFilter {
+	if limit.Threshold == 0 {
+		limit.Threshold = 1
+	}
+	return &repeatFilter{limit: limit, clock: clock}
+}
+
+// check reports whether the line should be logged. It also returns how many
+// repetitions of the previous line were suppressed, when they must be
+// reported before the line: because the line is different or because the
+// window elapsed
+func (f *repeatFilter) check(line string) (allowed bool, suppressed int) {
+	now := f.clock.Now()
+	if f.count > 0 && line == f.last && now.Sub(f.since) < f.limit.Window {
+		f.count++
+		if f.count > f.limit.Threshold {
+			f.suppressed++
+			return false, 0
+		}
+		return true, 0
+	}
+	suppressed = f.takeSuppressed()
+	f.last, f.since, f.count = line, now, 1
+	return true, suppressed
+}
+
+func (f *repeatFilter) takeSuppressed() int {
+	suppressed := f.suppressed
+	f.suppressed = 0
+	return suppressed
+}
+
+// OutputLimit bounds the output of a service that is logged
+type OutputLimit struct {
+	// MaxLineSize is the size in bytes after which a line is truncated,
+	// dropping the rest of it. The default is DefaultMaxLineSize
+	MaxLineSize int
+
+	// BytesPerSecond is how many bytes of output of the service are logged
+	// each second. The lines over it are dropped, and how many bytes were
+	// dropped is logged once the second is over. By default, all lines are
+	// logged
+	BytesPerSecond int
+}
+
+// outputBudget is how many bytes the writers of a service may still log in
+// the current second. It is shared by the stdout and stderr of the service
+type outputBudget struct {
+	mutex   sync.Mutex
+	limit   int
+	clock   Clock
+	window  time.Time
+	used    int
+	dropped int
+}
+
+// take reports whether a line of n bytes fits in the budget of the current
+// second. It also returns how many bytes were dropped in the previous second,
+// when the line begins a new one
+func (b *outputBudget) take(n int) (allowed bool, dropped int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now := b.clock.Now(); now.Sub(b.window) >= time.Second {
+		dropped = b.dropped
+		b.window, b.used, b.dropped = now, 0, 0
+	}
+	if b.used+n > b.limit {
+		b.dropped += n
+		return false, dropped
+	}
+	b.used += n
+	return true, dropped
+}
+
+func (b *outputBudget) takeDropped() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	dropped := b.dropped
+	b.dropped = 0
+	return dropped
+}
+
+// flushOutput flushes the writers that buffer partial lines
+func flushOutput(writers ...io.Writer) {
+	for _, writer := range writers {
+		if w := lineWriterOf(writer); w != nil {
+			_ = w.Flush()
+		}
+	}
+}
+
+// lineWriterOf returns the lineWriter that logs the output written to the
+// writer, if there is one
+func lineWriterOf(writer io.Writer) *lineWriter {
+	if tee, ok := writer.(teeWriter); ok {
+		writer = tee.console
+	}
+	w, _ := writer.(*lineWriter)
+	return w
+}
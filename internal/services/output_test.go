@@ -0,0 +1,331 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestLineWriter(t *testing.T) {
+
+	t.Run("it prefixes each line with the service name", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+
+		fmt.Fprint(w, "listening on :8080\nconnected\n")
+
+		expected := "indexer | listening on :8080\nindexer | connected\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it buffers partial lines until their newline", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+
+		fmt.Fprint(w, "listen")
+		if out.Len() != 0 {
+			t.Fatalf("expected the partial line to be buffered, got %q", out.String())
+		}
+		fmt.Fprint(w, "ing\n")
+
+		if out.String() != "indexer | listening\n" {
+			t.Fatalf("expected the joined line, got %q", out.String())
+		}
+	})
+
+	t.Run("it flushes the last partial line", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+
+		fmt.Fprint(w, "exiting")
+		if err := w.Flush(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if out.String() != "indexer | exiting\n" {
+			t.Fatalf("expected the flushed line, got %q", out.String())
+		}
+	})
+
+	t.Run("it truncates lines that are too long", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		limitOutput(OutputLimit{MaxLineSize: 8}, realClock{}, w)
+
+		fmt.Fprint(w, "0123456789")
+		fmt.Fprint(w, "abcdef")
+		fmt.Fprintln(w, "ghi")
+		fmt.Fprintln(w, "01234567")
+		fmt.Fprintln(w, "short")
+
+		expected := "indexer | 01234567 [truncated]\n" +
+			"indexer | 01234567\n" +
+			"indexer | short\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it does not cut the runes of truncated lines", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		limitOutput(OutputLimit{MaxLineSize: 6}, realClock{}, w)
+
+		// each rune takes 3 bytes, and the second one does not fit
+		fmt.Fprintln(w, "aa€€€")
+		fmt.Fprintln(w, "a€€")
+
+		expected := "indexer | aa€ [truncated]\n" +
+			"indexer | a€ [truncated]\n"
+		if out.String() != expected || !utf8.ValidString(out.String()) {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it keeps the memory bounded for pathological output", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		chunk := bytes.Repeat([]byte("a"), 32*1024)
+
+		// a single line of 64MiB without a newline
+		for i := 0; i < 2048; i++ {
+			if n, err := w.Write(chunk); n != len(chunk) || err != nil {
+				t.Fatalf("expected the whole chunk to be written, got %v (%v)", n, err)
+			}
+			if cap(w.buffer) > 2*DefaultMaxLineSize {
+				t.Fatalf("expected the buffer to be bounded, got %v bytes", cap(w.buffer))
+			}
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "next")
+		_ = w.Flush()
+
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != 2 || lines[1] != "indexer | next" {
+			t.Fatalf("expected the truncated line and the next one, got %v lines", len(lines))
+		}
+		expected := "indexer | " + strings.Repeat("a", DefaultMaxLineSize) + truncatedMarker
+		if lines[0] != expected {
+			t.Fatalf("expected the line to be truncated, got %v bytes", len(lines[0]))
+		}
+	})
+
+	t.Run("it drops the output over the budget", func(t *testing.T) {
+		var out bytes.Buffer
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		stdout := newLineWriter(log.New(&out, "", 0), "indexer")
+		stderr := newLineWriter(log.New(&out, "", 0), "indexer")
+		limitOutput(OutputLimit{BytesPerSecond: 10}, clock, stdout, stderr)
+
+		fmt.Fprintln(stdout, "12345")
+		fmt.Fprintln(stderr, "1234")
+		fmt.Fprintln(stdout, "12345")
+		fmt.Fprintln(stderr, "123")
+		fmt.Fprintln(stdout, "1")
+		clock.Advance(time.Second)
+		fmt.Fprintln(stderr, "next")
+		fmt.Fprintln(stdout, "1234567")
+		_ = stdout.Flush()
+		_ = stderr.Flush()
+
+		expected := "indexer | 12345\n" +
+			"indexer | 1234\n" +
+			"indexer | 1\n" +
+			"indexer | 8 bytes dropped over the limit of 10 bytes per second\n" +
+			"indexer | next\n" +
+			"indexer | 7 bytes dropped over the limit of 10 bytes per second\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it adds the time each line was read", func(t *testing.T) {
+		var out bytes.Buffer
+		clock := servicestest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		captureTimestamps(time.Millisecond, clock, w)
+
+		// the time of a line is the one of its newline
+		fmt.Fprint(w, "proc")
+		clock.Advance(1500 * time.Microsecond)
+		fmt.Fprint(w, "essed input 7\nfinished epoch 2\n")
+		clock.Advance(time.Second)
+		fmt.Fprint(w, "exiting")
+		_ = w.Flush()
+
+		expected := "2024-01-02T03:04:05.001Z indexer | processed input 7\n" +
+			"2024-01-02T03:04:05.001Z indexer | finished epoch 2\n" +
+			"2024-01-02T03:04:06.001Z indexer | exiting\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it uses the precision of the timestamps", func(t *testing.T) {
+		now := time.Date(2024, 1, 2, 3, 4, 5, 123456789, time.FixedZone("BRT", -3*60*60))
+		for precision, expected := range map[time.Duration]string{
+			time.Second:      "2024-01-02T06:04:05Z",
+			time.Millisecond: "2024-01-02T06:04:05.123Z",
+			time.Microsecond: "2024-01-02T06:04:05.123456Z",
+			time.Nanosecond:  "2024-01-02T06:04:05.123456789Z",
+		} {
+			var out bytes.Buffer
+			w := newLineWriter(log.New(&out, "", 0), "indexer")
+			captureTimestamps(precision, servicestest.NewClock(now), w)
+			fmt.Fprintln(w, "line")
+			if out.String() != expected+" indexer | line\n" {
+				t.Errorf("expected %v for the precision %v, got %q", expected, precision,
+					out.String())
+			}
+		}
+	})
+
+	t.Run("it orders the timestamps only within each pipe", func(t *testing.T) {
+		var out bytes.Buffer
+		clock := servicestest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		stdout := newLineWriter(log.New(&out, "", 0), "indexer")
+		stderr := newLineWriter(log.New(&out, "", 0), "indexer")
+		captureTimestamps(time.Second, clock, stdout, stderr)
+
+		// the process began the line of stdout first, but it was read last
+		fmt.Fprint(stdout, "first")
+		clock.Advance(time.Second)
+		fmt.Fprintln(stderr, "second")
+		clock.Advance(time.Second)
+		fmt.Fprintln(stdout, " line")
+
+		expected := "2024-01-02T03:04:06Z indexer | second\n" +
+			"2024-01-02T03:04:07Z indexer | first line\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it adds the time as a field in the JSON format", func(t *testing.T) {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		stdout := os.Stdout
+		os.Stdout = writer
+		err = logger.Configure(logger.Config{Format: logger.JSONFormat})
+		os.Stdout = stdout
+		defer setup()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		clock := servicestest.NewClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		w := newLineWriter(logger.Info, "indexer")
+		captureTimestamps(time.Second, clock, w)
+		fmt.Fprintln(w, "processed input 7")
+		writer.Close()
+
+		var entry map[string]any
+		if err := json.NewDecoder(reader).Decode(&entry); err != nil {
+			t.Fatalf("expected a JSON entry, got %v", err)
+		}
+		if entry["msg"] != "indexer | processed input 7" ||
+			entry["captured_at"] != "2024-01-02T03:04:05Z" {
+			t.Fatalf("expected the time to be a field, got %v", entry)
+		}
+	})
+
+	t.Run("it suppresses repeated lines", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		w.repeats = newRepeatFilter(RepeatLimit{Window: time.Minute}, clock)
+
+		for i := 0; i < 5; i++ {
+			fmt.Fprintln(w, "connection refused")
+		}
+		fmt.Fprintln(w, "connected")
+		fmt.Fprintln(w, "connection refused")
+
+		expected := "indexer | connection refused\n" +
+			"indexer | last message repeated 4 times\n" +
+			"indexer | connected\n" +
+			"indexer | connection refused\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it logs repeated lines up to the threshold", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		limit := RepeatLimit{Window: time.Minute, Threshold: 2}
+		w.repeats = newRepeatFilter(limit, servicestest.NewClock(time.Unix(0, 0)))
+
+		for i := 0; i < 3; i++ {
+			fmt.Fprintln(w, "connection refused")
+		}
+		_ = w.Flush()
+
+		expected := "indexer | connection refused\n" +
+			"indexer | connection refused\n" +
+			"indexer | last message repeated 1 times\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it reports the repetitions once the window elapses", func(t *testing.T) {
+		var out bytes.Buffer
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		w := newLineWriter(log.New(&out, "", 0), "indexer")
+		w.repeats = newRepeatFilter(RepeatLimit{Window: time.Minute}, clock)
+
+		fmt.Fprintln(w, "connection refused")
+		fmt.Fprintln(w, "connection refused")
+		clock.Advance(time.Minute)
+		fmt.Fprintln(w, "connection refused")
+
+		expected := "indexer | connection refused\n" +
+			"indexer | last message repeated 1 times\n" +
+			"indexer | connection refused\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it does not mix lines of different services", func(t *testing.T) {
+		var buffer bytes.Buffer
+		out := log.New(&buffer, "", 0)
+		var wg sync.WaitGroup
+		for _, name := range []string{"graphql-server", "indexer"} {
+			wg.Add(1)
+			go func(name string) {
+				defer wg.Done()
+				w := newLineWriter(out, name)
+				for i := 0; i < 100; i++ {
+					fmt.Fprint(w, name, " says ")
+					fmt.Fprintln(w, "hello")
+				}
+			}(name)
+		}
+		wg.Wait()
+
+		for _, line := range strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n") {
+			if line != "graphql-server | graphql-server says hello" &&
+				line != "indexer | indexer says hello" {
+				t.Fatalf("unexpected line %q", line)
+			}
+		}
+	})
+}
@@ -0,0 +1,51 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrPanic is wrapped by the errors of the services that panic
+var ErrPanic = errors.New("service panicked")
+
+// PanicError is the error of a service that panicked. It wraps [ErrPanic] and,
+// when the value of the panic is an error, that error too
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+
+	// Stack is the stack of the goroutine that panicked
+	Stack []byte
+}
+
+// Error describes the panic followed by its stack, so the stack is printed
+// along with the error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%v: %v\n\n%s", ErrPanic, e.Value, e.Stack)
+}
+
+func (e *PanicError) Unwrap() []error {
+	if err, ok := e.Value.(error); ok {
+		return []error{ErrPanic, err}
+	}
+	return []error{ErrPanic}
+}
+
+// recoverPanic recovers a panic and stores it in err as a [PanicError]. It
+// must be deferred directly
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
+
+// startService starts the service, turning a panic into an error
+func startService(ctx context.Context, service Service) (err error) {
+	defer recoverPanic(&err)
+	return service.Start(ctx)
+}
@@ -0,0 +1,70 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPanics(t *testing.T) {
+
+	t.Run("it stops the other services when a service panics", func(t *testing.T) {
+		setup()
+		var stopped atomic.Bool
+		sleeper := testService{name: "sleeper", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped.Store(true)
+			return nil
+		}}
+		crash := func(ctx context.Context) error {
+			var nilMap map[string]int
+			nilMap["key"]++
+			return nil
+		}
+		panicking := DependsOn(testService{name: "panicking", start: crash}, "sleeper")
+
+		err := Run(context.Background(), []Service{sleeper, panicking})
+		var panicErr *PanicError
+		if !errors.Is(err, ErrPanic) || !errors.As(err, &panicErr) {
+			t.Fatalf("expected the panic to be returned, got %v", err)
+		}
+		if !strings.HasPrefix(err.Error(), "service 'panicking' exited with error: ") {
+			t.Fatalf("expected the service to be named, got %v", err)
+		}
+		for _, text := range []string{"assignment to entry in nil map", "goroutine", "TestPanics"} {
+			if !strings.Contains(err.Error(), text) {
+				t.Errorf("expected the error to contain %q, got %v", text, err)
+			}
+		}
+		if !stopped.Load() {
+			t.Fatal("expected the other services to be stopped")
+		}
+	})
+
+	t.Run("it recovers from panics in the readiness of a service", func(t *testing.T) {
+		setup()
+		service := readyTestService{
+			testService: testService{name: "api", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			ready: func(ctx context.Context) error {
+				panic(io.ErrUnexpectedEOF)
+			},
+		}
+
+		err := Run(context.Background(), []Service{service})
+		if !errors.Is(err, ErrPanic) || !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("expected the panic to be returned, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "service 'api' did not become ready") {
+			t.Fatalf("expected the service to be named, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,275 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultPeriodicGrace is how long a periodic service lets a run that is in
+// flight finish after it is stopped, by default
+const DefaultPeriodicGrace = 10 * time.Second
+
+// ErrTooManyFailures is returned by a periodic service whose runs failed more
+// times in a row than its threshold allows
+var ErrTooManyFailures = errors.New("too many consecutive failures")
+
+// PeriodicConfig configures a service created by [NewPeriodicService]
+type PeriodicConfig struct {
+	// Interval is the time between the start of two runs
+	Interval time.Duration
+
+	// Jitter is the maximum random delay added to each interval, so the runs
+	// of several nodes do not line up
+	Jitter time.Duration
+
+	// Immediate makes the first run start along with the service instead of
+	// after the first interval
+	Immediate bool
+
+	// Grace is how long a run that is in flight may continue after the
+	// service is stopped before its context is canceled. The default is
+	// [DefaultPeriodicGrace]
+	Grace time.Duration
+
+	// MaxFailures is how many runs may fail in a row before the service exits
+	// with [ErrTooManyFailures]. Zero means failed runs are only logged
+	MaxFailures int
+}
+
+// PeriodicStats counts the runs of a periodic service
+type PeriodicStats struct {
+	// Runs is how many runs finished, successfully or not
+	Runs int64
+
+	// Failures is how many runs failed
+	Failures int64
+
+	// Skipped is how many runs were skipped because the previous run was
+	// still in flight
+	Skipped int64
+}
+
+// PeriodicService runs a task repeatedly on a schedule, such as pruning old
+// data, so housekeeping runs only while the node is up. A run is skipped when
+// the previous one is still in flight
+type PeriodicService struct {
+	name    string
+	config  PeriodicConfig
+	task    func(ctx context.Context) error
+	command *simpleService
+
+	runs     atomic.Int64
+	failures atomic.Int64
+	skipped  atomic.Int64
+}
+
+// NewPeriodicService creates a service that calls the task every interval.
+// The task is canceled after the grace period once the service is stopped
+func NewPeriodicService(
+	name string,
+	config PeriodicConfig,
+	task func(ctx context.Context) error,
+) *PeriodicService {
+	return &PeriodicService{name: name, config: config, task: task}
+}
+
+// NewPeriodicCommand creates a service that runs the binary every interval,
+// configured like the services created by [NewCommandService]. The process is
+// sent its stop signal after the grace period once the service is stopped
+func NewPeriodicCommand(
+	name string,
+	config PeriodicConfig,
+	binary string,
+	opts ...CommandOption,
+) *PeriodicService {
+	command := NewCommandService(name, binary, opts...).(*simpleService)
+	return &PeriodicService{name: name, config: config, task: command.Start, command: command}
+}
+
+func (s *PeriodicService) String() string {
+	return s.name
+}
+
+// Fingerprint describes the schedule and the task of the service
+func (s *PeriodicService) Fingerprint() string {
+	fingerprint := fmt.Sprintf("%v %+v %p", s.name, s.config, s.task)
+	if s.command != nil {
+		fingerprint = fmt.Sprintf("%v %+v %v", s.name, s.config, s.command.Fingerprint())
+	}
+	return fingerprint
+}
+
+// release releases the command of the service, if it runs one
+func (s *PeriodicService) release() {
+	if s.command != nil {
+		s.command.release()
+	}
+}
+
+// Stats returns how many times the task ran, failed, and was skipped
+func (s *PeriodicService) Stats() PeriodicStats {
+	return PeriodicStats{
+		Runs:     s.runs.Load(),
+		Failures: s.failures.Load(),
+		Skipped:  s.skipped.Load(),
+	}
+}
+
+// Validate checks the schedule and, for commands, the binary
+func (s *PeriodicService) Validate() error {
+	var problems []error
+	if s.task == nil {
+		problems = append(problems, errors.New("missing task"))
+	}
+	if s.config.Interval <= 0 {
+		problems = append(problems, fmt.Errorf("invalid interval %v", s.config.Interval))
+	}
+	if s.config.Jitter < 0 || s.config.Grace < 0 || s.config.MaxFailures < 0 {
+		problems = append(problems, errors.New("negative jitter, grace, or failure threshold"))
+	}
+	if s.command != nil {
+		if err := s.command.Validate(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return joinProblems(problems)
+}
+
+// Start runs the task on the schedule until ctx is canceled, then waits for
+// the run that is in flight, if any. It only returns an error when the task
+// failed more times in a row than the threshold
+func (s *PeriodicService) Start(ctx context.Context) error {
+	if s.task == nil || s.config.Interval <= 0 {
+		return fmt.Errorf("service '%v' has no valid schedule", s.name)
+	}
+	filter := logFilterFrom(ctx)
+	first := s.delay()
+	if s.config.Immediate {
+		first = 0
+	}
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+
+	// the runs outlive ctx for the grace period, but keep its values
+	runCtx, cancelRuns := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRuns()
+	results := make(chan error, 1)
+	running := false
+	run, consecutive := 0, 0
+	var startedAt time.Time
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(s.delay())
+			if running {
+				s.skipped.Add(1)
+				msg := "main: skipping a run of service '%v'; run %v is still in flight"
+				msg = fmt.Sprintf(msg, s.name, run)
+				filter.log(logger.Warning, msg, "service", s.name, "event", "run_skipped",
+					"run", run)
+				continue
+			}
+			run++
+			running = true
+			startedAt = time.Now()
+			filter.log(logger.Debug, fmt.Sprintf("main: starting run %v of service '%v'", run,
+				s.name), "service", s.name, "event", "run_started", "run", run)
+			go func() {
+				results <- callTask(runCtx, s.task)
+			}()
+		case err := <-results:
+			running = false
+			consecutive = s.finish(filter, run, startedAt, err, consecutive)
+			if limit := s.config.MaxFailures; limit > 0 && consecutive >= limit {
+				return fmt.Errorf("%w: %v runs failed in a row: %w", ErrTooManyFailures,
+					consecutive, err)
+			}
+		case <-ctx.Done():
+			if running {
+				err := s.wait(filter, run, results, cancelRuns)
+				s.finish(filter, run, startedAt, err, consecutive)
+			}
+			return nil
+		}
+	}
+}
+
+// delay returns the time until the next run
+func (s *PeriodicService) delay() time.Duration {
+	delay := s.config.Interval
+	if s.config.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(s.config.Jitter)))
+	}
+	return delay
+}
+
+// finish logs and counts the outcome of a run, returning how many runs failed
+// in a row
+func (s *PeriodicService) finish(
+	filter *logFilter,
+	run int,
+	startedAt time.Time,
+	err error,
+	consecutive int,
+) int {
+	elapsed := time.Since(startedAt).Round(time.Millisecond)
+	s.runs.Add(1)
+	if err == nil {
+		msg := fmt.Sprintf("main: run %v of service '%v' succeeded in %v", run, s.name, elapsed)
+		filter.log(logger.Info, msg, "service", s.name, "event", "run_succeeded", "run", run,
+			"elapsed", elapsed)
+		return 0
+	}
+	s.failures.Add(1)
+	consecutive++
+	msg := fmt.Sprintf("main: run %v of service '%v' failed after %v (%v in a row): %v", run,
+		s.name, elapsed, consecutive, err)
+	filter.log(logger.Warning, msg, "service", s.name, "event", "run_failed", "run", run,
+		"elapsed", elapsed, "error", err)
+	return consecutive
+}
+
+// wait waits for the run that is in flight to finish, canceling it after the
+// grace period, and returns its error. A run that returns the cancelation of
+// its context succeeds
+func (s *PeriodicService) wait(
+	filter *logFilter,
+	run int,
+	results <-chan error,
+	cancelRuns context.CancelFunc,
+) error {
+	grace := s.config.Grace
+	if grace == 0 {
+		grace = DefaultPeriodicGrace
+	}
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case err := <-results:
+		return err
+	case <-timer.C:
+	}
+	msg := fmt.Sprintf("main: run %v of service '%v' did not finish in %v; canceling it", run,
+		s.name, grace)
+	filter.log(logger.Warning, msg, "service", s.name, "event", "run_canceled", "run", run)
+	cancelRuns()
+	if err := <-results; !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// callTask calls the task, turning a panic into an error
+func callTask(ctx context.Context, task func(ctx context.Context) error) (err error) {
+	defer recoverPanic(&err)
+	return task(ctx)
+}
@@ -0,0 +1,155 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeriodicService(t *testing.T) {
+
+	t.Run("it runs the task repeatedly and skips overlapping runs", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var runs, inFlight atomic.Int32
+		config := PeriodicConfig{Interval: 10 * time.Millisecond, Immediate: true}
+		service := NewPeriodicService("pruner", config, func(ctx context.Context) error {
+			if inFlight.Add(1) > 1 {
+				t.Error("expected the runs to not overlap")
+			}
+			defer inFlight.Add(-1)
+			if runs.Add(1) == 1 {
+				time.Sleep(35 * time.Millisecond)
+			}
+			if runs.Load() == 3 {
+				cancel()
+			}
+			return nil
+		})
+
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		stats := service.Stats()
+		if stats.Runs < 3 || stats.Failures != 0 || stats.Skipped == 0 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("it keeps running when runs fail below the threshold", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var runs atomic.Int32
+		config := PeriodicConfig{Interval: time.Millisecond, MaxFailures: 3}
+		service := NewPeriodicService("pruner", config, func(ctx context.Context) error {
+			switch runs.Add(1) {
+			case 3:
+				return nil
+			case 5:
+				cancel()
+			}
+			return errors.New("database is locked")
+		})
+
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// a last run may start along with the cancelation
+		if stats := service.Stats(); stats.Runs < 5 || stats.Failures != stats.Runs-1 {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+	})
+
+	t.Run("it fails after too many failures in a row", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		config := PeriodicConfig{Interval: time.Millisecond, MaxFailures: 3}
+		service := NewPeriodicService("pruner", config, func(ctx context.Context) error {
+			return boom
+		})
+
+		err := Run(context.Background(), []Service{service})
+		if !errors.Is(err, ErrTooManyFailures) || !errors.Is(err, boom) {
+			t.Fatalf("expected too many failures, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "3 runs failed in a row") {
+			t.Fatalf("expected the failures to be counted, got %v", err)
+		}
+	})
+
+	t.Run("it lets the run in flight finish within the grace period", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		var canceled atomic.Bool
+		config := PeriodicConfig{Interval: time.Hour, Immediate: true, Grace: time.Second}
+		service := NewPeriodicService("snapshot", config, func(runCtx context.Context) error {
+			cancel()
+			time.Sleep(20 * time.Millisecond)
+			canceled.Store(runCtx.Err() != nil)
+			return nil
+		})
+
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if canceled.Load() || service.Stats().Runs != 1 {
+			t.Fatalf("expected the run to finish, got %+v", service.Stats())
+		}
+	})
+
+	t.Run("it cancels the run in flight after the grace period", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		config := PeriodicConfig{Interval: time.Hour, Immediate: true,
+			Grace: 20 * time.Millisecond}
+		service := NewPeriodicService("snapshot", config, func(runCtx context.Context) error {
+			cancel()
+			<-runCtx.Done()
+			return runCtx.Err()
+		})
+
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if stats := service.Stats(); stats.Runs != 1 || stats.Failures != 0 {
+			t.Fatalf("expected the canceled run to succeed, got %+v", stats)
+		}
+	})
+
+	t.Run("it runs commands", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config := PeriodicConfig{Interval: time.Millisecond, Immediate: true, MaxFailures: 1}
+		service := NewPeriodicCommand("pruner", config, writeScript(t, "exit 0"))
+		done := make(chan error)
+		go func() {
+			done <- service.Start(ctx)
+		}()
+		deadline := time.Now().Add(time.Second)
+		for service.Stats().Runs < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		if err := <-done; err != nil || service.Stats().Runs < 2 {
+			t.Fatalf("expected the command to run, got %v and %+v", err, service.Stats())
+		}
+	})
+
+	t.Run("it validates the schedule and the command", func(t *testing.T) {
+		service := NewPeriodicCommand("pruner", PeriodicConfig{}, "cartesi-rollups-missing")
+		err := service.Validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid interval 0s") ||
+			!strings.Contains(err.Error(), "missing binary") {
+			t.Fatalf("expected the service to be invalid, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,207 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Port is a TCP port a service binds
+type Port struct {
+	// Name tells the ports of a service apart, such as "graphql"
+	Name string
+
+	// Number is the number of the port. Zero asks the supervisor to pick a
+	// free port before the startup
+	Number int
+
+	// Env is the variable that tells the process the number of the port, if
+	// it is set
+	Env string
+}
+
+// A PortUser is a service that binds ports. Before the startup, the
+// supervisor picks the ports declared with zero and checks that no two
+// services claim the same port and that no other process already bound them
+type PortUser interface {
+	// Ports returns the ports of the service, with the numbers picked by the
+	// supervisor
+	Ports() []Port
+}
+
+// WithPort declares a port the process binds. The port must be free when the
+// service is validated, and zero asks the supervisor to pick a free port,
+// which is kept while the service restarts. When env is set, the process is
+// told the number of the port in that variable
+func WithPort(name string, number int, env string) CommandOption {
+	return func(s *simpleService) {
+		s.ports = append(s.ports, Port{Name: name, Number: number, Env: env})
+	}
+}
+
+// portAssigner is a service whose ports declared with zero are picked by the
+// supervisor
+type portAssigner interface {
+	PortUser
+	assignPort(name string, number int)
+}
+
+// pickedPorts are the numbers picked for the ports of a service that were
+// declared with zero, by name
+type pickedPorts struct {
+	mutex   sync.Mutex
+	numbers map[string]int
+}
+
+func (p *pickedPorts) get(name string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.numbers[name]
+}
+
+func (p *pickedPorts) set(name string, number int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.numbers == nil {
+		p.numbers = make(map[string]int)
+	}
+	p.numbers[name] = number
+}
+
+// Ports returns the ports declared by WithPort, with the numbers picked by
+// the supervisor, which are zero until they are picked
+func (s *simpleService) Ports() []Port {
+	if len(s.ports) == 0 {
+		return nil
+	}
+	ports := make([]Port, len(s.ports))
+	for i, port := range s.ports {
+		if port.Number == 0 {
+			port.Number = s.picked.get(port.Name)
+		}
+		ports[i] = port
+	}
+	return ports
+}
+
+func (s *simpleService) assignPort(name string, number int) {
+	s.picked.set(name, number)
+}
+
+// adoptPorts makes the service keep the ports picked for the previous
+// definition of the service, so a reload does not move them
+func (s *simpleService) adoptPorts(previous Service) {
+	old, ok := previous.(*simpleService)
+	if !ok || old == s {
+		return
+	}
+	for _, port := range s.ports {
+		if number := old.picked.get(port.Name); port.Number == 0 && number != 0 {
+			s.picked.set(port.Name, number)
+		}
+	}
+}
+
+// portEnv returns the variables that tell the process its ports
+func (s *simpleService) portEnv() []string {
+	var env []string
+	for _, port := range s.Ports() {
+		if port.Env != "" && port.Number != 0 {
+			env = append(env, port.Env+"="+strconv.Itoa(port.Number))
+		}
+	}
+	return env
+}
+
+// assignPorts picks free ports for the ports of the services that were
+// declared with zero and were not picked yet, avoiding the ports claimed by
+// the other services
+func assignPorts(specs []ServiceSpec) error {
+	claimed := heldPorts(specs)
+	for _, spec := range specs {
+		assigner, ok := spec.Service.(portAssigner)
+		if !ok {
+			continue
+		}
+		for _, port := range assigner.Ports() {
+			if port.Number != 0 {
+				continue
+			}
+			number, err := freePort(claimed)
+			if err != nil {
+				return fmt.Errorf("failed to pick the port %v of service '%v': %w", port.Name,
+					spec.String(), err)
+			}
+			claimed[number] = true
+			assigner.assignPort(port.Name, number)
+		}
+	}
+	return nil
+}
+
+// freePort returns a port that is free and not claimed
+func freePort(claimed map[int]bool) (int, error) {
+	for {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, err
+		}
+		number := listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+		if !claimed[number] {
+			return number, nil
+		}
+	}
+}
+
+// checkPorts adds the problems of the ports claimed by more than one service
+// and of the ports that are already in use, except for the ones held by the
+// services that are running
+func (e *validationError) checkPorts(specs []ServiceSpec, held map[int]bool) {
+	claims := make(map[int]string)
+	for _, spec := range specs {
+		user, ok := spec.Service.(PortUser)
+		if !ok {
+			continue
+		}
+		subject := fmt.Sprintf("service '%v'", spec.String())
+		for _, port := range user.Ports() {
+			if port.Number == 0 {
+				continue
+			}
+			if other, ok := claims[port.Number]; ok {
+				e.add(subject, fmt.Errorf("port %v (%v) is also claimed by service '%v'",
+					port.Number, port.Name, other))
+				continue
+			}
+			claims[port.Number] = spec.String()
+			if held[port.Number] {
+				continue
+			}
+			listener, err := net.Listen("tcp", ":"+strconv.Itoa(port.Number))
+			if err != nil {
+				e.add(subject, fmt.Errorf("port %v (%v) is not available: %w", port.Number,
+					port.Name, err))
+				continue
+			}
+			listener.Close()
+		}
+	}
+}
+
+// heldPorts returns the ports claimed by the services
+func heldPorts(specs []ServiceSpec) map[int]bool {
+	held := make(map[int]bool)
+	for _, spec := range specs {
+		if user, ok := spec.Service.(PortUser); ok {
+			for _, port := range user.Ports() {
+				held[port.Number] = true
+			}
+		}
+	}
+	return held
+}
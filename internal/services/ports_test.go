@@ -0,0 +1,170 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// portService is a service that binds its port while it runs
+type portService struct {
+	testService
+	config string
+	port   int
+}
+
+func (s portService) Ports() []Port {
+	return []Port{{Name: "http", Number: s.port}}
+}
+
+func newPortService(name string, config string, port int) portService {
+	return portService{config: config, port: port, testService: testService{name: name,
+		start: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+			if err != nil {
+				return err
+			}
+			defer listener.Close()
+			<-ctx.Done()
+			return nil
+		}}}
+}
+
+func TestPorts(t *testing.T) {
+
+	// free returns a port that is free
+	free := func(t *testing.T) int {
+		t.Helper()
+		port, err := freePort(nil)
+		if err != nil {
+			t.Fatalf("failed to pick a port: %v", err)
+		}
+		return port
+	}
+
+	// server creates a command service that declares the port
+	server := func(name string, port int) Service {
+		return NewCommandService(name, os.Args[0], WithPort("http", port, ""))
+	}
+
+	t.Run("it fails the validation of the ports claimed twice", func(t *testing.T) {
+		port := free(t)
+		err := Verify([]Service{server("indexer", port), server("graphql-server", port)})
+		expected := fmt.Sprintf("service 'graphql-server': port %v (http) is also claimed by "+
+			"service 'indexer'", port)
+		if !errors.Is(err, ErrInvalidServices) || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the conflict to fail the validation, got %v", err)
+		}
+	})
+
+	t.Run("it fails the validation of the ports in use", func(t *testing.T) {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		port := listener.Addr().(*net.TCPAddr).Port
+		err = Verify([]Service{server("indexer", port)})
+		expected := fmt.Sprintf("service 'indexer': port %v (http) is not available", port)
+		if !errors.Is(err, ErrInvalidServices) || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the port in use to fail the validation, got %v", err)
+		}
+	})
+
+	t.Run("it lists every problem with the ports", func(t *testing.T) {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		defer listener.Close()
+		used, claimed := listener.Addr().(*net.TCPAddr).Port, free(t)
+		err = Run(context.Background(), []Service{
+			server("indexer", used),
+			server("graphql-server", claimed),
+			server("dispatcher", claimed),
+		})
+		var problems *validationError
+		if !errors.As(err, &problems) || len(problems.problems) != 2 {
+			t.Fatalf("expected two problems, got %v", err)
+		}
+	})
+
+	t.Run("it picks a free port and tells the process", func(t *testing.T) {
+		setup()
+		output := filepath.Join(t.TempDir(), "port")
+		script := writeScript(t, fmt.Sprintf(`echo "$HTTP_PORT" > %v; exec sleep 30`, output))
+		service := NewCommandService("graphql-server", script, WithPort("http", 0, "HTTP_PORT"))
+		supervisor := NewSupervisor([]Service{service})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background())
+
+		ports := supervisor.Status()[0].Ports
+		if len(ports) != 1 || ports[0].Name != "http" || ports[0].Number == 0 {
+			t.Fatalf("expected the picked port in the status, got %+v", ports)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			data, _ := os.ReadFile(output)
+			if got := strings.TrimSpace(string(data)); got == strconv.Itoa(ports[0].Number) {
+				break
+			} else if time.Now().After(deadline) {
+				t.Fatalf("expected the process to be told port %v, got %q", ports[0].Number, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("it keeps the picked port", func(t *testing.T) {
+		service := NewCommandService("graphql-server", os.Args[0], WithPort("http", 0, ""))
+		specs := []ServiceSpec{specOf(service)}
+		for i := 0; i < 2; i++ {
+			if err := assignPorts(specs); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		picked := service.(PortUser).Ports()[0].Number
+		changed := NewCommandService("graphql-server", os.Args[0], WithPort("http", 0, ""),
+			WithArgs("--verbose")).(*simpleService)
+		changed.adoptPorts(service)
+		if got := changed.Ports()[0].Number; picked == 0 || got != picked {
+			t.Fatalf("expected the new definition to keep port %v, got %v", picked, got)
+		}
+	})
+
+	t.Run("it lets the new definition claim the port of the old one", func(t *testing.T) {
+		setup()
+		port := free(t)
+		supervisor := NewSupervisor([]Service{newPortService("graphql-server", "v1", port)})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background())
+		reloaded := []Service{newPortService("graphql-server", "v2", port)}
+		if err := supervisor.Reload(context.Background(), reloaded); err != nil {
+			t.Fatalf("expected the reload to succeed, got %v", err)
+		}
+		added := append(reloaded, newPortService("indexer", "v1", port))
+		if err := supervisor.Reload(context.Background(), added); err == nil {
+			t.Fatalf("expected the conflict to fail the reload")
+		}
+	})
+
+	t.Run("it serves the ports in the status", func(t *testing.T) {
+		status := ServiceStatus{Name: "graphql-server", Ports: []Port{{Name: "http", Number: 4000}}}
+		if ports := newStatusResponse(status).Ports; ports["http"] != 4000 {
+			t.Fatalf("expected the ports in the response, got %v", ports)
+		}
+	})
+}
@@ -0,0 +1,304 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultPostgresGateTimeout is how long the gate created by
+// [NewPostgresGate] waits for the database by default
+const DefaultPostgresGateTimeout = time.Minute
+
+// DefaultPostgresGateBackoff is the delay between the attempts of the gate
+// created by [NewPostgresGate] by default
+var DefaultPostgresGateBackoff = Backoff{Initial: 250 * time.Millisecond, Max: 5 * time.Second}
+
+// ErrDatabaseUnreachable is returned by the gate created by [NewPostgresGate]
+// when the database does not accept connections in time
+var ErrDatabaseUnreachable = errors.New("the database was unreachable")
+
+// sqlStateCannotConnectNow is the SQLSTATE of the errors of a database that is
+// starting up or shutting down
+const sqlStateCannotConnectNow = "57P03"
+
+// PostgresProbe is a readiness probe that succeeds when the PostgreSQL
+// database of the URL accepts connections. Like pg_isready, it only sends the
+// startup message and never authenticates, so the password in the URL is
+// never sent and an authentication failure still means the database is up
+type PostgresProbe struct {
+	// URL is the connection string, such as postgres://user@host:5432/db
+	URL string
+
+	// Timeout of each attempt. The default is DefaultProbeTimeout
+	Timeout time.Duration
+}
+
+// Validate checks that the URL is a postgres URL
+func (p PostgresProbe) Validate() error {
+	_, err := parsePostgresURL(p.URL)
+	return err
+}
+
+func (p PostgresProbe) Ready(ctx context.Context) error {
+	config, err := parsePostgresURL(p.URL)
+	if err != nil {
+		return err
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", config.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(startupMessage(config.user, config.database)); err != nil {
+		return err
+	}
+	kind, payload, err := readMessage(bufio.NewReader(conn))
+	if err != nil {
+		return fmt.Errorf("failed to read the response of the database: %w", err)
+	}
+	switch kind {
+	case 'R':
+		// say goodbye instead of answering the authentication request
+		_, _ = conn.Write([]byte{'X', 0, 0, 0, 4})
+		return nil
+	case 'E':
+		code, message := parseErrorResponse(payload)
+		if code == sqlStateCannotConnectNow {
+			return fmt.Errorf("the database does not accept connections yet: %v", message)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unexpected response %q from the database", kind)
+	}
+}
+
+// postgresConfig is what the probe needs from a connection string
+type postgresConfig struct {
+	address  string
+	user     string
+	database string
+}
+
+// parsePostgresURL parses a postgres:// or postgresql:// URL. The user
+// defaults to postgres, the database to the user, and the port to 5432
+func parsePostgresURL(raw string) (postgresConfig, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return postgresConfig{}, fmt.Errorf("invalid database URL: %w", redactURLError(err))
+	}
+	if parsed.Scheme != "postgres" && parsed.Scheme != "postgresql" {
+		return postgresConfig{}, fmt.Errorf("invalid database URL %v: the scheme must be "+
+			"postgres or postgresql", redactURL(raw))
+	}
+	if parsed.Hostname() == "" {
+		return postgresConfig{}, fmt.Errorf("invalid database URL %v: missing host",
+			redactURL(raw))
+	}
+	config := postgresConfig{user: parsed.User.Username(), database: parsed.Path}
+	if len(config.database) > 0 && config.database[0] == '/' {
+		config.database = config.database[1:]
+	}
+	if config.user == "" {
+		config.user = "postgres"
+	}
+	if config.database == "" {
+		config.database = config.user
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = "5432"
+	}
+	config.address = net.JoinHostPort(parsed.Hostname(), port)
+	return config, nil
+}
+
+// redactURL hides the password of the URL, both in its user info and in its
+// query, so it can be logged
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid URL>"
+	}
+	query := parsed.Query()
+	if query.Has("password") {
+		query.Set("password", "xxxxx")
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.Redacted()
+}
+
+// redactURLError drops the URL from the error of parsing it, since it may
+// hold a password
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// startupMessage returns the startup message of the version 3.0 of the
+// protocol for the user and database
+func startupMessage(user, database string) []byte {
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.BigEndian, int32(3<<16))
+	for _, value := range []string{"user", user, "database", database} {
+		body.WriteString(value)
+		body.WriteByte(0)
+	}
+	body.WriteByte(0)
+	message := binary.BigEndian.AppendUint32(nil, uint32(body.Len()+4))
+	return append(message, body.Bytes()...)
+}
+
+// maxMessageSize bounds the messages read from the database
+const maxMessageSize = 64 * 1024
+
+// readMessage reads a message of the protocol, returning its type and payload
+func readMessage(reader *bufio.Reader) (byte, []byte, error) {
+	kind, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var length int32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	if length < 4 || length > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid message length %v", length)
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return kind, payload, nil
+}
+
+// parseErrorResponse returns the SQLSTATE code and the message of an error
+// response
+func parseErrorResponse(payload []byte) (string, string) {
+	var code, message string
+	for len(payload) > 1 {
+		field := payload[0]
+		end := bytes.IndexByte(payload[1:], 0)
+		if end < 0 {
+			break
+		}
+		value := string(payload[1 : end+1])
+		payload = payload[end+2:]
+		switch field {
+		case 'C':
+			code = value
+		case 'M':
+			message = value
+		}
+	}
+	return code, message
+}
+
+// PostgresGateConfig configures the gate created by [NewPostgresGate]
+type PostgresGateConfig struct {
+	// URL is the connection string of the database. Its password is never
+	// logged
+	URL string
+
+	// Timeout is how long to wait for the database to accept connections.
+	// The default is DefaultPostgresGateTimeout
+	Timeout time.Duration
+
+	// Backoff is the delay between two attempts, which doubles from Initial
+	// up to Max. The default is DefaultPostgresGateBackoff
+	Backoff Backoff
+}
+
+// postgresGate waits for the database to accept connections
+type postgresGate struct {
+	config PostgresGateConfig
+}
+
+// NewPostgresGate creates a one-shot service named postgres that waits for
+// the database to accept connections, so the services that depend on it, such
+// as the indexer, only start once it does. It retries with a backoff and
+// fails with [ErrDatabaseUnreachable] once the timeout elapses
+func NewPostgresGate(config PostgresGateConfig) Service {
+	return OneShot(&postgresGate{config: config})
+}
+
+func (g *postgresGate) String() string {
+	return "postgres"
+}
+
+// Validate checks the URL of the database
+func (g *postgresGate) Validate() error {
+	return PostgresProbe{URL: g.config.URL}.Validate()
+}
+
+// Fingerprint describes the configuration of the gate
+func (g *postgresGate) Fingerprint() string {
+	return fmt.Sprintf("%q %v %+v", g.config.URL, g.config.Timeout, g.config.Backoff)
+}
+
+func (g *postgresGate) Start(ctx context.Context) error {
+	filter := logFilterFrom(ctx)
+	timeout := g.config.Timeout
+	if timeout == 0 {
+		timeout = DefaultPostgresGateTimeout
+	}
+	config := g.config.Backoff
+	if config == (Backoff{}) {
+		config = DefaultPostgresGateBackoff
+	}
+	redacted := redactURL(g.config.URL)
+	probe := PostgresProbe{URL: g.config.URL}
+	deadline := time.Now().Add(timeout)
+	filter.log(logger.Info, fmt.Sprintf("main: waiting for the database at %v", redacted),
+		"service", g.String(), "event", "waiting_for_database")
+	delay := config.Initial
+	for attempt := 1; ; attempt, delay = attempt+1, min(2*delay, config.Max) {
+		err := probe.Ready(ctx)
+		if err == nil {
+			msg := fmt.Sprintf("main: the database at %v accepts connections", redacted)
+			filter.log(logger.Info, msg, "service", g.String(), "event", "database_ready",
+				"attempts", attempt)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%w: %v did not accept connections within %v: %v",
+				ErrDatabaseUnreachable, redacted, timeout, err)
+		}
+		msg := fmt.Sprintf("main: the database at %v is not ready (attempt %v): %v", redacted,
+			attempt, err)
+		filter.log(logger.Debug, msg, "service", g.String(), "event", "database_not_ready")
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePostgres accepts connections like a PostgreSQL database, replying to
+// their startup messages with the responses, in order. The last response is
+// repeated
+type fakePostgres struct {
+	listener net.Listener
+
+	mutex     sync.Mutex
+	responses [][]byte
+	startups  [][]byte
+}
+
+// authenticationRequest asks for a password, like a database that is up
+var authenticationRequest = []byte{'R', 0, 0, 0, 8, 0, 0, 0, 3}
+
+// errorResponse returns an error response with the SQLSTATE code
+func errorResponse(code string, message string) []byte {
+	fields := fmt.Sprintf("SFATAL\x00C%v\x00M%v\x00\x00", code, message)
+	response := []byte{'E'}
+	response = binary.BigEndian.AppendUint32(response, uint32(len(fields)+4))
+	return append(response, fields...)
+}
+
+func newFakePostgres(t *testing.T, responses ...[]byte) *fakePostgres {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	db := &fakePostgres{listener: listener, responses: responses}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			db.serve(conn)
+		}
+	}()
+	return db
+}
+
+func (db *fakePostgres) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var length int32
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return
+	}
+	startup := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, startup); err != nil {
+		return
+	}
+	db.mutex.Lock()
+	db.startups = append(db.startups, startup)
+	response := db.responses[0]
+	if len(db.responses) > 1 {
+		db.responses = db.responses[1:]
+	}
+	db.mutex.Unlock()
+	_, _ = conn.Write(response)
+	_, _ = io.Copy(io.Discard, reader)
+}
+
+func (db *fakePostgres) url(credentials string) string {
+	return fmt.Sprintf("postgres://%v@%v/rollups", credentials, db.listener.Addr())
+}
+
+func (db *fakePostgres) attempts() int {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return len(db.startups)
+}
+
+func TestPostgresProbe(t *testing.T) {
+
+	t.Run("it succeeds when the database asks for a password", func(t *testing.T) {
+		db := newFakePostgres(t, authenticationRequest)
+		probe := PostgresProbe{URL: db.url("indexer:secret")}
+		if err := probe.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the database to be ready, got %v", err)
+		}
+		startup := db.startups[0]
+		if !bytes.Contains(startup, []byte("user\x00indexer\x00database\x00rollups\x00")) {
+			t.Fatalf("expected the user and the database in the startup, got %q", startup)
+		}
+		if bytes.Contains(startup, []byte("secret")) {
+			t.Fatalf("expected the password to not be sent, got %q", startup)
+		}
+	})
+
+	t.Run("it succeeds when the database rejects the user", func(t *testing.T) {
+		db := newFakePostgres(t, errorResponse("28P01", "password authentication failed"))
+		if err := (PostgresProbe{URL: db.url("indexer")}).Ready(context.Background()); err != nil {
+			t.Fatalf("expected the database to be up, got %v", err)
+		}
+	})
+
+	t.Run("it fails while the database is starting up", func(t *testing.T) {
+		db := newFakePostgres(t, errorResponse("57P03", "the database system is starting up"))
+		err := PostgresProbe{URL: db.url("indexer")}.Ready(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "the database system is starting up") {
+			t.Fatalf("expected the database to not be ready, got %v", err)
+		}
+	})
+
+	t.Run("it fails when nothing listens", func(t *testing.T) {
+		db := newFakePostgres(t, authenticationRequest)
+		url := db.url("indexer")
+		db.listener.Close()
+		if err := (PostgresProbe{URL: url}).Ready(context.Background()); err == nil {
+			t.Fatalf("expected the probe to fail")
+		}
+	})
+
+	t.Run("it validates the URL", func(t *testing.T) {
+		for _, url := range []string{"mysql://db:3306", "postgres:///rollups", "postgres://%zz"} {
+			if err := (PostgresProbe{URL: url}).Validate(); err == nil {
+				t.Errorf("expected %q to be invalid", url)
+			}
+		}
+		if err := (PostgresProbe{URL: "postgresql://db/rollups"}).Validate(); err != nil {
+			t.Errorf("expected the URL to be valid, got %v", err)
+		}
+	})
+
+	t.Run("it redacts the password", func(t *testing.T) {
+		url := "postgres://indexer:secret@db:5432/rollups?password=secret&sslmode=disable"
+		redacted := redactURL(url)
+		if strings.Contains(redacted, "secret") || !strings.Contains(redacted, "indexer:xxxxx@db") {
+			t.Fatalf("expected the password to be redacted, got %v", redacted)
+		}
+		err := PostgresProbe{URL: "mysql://indexer:secret@db"}.Validate()
+		if err == nil || strings.Contains(err.Error(), "secret") {
+			t.Fatalf("expected the error to hide the password, got %v", err)
+		}
+	})
+}
+
+func TestPostgresGate(t *testing.T) {
+	backoff := Backoff{Initial: 10 * time.Millisecond, Max: 20 * time.Millisecond}
+
+	t.Run("it starts the dependents once the database accepts connections", func(t *testing.T) {
+		setup()
+		notReady := errorResponse("57P03", "the database system is starting up")
+		db := newFakePostgres(t, notReady, notReady, authenticationRequest)
+		gate := NewPostgresGate(PostgresGateConfig{URL: db.url("indexer"), Backoff: backoff})
+		var attempts int
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			attempts = db.attempts()
+			return nil
+		}}
+		if err := Run(context.Background(), []Service{gate, OneShot(indexer)}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if attempts != 3 {
+			t.Fatalf("expected the indexer to start after 3 attempts, got %v", attempts)
+		}
+	})
+
+	t.Run("it tells that the database was unreachable", func(t *testing.T) {
+		setup()
+		db := newFakePostgres(t, errorResponse("57P03", "the database system is starting up"))
+		gate := NewPostgresGate(PostgresGateConfig{
+			URL:     db.url("indexer:secret"),
+			Timeout: 100 * time.Millisecond,
+			Backoff: backoff,
+		})
+		started := false
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			started = true
+			return nil
+		}}
+		err := Run(context.Background(), []Service{gate, indexer})
+		if !errors.Is(err, ErrDatabaseUnreachable) {
+			t.Fatalf("expected the database to be unreachable, got %v", err)
+		}
+		if strings.Contains(err.Error(), "secret") || !strings.Contains(err.Error(), "xxxxx") {
+			t.Fatalf("expected the error to hide the password, got %v", err)
+		}
+		if started {
+			t.Fatalf("expected the indexer to not start")
+		}
+	})
+}
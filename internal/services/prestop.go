@@ -0,0 +1,137 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultPreStopTimeout is how long a pre-stop hook may take by default
+const DefaultPreStopTimeout = 5 * time.Second
+
+// PreStopHook tells a service that it is about to be stopped, so it can stop
+// accepting work and drain what is in flight before it is signaled. The hook
+// is either an HTTP request to the URL or the command, but not both
+type PreStopHook struct {
+	// URL receives a request with the method, which is POST by default. Any
+	// status other than 2xx is a failure
+	URL    string
+	Method string
+
+	// Command is the binary and the arguments of a command that runs with the
+	// environment and the working directory of the service
+	Command []string
+
+	// Timeout bounds the hook. The default is DefaultPreStopTimeout
+	Timeout time.Duration
+}
+
+// WithPreStop makes the service run the hook whenever its process is asked to
+// stop, which is at the shutdown, when a reload replaces it, and when it is
+// stopped for failing its liveness checks. The stop signal is only sent once
+// the hook finishes or times out. Failures of the hook are logged but do not
+// hold the stop, whose grace period only starts after the hook
+func WithPreStop(hook PreStopHook) CommandOption {
+	return func(s *simpleService) {
+		s.preStop = &hook
+	}
+}
+
+// Validate checks that the hook has either a well-formed URL or a command
+func (h PreStopHook) Validate() error {
+	switch {
+	case h.URL != "" && len(h.Command) > 0:
+		return errors.New("set either a URL or a command")
+	case h.URL != "":
+		return HttpProbe{URL: h.URL}.Validate()
+	case len(h.Command) > 0:
+		if _, err := exec.LookPath(h.Command[0]); err != nil {
+			return fmt.Errorf("missing binary: %w", err)
+		}
+		return nil
+	default:
+		return errors.New("missing URL or command")
+	}
+}
+
+// runPreStop runs the pre-stop hook of the service, if it has one, and logs
+// its failure. The context of the service is already canceled, so the hook
+// only keeps its values
+func (s *simpleService) runPreStop(ctx context.Context, filter *logFilter) {
+	hook := s.preStop
+	if hook == nil {
+		return
+	}
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultPreStopTimeout
+	}
+	filter.log(logger.Debug, fmt.Sprintf("%v: running the pre-stop hook", s.String()),
+		"service", s.String(), "event", "pre_stop")
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+	var err error
+	if hook.URL != "" {
+		err = hook.request(ctx)
+	} else {
+		err = s.runPreStopCommand(ctx, hook.Command, timeout)
+	}
+	if err != nil {
+		msg := fmt.Sprintf("%v: the pre-stop hook failed: %v", s.String(), err)
+		filter.log(logger.Warning, msg, "service", s.String(), "event", "pre_stop_failed",
+			"error", err)
+	}
+}
+
+// request sends the request of the hook
+func (h *PreStopHook) request(ctx context.Context) error {
+	method := h.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBodySize))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v from %v", resp.Status, h.URL)
+	}
+	return nil
+}
+
+// runPreStopCommand runs the command of the hook like the service, with its
+// output logged as the output of the service
+func (s *simpleService) runPreStopCommand(
+	ctx context.Context,
+	command []string,
+	timeout time.Duration,
+) error {
+	service := s.command()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env, cmd.Dir = service.Env, service.Dir
+	cmd.Stdout, cmd.Stderr = service.Stdout, service.Stderr
+	filterOutput(logFilterFrom(ctx), cmd.Stdout, cmd.Stderr)
+	colorOutput(ctx, cmd.Stdout, cmd.Stderr)
+	cmd.WaitDelay = timeout
+	err := cmd.Run()
+	flushOutput(cmd.Stdout, cmd.Stderr)
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %v", timeout)
+	}
+	return err
+}
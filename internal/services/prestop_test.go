@@ -0,0 +1,149 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestPreStop(t *testing.T) {
+
+	// drained returns a service that records when it starts and when it gets
+	// its stop signal in the steps file
+	drained := func(t *testing.T, steps string, opts ...CommandOption) *simpleService {
+		script := writeScript(t, fmt.Sprintf(`
+			trap 'kill $!; echo term >> %[1]v; exit 0' TERM
+			sleep 600 &
+			echo started >> %[1]v
+			wait
+		`, steps))
+		return NewCommandService("drained", script, opts...).(*simpleService)
+	}
+
+	// stop starts the service and stops it once it started
+	stop := func(t *testing.T, service *simpleService, steps string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+		waitForFileContent(t, steps, "started\n")
+		cancel()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected the service to exit successfully, got %v", err)
+		}
+	}
+
+	// recorder is a server whose requests are recorded in the steps file
+	recorder := func(t *testing.T, steps string, status int) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				file, err := os.OpenFile(steps, os.O_APPEND|os.O_WRONLY, 0)
+				if err == nil {
+					fmt.Fprintf(file, "%v %v\n", r.Method, r.URL.Path)
+					file.Close()
+				}
+				w.WriteHeader(status)
+			}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	t.Run("it runs the command before the stop signal", func(t *testing.T) {
+		setup()
+		steps := filepath.Join(t.TempDir(), "steps")
+		hook := PreStopHook{
+			Command: []string{"sh", "-c", fmt.Sprintf("sleep 0.2; echo hook >> %v", steps)},
+		}
+		service := drained(t, steps, WithPreStop(hook))
+		stop(t, service, steps)
+		waitForFileContent(t, steps, "started\nhook\nterm\n")
+	})
+
+	t.Run("it sends the request before the stop signal", func(t *testing.T) {
+		setup()
+		steps := filepath.Join(t.TempDir(), "steps")
+		server := recorder(t, steps, http.StatusNoContent)
+		service := drained(t, steps, WithPreStop(PreStopHook{URL: server.URL + "/drain"}))
+		stop(t, service, steps)
+		waitForFileContent(t, steps, "started\nPOST /drain\nterm\n")
+	})
+
+	t.Run("it sends the stop signal after the hook times out", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		steps := filepath.Join(t.TempDir(), "steps")
+		hook := PreStopHook{Command: []string{"sleep", "600"}, Timeout: 100 * time.Millisecond}
+		service := drained(t, steps, WithPreStop(hook))
+		start := time.Now()
+		stop(t, service, steps)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the hook to time out, took %v", elapsed)
+		}
+		waitForFileContent(t, steps, "started\nterm\n")
+		waitForLog(t, &out, "WARN drained: the pre-stop hook failed: timed out after 100ms\n")
+	})
+
+	t.Run("it logs the failures of the hook", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		steps := filepath.Join(t.TempDir(), "steps")
+		server := recorder(t, steps, http.StatusServiceUnavailable)
+		hook := PreStopHook{URL: server.URL + "/drain", Method: http.MethodPut}
+		service := drained(t, steps, WithPreStop(hook))
+		stop(t, service, steps)
+		waitForFileContent(t, steps, "started\nPUT /drain\nterm\n")
+		waitForLog(t, &out, "WARN drained: the pre-stop hook failed: unexpected status 503 "+
+			"Service Unavailable")
+	})
+
+	t.Run("it runs the hook when a reload replaces the service", func(t *testing.T) {
+		setup()
+		steps := filepath.Join(t.TempDir(), "steps")
+		server := recorder(t, steps, http.StatusOK)
+		hook := WithPreStop(PreStopHook{URL: server.URL + "/drain"})
+		supervisor := NewSupervisor([]Service{drained(t, steps, hook)})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForFileContent(t, steps, "started\n")
+		replacement := drained(t, steps, hook, WithArgs("v2"))
+		if err := supervisor.Reload(context.Background(), []Service{replacement}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForFileContent(t, steps, "started\nPOST /drain\nterm\nstarted\n")
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForFileContent(t, steps, "started\nPOST /drain\nterm\nstarted\nPOST /drain\nterm\n")
+	})
+
+	t.Run("it rejects the malformed hooks", func(t *testing.T) {
+		cases := map[string]PreStopHook{
+			"missing URL or command":        {},
+			"set either a URL or a command": {URL: "http://127.0.0.1:1", Command: []string{"sh"}},
+			"the scheme must be http":       {URL: "ftp://127.0.0.1:1"},
+			"missing binary":                {Command: []string{"cartesi-missing-binary"}},
+		}
+		for expected, hook := range cases {
+			err := hook.Validate()
+			if err == nil || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected the error %q, got %v", expected, err)
+			}
+		}
+	})
+}
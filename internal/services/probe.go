@@ -0,0 +1,132 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultProbeTimeout is how long each probe attempt may take
+const DefaultProbeTimeout = time.Second
+
+// TcpPortProbe is a readiness probe that succeeds when the port accepts TCP
+// connections
+type TcpPortProbe struct {
+	Host string
+	Port int
+
+	// Timeout of each connection attempt. The default is DefaultProbeTimeout
+	Timeout time.Duration
+}
+
+// Validate checks that the port is a valid TCP port
+func (p TcpPortProbe) Validate() error {
+	if p.Port <= 0 || p.Port > 65535 {
+		return fmt.Errorf("invalid port %v", p.Port)
+	}
+	return nil
+}
+
+func (p TcpPortProbe) Ready(ctx context.Context) error {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	dialer := net.Dialer{Timeout: timeout}
+	address := net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeClient is shared by all HTTP probes so connections are reused between
+// attempts instead of piling up
+var probeClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: DefaultProbeTimeout}).DialContext,
+		MaxIdleConnsPerHost: 1,
+		IdleConnTimeout:     30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// HttpProbe is a readiness probe that succeeds when a GET request to the URL
+// returns one of the expected status codes. The overall deadline is given by
+// the context, which Run bounds by the readiness timeout
+type HttpProbe struct {
+	URL string
+
+	// StatusCodes considered ready. The default is 200
+	StatusCodes []int
+
+	// Timeout of each request. The default is DefaultProbeTimeout
+	Timeout time.Duration
+}
+
+// Validate checks that the URL is an absolute HTTP URL with a valid port
+func (p HttpProbe) Validate() error {
+	parsed, err := url.Parse(p.URL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("invalid URL %v: the scheme must be http or https", p.URL)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("invalid URL %v: missing host", p.URL)
+	}
+	if port := parsed.Port(); port != "" {
+		if number, err := strconv.Atoi(port); err != nil || number <= 0 || number > 65535 {
+			return fmt.Errorf("invalid URL %v: invalid port %v", p.URL, port)
+		}
+	}
+	return nil
+}
+
+func (p HttpProbe) Ready(ctx context.Context) error {
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	// drain the body so the connection can be reused by the next attempt
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBodySize))
+	resp.Body.Close()
+
+	statusCodes := p.StatusCodes
+	if len(statusCodes) == 0 {
+		statusCodes = []int{http.StatusOK}
+	}
+	for _, code := range statusCodes {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected status %v from %v", resp.Status, p.URL)
+}
+
+// maxProbeBodySize is how much of a probe response body is read before the
+// connection is closed
+const maxProbeBodySize = 64 * 1024
@@ -0,0 +1,101 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTcpPortProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	probe := TcpPortProbe{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port}
+
+	if err := probe.Ready(context.Background()); err != nil {
+		t.Fatalf("expected the probe to succeed, got %v", err)
+	}
+	listener.Close()
+	if err := probe.Ready(context.Background()); err == nil {
+		t.Fatal("expected the probe to fail after the listener is closed")
+	}
+}
+
+func TestHttpProbe(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	t.Run("it succeeds on the expected status codes", func(t *testing.T) {
+		probe := HttpProbe{URL: server.URL}
+		status.Store(http.StatusServiceUnavailable)
+		if err := probe.Ready(context.Background()); err == nil {
+			t.Fatal("expected the probe to fail on 503")
+		}
+		status.Store(http.StatusOK)
+		if err := probe.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the probe to succeed on 200, got %v", err)
+		}
+
+		probe.StatusCodes = []int{http.StatusNoContent}
+		if err := probe.Ready(context.Background()); err == nil {
+			t.Fatal("expected the probe to fail on an unexpected status")
+		}
+		status.Store(http.StatusNoContent)
+		if err := probe.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the probe to succeed on 204, got %v", err)
+		}
+	})
+
+	t.Run("it times out slow requests", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer slow.Close()
+		probe := HttpProbe{URL: slow.URL, Timeout: 100 * time.Millisecond}
+
+		start := time.Now()
+		if err := probe.Ready(context.Background()); err == nil {
+			t.Fatal("expected the probe to time out")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the probe to give up after its timeout, took %v", elapsed)
+		}
+	})
+}
+
+func TestProbeValidation(t *testing.T) {
+	for _, test := range []struct {
+		probe Validator
+		valid bool
+	}{
+		{probe: TcpPortProbe{Port: 4000}, valid: true},
+		{probe: TcpPortProbe{Host: "localhost", Port: 65535}, valid: true},
+		{probe: TcpPortProbe{}, valid: false},
+		{probe: TcpPortProbe{Port: 65536}, valid: false},
+		{probe: HttpProbe{URL: "http://127.0.0.1:4000/graphql"}, valid: true},
+		{probe: HttpProbe{URL: "https://example.com/healthz"}, valid: true},
+		{probe: HttpProbe{URL: "localhost:4000"}, valid: false},
+		{probe: HttpProbe{URL: "http:///graphql"}, valid: false},
+		{probe: HttpProbe{URL: "http://localhost:99999"}, valid: false},
+		{probe: HttpProbe{URL: "http://localhost:port"}, valid: false},
+	} {
+		if err := test.probe.Validate(); (err == nil) != test.valid {
+			t.Errorf("expected %+v to be valid: %v, got %v", test.probe, test.valid, err)
+		}
+	}
+}
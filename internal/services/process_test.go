@@ -0,0 +1,122 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestProcess(t *testing.T) {
+
+	t.Run("it stops the process with the stop signal", func(t *testing.T) {
+		cmd := helperProcess(t, "sleep")
+		fellBack, err := terminateProcess(cmd, defaultStopSignal, true)
+		if err != nil {
+			t.Fatalf("failed to terminate the process: %v", err)
+		}
+		_ = cmd.Wait()
+		// processes that cannot receive the stop signal are killed instead
+		if !fellBack && !stoppedBy(cmd.ProcessState, defaultStopSignal) {
+			t.Fatalf("expected the process to be stopped, got %v", cmd.ProcessState)
+		}
+	})
+
+	t.Run("it kills the process", func(t *testing.T) {
+		cmd := helperProcess(t, "sleep")
+		if err := killProcess(cmd, true); err != nil {
+			t.Fatalf("failed to kill the process: %v", err)
+		}
+		done := make(chan struct{})
+		go func() {
+			_ = cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the process survived being killed")
+		}
+		if cmd.ProcessState.Success() {
+			t.Fatalf("expected the process to fail, got %v", cmd.ProcessState)
+		}
+	})
+
+	t.Run("it does not take other exits for a stop", func(t *testing.T) {
+		cmd := helperProcess(t, "fail")
+		if err := cmd.Wait(); err == nil {
+			t.Fatal("expected the process to fail")
+		}
+		if stoppedBy(cmd.ProcessState, defaultStopSignal) {
+			t.Fatalf("expected the exit to not be a stop, got %v", cmd.ProcessState)
+		}
+	})
+}
+
+// TestHelperProcess is not a real test. It is the process started by
+// helperProcess, since the test binary is the only one known to exist on
+// every platform
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("SERVICES_HELPER_PROCESS") {
+	case "sleep":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	case "fail":
+		os.Exit(3)
+	case "stdin":
+		// 3 when stdin is empty, 4 when it is not the secret
+		data, err := io.ReadAll(os.Stdin)
+		switch {
+		case err != nil || len(data) == 0:
+			os.Exit(3)
+		case string(data) != "secret":
+			os.Exit(4)
+		}
+		os.Exit(0)
+	case "accept":
+		// greet one connection on the inherited listener with its name
+		listener, err := net.FileListener(os.NewFile(listenFDsStart, "listener"))
+		if err != nil || os.Getenv("LISTEN_FDS") != "1" {
+			os.Exit(3)
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			os.Exit(4)
+		}
+		fmt.Fprint(conn, os.Getenv("LISTEN_FDNAMES"))
+		conn.Close()
+		os.Exit(0)
+	case "allocate":
+		allocated = make([]byte, 256<<20)
+		os.Exit(0)
+	}
+}
+
+// allocated keeps the allocation of the helper process from being optimized
+// away
+var allocated []byte
+
+// helperProcess starts the test binary as a child process that behaves
+// according to the mode. The process is killed when the test finishes
+func helperProcess(t *testing.T, mode string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "SERVICES_HELPER_PROCESS="+mode)
+	newProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start the helper process: %v", err)
+	}
+	t.Cleanup(func() {
+		if cmd.ProcessState == nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}
+	})
+	return cmd
+}
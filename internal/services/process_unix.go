@@ -0,0 +1,126 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build unix
+
+package services
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// defaultStopSignal is the signal sent to the services to stop them by default
+var defaultStopSignal os.Signal = syscall.SIGTERM
+
+// forwardedSignals are the signals the node forwards to its services instead
+// of handling them itself
+var forwardedSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// stopSignals are the signals that may stop a service, by name
+var stopSignals = map[string]os.Signal{
+	"SIGTERM": syscall.SIGTERM,
+	"SIGINT":  syscall.SIGINT,
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGHUP":  syscall.SIGHUP,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGKILL": syscall.SIGKILL,
+}
+
+// requestedSignals are the signals that may be sent to the services on
+// request, by name
+var requestedSignals = map[string]os.Signal{
+	"SIGQUIT": syscall.SIGQUIT,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+	"SIGHUP":  syscall.SIGHUP,
+}
+
+// maxRSS returns the peak resident set size of the process that exited, in
+// bytes. Darwin reports it in bytes and the other systems in kilobytes
+func maxRSS(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0
+	}
+	if runtime.GOOS == "darwin" {
+		return int64(rusage.Maxrss)
+	}
+	return int64(rusage.Maxrss) * 1024
+}
+
+// newProcessGroup makes the process the leader of a new process group, so it
+// can be stopped along with the children it spawns
+func newProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// setCredential makes the process run as the user and group. Only root may
+// set the supplementary groups, which are then dropped
+func setCredential(cmd *exec.Cmd, uid, gid uint32) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:         uid,
+		Gid:         gid,
+		NoSetGroups: os.Geteuid() != 0,
+	}
+	return nil
+}
+
+// checkCredential fails if the node may not run processes as the user and
+// group, which requires running as root unless they are the ones of the node
+func checkCredential(uid, gid uint32) error {
+	if os.Geteuid() == 0 || (uint32(os.Geteuid()) == uid && uint32(os.Getegid()) == gid) {
+		return nil
+	}
+	return fmt.Errorf("the node must run as root to run processes as uid %v and gid %v",
+		uid, gid)
+}
+
+// terminateProcess sends the stop signal to the process or, when it leads a
+// process group, to the whole group. It never falls back to killing the
+// process, so it always returns false
+func terminateProcess(cmd *exec.Cmd, signal os.Signal, group bool) (bool, error) {
+	return false, signalProcess(cmd, signal, group)
+}
+
+// killProcess kills the process or, when it leads a process group, the whole
+// group
+func killProcess(cmd *exec.Cmd, group bool) error {
+	return signalProcess(cmd, syscall.SIGKILL, group)
+}
+
+// killGroup kills the processes left in the process group led by the process
+// after it exited, reporting whether there were any
+func killGroup(cmd *exec.Cmd) bool {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) == nil
+}
+
+func signalProcess(cmd *exec.Cmd, signal os.Signal, group bool) error {
+	if sig, ok := signal.(syscall.Signal); ok && group {
+		return syscall.Kill(-cmd.Process.Pid, sig)
+	}
+	return cmd.Process.Signal(signal)
+}
+
+// stoppedBy reports whether the process exited because of the stop signal
+func stoppedBy(state *os.ProcessState, signal os.Signal) bool {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == signal
+}
+
+// terminatingSignal returns the signal that terminated the process, or nil if
+// it exited by itself
+func terminatingSignal(state *os.ProcessState) os.Signal {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return nil
+	}
+	return status.Signal()
+}
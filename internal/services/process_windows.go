@@ -0,0 +1,101 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build windows
+
+package services
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// defaultStopSignal is the signal sent to the services to stop them by
+// default. Windows has no signals, so it stands for a CTRL_BREAK_EVENT
+var defaultStopSignal os.Signal = os.Interrupt
+
+// forwardedSignals are the signals the node forwards to its services. Windows
+// has no signals to forward
+var forwardedSignals []os.Signal
+
+// stopSignals are the signals that may stop a service, by name. Windows only
+// has the console control event and the termination of the process
+var stopSignals = map[string]os.Signal{
+	"SIGINT":  os.Interrupt,
+	"SIGKILL": os.Kill,
+}
+
+// requestedSignals are the signals that may be sent to the services on
+// request, by name. Windows has none that do not stop the process
+var requestedSignals = map[string]os.Signal{}
+
+// statusControlCExit is the exit code of the processes that are terminated by
+// a console control event they do not handle
+const statusControlCExit = 0xC000013A
+
+// maxRSS returns zero, since Windows does not report the peak resident set
+// size of the processes that exited
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
+
+// newProcessGroup makes the process the root of a new process group, so it
+// can receive console control events without the node receiving them too
+func newProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// errCredentialUnsupported is returned by the services that run as another
+// user on Windows
+var errCredentialUnsupported = errors.New("running processes as another user is not supported")
+
+// setCredential fails, since Windows cannot run processes as another user
+func setCredential(cmd *exec.Cmd, uid, gid uint32) error {
+	return errCredentialUnsupported
+}
+
+// checkCredential fails like setCredential
+func checkCredential(uid, gid uint32) error {
+	return errCredentialUnsupported
+}
+
+// terminateProcess sends a CTRL_BREAK_EVENT to the process group of the
+// process, which is the closest Windows has to a stop signal, so the signal
+// itself is ignored. The event can only be sent to processes that lead a
+// process group and share the console of the node. Otherwise, the process is
+// killed instead and terminateProcess returns true
+func terminateProcess(cmd *exec.Cmd, signal os.Signal, group bool) (bool, error) {
+	if group {
+		pid := uint32(cmd.Process.Pid)
+		if err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, pid); err == nil {
+			return false, nil
+		}
+	}
+	return true, cmd.Process.Kill()
+}
+
+// killProcess kills the process. Windows does not kill the children of the
+// process along with it
+func killProcess(cmd *exec.Cmd, group bool) error {
+	return cmd.Process.Kill()
+}
+
+// killGroup does nothing, since Windows has no process groups to kill
+func killGroup(cmd *exec.Cmd) bool {
+	return false
+}
+
+// stoppedBy reports whether the process exited because of the console control
+// event sent by terminateProcess
+func stoppedBy(state *os.ProcessState, signal os.Signal) bool {
+	return uint32(state.ExitCode()) == statusControlCExit
+}
+
+// terminatingSignal returns nil, since Windows has no signals
+func terminatingSignal(state *os.ProcessState) os.Signal {
+	return nil
+}
@@ -0,0 +1,188 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultProxyAddress is the address of the proxy by default. Unlike the other
+// built-in servers, it accepts remote connections, since it is the single
+// entry point of the node
+const DefaultProxyAddress = ":10000"
+
+// The timeouts of the proxy bound the connections to the services, so a
+// service that is down fails the requests instead of holding them. The responses are not
+// bounded once they start, so they may be streamed
+const (
+	proxyDialTimeout           = 5 * time.Second
+	proxyResponseHeaderTimeout = time.Minute
+	proxyIdleConnTimeout       = 90 * time.Second
+)
+
+// ProxyRoute sends the requests whose paths start with Prefix to the port of
+// a service of the node, keeping their paths
+type ProxyRoute struct {
+	Prefix string
+
+	// Service is the name of the service and Port is the name of the port it
+	// declares (see [PortUser]), so the route follows the port the service
+	// was started with. The port is reached on the loopback address
+	Service string
+	Port    string
+}
+
+// DefaultProxyRoutes are the routes of the proxy by default, to the ports of
+// the graphql-server and of the inspect-server
+var DefaultProxyRoutes = []ProxyRoute{
+	{Prefix: "/graphql", Service: "graphql-server", Port: "graphql"},
+	{Prefix: "/inspect", Service: "inspect-server", Port: "http"},
+}
+
+// ProxyConfig configures the proxy service
+type ProxyConfig struct {
+	// Address is where the proxy listens. The default is DefaultProxyAddress
+	Address string
+
+	// Routes are the routes to the services. The default is
+	// DefaultProxyRoutes
+	Routes []ProxyRoute
+}
+
+// proxyService serves the endpoints of the services of the node on a single
+// address
+type proxyService struct {
+	httpServer
+	routes []ProxyRoute
+}
+
+// NewProxyService creates a service that serves the endpoints of the services
+// of the node on a single address, so only one port has to be exposed. It
+// sends the requests to the services by the prefix of their paths, after
+// [DefaultProxyRoutes] by default, and it serves /healthz and /readyz itself,
+// like [NewHealthService]. The ports of the services are the ones declared by
+// the services run along with it by [Run] or a [Supervisor], so they cannot
+// drift apart. The responses are streamed, and the connections are upgraded.
+// The proxy returns 502 with a JSON error when the service of a route is not
+// running or does not answer, and 404 when no route matches
+func NewProxyService(config ProxyConfig) Service {
+	routes := config.Routes
+	if routes == nil {
+		routes = DefaultProxyRoutes
+	}
+	address := valueOr(config.Address, DefaultProxyAddress)
+	return &proxyService{httpServer: newHttpServer("proxy", address, 0), routes: routes}
+}
+
+// Fingerprint describes the address and the routes of the proxy
+func (s *proxyService) Fingerprint() string {
+	return fmt.Sprintf("%v %+v", s.httpServer.Fingerprint(), s.routes)
+}
+
+// Start serves the requests until the context is canceled. It fails unless it
+// is run by a supervisor
+func (s *proxyService) Start(ctx context.Context) error {
+	board := statusBoardFrom(ctx)
+	if board == nil {
+		return errors.New("the proxy service must be run by a supervisor")
+	}
+	return s.serve(ctx, s.handler(statusesWithout(board, s), board.isReady))
+}
+
+// upstreamKey is the key of the address of the service that a request is
+// sent to in its context
+type upstreamKey struct{}
+
+func (s *proxyService) handler(status func() []ServiceStatus, ready func() bool) http.Handler {
+	dialer := &net.Dialer{Timeout: proxyDialTimeout, KeepAlive: 30 * time.Second}
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(r.In.Context().Value(upstreamKey{}).(*url.URL))
+			r.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			ResponseHeaderTimeout: proxyResponseHeaderTimeout,
+			IdleConnTimeout:       proxyIdleConnTimeout,
+			MaxIdleConnsPerHost:   16,
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			route := s.route(r.URL.Path)
+			writeError(w, http.StatusBadGateway,
+				fmt.Sprintf("service '%v' is unreachable: %v", route.Service, err))
+		},
+	}
+	mux := http.NewServeMux()
+	health := healthHandler(status, ready)
+	mux.Handle("/healthz", health)
+	mux.Handle("/readyz", health)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		route := s.route(r.URL.Path)
+		if route == nil {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("%v not found", r.URL.Path))
+			return
+		}
+		upstream, err := upstreamOf(status(), route)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		ctx := context.WithValue(r.Context(), upstreamKey{}, upstream)
+		proxy.ServeHTTP(w, r.WithContext(ctx))
+	})
+	return mux
+}
+
+// route returns the route of the path, which is the one with the longest
+// prefix, or nil if there is none
+func (s *proxyService) route(path string) *ProxyRoute {
+	var match *ProxyRoute
+	for i, route := range s.routes {
+		if !hasPathPrefix(path, route.Prefix) {
+			continue
+		}
+		if match == nil || len(route.Prefix) > len(match.Prefix) {
+			match = &s.routes[i]
+		}
+	}
+	return match
+}
+
+// hasPathPrefix reports whether the path is the prefix or one of its
+// subpaths, so /graphql matches /graphql/ but not /graphqlx
+func hasPathPrefix(path string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// upstreamOf returns the URL of the port of the service of the route, which
+// must be running
+func upstreamOf(statuses []ServiceStatus, route *ProxyRoute) (*url.URL, error) {
+	for _, status := range statuses {
+		if status.Name != route.Service {
+			continue
+		}
+		if status.State != StateReady && status.State != StateRunning {
+			return nil, fmt.Errorf("service '%v' is %v", route.Service, status.State)
+		}
+		for _, port := range status.Ports {
+			if port.Name == route.Port {
+				host := net.JoinHostPort("127.0.0.1", strconv.Itoa(port.Number))
+				return &url.URL{Scheme: "http", Host: host}, nil
+			}
+		}
+		return nil, fmt.Errorf("service '%v' has no port '%v'", route.Service, route.Port)
+	}
+	return nil, fmt.Errorf("service '%v' is not part of the node", route.Service)
+}
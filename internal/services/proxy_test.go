@@ -0,0 +1,172 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upstreamService is an HTTP service that declares the port it listens on
+type upstreamService struct {
+	*HttpService
+	port   string
+	number int
+}
+
+func newUpstreamService(t *testing.T, name string, port string,
+	handler http.Handler) upstreamService {
+	address := freeAddress(t)
+	server := &http.Server{Addr: address, Handler: handler}
+	service := NewHttpService(name, server).(*HttpService)
+	return upstreamService{HttpService: service, port: port, number: portOf(address)}
+}
+
+// portOf returns the number of the port of the address
+func portOf(address string) int {
+	_, port, _ := net.SplitHostPort(address)
+	number, _ := strconv.Atoi(port)
+	return number
+}
+
+func (s upstreamService) Ports() []Port {
+	return []Port{{Name: s.port, Number: s.number}}
+}
+
+// closedPortService declares a port it does not listen on
+type closedPortService struct {
+	testService
+	port Port
+}
+
+func (s closedPortService) Ports() []Port {
+	return []Port{s.port}
+}
+
+func TestProxyService(t *testing.T) {
+
+	// echo creates a handler that answers with the name and the path of the
+	// request
+	echo := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%v %v", name, r.URL.Path)
+		})
+	}
+
+	// start starts the services with a proxy, returning the URL of the proxy
+	start := func(t *testing.T, list ...Service) string {
+		t.Helper()
+		setup()
+		address := freeAddress(t)
+		list = append(list, NewProxyService(ProxyConfig{Address: address}))
+		supervisor := NewSupervisor(list)
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		t.Cleanup(func() {
+			_ = supervisor.Stop(context.Background())
+		})
+		return "http://" + address
+	}
+
+	get := func(t *testing.T, url string) (int, string) {
+		t.Helper()
+		response, err := http.Get(url)
+		if err != nil {
+			t.Fatalf("failed to get %v: %v", url, err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	t.Run("it routes the requests by the prefix of their paths", func(t *testing.T) {
+		url := start(t,
+			newUpstreamService(t, "graphql-server", "graphql", echo("graphql")),
+			newUpstreamService(t, "inspect-server", "http", echo("inspect")))
+		expected := map[string]string{
+			"/graphql":        "graphql /graphql",
+			"/inspect/0x1234": "inspect /inspect/0x1234",
+		}
+		for path, body := range expected {
+			if code, got := get(t, url+path); code != http.StatusOK || got != body {
+				t.Errorf("expected %q for %v, got %v %q", body, path, code, got)
+			}
+		}
+		if code, _ := get(t, url+"/graphqlx"); code != http.StatusNotFound {
+			t.Fatalf("expected status 404 for the unknown paths, got %v", code)
+		}
+	})
+
+	t.Run("it serves the health of the node", func(t *testing.T) {
+		url := start(t, newUpstreamService(t, "graphql-server", "graphql", echo("graphql")))
+		code, body := get(t, url+"/healthz")
+		if code != http.StatusOK || !strings.Contains(body, `"status":"healthy"`) {
+			t.Fatalf("expected the node to be healthy, got %v %q", code, body)
+		}
+	})
+
+	t.Run("it returns 502 when a service is down", func(t *testing.T) {
+		// the graphql-server is running but does not listen on its port
+		idle := testService{name: "graphql-server", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		port := Port{Name: "graphql", Number: portOf(freeAddress(t))}
+		url := start(t, closedPortService{idle, port})
+		for path, expected := range map[string]string{
+			"/graphql": "service 'graphql-server' is unreachable",
+			"/inspect": "service 'inspect-server' is not part of the node",
+		} {
+			began := time.Now()
+			code, body := get(t, url+path)
+			var response map[string]string
+			_ = json.Unmarshal([]byte(body), &response)
+			if code != http.StatusBadGateway || !strings.HasPrefix(response["error"], expected) {
+				t.Errorf("expected 502 with %q for %v, got %v %q", expected, path, code, body)
+			}
+			if elapsed := time.Since(began); elapsed > time.Second {
+				t.Errorf("expected the proxy to fail fast for %v, took %v", path, elapsed)
+			}
+		}
+	})
+
+	t.Run("it streams the responses", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "first\n")
+			w.(http.Flusher).Flush()
+			<-release
+		})
+		url := start(t, newUpstreamService(t, "graphql-server", "graphql", handler))
+		response, err := http.Get(url + "/graphql")
+		if err != nil {
+			t.Fatalf("failed to get the stream: %v", err)
+		}
+		defer response.Body.Close()
+		read := make(chan string, 1)
+		go func() {
+			line, _ := bufio.NewReader(response.Body).ReadString('\n')
+			read <- line
+		}()
+		select {
+		case line := <-read:
+			if line != "first\n" {
+				t.Fatalf("expected the first line, got %q", line)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the first line before the response completes")
+		}
+	})
+}
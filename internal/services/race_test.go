@@ -0,0 +1,10 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build race
+
+package services
+
+// raceEnabled is set when the tests run with the race detector, whose
+// runtime needs far more memory than the processes it instruments
+const raceEnabled = true
@@ -0,0 +1,50 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrReadyTimeout is returned when a service does not become ready in time
+var ErrReadyTimeout = errors.New("service did not become ready in time")
+
+// DefaultReadyTimeout is how long Run waits for a service to become ready
+const DefaultReadyTimeout = 2 * time.Minute
+
+// readyPollInterval is the interval between calls to Readiness.Ready
+var readyPollInterval = 100 * time.Millisecond
+
+// Readiness is implemented by services that take some time after being
+// started to be able to serve requests. Services that do not implement it
+// are considered ready as soon as they are started
+type Readiness interface {
+	// Ready returns nil if the service is ready and an error describing why
+	// it is not ready otherwise. It must not block for long, as Run will call
+	// it repeatedly until it succeeds
+	Ready(ctx context.Context) error
+}
+
+// waitReady polls the readiness of the service until it succeeds or the
+// context is done. A panic in Ready is returned as a [PanicError]
+func waitReady(ctx context.Context, service Service) (err error) {
+	defer recoverPanic(&err)
+	readiness, ok := service.(Readiness)
+	if !ok {
+		return nil
+	}
+	for {
+		err := readiness.Ready(ctx)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(readyPollInterval):
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunReadiness(t *testing.T) {
+
+	t.Run("it starts each service after the previous one is ready", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var firstReady atomic.Bool
+		first := readyTestService{
+			testService: testService{
+				name: "first",
+				start: func(ctx context.Context) error {
+					time.AfterFunc(200*time.Millisecond, func() { firstReady.Store(true) })
+					<-ctx.Done()
+					return nil
+				},
+			},
+			ready: func(ctx context.Context) error {
+				if !firstReady.Load() {
+					return errors.New("not ready yet")
+				}
+				return nil
+			},
+		}
+		startedBeforeReady := false
+		second := testService{
+			name: "second",
+			start: func(ctx context.Context) error {
+				startedBeforeReady = !firstReady.Load()
+				cancel()
+				return nil
+			},
+		}
+
+		if err := Run(ctx, []Service{first, second}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if startedBeforeReady {
+			t.Fatal("expected the second service to start after the first was ready")
+		}
+	})
+
+	t.Run("it notifies when all services are ready", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var secondReady atomic.Bool
+		first := testService{
+			name: "first",
+			start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			},
+		}
+		second := readyTestService{
+			testService: testService{
+				name: "second",
+				start: func(ctx context.Context) error {
+					time.AfterFunc(100*time.Millisecond, func() { secondReady.Store(true) })
+					<-ctx.Done()
+					return nil
+				},
+			},
+			ready: func(ctx context.Context) error {
+				if !secondReady.Load() {
+					return errors.New("not ready yet")
+				}
+				return nil
+			},
+		}
+		calls := 0
+		notifiedEarly := false
+		onAllReady := func() {
+			calls++
+			notifiedEarly = !secondReady.Load()
+			cancel()
+		}
+
+		if err := Run(ctx, []Service{first, second}, WithOnAllReady(onAllReady)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if calls != 1 || notifiedEarly {
+			t.Fatalf("expected a single notification after the services were ready")
+		}
+	})
+
+	t.Run("it aborts the startup when a service is not ready in time", func(t *testing.T) {
+		setup()
+		firstStopped := false
+		first := readyTestService{
+			testService: testService{
+				name: "never-ready",
+				start: func(ctx context.Context) error {
+					<-ctx.Done()
+					firstStopped = true
+					return nil
+				},
+			},
+			ready: func(ctx context.Context) error {
+				return errors.New("still loading")
+			},
+		}
+		secondStarted := false
+		second := testService{
+			name: "second",
+			start: func(ctx context.Context) error {
+				secondStarted = true
+				return nil
+			},
+		}
+
+		err := Run(context.Background(), []Service{first, second},
+			WithReadyTimeout(200*time.Millisecond))
+		if !errors.Is(err, ErrReadyTimeout) || !strings.Contains(err.Error(), "never-ready") {
+			t.Fatalf("expected an error naming the service, got %v", err)
+		}
+		if !firstStopped {
+			t.Fatal("expected the started service to be stopped")
+		}
+		if secondStarted {
+			t.Fatal("expected the second service to not be started")
+		}
+	})
+}
+
+func TestRunReadyTimeout(t *testing.T) {
+
+	t.Run("it applies the ready timeout of each service", func(t *testing.T) {
+		setup()
+		stuck := &simpleService{
+			serviceName: "stuck",
+			binaryName:  writeScript(t, "trap 'kill $!; exit 0' TERM; sleep 600 & wait"),
+			probe: readinessFunc(func(ctx context.Context) error {
+				return errors.New("waiting for the database")
+			}),
+		}
+		spec := ServiceSpec{Service: stuck, ReadyTimeout: 200 * time.Millisecond}
+
+		start := time.Now()
+		err := Run(context.Background(), []Service{spec}, WithReadyTimeout(time.Minute))
+		if !errors.Is(err, ErrReadyTimeout) || !strings.Contains(err.Error(), "stuck") {
+			t.Fatalf("expected a ready timeout error naming the service, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Fatalf("expected the node to stop after the service ready timeout, took %v", elapsed)
+		}
+		if stuck.running.Load() {
+			t.Fatal("expected the stuck process to be stopped")
+		}
+	})
+}
+
+// readyTestService is a testService that implements Readiness
+type readyTestService struct {
+	testService
+	ready func(ctx context.Context) error
+}
+
+func (s readyTestService) Ready(ctx context.Context) error {
+	return s.ready(ctx)
+}
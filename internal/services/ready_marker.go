@@ -0,0 +1,113 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// readyMarkerName is the name of the default ready marker
+const readyMarkerName = "cartesi-rollups-node.ready"
+
+// DefaultReadyMarkerPath returns the path of the ready marker used when
+// WithReadyMarker is given no path, which is in the temporary directory
+func DefaultReadyMarkerPath() string {
+	return filepath.Join(os.TempDir(), readyMarkerName)
+}
+
+// WithReadyMarker makes Run create a file at path while the node is ready, for
+// the healthchecks that can only test that a file exists, such as test -f in
+// the healthcheck of a container. The file is created once all services are
+// ready, written to a temporary file and renamed, so it never appears empty.
+// It is removed when a critical service is no longer ready or running and as
+// the first step of the shutdown, and created again when the services recover
+// before that. A file left behind by a node that crashed is removed before any
+// service is started. The file holds the time the node became ready. The path
+// is DefaultReadyMarkerPath when it is empty
+func WithReadyMarker(path string) RunOption {
+	return func(c *runConfig) {
+		if path == "" {
+			path = DefaultReadyMarkerPath()
+		}
+		c.readyMarker = path
+	}
+}
+
+// readyMarker is the file that exists while the node is ready. A nil marker
+// does nothing
+type readyMarker struct {
+	path    string
+	created bool
+}
+
+// newReadyMarker creates the marker at path, removing the file left behind by
+// a previous node
+func newReadyMarker(path string) *readyMarker {
+	m := &readyMarker{path: path}
+	err := os.Remove(path)
+	switch {
+	case err == nil:
+		logger.Log(logger.Info, fmt.Sprintf("main: removed the stale ready marker %v", path),
+			"event", "ready_marker_removed", "path", path)
+	case !errors.Is(err, fs.ErrNotExist):
+		m.logFailure("remove", err)
+	}
+	return m
+}
+
+// update creates the file when the node is ready and removes it otherwise
+func (m *readyMarker) update(ready bool, now time.Time) {
+	if m == nil || ready == m.created {
+		return
+	}
+	if ready {
+		if err := m.create(now); err != nil {
+			m.logFailure("create", err)
+			return
+		}
+		m.created = true
+		return
+	}
+	m.created = false
+	if err := os.Remove(m.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		m.logFailure("remove", err)
+	}
+}
+
+// create writes the file to a temporary file in the same directory and
+// renames it, so it appears with its content at once
+func (m *readyMarker) create(now time.Time) error {
+	dir, name := filepath.Split(m.path)
+	if dir == "" {
+		dir = "."
+	}
+	file, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = fmt.Fprintln(file, now.UTC().Format(time.RFC3339))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), m.path)
+}
+
+func (m *readyMarker) logFailure(action string, err error) {
+	logger.Log(logger.Warning, fmt.Sprintf("main: failed to %v the ready marker: %v", action,
+		err), "event", "ready_marker_failed", "path", m.path, "error", err)
+}
@@ -0,0 +1,176 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestReadyMarker(t *testing.T) {
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// waitForMarker waits for the marker to exist or not
+	waitForMarker := func(t *testing.T, path string, expected bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for exists(path) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the marker to exist: %v", expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// stopper creates a service that records whether the marker exists when
+	// it is asked to stop
+	stopper := func(path string, existed chan<- bool) Service {
+		return testService{name: "server", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			existed <- exists(path)
+			return nil
+		}}
+	}
+
+	t.Run("it creates the marker once the services are ready", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node-ready")
+		if err := os.WriteFile(path, []byte("stale\n"), 0o644); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{database, indexer}, WithReadyMarker(path))
+		go supervisor.Start(context.Background())   //nolint:errcheck
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		database.WaitForStarts(t, 1)
+		if exists(path) {
+			t.Fatal("expected the stale marker to be removed before the services start")
+		}
+		database.BecomeReady()
+		indexer.WaitForStarts(t, 1)
+		if exists(path) {
+			t.Fatal("expected no marker until all services are ready")
+		}
+		indexer.BecomeReady()
+		<-supervisor.Ready()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected the marker once the services are ready, got %v", err)
+		}
+		if _, err := time.Parse(time.RFC3339, string(content[:len(content)-1])); err != nil {
+			t.Fatalf("expected the time the node became ready, got %q", content)
+		}
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 1 {
+			t.Fatalf("expected no temporary files, got %v", entries)
+		}
+	})
+
+	t.Run("it removes the marker first when the node is stopped", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node-ready")
+		existed := make(chan bool, 1)
+		supervisor := NewSupervisor([]Service{stopper(path, existed)}, WithReadyMarker(path))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForMarker(t, path, true)
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if <-existed {
+			t.Fatal("expected the marker to be removed before the services are stopped")
+		}
+		if exists(path) {
+			t.Fatal("expected no marker after the shutdown")
+		}
+	})
+
+	t.Run("it removes the marker first when a critical service exits", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node-ready")
+		existed := make(chan bool, 1)
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{stopper(path, existed), indexer},
+			WithReadyMarker(path))
+		go func() {
+			indexer.WaitForStarts(t, 1)
+			indexer.BecomeReady()
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForMarker(t, path, true)
+		indexer.Fail(errors.New("connection lost"))
+		if err := supervisor.Wait(); err == nil {
+			t.Fatal("expected the failure of the indexer")
+		}
+		if <-existed {
+			t.Fatal("expected the marker to be removed before the services are stopped")
+		}
+		if exists(path) {
+			t.Fatal("expected no marker after the shutdown")
+		}
+	})
+
+	t.Run("it removes the marker while a critical service restarts", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node-ready")
+		indexer := servicestest.NewFakeService("indexer")
+		backoff := Backoff{Initial: 50 * time.Millisecond, Max: 50 * time.Millisecond,
+			Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{Restart(indexer, RestartOnFailure)},
+			WithReadyMarker(path), WithRestartOnFailure(backoff))
+		go func() {
+			indexer.WaitForStarts(t, 1)
+			indexer.BecomeReady()
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		waitForMarker(t, path, true)
+
+		indexer.Fail(errors.New("connection lost"))
+		waitForMarker(t, path, false)
+		indexer.WaitForStarts(t, 2)
+		indexer.BecomeReady()
+		waitForMarker(t, path, true)
+	})
+
+	t.Run("it keeps the marker when an optional service exits", func(t *testing.T) {
+		setup()
+		path := filepath.Join(t.TempDir(), "node-ready")
+		indexer := servicestest.NewFakeService("indexer")
+		existed := make(chan bool, 1)
+		supervisor := NewSupervisor([]Service{stopper(path, existed), Optional(indexer)},
+			WithReadyMarker(path))
+		go func() {
+			indexer.WaitForStarts(t, 1)
+			indexer.BecomeReady()
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		waitForMarker(t, path, true)
+		indexer.Fail(errors.New("connection lost"))
+		waitForStates(t, supervisor, StateReady, StateFailed)
+		if !exists(path) {
+			t.Fatal("expected the marker to be kept")
+		}
+	})
+}
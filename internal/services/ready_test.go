@@ -0,0 +1,153 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestSupervisorReady(t *testing.T) {
+
+	// waitForReady waits for the channel of Ready to be closed
+	waitForReady := func(t *testing.T, supervisor *Supervisor) {
+		t.Helper()
+		select {
+		case <-supervisor.Ready():
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the channel of Ready to be closed")
+		}
+	}
+
+	// notReady fails the test if the channel of Ready is closed
+	notReady := func(t *testing.T, supervisor *Supervisor) {
+		t.Helper()
+		select {
+		case <-supervisor.Ready():
+			t.Fatal("expected the channel of Ready to be open")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	t.Run("it closes the channel once all services are ready", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{database, indexer})
+		go supervisor.Start(context.Background())   //nolint:errcheck
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		database.WaitForStarts(t, 1)
+		database.BecomeReady()
+		indexer.WaitForStarts(t, 1)
+		notReady(t, supervisor)
+		if err := supervisor.ReadyErr(); err != nil {
+			t.Fatalf("expected no error while waiting, got %v", err)
+		}
+		indexer.BecomeReady()
+		waitForReady(t, supervisor)
+		if err := supervisor.ReadyErr(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it does not reopen the channel when a service restarts", func(t *testing.T) {
+		setup()
+		indexer := servicestest.NewFakeService("indexer")
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{indexer}, WithRestartOnFailure(backoff))
+		go supervisor.Start(context.Background())   //nolint:errcheck
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		indexer.WaitForStarts(t, 1)
+		indexer.BecomeReady()
+		waitForReady(t, supervisor)
+		ready := supervisor.Ready()
+		indexer.Fail(errors.New("connection lost"))
+		indexer.WaitForStarts(t, 2)
+		if supervisor.Ready() != ready {
+			t.Fatal("expected the same channel after the restart")
+		}
+		waitForReady(t, supervisor)
+		if err := supervisor.ReadyErr(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it does not wait for the services added by a reload", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		supervisor := NewSupervisor([]Service{database})
+		go supervisor.Start(context.Background())   //nolint:errcheck
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		database.WaitForStarts(t, 1)
+		database.BecomeReady()
+		waitForReady(t, supervisor)
+		indexer := servicestest.NewFakeService("indexer")
+		reloaded := make(chan error, 1)
+		go func() {
+			reloaded <- supervisor.Reload(context.Background(), []Service{database, indexer})
+		}()
+		indexer.WaitForStarts(t, 1)
+		waitForReady(t, supervisor)
+		if err := supervisor.ReadyErr(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		indexer.BecomeReady()
+		if err := <-reloaded; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it closes the channel when the startup fails", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{database, indexer})
+		go supervisor.Start(context.Background()) //nolint:errcheck
+
+		database.WaitForStarts(t, 1)
+		database.BecomeReady()
+		indexer.WaitForStarts(t, 1)
+		indexer.Fail(errors.New("bad config"))
+		waitForReady(t, supervisor)
+		err := supervisor.ReadyErr()
+		if !errors.Is(err, ErrNeverReady) {
+			t.Fatalf("expected the services to never be ready, got %v", err)
+		}
+		waitErr := supervisor.Wait()
+		if waitErr == nil || !errors.Is(err, waitErr) {
+			t.Fatalf("expected ReadyErr to wrap %v, got %v", waitErr, err)
+		}
+	})
+
+	t.Run("it closes the channel when stopped before starting", func(t *testing.T) {
+		setup()
+		supervisor := NewSupervisor([]Service{servicestest.NewFakeService("indexer")})
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForReady(t, supervisor)
+		if err := supervisor.ReadyErr(); !errors.Is(err, ErrNeverReady) {
+			t.Fatalf("expected the services to never be ready, got %v", err)
+		}
+	})
+
+	t.Run("it closes the channel when the services are invalid", func(t *testing.T) {
+		setup()
+		supervisor := NewSupervisor(nil)
+		if err := supervisor.Start(context.Background()); !errors.Is(err, ErrNoServices) {
+			t.Fatalf("expected no services, got %v", err)
+		}
+		waitForReady(t, supervisor)
+		if err := supervisor.ReadyErr(); !errors.Is(err, ErrNoServices) {
+			t.Fatalf("expected ReadyErr to wrap the error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,440 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// A Fingerprinter is a service that describes its own configuration, so a
+// reload can tell whether it changed. Services that do not implement it are
+// compared by the values of their fields
+type Fingerprinter interface {
+	// Fingerprint returns a description of the configuration of the service
+	// that changes whenever the configuration does
+	Fingerprint() string
+}
+
+// WithReloader makes the node reload its services when it receives SIGHUP,
+// instead of forwarding the signal to them. The function returns the new
+// definitions of the services, which are applied like [Supervisor.Reload]
+func WithReloader(load func(ctx context.Context) ([]Service, error)) RunOption {
+	return func(c *runConfig) {
+		c.reloader = load
+	}
+}
+
+// Reload replaces the services of the supervisor with the given ones without
+// stopping the node. The services are matched with the current ones by name:
+// the services whose definition did not change keep running, the ones that
+// changed are stopped and started again with the new definition, the new ones
+// are started, and the ones that are missing are stopped. The services are
+// stopped after the services that depend on them and started after the
+// services they depend on, but the services that did not change are not
+// restarted along with their dependencies. The admin server, if it is
+// enabled, is never reloaded.
+//
+// Reload returns once the services that were started are ready, or the error
+// that prevented the reload, in which case the services are left as they were.
+// Each step is published in the events of the supervisor, between
+// [EventReloadStarted] and [EventReloadCompleted]
+func (s *Supervisor) Reload(ctx context.Context, services []Service) error {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return errors.New("supervisor was not started")
+	}
+	result := make(chan error, 1)
+	select {
+	case s.reloads <- reloadRequest{services: services, result: result}:
+	case <-s.done:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reloadRequest asks the supervisor to replace its services. The error of
+// loading the services, if any, fails the reload
+type reloadRequest struct {
+	services []Service
+	err      error
+	result   chan<- error
+}
+
+func (r reloadRequest) respond(err error) {
+	if r.result != nil {
+		r.result <- err
+	}
+}
+
+// reload is a reload that is being applied
+type reload struct {
+	request reloadRequest
+
+	// replacements are the new definitions of the services that must stop
+	// before they are replaced, which are nil for the services being removed
+	replacements map[int]*ServiceSpec
+	stopping     map[int]bool
+
+	// dependents are the dependents of each service before the reload, which
+	// are stopped first
+	dependents [][]int
+
+	// pending are the services that must settle to complete the reload
+	pending map[int]bool
+}
+
+// replacing reports whether the service at index i is waiting to be replaced
+func (r *reload) replacing(i int) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.replacements[i]
+	return ok
+}
+
+// reloadPlan is the outcome of matching the services of a reload with the
+// current ones
+type reloadPlan struct {
+	specs   []ServiceSpec
+	deps    [][]int
+	kept    []bool
+	changed []int
+	added   []int
+	removed []int
+}
+
+// load calls the reloader and sends its services to the loop of the
+// supervisor
+func (s *supervisor) load() {
+	services, err := s.config.reloader(s.servicesCtx)
+	select {
+	case s.reloads <- reloadRequest{services: services, err: err}:
+	case <-s.servicesCtx.Done():
+	}
+}
+
+// beginReload plans the reload and begins to stop the services that changed
+// or were removed. The reload continues as they exit
+func (s *supervisor) beginReload(request reloadRequest) {
+	err := request.err
+	if err == nil && s.reloading != nil {
+		err = errors.New("a reload is already in progress")
+	}
+	if err == nil && (len(s.restarting) > 0 || s.rolling != nil) {
+		err = errors.New("a restart is in progress")
+	}
+	var plan reloadPlan
+	if err == nil {
+		plan, err = s.planReload(request.services)
+	}
+	if err != nil {
+		logger.Log(logger.Error, fmt.Sprintf("main: failed to reload the services: %v", err),
+			"event", "reload_failed", "error", err)
+		s.config.events.publish(ServiceEvent{Kind: EventReloadCompleted,
+			Time: s.config.clock.Now(), Err: err})
+		request.respond(err)
+		return
+	}
+
+	names := func(indexes []int) string {
+		list := make([]string, len(indexes))
+		for i, index := range indexes {
+			list[i] = plan.specs[index].String()
+		}
+		return "[" + strings.Join(list, ", ") + "]"
+	}
+	msg := fmt.Sprintf("main: reloading the services; changed: %v, added: %v, removed: %v",
+		names(plan.changed), names(plan.added), names(plan.removed))
+	logger.Log(logger.Info, msg, "event", "reload_started")
+	s.config.events.publish(ServiceEvent{Kind: EventReloadStarted, Time: s.config.clock.Now()})
+
+	reload := &reload{
+		request:      request,
+		replacements: make(map[int]*ServiceSpec),
+		stopping:     make(map[int]bool),
+		dependents:   s.dependents,
+		pending:      make(map[int]bool),
+	}
+	for _, i := range plan.changed {
+		spec := plan.specs[i]
+		reload.replacements[i] = &spec
+		s.status.publish(i, EventReplaced, nil)
+	}
+	for _, i := range plan.removed {
+		reload.replacements[i] = nil
+	}
+	for _, i := range plan.added {
+		spec := plan.specs[i]
+		s.specs = append(s.specs, spec)
+		s.setFilter(i, newLogFilter(spec.String(), spec.LogLevel))
+		s.cancels = append(s.cancels, nil)
+		s.readyCancels = append(s.readyCancels, nil)
+		s.startSpans = append(s.startSpans, nil)
+		s.started = append(s.started, false)
+		s.settled = append(s.settled, false)
+		s.removed = append(s.removed, false)
+		s.generations = append(s.generations, 0)
+		s.status.add(spec)
+		s.status.publish(i, EventAdded, nil)
+		reload.pending[i] = true
+	}
+	s.deps = plan.deps
+	s.dependents = dependentsOf(plan.deps)
+	s.reloading = reload
+	s.stopReplaced()
+	s.startEligible()
+	s.checkReload()
+}
+
+// planReload matches the services with the current ones by name and checks
+// the services that would run after the reload
+func (s *supervisor) planReload(services []Service) (reloadPlan, error) {
+	if err := checkServices(services); err != nil {
+		return reloadPlan{}, err
+	}
+	plan := reloadPlan{
+		specs: slices.Clone(s.specs),
+		kept:  make([]bool, len(s.specs)),
+	}
+	indexes := make(map[string]int, len(s.specs))
+	for i := s.builtin; i < len(s.specs); i++ {
+		indexes[s.specs[i].String()] = i
+	}
+	for i := 0; i < s.builtin; i++ {
+		plan.kept[i] = true
+	}
+	var check []ServiceSpec
+	for _, service := range services {
+		spec := specOf(service)
+		spec.Restart = s.config.restartPolicy(spec)
+		name := spec.String()
+		i, ok := indexes[name]
+		switch {
+		case !ok:
+			i = len(plan.specs)
+			indexes[name] = i
+			plan.specs = append(plan.specs, spec)
+			plan.kept = append(plan.kept, false)
+			plan.added = append(plan.added, i)
+			check = append(check, spec)
+		case plan.kept[i]:
+			releaseServices(check)
+			return reloadPlan{}, &DuplicateNameError{Name: name}
+		case s.removed[i] || configHash(spec) != configHash(s.specs[i]):
+			if service, ok := spec.Service.(*simpleService); ok && !s.removed[i] {
+				service.adoptListeners(s.specs[i].Service)
+				service.adoptPorts(s.specs[i].Service)
+			}
+			plan.specs[i] = spec
+			plan.changed = append(plan.changed, i)
+			check = append(check, spec)
+		}
+		plan.kept[i] = true
+	}
+	for i := s.builtin; i < len(s.specs); i++ {
+		if !plan.kept[i] && !s.removed[i] {
+			plan.removed = append(plan.removed, i)
+		}
+	}
+
+	// the dependencies are resolved among the services that are kept, and
+	// the services that were removed depend on nothing
+	var live []int
+	var liveSpecs []ServiceSpec
+	for i, kept := range plan.kept {
+		if kept {
+			live = append(live, i)
+			liveSpecs = append(liveSpecs, plan.specs[i])
+		}
+	}
+	liveDeps, err := resolveDependencies(liveSpecs)
+	if err != nil {
+		releaseServices(check)
+		return reloadPlan{}, err
+	}
+	plan.deps = make([][]int, len(plan.specs))
+	for j, deps := range liveDeps {
+		for _, dep := range deps {
+			plan.deps[live[j]] = append(plan.deps[live[j]], live[dep])
+		}
+	}
+	if err := assignPorts(liveSpecs); err != nil {
+		releaseServices(check)
+		return reloadPlan{}, err
+	}
+	if !s.config.skipValidation {
+		// the ports of the services that are running are not free, but they
+		// may be claimed by their new definitions
+		var running []ServiceSpec
+		for i, spec := range s.specs {
+			if !s.removed[i] {
+				running = append(running, spec)
+			}
+		}
+		problems := &validationError{}
+		problems.validate(check)
+		problems.checkPorts(liveSpecs, heldPorts(running))
+		if err := problems.orNil(); err != nil {
+			releaseServices(check)
+			return reloadPlan{}, err
+		}
+	}
+	return plan, nil
+}
+
+// stopReplaced stops the services waiting to be replaced whose dependents
+// that are also being replaced already stopped, and replaces the ones that are
+// not running right away
+func (s *supervisor) stopReplaced() {
+	reload := s.reloading
+	for i := range s.specs {
+		if !reload.replacing(i) || reload.stopping[i] {
+			continue
+		}
+		if !s.running[i] {
+			s.replace(i)
+			continue
+		}
+		eligible := true
+		for _, dependent := range reload.dependents[i] {
+			if reload.replacing(dependent) && s.running[dependent] {
+				eligible = false
+			}
+		}
+		if !eligible {
+			continue
+		}
+		name := s.specs[i].String()
+		s.filters[i].log(logger.Info, fmt.Sprintf("main: stopping service '%v' to reload it",
+			name), "service", name, "event", "stopping", "reload", true)
+		s.status.set(i, StateStopping, nil)
+		reload.stopping[i] = true
+		s.cancels[i]()
+	}
+}
+
+// replacedExit handles the exit of a service that is waiting to be replaced
+func (s *supervisor) replacedExit(e serviceExit) {
+	delete(s.running, e.index)
+	s.runExitHooks(e.index, e.err)
+	s.replace(e.index)
+	s.stopReplaced()
+	s.startEligible()
+	s.checkReload()
+}
+
+// replace replaces the service at index i, which is not running, with its new
+// definition, so it is started again once its dependencies are ready, or
+// removes it
+func (s *supervisor) replace(i int) {
+	reload := s.reloading
+	spec := reload.replacements[i]
+	delete(reload.replacements, i)
+	delete(reload.stopping, i)
+	if s.readyCancels[i] != nil {
+		s.readyCancels[i]()
+	}
+	s.endStartSpan(i, errExitedBeforeReady)
+	name := s.specs[i].String()
+	releaseServices(s.specs[i : i+1])
+	if spec == nil {
+		s.removed[i] = true
+		s.started[i] = true
+		s.settled[i] = true
+		s.status.publish(i, EventRemoved, nil)
+		s.status.remove(i)
+		s.filters[i].log(logger.Info, fmt.Sprintf("main: removed service '%v'", name),
+			"service", name, "event", "removed")
+		return
+	}
+	s.specs[i] = *spec
+	s.setFilter(i, newLogFilter(name, spec.LogLevel))
+	s.started[i] = false
+	s.settled[i] = false
+	s.removed[i] = false
+	s.status.replace(i, *spec)
+	reload.pending[i] = true
+}
+
+// checkReload completes the reload once all of its services settled
+func (s *supervisor) checkReload() {
+	reload := s.reloading
+	if reload == nil || len(reload.replacements) > 0 || len(reload.pending) > 0 {
+		return
+	}
+	s.reloading = nil
+	logger.Log(logger.Info, "main: reloaded the services", "event", "reload_completed")
+	s.config.events.publish(ServiceEvent{Kind: EventReloadCompleted, Time: s.config.clock.Now()})
+	reload.request.respond(nil)
+}
+
+// abortReload fails the reload in progress, if any, when the supervisor stops
+// before it completes
+func (s *supervisor) abortReload() {
+	reload := s.reloading
+	if reload == nil {
+		return
+	}
+	s.reloading = nil
+	err := errors.New("the supervisor stopped before the reload completed")
+	s.config.events.publish(ServiceEvent{Kind: EventReloadCompleted,
+		Time: s.config.clock.Now(), Err: err})
+	reload.request.respond(err)
+}
+
+// configHash returns a hash of the definition of the service, which changes
+// when its configuration does
+func configHash(spec ServiceSpec) string {
+	// the fields of running services may change, so they are only formatted
+	// when the service does not describe itself
+	var service string
+	if fingerprinter, ok := spec.Service.(Fingerprinter); ok {
+		service = fmt.Sprintf("%T %v", spec.Service, fingerprinter.Fingerprint())
+	} else {
+		service = fmt.Sprintf("%T %#v", spec.Service, spec.Service)
+	}
+	definition := fmt.Sprintf("%v|%v|%v|%v|%q|%v|%v|%v|%v|%v", service, spec.Optional,
+		spec.Fatal, spec.OneShot, spec.DependsOn, spec.ReadyTimeout, spec.LogLevel, spec.Restart,
+		livenessFingerprint(spec.Liveness), hooksFingerprint(spec.Hooks))
+	sum := sha256.Sum256([]byte(definition))
+	return hex.EncodeToString(sum[:])
+}
+
+// livenessFingerprint describes the liveness checks of a service by the values
+// of their configuration, including the fields of the probe
+func livenessFingerprint(config *LivenessConfig) string {
+	if config == nil {
+		return "no liveness"
+	}
+	return fmt.Sprintf("%T %+v %v %v %v", config.Probe, config.Probe, config.Interval,
+		config.Timeout, config.FailureThreshold)
+}
+
+// hooksFingerprint describes the hooks of a service by which of their
+// functions are set, since functions cannot be compared
+func hooksFingerprint(hooks []Hooks) string {
+	described := make([]string, len(hooks))
+	for i, h := range hooks {
+		described[i] = fmt.Sprintf("%v %v %v", h.OnStart != nil, h.OnReady != nil,
+			h.OnExit != nil)
+	}
+	return strings.Join(described, ",")
+}
@@ -0,0 +1,333 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// configuredService is a service whose configuration tells the definitions
+// of a reload apart
+type configuredService struct {
+	testService
+	config string
+	ready  func() error
+}
+
+func (s configuredService) Ready(ctx context.Context) error {
+	return s.ready()
+}
+
+// reloadRecorder creates services that record when they start and stop
+type reloadRecorder struct {
+	mutex sync.Mutex
+	steps []string
+}
+
+func (r *reloadRecorder) record(step string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *reloadRecorder) recorded() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string(nil), r.steps...)
+}
+
+// service creates a service that becomes ready once it records its start
+func (r *reloadRecorder) service(name string, config string, deps ...string) Service {
+	service := configuredService{config: config, testService: testService{name: name,
+		start: func(ctx context.Context) error {
+			r.record("start " + name)
+			<-ctx.Done()
+			r.record("stop " + name)
+			return nil
+		}}}
+	service.ready = func() error {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		for i := len(r.steps) - 1; i >= 0; i-- {
+			switch r.steps[i] {
+			case "start " + name:
+				return nil
+			case "stop " + name:
+				return errors.New("not started")
+			}
+		}
+		return errors.New("not started")
+	}
+	if len(deps) == 0 {
+		return service
+	}
+	return DependsOn(service, deps...)
+}
+
+func TestReload(t *testing.T) {
+
+	// start starts a supervisor for the services, stopping it when the test
+	// finishes
+	start := func(t *testing.T, services []Service, opts ...RunOption) *Supervisor {
+		supervisor := NewSupervisor(services, opts...)
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		t.Cleanup(func() {
+			if err := supervisor.Stop(context.Background()); err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		})
+		return supervisor
+	}
+
+	names := func(supervisor *Supervisor) []string {
+		var names []string
+		for _, status := range supervisor.Status() {
+			names = append(names, status.Name)
+		}
+		return names
+	}
+
+	t.Run("it restarts only the services that changed", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		supervisor := start(t, []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v1", "database"),
+			recorder.service("graphql-server", "v1", "indexer"),
+		})
+
+		err := supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v2", "database"),
+			recorder.service("graphql-server", "v1", "indexer"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{
+			"start database",
+			"start indexer",
+			"start graphql-server",
+			"stop indexer",
+			"start indexer",
+		}
+		if steps := recorder.recorded(); !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("expected the steps %v, got %v", expected, steps)
+		}
+		waitForStates(t, supervisor, StateReady, StateReady, StateReady)
+	})
+
+	t.Run("it restarts the services whose liveness checks changed", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		indexer := func(port int) Service {
+			probe := TcpPortProbe{Host: "127.0.0.1", Port: port}
+			return Liveness(recorder.service("indexer", "v1", "database"),
+				LivenessConfig{Probe: probe, Interval: time.Hour})
+		}
+		supervisor := start(t, []Service{recorder.service("database", "v1"), indexer(4000)})
+
+		for _, port := range []int{4000, 4001} {
+			err := supervisor.Reload(context.Background(), []Service{
+				recorder.service("database", "v1"),
+				indexer(port),
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		expected := []string{"start database", "start indexer", "stop indexer", "start indexer"}
+		if steps := recorder.recorded(); !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("expected the steps %v, got %v", expected, steps)
+		}
+		waitForStates(t, supervisor, StateReady, StateReady)
+	})
+
+	t.Run("it adds and removes services", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		supervisor := start(t, []Service{
+			recorder.service("database", "v1"),
+			recorder.service("graphql-server", "v1", "database"),
+		})
+
+		err := supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v1"),
+			recorder.service("dispatcher", "v1", "database"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the new service does not wait for the removed one to stop
+		steps := recorder.recorded()
+		sort.Strings(steps[2:])
+		expected := []string{
+			"start database",
+			"start graphql-server",
+			"start dispatcher",
+			"stop graphql-server",
+		}
+		if !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("expected the steps %v, got %v", expected, steps)
+		}
+		if got := names(supervisor); !reflect.DeepEqual(got, []string{"database", "dispatcher"}) {
+			t.Fatalf("expected the removed service to be left out of the status, got %v", got)
+		}
+
+		// a removed service may come back
+		err = supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v1"),
+			recorder.service("graphql-server", "v1", "database"),
+			recorder.service("dispatcher", "v1", "database"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected = []string{"database", "graphql-server", "dispatcher"}
+		if got := names(supervisor); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the services %v, got %v", expected, got)
+		}
+		waitForStates(t, supervisor, StateReady, StateReady, StateReady)
+	})
+
+	t.Run("it stops the dependents first and starts them last", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		supervisor := start(t, []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v1", "database"),
+		})
+
+		err := supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v2"),
+			recorder.service("indexer", "v2", "database"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{
+			"start database",
+			"start indexer",
+			"stop indexer",
+			"stop database",
+			"start database",
+			"start indexer",
+		}
+		if steps := recorder.recorded(); !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("expected the steps %v, got %v", expected, steps)
+		}
+	})
+
+	t.Run("it reports the steps in the events", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		supervisor := start(t, []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v1", "database"),
+		})
+		events := supervisor.Events()
+		for i := 0; i < 4; i++ {
+			<-events // the startup
+		}
+
+		err := supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v2", "database"),
+			recorder.service("dispatcher", "v1", "database"),
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the steps of each service are in order, but the services are
+		// reloaded concurrently
+		got := make(map[string][]EventKind)
+		for event := range events {
+			got[event.Service] = append(got[event.Service], event.Kind)
+			if event.Kind == EventReloadCompleted {
+				break
+			}
+		}
+		expected := map[string][]EventKind{
+			"":           {EventReloadStarted, EventReloadCompleted},
+			"indexer":    {EventReplaced, EventStopping, EventExited, EventStarted, EventReady},
+			"dispatcher": {EventAdded, EventStarted, EventReady},
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the events\n%v\ngot\n%v", expected, got)
+		}
+	})
+
+	t.Run("it leaves the services as they were if the reload is invalid", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		supervisor := start(t, []Service{
+			recorder.service("database", "v1"),
+			recorder.service("indexer", "v1", "database"),
+		})
+
+		err := supervisor.Reload(context.Background(), []Service{
+			recorder.service("database", "v2"),
+			recorder.service("indexer", "v2", "missing"),
+		})
+		if err == nil {
+			t.Fatalf("expected the unknown dependency to fail the reload")
+		}
+		err = supervisor.Reload(context.Background(), nil)
+		if err == nil {
+			t.Fatalf("expected a reload without services to fail")
+		}
+		expected := []string{"start database", "start indexer"}
+		if steps := recorder.recorded(); !reflect.DeepEqual(steps, expected) {
+			t.Fatalf("expected the steps %v, got %v", expected, steps)
+		}
+	})
+
+	t.Run("it fails the reload if the supervisor was not started", func(t *testing.T) {
+		services := []Service{testService{name: "database"}}
+		supervisor := NewSupervisor(services)
+		if err := supervisor.Reload(context.Background(), services); err == nil {
+			t.Fatalf("expected an error")
+		}
+	})
+
+	t.Run("it tells the configurations apart", func(t *testing.T) {
+		command := func(args ...string) ServiceSpec {
+			binary := "cartesi-rollups-indexer"
+			return specOf(NewCommandService("indexer", binary, WithArgs(args...)))
+		}
+		if configHash(command("--verbose")) != configHash(command("--verbose")) {
+			t.Fatalf("expected equal commands to have the same hash")
+		}
+		if configHash(command("--verbose")) == configHash(command("--quiet")) {
+			t.Fatalf("expected different commands to have different hashes")
+		}
+		spec := command()
+		optional := specOf(Optional(spec.Service))
+		if configHash(spec) == configHash(optional) {
+			t.Fatalf("expected the attributes of the spec to change the hash")
+		}
+		live := func() ServiceSpec {
+			probe := &GrpcHealthProbe{Address: "127.0.0.1:5001"}
+			return specOf(Liveness(spec.Service, LivenessConfig{Probe: probe}))
+		}
+		if configHash(live()) != configHash(live()) {
+			t.Fatalf("expected equal liveness checks to have the same hash")
+		}
+		if configHash(spec) == configHash(live()) {
+			t.Fatalf("expected the liveness checks to change the hash")
+		}
+		hooked := specOf(AddHooks(spec.Service, Hooks{OnReady: func(string) {}}))
+		if configHash(spec) == configHash(hooked) {
+			t.Fatalf("expected the hooks to change the hash")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCrashLoop is returned when a service fails too many times in a row
+var ErrCrashLoop = errors.New("service is crash looping")
+
+// Backoff defines the delays between the restarts of a failing service. The
+// delay starts at Initial and doubles after each failure up to Max. It goes
+// back to Initial once the service stays up for at least Reset
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Reset   time.Duration
+}
+
+// DefaultBackoff is a reasonable restart backoff for most services
+var DefaultBackoff = Backoff{
+	Initial: time.Second,
+	Max:     30 * time.Second,
+	Reset:   time.Minute,
+}
+
+// backoff keeps track of the restart delay of a single service
+type backoff struct {
+	delay time.Duration
+}
+
+// next returns the delay before restarting a service that failed after
+// running for the given uptime
+func (b *backoff) next(config Backoff, uptime time.Duration) time.Duration {
+	if b.delay == 0 || uptime >= config.Reset {
+		b.delay = config.Initial
+	} else {
+		b.delay = min(2*b.delay, config.Max)
+	}
+	return b.delay
+}
+
+// crashLoopLimit is the maximum number of restarts of a service allowed
+// within a time window
+type crashLoopLimit struct {
+	restarts int
+	window   time.Duration
+}
+
+var defaultCrashLoopLimit = crashLoopLimit{restarts: 5, window: 2 * time.Minute}
+
+// crashLoopDetector keeps track of the recent restarts of a single service
+type crashLoopDetector struct {
+	restarts []time.Time
+}
+
+// allow reports whether the service may be restarted at the given time and,
+// if so, records the restart
+func (d *crashLoopDetector) allow(limit crashLoopLimit, now time.Time) bool {
+	if limit.restarts <= 0 {
+		return true
+	}
+	recent := d.restarts[:0]
+	for _, restart := range d.restarts {
+		if now.Sub(restart) < limit.window {
+			recent = append(recent, restart)
+		}
+	}
+	d.restarts = recent
+	if len(d.restarts) >= limit.restarts {
+		return false
+	}
+	d.restarts = append(d.restarts, now)
+	return true
+}
+
+// reset forgets the previous restarts after the service has been stable
+func (d *crashLoopDetector) reset() {
+	d.restarts = nil
+}
+
+// RestartPolicy is when Run restarts a service that exits
+type RestartPolicy int
+
+const (
+	// RestartDefault follows the policy of Run, which is [RestartOnFailure]
+	// with [WithRestartOnFailure] and [RestartNever] otherwise
+	RestartDefault RestartPolicy = iota
+
+	// RestartNever lets the exit of the service stop the node, unless the
+	// service is optional
+	RestartNever
+
+	// RestartOnFailure restarts the service when it exits with an error
+	RestartOnFailure
+
+	// RestartAlways restarts the service whenever it exits, such as stateless
+	// servers. Services are never restarted during the shutdown
+	RestartAlways
+)
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	default:
+		return "default"
+	}
+}
+
+// Restart sets the restart policy of a service, overriding the policy of Run.
+// The restarts follow the backoff of [WithRestartOnFailure] or, without it,
+// [DefaultBackoff]. One-shot and fatal services are never restarted
+func Restart(service Service, policy RestartPolicy) Service {
+	spec := specOf(service)
+	spec.Restart = policy
+	return spec
+}
+
+// restartPolicy returns the policy that applies to the service
+func (c *runConfig) restartPolicy(spec ServiceSpec) RestartPolicy {
+	switch {
+	case spec.OneShot, spec.Fatal:
+		return RestartNever
+	case spec.Restart != RestartDefault:
+		return spec.Restart
+	case c.restart != nil:
+		return RestartOnFailure
+	default:
+		return RestartNever
+	}
+}
+
+// backoff returns the backoff of the restarts
+func (c *runConfig) backoff() Backoff {
+	if c.restart == nil {
+		return DefaultBackoff
+	}
+	return *c.restart
+}
+
+// restarts reports whether the policy restarts a service that exited with err
+func (p RestartPolicy) restarts(err error) bool {
+	return p == RestartAlways || p == RestartOnFailure && err != nil
+}
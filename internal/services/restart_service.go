@@ -0,0 +1,381 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// ErrServiceNotFound is returned by Supervisor.RestartService when no service
+// has the name
+var ErrServiceNotFound = errors.New("service not found")
+
+// ErrRestartInProgress is returned by Supervisor.RestartService when the
+// service is already being restarted, or when the services are being reloaded
+var ErrRestartInProgress = errors.New("a restart is already in progress")
+
+// errNotStarted is returned by Supervisor.RestartService when the service
+// still waits for its dependencies
+var errNotStarted = errors.New("the service was not started yet")
+
+// RestartService restarts a single service without stopping the node. The
+// service is stopped like in the shutdown, by its stop signal and, if it does
+// not exit in time, by the escalation to SIGKILL, and then started again and
+// its readiness is checked again. The other services keep running, including
+// the ones that depend on it, and the exit of the service does not begin the
+// shutdown. The restart is counted in the restarts of its status and each
+// step is published in the events of the supervisor, starting with
+// [EventRestartRequested].
+//
+// RestartService returns the status of the service once it is ready again.
+// Only one restart of a service may be in progress at a time, and none while
+// the services are being reloaded, otherwise it returns
+// [ErrRestartInProgress]. It returns [ErrServiceNotFound] when no service has
+// the name. The restart is not canceled when ctx is done and RestartService
+// returns early with its error
+func (s *Supervisor) RestartService(ctx context.Context, name string) (ServiceStatus, error) {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return ServiceStatus{}, errors.New("supervisor was not started")
+	}
+	result := make(chan error, 1)
+	select {
+	case s.restarts <- restartRequest{name: name, result: result}:
+	case <-s.done:
+		return ServiceStatus{}, ErrStopped
+	case <-ctx.Done():
+		return ServiceStatus{}, ctx.Err()
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			return ServiceStatus{}, err
+		}
+	case <-ctx.Done():
+		return ServiceStatus{}, ctx.Err()
+	}
+	for _, status := range s.Status() {
+		if status.Name == name {
+			return status, nil
+		}
+	}
+	return ServiceStatus{}, fmt.Errorf("%w: '%v'", ErrServiceNotFound, name)
+}
+
+// restartRequest asks the supervisor to restart a service
+type restartRequest struct {
+	name   string
+	result chan<- error
+
+	// stopping is set until the service exits to be started again
+	stopping bool
+}
+
+func (r restartRequest) respond(err error) {
+	if r.result != nil {
+		r.result <- err
+	}
+}
+
+// beginRestart stops the service of the request, which is started again once
+// it exits
+func (s *supervisor) beginRestart(request restartRequest) {
+	i := -1
+	for j := s.builtin; j < len(s.specs); j++ {
+		if !s.removed[j] && s.specs[j].String() == request.name {
+			i = j
+		}
+	}
+	var err error
+	switch {
+	case i < 0:
+		err = fmt.Errorf("%w: '%v'", ErrServiceNotFound, request.name)
+	case s.reloading != nil:
+		err = fmt.Errorf("%w: the services are being reloaded", ErrRestartInProgress)
+	case s.rolling != nil:
+		err = fmt.Errorf("%w: the services are being restarted", ErrRestartInProgress)
+	case s.restarting[i] != nil:
+		err = fmt.Errorf("%w for service '%v'", ErrRestartInProgress, request.name)
+	case !s.started[i]:
+		err = fmt.Errorf("%w: '%v'", errNotStarted, request.name)
+	}
+	if err != nil {
+		logger.Log(logger.Warning, fmt.Sprintf("main: failed to restart service '%v': %v",
+			request.name, err), "service", request.name, "event", "restart_failed", "error", err)
+		request.respond(err)
+		return
+	}
+
+	s.restart(i, &request)
+}
+
+// restart begins the restart of the service at index i, stopping it if it is
+// running
+func (s *supervisor) restart(i int, request *restartRequest) {
+	s.restarting[i] = request
+	s.status.publish(i, EventRestartRequested, nil)
+	if !s.running[i] {
+		s.relaunch(i)
+		return
+	}
+	name := s.specs[i].String()
+	s.filters[i].log(logger.Info, fmt.Sprintf("main: stopping service '%v' to restart it",
+		name), "service", name, "event", "stopping", "restart", true)
+	request.stopping = true
+	s.status.set(i, StateStopping, nil)
+	s.readyCancels[i]()
+	s.cancels[i]()
+}
+
+// stoppedToRestart reports whether the exit of the service at index i is the
+// one of a restart
+func (s *supervisor) stoppedToRestart(i int) bool {
+	request := s.restarting[i]
+	return request != nil && request.stopping
+}
+
+// restartedExit handles the exit of a service that was stopped to be
+// restarted
+func (s *supervisor) restartedExit(e serviceExit) {
+	delete(s.running, e.index)
+	s.endStartSpan(e.index, errExitedBeforeReady)
+	s.runExitHooks(e.index, e.err)
+	s.relaunch(e.index)
+}
+
+// relaunch starts the service at index i again, which is not running, to
+// complete its restart once it settles
+func (s *supervisor) relaunch(i int) {
+	s.restarting[i].stopping = false
+	s.status.restarted(i)
+	s.settled[i] = false
+	name := s.specs[i].String()
+	s.filters[i].log(logger.Info, fmt.Sprintf("main: restarting service '%v' on request",
+		name), "service", name, "event", "restarted", "restart", true)
+	s.start(i)
+}
+
+// checkRestart completes the restart of the service at index i, if there is
+// one, once the service settled
+func (s *supervisor) checkRestart(i int) {
+	request := s.restarting[i]
+	if request == nil || request.stopping {
+		return
+	}
+	delete(s.restarting, i)
+	request.respond(nil)
+	if rolling := s.rolling; rolling != nil && rolling.current == i {
+		rolling.restarts = append(rolling.restarts, ServiceRestart{
+			Name:     s.specs[i].String(),
+			Duration: s.config.clock.Now().Sub(rolling.stepStart),
+		})
+		s.rollOn()
+	}
+}
+
+// failRestart fails the restart of the service at index i, if there is one,
+// with the error that prevented it
+func (s *supervisor) failRestart(i int, err error) {
+	request := s.restarting[i]
+	if request == nil {
+		return
+	}
+	delete(s.restarting, i)
+	if rolling := s.rolling; rolling != nil && rolling.current == i {
+		s.endRolling(fmt.Errorf("the rolling restart stopped at service '%v' (%v of %v): %w",
+			s.specs[i].String(), rolling.next, len(rolling.order), err))
+		return
+	}
+	request.respond(err)
+}
+
+// abortRestarts fails the restarts in progress, including the rolling one,
+// when the supervisor stops before they complete, since the shutdown takes
+// precedence over them
+func (s *supervisor) abortRestarts() {
+	for i, request := range s.restarting {
+		delete(s.restarting, i)
+		request.respond(fmt.Errorf("%w before the restart completed", ErrStopped))
+	}
+	if s.rolling != nil {
+		s.endRolling(fmt.Errorf("%w before the rolling restart completed", ErrStopped))
+	}
+}
+
+// ServiceRestart is how long a service took to restart during a rolling
+// restart, from when it was asked to stop until it was ready again
+type ServiceRestart struct {
+	Name     string
+	Duration time.Duration
+}
+
+// RollingRestart restarts the running services one at a time, like
+// RestartService, so that they pick up the changes to the environment of the
+// node. The services are restarted after the services they depend on, each
+// one once the previous one is ready again. The services that are not
+// running, such as the one-shot services that completed, are skipped.
+//
+// RollingRestart returns the durations of the restarts, and an error naming
+// the service at which it stopped, if a service does not come back. As
+// during the startup, a service that does not become ready in time stops the
+// node. The shutdown of the node takes precedence over the rolling restart,
+// which fails with [ErrStopped] when the node stops before it completes. It
+// returns [ErrRestartInProgress] while another restart or a reload is in
+// progress. The steps are published in the events of the supervisor, between
+// [EventRollingRestartStarted] and [EventRollingRestartCompleted]
+func (s *Supervisor) RollingRestart(ctx context.Context) ([]ServiceRestart, error) {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return nil, errors.New("supervisor was not started")
+	}
+	result := make(chan rollingResult, 1)
+	select {
+	case s.rollings <- result:
+	case <-s.done:
+		return nil, ErrStopped
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	select {
+	case r := <-result:
+		return r.restarts, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// rollingResult is the outcome of a rolling restart
+type rollingResult struct {
+	restarts []ServiceRestart
+	err      error
+}
+
+// rollingRestart is a rolling restart in progress
+type rollingRestart struct {
+	result chan<- rollingResult
+
+	// order are the services in the order they are restarted, next is the
+	// position of the service after the current one, which is the index of
+	// the service being restarted
+	order   []int
+	next    int
+	current int
+
+	startedAt time.Time
+	stepStart time.Time
+	restarts  []ServiceRestart
+}
+
+// beginRollingRestart restarts the first service of a rolling restart, and
+// the other ones as each restart completes
+func (s *supervisor) beginRollingRestart(result chan<- rollingResult) {
+	var err error
+	switch {
+	case s.reloading != nil:
+		err = fmt.Errorf("%w: the services are being reloaded", ErrRestartInProgress)
+	case s.rolling != nil || len(s.restarting) > 0:
+		err = ErrRestartInProgress
+	}
+	if err != nil {
+		logger.Log(logger.Warning, fmt.Sprintf("main: failed to restart the services: %v", err),
+			"event", "rolling_restart_failed", "error", err)
+		result <- rollingResult{err: err}
+		return
+	}
+	order := s.restartOrder()
+	names := make([]string, len(order))
+	for k, i := range order {
+		names[k] = s.specs[i].String()
+	}
+	msg := fmt.Sprintf("main: restarting the services one at a time: %v",
+		strings.Join(names, ", "))
+	logger.Log(logger.Info, msg, "event", "rolling_restart_started", "services", names)
+	now := s.config.clock.Now()
+	s.config.events.publish(ServiceEvent{Kind: EventRollingRestartStarted, Time: now})
+	s.rolling = &rollingRestart{result: result, order: order, current: -1, startedAt: now}
+	s.rollOn()
+}
+
+// restartOrder returns the services that were not removed in an order where
+// each one comes after its dependencies, keeping the order they were given in
+// otherwise
+func (s *supervisor) restartOrder() []int {
+	ordered := make([]bool, len(s.specs))
+	pending := 0
+	for i := range s.specs {
+		ordered[i] = i < s.builtin || s.removed[i]
+		if !ordered[i] {
+			pending++
+		}
+	}
+	order := make([]int, 0, pending)
+	for len(order) < pending {
+		for i := range s.specs {
+			eligible := !ordered[i]
+			for _, dep := range s.deps[i] {
+				eligible = eligible && ordered[dep]
+			}
+			if eligible {
+				ordered[i] = true
+				order = append(order, i)
+				break
+			}
+		}
+	}
+	return order
+}
+
+// rollOn restarts the next service of the rolling restart that is running, or
+// completes the rolling restart when there is none left
+func (s *supervisor) rollOn() {
+	rolling := s.rolling
+	for rolling.next < len(rolling.order) {
+		i := rolling.order[rolling.next]
+		rolling.next++
+		if !s.running[i] {
+			continue
+		}
+		rolling.current = i
+		rolling.stepStart = s.config.clock.Now()
+		s.restart(i, &restartRequest{name: s.specs[i].String()})
+		return
+	}
+	s.endRolling(nil)
+}
+
+// endRolling completes the rolling restart with the error, if it failed, and
+// summarizes how long each service took to restart
+func (s *supervisor) endRolling(err error) {
+	rolling := s.rolling
+	s.rolling = nil
+	now := s.config.clock.Now()
+	elapsed := now.Sub(rolling.startedAt).Round(time.Millisecond)
+	restarted := make([]string, len(rolling.restarts))
+	for k, restart := range rolling.restarts {
+		restarted[k] = fmt.Sprintf("%v in %v", restart.Name,
+			restart.Duration.Round(time.Millisecond))
+	}
+	summary := strings.Join(restarted, ", ")
+	if err != nil {
+		msg := fmt.Sprintf("main: the rolling restart failed after %v: %v; restarted: [%v]",
+			elapsed, err, summary)
+		logger.Log(logger.Error, msg, "event", "rolling_restart_failed", "error", err)
+	} else {
+		msg := fmt.Sprintf("main: restarted the services in %v: %v", elapsed, summary)
+		logger.Log(logger.Info, msg, "event", "rolling_restart_completed", "elapsed", elapsed)
+	}
+	s.config.events.publish(ServiceEvent{Kind: EventRollingRestartCompleted, Time: now,
+		Err: err})
+	rolling.result <- rollingResult{restarts: rolling.restarts, err: err}
+}
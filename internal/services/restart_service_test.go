@@ -0,0 +1,328 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestRestartService(t *testing.T) {
+
+	// start starts a supervisor for the fake services, making each one ready
+	// once it starts
+	start := func(t *testing.T, fakes ...*servicestest.FakeService) *Supervisor {
+		t.Helper()
+		services := make([]Service, len(fakes))
+		for i, fake := range fakes {
+			services[i] = fake
+		}
+		supervisor := NewSupervisor(services)
+		started := make(chan error, 1)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		for _, fake := range fakes {
+			fake.WaitForStarts(t, 1)
+			fake.BecomeReady()
+		}
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return supervisor
+	}
+
+	// restart restarts the service in the background
+	restart := func(supervisor *Supervisor, name string) <-chan error {
+		restarted := make(chan error, 1)
+		go func() {
+			_, err := supervisor.RestartService(context.Background(), name)
+			restarted <- err
+		}()
+		return restarted
+	}
+
+	t.Run("it restarts a single service", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		graphql := servicestest.NewFakeService("graphql-server")
+		supervisor := start(t, database, graphql)
+		events := supervisor.Events()
+
+		type result struct {
+			status ServiceStatus
+			err    error
+		}
+		restarted := make(chan result, 1)
+		go func() {
+			status, err := supervisor.RestartService(context.Background(), "graphql-server")
+			restarted <- result{status, err}
+		}()
+		graphql.WaitForStarts(t, 2)
+		graphql.BecomeReady()
+		r := <-restarted
+		if r.err != nil {
+			t.Fatalf("expected no error, got %v", r.err)
+		}
+		if r.status.State != StateReady || r.status.Restarts != 1 {
+			t.Fatalf("expected the service to be ready after a restart, got %+v", r.status)
+		}
+		if database.Starts() != 1 || !database.Running() {
+			t.Fatal("expected the database to keep running")
+		}
+		if cause := supervisor.ShutdownCause(); cause != nil {
+			t.Fatalf("expected the node to keep running, got %v", cause)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var got []EventKind
+		for event := range events {
+			if event.Service == "graphql-server" {
+				got = append(got, event.Kind)
+			}
+		}
+		expected := []EventKind{
+			EventStarted, EventReady,
+			EventRestartRequested, EventStopping, EventExited, EventStarted, EventReady,
+			EventStopping, EventExited,
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the events %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("it serializes the restarts of a service", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		graphql := servicestest.NewFakeService("graphql-server")
+		supervisor := start(t, database, graphql)
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		first := restart(supervisor, "graphql-server")
+		graphql.WaitForStarts(t, 2)
+		_, err := supervisor.RestartService(context.Background(), "graphql-server")
+		if !errors.Is(err, ErrRestartInProgress) {
+			t.Fatalf("expected a restart to be in progress, got %v", err)
+		}
+		// the other services may be restarted meanwhile
+		second := restart(supervisor, "database")
+		database.WaitForStarts(t, 2)
+		database.BecomeReady()
+		graphql.BecomeReady()
+		for _, restarted := range []<-chan error{first, second} {
+			if err := <-restarted; err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+		if graphql.Starts() != 2 || database.Starts() != 2 {
+			t.Fatal("expected each service to be restarted once")
+		}
+	})
+
+	t.Run("it rejects unknown services", func(t *testing.T) {
+		setup()
+		supervisor := start(t, servicestest.NewFakeService("database"))
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		_, err := supervisor.RestartService(context.Background(), "unknown")
+		if !errors.Is(err, ErrServiceNotFound) {
+			t.Fatalf("expected the service to not be found, got %v", err)
+		}
+	})
+
+	t.Run("it fails the restarts when the node stops", func(t *testing.T) {
+		setup()
+		graphql := servicestest.NewFakeService("graphql-server")
+		supervisor := start(t, graphql)
+
+		restarted := restart(supervisor, "graphql-server")
+		graphql.WaitForStarts(t, 2)
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := <-restarted; err == nil {
+			t.Fatal("expected the restart to fail")
+		}
+		_, err := supervisor.RestartService(context.Background(), "graphql-server")
+		if !errors.Is(err, ErrStopped) {
+			t.Fatalf("expected the supervisor to be stopped, got %v", err)
+		}
+	})
+}
+
+func TestRollingRestart(t *testing.T) {
+
+	// start starts a supervisor for the services, making the fake services
+	// ready in the order they start
+	start := func(t *testing.T, services []Service, fakes []*servicestest.FakeService,
+		opts ...RunOption) *Supervisor {
+		t.Helper()
+		supervisor := NewSupervisor(services, opts...)
+		started := make(chan error, 1)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		for _, fake := range fakes {
+			fake.WaitForStarts(t, 1)
+			fake.BecomeReady()
+		}
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return supervisor
+	}
+
+	// rollingRestart restarts the services in the background
+	type result struct {
+		restarts []ServiceRestart
+		err      error
+	}
+	rollingRestart := func(supervisor *Supervisor) <-chan result {
+		restarted := make(chan result, 1)
+		go func() {
+			restarts, err := supervisor.RollingRestart(context.Background())
+			restarted <- result{restarts, err}
+		}()
+		return restarted
+	}
+
+	t.Run("it restarts the services in the order of their dependencies", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		graphql := servicestest.NewFakeService("graphql-server")
+		supervisor := start(t, []Service{
+			DependsOn(graphql, "indexer"),
+			DependsOn(indexer, "database"),
+			database,
+		}, []*servicestest.FakeService{database, indexer, graphql})
+		events := supervisor.Events()
+
+		restarted := rollingRestart(supervisor)
+		for _, fake := range []*servicestest.FakeService{database, indexer, graphql} {
+			fake.WaitForStarts(t, 2)
+			for _, other := range []*servicestest.FakeService{database, indexer, graphql} {
+				if other != fake && !other.Running() {
+					t.Fatalf("expected only %v to be restarted at once", fake)
+				}
+			}
+			fake.BecomeReady()
+		}
+		r := <-restarted
+		if r.err != nil {
+			t.Fatalf("expected no error, got %v", r.err)
+		}
+		var names []string
+		for _, restart := range r.restarts {
+			names = append(names, restart.Name)
+		}
+		expected := []string{"database", "indexer", "graphql-server"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("expected the restarts of %v, got %v", expected, r.restarts)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var got []string
+		for event := range events {
+			switch event.Kind {
+			case EventRollingRestartStarted, EventRollingRestartCompleted:
+				got = append(got, string(event.Kind))
+			case EventRestartRequested:
+				got = append(got, event.Service)
+			}
+		}
+		expected = []string{"rolling_restart_started", "database", "indexer", "graphql-server",
+			"rolling_restart_completed"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected the events %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("it stops when a service does not come back", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		fakes := []*servicestest.FakeService{database, indexer}
+		supervisor := start(t, []Service{database, indexer}, fakes,
+			WithReadyTimeout(time.Second))
+
+		restarted := rollingRestart(supervisor)
+		database.WaitForStarts(t, 2)
+		r := <-restarted
+		if !errors.Is(r.err, ErrReadyTimeout) || len(r.restarts) != 0 {
+			t.Fatalf("expected the database to not become ready, got %v", r.err)
+		}
+		expected := "the rolling restart stopped at service 'database' (1 of 2): " +
+			"service 'database' did not become ready"
+		if !strings.HasPrefix(r.err.Error(), expected) {
+			t.Fatalf("expected %q, got %q", expected, r.err.Error())
+		}
+		if indexer.Starts() != 1 {
+			t.Fatal("expected the indexer to not be restarted")
+		}
+		// like during the startup, the node stops
+		if err := supervisor.Wait(); !errors.Is(err, ErrReadyTimeout) {
+			t.Fatalf("expected the node to stop, got %v", err)
+		}
+	})
+
+	t.Run("it gives way to the shutdown", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		fakes := []*servicestest.FakeService{database, indexer}
+		supervisor := start(t, []Service{database, indexer}, fakes)
+
+		restarted := rollingRestart(supervisor)
+		database.WaitForStarts(t, 2)
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if r := <-restarted; !errors.Is(r.err, ErrStopped) {
+			t.Fatalf("expected the shutdown to abort the rolling restart, got %v", r.err)
+		}
+		if indexer.Starts() != 1 {
+			t.Fatal("expected the indexer to not be restarted")
+		}
+		if _, err := supervisor.RollingRestart(context.Background()); !errors.Is(err, ErrStopped) {
+			t.Fatalf("expected the supervisor to be stopped, got %v", err)
+		}
+	})
+
+	t.Run("it excludes the other restarts", func(t *testing.T) {
+		setup()
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		fakes := []*servicestest.FakeService{database, indexer}
+		supervisor := start(t, []Service{database, indexer}, fakes)
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		restarted := rollingRestart(supervisor)
+		database.WaitForStarts(t, 2)
+		if _, err := supervisor.RollingRestart(context.Background()); !errors.Is(err,
+			ErrRestartInProgress) {
+			t.Fatalf("expected a restart to be in progress, got %v", err)
+		}
+		_, err := supervisor.RestartService(context.Background(), "indexer")
+		if !errors.Is(err, ErrRestartInProgress) {
+			t.Fatalf("expected a restart to be in progress, got %v", err)
+		}
+		database.BecomeReady()
+		indexer.WaitForStarts(t, 2)
+		indexer.BecomeReady()
+		if r := <-restarted; r.err != nil || len(r.restarts) != 2 {
+			t.Fatalf("expected the services to be restarted, got %v (%v)", r.restarts, r.err)
+		}
+	})
+}
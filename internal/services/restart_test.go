@@ -0,0 +1,336 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestBackoff(t *testing.T) {
+	config := Backoff{Initial: time.Second, Max: 5 * time.Second, Reset: time.Minute}
+	steps := []struct {
+		uptime time.Duration
+		delay  time.Duration
+	}{
+		{uptime: 0, delay: time.Second},
+		{uptime: time.Second, delay: 2 * time.Second},
+		{uptime: time.Second, delay: 4 * time.Second},
+		{uptime: time.Second, delay: 5 * time.Second},
+		{uptime: time.Second, delay: 5 * time.Second},
+		{uptime: time.Minute, delay: time.Second},
+		{uptime: time.Second, delay: 2 * time.Second},
+	}
+
+	var b backoff
+	for i, step := range steps {
+		if delay := b.next(config, step.uptime); delay != step.delay {
+			t.Fatalf("step %v: expected delay %v, got %v", i, step.delay, delay)
+		}
+	}
+}
+
+func TestRunRestart(t *testing.T) {
+
+	t.Run("it restarts a failing service with backoff", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		attempts := 0
+		service := testService{
+			name: "flaky",
+			start: func(ctx context.Context) error {
+				attempts++
+				switch attempts {
+				case 5:
+					// stay up long enough to reset the backoff
+					clock.Advance(2 * time.Minute)
+				case 7:
+					cancel()
+					<-ctx.Done()
+					return nil
+				}
+				return errors.New("flaky failure")
+			},
+		}
+		backoff := Backoff{Initial: time.Second, Max: 4 * time.Second, Reset: time.Minute}
+
+		exit := make(chan error)
+		go func() {
+			exit <- Run(ctx, []Service{service}, WithRestartOnFailure(backoff),
+				WithClock(clock))
+		}()
+		delays := []time.Duration{
+			1 * time.Second,
+			2 * time.Second,
+			4 * time.Second,
+			4 * time.Second,
+			1 * time.Second,
+			2 * time.Second,
+		}
+		for _, delay := range delays {
+			clock.WaitFor(t, delay)
+			clock.Advance(delay)
+		}
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if attempts != 7 {
+			t.Fatalf("expected 7 attempts, got %v", attempts)
+		}
+	})
+
+	t.Run("it keeps the other services running during a restart", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		databaseStarts := make(chan struct{}, 2)
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			databaseStarts <- struct{}{}
+			<-ctx.Done()
+			return nil
+		}}
+		indexer := servicestest.NewFakeService("indexer")
+		backoff := Backoff{Initial: time.Second, Max: time.Second, Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{database, indexer},
+			WithRestartOnFailure(backoff), WithClock(clock))
+		go func() {
+			indexer.WaitForStarts(t, 1)
+			indexer.BecomeReady()
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		indexer.Fail(errors.New("connection lost"))
+		clock.WaitFor(t, time.Second)
+		status := supervisor.Status()
+		if !status[1].Restarting || status[0].State != StateReady {
+			t.Fatalf("expected only the indexer to wait for its restart, got %+v", status)
+		}
+		clock.Advance(time.Second)
+		indexer.WaitForStarts(t, 2)
+		waitForStates(t, supervisor, StateReady, StateRunning)
+		status = supervisor.Status()
+		if status[1].Restarting || status[1].Degraded != time.Second {
+			t.Fatalf("expected the indexer to be degraded for a second, got %+v", status[1])
+		}
+		if len(databaseStarts) != 1 {
+			t.Fatalf("expected the database to keep running, got %v starts",
+				len(databaseStarts))
+		}
+	})
+
+	t.Run("it stops the node when a fatal service fails", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		attempts := 0
+		database := Fatal(testService{name: "database", start: func(ctx context.Context) error {
+			attempts++
+			return boom
+		}})
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+
+		supervisor := NewSupervisor([]Service{database}, WithRestartOnFailure(backoff))
+		err := supervisor.Start(context.Background())
+		if err == nil {
+			err = supervisor.Wait()
+		}
+		if !errors.Is(err, boom) || attempts != 1 {
+			t.Fatalf("expected the failure without restarts, got %v after %v attempts", err,
+				attempts)
+		}
+		if status := supervisor.Status()[0]; !status.Fatal || status.Restart != RestartNever {
+			t.Fatalf("expected the fatal service in the status, got %+v", status)
+		}
+	})
+
+	t.Run("it does not restart services by default", func(t *testing.T) {
+		setup()
+		attempts := 0
+		service := testService{
+			name: "failing",
+			start: func(ctx context.Context) error {
+				attempts++
+				return errors.New("failure")
+			},
+		}
+
+		if err := Run(context.Background(), []Service{service}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if attempts != 1 {
+			t.Fatalf("expected a single attempt, got %v", attempts)
+		}
+	})
+}
+
+func TestRunCrashLoop(t *testing.T) {
+
+	t.Run("it gives up on a service that always fails", func(t *testing.T) {
+		setup()
+		attempts := 0
+		cause := errors.New("always fails")
+		looping := testService{
+			name: "looping",
+			start: func(ctx context.Context) error {
+				attempts++
+				return cause
+			},
+		}
+		sleeperStopped := false
+		sleeper := testService{
+			name: "sleeper",
+			start: func(ctx context.Context) error {
+				<-ctx.Done()
+				sleeperStopped = true
+				return nil
+			},
+		}
+
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		exit := make(chan error)
+		go func() {
+			exit <- Run(context.Background(), []Service{sleeper, looping},
+				WithRestartOnFailure(DefaultBackoff),
+				WithCrashLoopLimit(3, time.Minute),
+				WithClock(clock))
+		}()
+		for _, delay := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+			clock.WaitFor(t, delay)
+			clock.Advance(delay)
+		}
+		err := <-exit
+		if !errors.Is(err, ErrCrashLoop) || !errors.Is(err, cause) {
+			t.Fatalf("expected a crash loop error wrapping the last failure, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "looping") {
+			t.Fatalf("expected the error to name the looping service, got %v", err)
+		}
+		if attempts != 4 {
+			t.Fatalf("expected 4 attempts, got %v", attempts)
+		}
+		if !sleeperStopped {
+			t.Fatal("expected the other service to be stopped")
+		}
+	})
+}
+
+func TestRestartPolicy(t *testing.T) {
+	boom := errors.New("boom")
+	backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+	cases := []struct {
+		policy    RestartPolicy
+		exit      error
+		restarted bool
+	}{
+		{RestartNever, nil, false},
+		{RestartNever, boom, false},
+		{RestartOnFailure, nil, false},
+		{RestartOnFailure, boom, true},
+		{RestartAlways, nil, true},
+		{RestartAlways, boom, true},
+	}
+	for _, c := range cases {
+		name := fmt.Sprintf("it applies %v to exits with error %v", c.policy, c.exit)
+		t.Run(name, func(t *testing.T) {
+			setup()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			attempts := 0
+			service := Restart(testService{name: "indexer", start: func(ctx context.Context) error {
+				attempts++
+				if attempts == 1 {
+					return c.exit
+				}
+				cancel()
+				<-ctx.Done()
+				return nil
+			}}, c.policy)
+
+			err := Run(ctx, []Service{service}, WithRestartOnFailure(backoff))
+			if c.restarted && (err != nil || attempts != 2) {
+				t.Fatalf("expected a restart, got %v after %v attempts", err, attempts)
+			}
+			if !c.restarted && (!errors.Is(err, c.exit) || attempts != 1) {
+				t.Fatalf("expected no restart, got %v after %v attempts", err, attempts)
+			}
+		})
+	}
+
+	t.Run("it follows the policy of Run by default", func(t *testing.T) {
+		config := runConfig{}
+		if policy := config.restartPolicy(ServiceSpec{}); policy != RestartNever {
+			t.Fatalf("expected no restarts, got %v", policy)
+		}
+		config.restart = &backoff
+		if policy := config.restartPolicy(ServiceSpec{}); policy != RestartOnFailure {
+			t.Fatalf("expected restarts on failure, got %v", policy)
+		}
+		oneShot := ServiceSpec{OneShot: true, Restart: RestartAlways}
+		if policy := config.restartPolicy(oneShot); policy != RestartNever {
+			t.Fatalf("expected one-shot services to not be restarted, got %v", policy)
+		}
+		fatal := specOf(Fatal(Restart(testService{name: "database"}, RestartAlways)))
+		if policy := config.restartPolicy(fatal); policy != RestartNever {
+			t.Fatalf("expected fatal services to not be restarted, got %v", policy)
+		}
+		if spec := specOf(Fatal(Optional(testService{name: "database"}))); spec.Optional {
+			t.Fatal("expected fatal services to not be optional")
+		}
+	})
+
+	t.Run("it does not restart services during the shutdown", func(t *testing.T) {
+		setup()
+		attempts := 0
+		server := testService{name: "graphql-server", start: func(ctx context.Context) error {
+			attempts++
+			<-ctx.Done()
+			return nil
+		}}
+		service := Restart(server, RestartAlways)
+
+		supervisor := NewSupervisor([]Service{service}, WithRestartOnFailure(backoff))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status := supervisor.Status()[0]; status.Restart != RestartAlways {
+			t.Fatalf("expected the policy in the status, got %v", status.Restart)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if attempts != 1 {
+			t.Fatalf("expected the service to not be restarted, got %v attempts", attempts)
+		}
+	})
+}
+
+func TestCrashLoopDetector(t *testing.T) {
+	limit := crashLoopLimit{restarts: 2, window: time.Minute}
+	start := time.Unix(0, 0)
+	var detector crashLoopDetector
+
+	if !detector.allow(limit, start) || !detector.allow(limit, start.Add(time.Second)) {
+		t.Fatal("expected the first restarts to be allowed")
+	}
+	if detector.allow(limit, start.Add(2*time.Second)) {
+		t.Fatal("expected the restart to be denied")
+	}
+	if !detector.allow(limit, start.Add(time.Minute+time.Second)) {
+		t.Fatal("expected the restart to be allowed after the window")
+	}
+	detector.reset()
+	if !detector.allow(limit, start.Add(time.Minute+2*time.Second)) {
+		t.Fatal("expected the restart to be allowed after the reset")
+	}
+}
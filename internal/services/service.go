@@ -7,9 +7,8 @@ package services
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"syscall"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/cartesi/rollups-node/internal/logger"
@@ -24,97 +23,269 @@ type Service interface {
 	Start(ctx context.Context) error
 }
 
-const DefaultServiceTimeout = 15 * time.Second
+// ServiceSpec wraps a Service with the attributes Run uses to supervise it
+type ServiceSpec struct {
+	Service
+
+	// Optional services do not stop the node when they exit
+	Optional bool
+
+	// Fatal services stop the node when they exit, even when Run restarts
+	// the failed services in place (see [Fatal])
+	Fatal bool
+
+	// OneShot services run to completion during the startup. They count as
+	// ready once they exit successfully (see [OneShot])
+	OneShot bool
+
+	// DependsOn lists the names of the services that must be ready before
+	// this service is started. When no service in the list given to Run
+	// declares dependencies, each service depends on the previous one
+	DependsOn []string
+
+	// ReadyTimeout overrides the readiness timeout of Run for this service
+	// when it is not zero. If the service does not become ready in time, Run
+	// stops all services and returns [ErrReadyTimeout]
+	ReadyTimeout time.Duration
+
+	// LogLevel is the minimum level of the entries about this service,
+	// including its output, when it is set. Entries below the level of the
+	// node are dropped regardless
+	LogLevel logger.Level
 
-// simpleService implements the context cancelation logic of the Service interface
-type simpleService struct {
-	serviceName string
-	binaryName  string
+	// Restart is when the service is restarted after it exits (see
+	// [Restart])
+	Restart RestartPolicy
+
+	// Hooks are called when the service changes state, before the hooks of
+	// Run (see [AddHooks])
+	Hooks []Hooks
+
+	// Liveness checks that the service is still alive once it is ready when
+	// it is set (see [Liveness])
+	Liveness *LivenessConfig
 }
 
-func (s simpleService) Start(ctx context.Context) error {
-	cmd := exec.Command(s.binaryName)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
+// Optional marks a service as optional: when it exits, Run logs a warning and
+// keeps the other services running instead of stopping the node. It undoes
+// [Fatal]
+func Optional(service Service) Service {
+	spec := specOf(service)
+	spec.Optional = true
+	spec.Fatal = false
+	return spec
+}
 
-	if err := cmd.Start(); err != nil {
-		return err
-	}
+// Fatal marks a service as fatal: it is never restarted, whatever its restart
+// policy, so its exit always stops the node. It is meant for the services the
+// others cannot run without when Run restarts the failed services in place
+// (see [WithRestartOnFailure]), where the node only stops for the exits of the
+// fatal services, of the services whose policies do not restart them, and of
+// the services that crash loop. It undoes [Optional]
+func Fatal(service Service) Service {
+	spec := specOf(service)
+	spec.Fatal = true
+	spec.Optional = false
+	return spec
+}
 
-	go func() {
-		<-ctx.Done()
-		logger.Debug.Printf("%v: %v\n", s.String(), ctx.Err())
-		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
-			msg := "%v: failed to send SIGTERM to %v\n"
-			logger.Error.Printf(msg, s.String(), s.binaryName)
-		}
-	}()
+// OneShot marks a service as a one-shot, such as a database migration: the
+// services that depend on it are only started after it exits successfully, and
+// its exit does not stop the node. If it fails, Run aborts the startup and
+// returns its error. One-shot services are never restarted, and their
+// readiness is not checked
+func OneShot(service Service) Service {
+	spec := specOf(service)
+	spec.OneShot = true
+	return spec
+}
 
-	err := cmd.Wait()
-	if err != nil && cmd.ProcessState.ExitCode() != int(syscall.SIGTERM) {
-		return err
+// DependsOn declares that a service must only be started after the services
+// with the given names are ready, and stopped before them
+func DependsOn(service Service, names ...string) Service {
+	spec := specOf(service)
+	spec.DependsOn = append(spec.DependsOn, names...)
+	return spec
+}
+
+// LogLevel sets the minimum level of the entries about a service. Run
+// periodically logs how many entries were dropped
+func LogLevel(service Service, level logger.Level) Service {
+	spec := specOf(service)
+	spec.LogLevel = level
+	return spec
+}
+
+// specOf returns the spec of a service, which has the default attributes if
+// the service is not a ServiceSpec
+func specOf(service Service) ServiceSpec {
+	if spec, ok := service.(ServiceSpec); ok {
+		return spec
 	}
-	return nil
+	return ServiceSpec{Service: service}
 }
 
-func (s simpleService) String() string {
-	return s.serviceName
+// DefaultServiceTimeout is how long Run waits for the services to stop
+const DefaultServiceTimeout = 15 * time.Second
+
+// OutputConfig configures how the output of a service is written. The zero
+// value logs each line of the output
+type OutputConfig struct {
+	// Raw writes the output straight to the stdout and stderr of the node
+	// instead of logging it
+	Raw bool
+
+	// LogFile writes the output to a file when it is set
+	LogFile *LogFileConfig
+
+	// RepeatLimit suppresses repeated lines when it is set
+	RepeatLimit *RepeatLimit
+
+	// OutputLimit bounds the output that is logged when it is set
+	OutputLimit *OutputLimit
+
+	// CaptureTimestamps is the precision of the time added to each line when
+	// it is read (see [WithCaptureTimestamps]). No time is added when it is
+	// zero
+	CaptureTimestamps time.Duration
 }
 
-// The Run function serves as a very simple supervisor: it will start all the
-// services provided to it and will run until the first of them finishes. Next
-// it will try to stop the remaining services or timeout if they take too long
-func Run(services []Service) {
-	if len(services) == 0 {
-		logger.Error.Panic("there are no services to run")
+func (c OutputConfig) options() []CommandOption {
+	var opts []CommandOption
+	if c.Raw {
+		opts = append(opts, WithRawOutput())
+	}
+	if c.LogFile != nil {
+		opts = append(opts, WithLogFile(*c.LogFile))
+	}
+	if c.RepeatLimit != nil {
+		opts = append(opts, WithRepeatLimit(*c.RepeatLimit))
+	}
+	if c.OutputLimit != nil {
+		opts = append(opts, WithOutputLimit(*c.OutputLimit))
+	}
+	if c.CaptureTimestamps > 0 {
+		opts = append(opts, WithCaptureTimestamps(c.CaptureTimestamps))
 	}
+	return opts
+}
+
+// ProcessConfig configures the process of a service of the node. It is
+// embedded in the configuration of each of them
+type ProcessConfig struct {
+	// Env is added to the environment of the process
+	Env map[string]string
+
+	// RedactedEnv lists the variables whose values must not be logged
+	RedactedEnv []string
+
+	// Variables expands the references to them in the arguments and the
+	// environment of the process when it is not nil (see [WithVariables])
+	Variables map[string]string
 
-	// start services
-	ctx, cancel := context.WithCancel(context.Background())
-	exit := make(chan struct{})
-	for _, service := range services {
-		service := service
-		go func() {
-			if err := service.Start(ctx); err != nil {
-				msg := "main: service '%v' exited with error: %v\n"
-				logger.Error.Printf(msg, service.String(), err)
-			} else {
-				msg := "main: service '%v' exited successfully\n"
-				logger.Info.Printf(msg, service.String())
-			}
-			exit <- struct{}{}
-		}()
+	// PropagatedEnv lists the prefixes of the variables of the node copied to
+	// the environment of the process (see [WithPropagatedEnv]). The default is
+	// DefaultPropagatedEnv, and an empty list copies none
+	PropagatedEnv []string
+
+	// StartRetry is how long the start of the process is retried while its
+	// binary is unavailable (see [WithStartRetry])
+	StartRetry time.Duration
+
+	// Output configures how the output of the process is written
+	Output OutputConfig
+}
+
+func (c ProcessConfig) options() []CommandOption {
+	opts := []CommandOption{WithEnv(c.Env), WithRedactedEnv(c.RedactedEnv...)}
+	if c.Variables != nil {
+		opts = append(opts, WithVariables(c.Variables))
+	}
+	opts = append(opts, WithPropagatedEnv(propagatedEnvOr(c.PropagatedEnv)...))
+	if c.StartRetry > 0 {
+		opts = append(opts, WithStartRetry(c.StartRetry))
 	}
+	return append(opts, c.Output.options()...)
+}
 
-	// wait for first service to exit
-	<-exit
+// DefaultGraphQLPort is the port the graphql-server listens on by default
+const DefaultGraphQLPort = 4000
 
-	// send stop message to all other services and wait for them to finish
-	// or timeout
-	wait := make(chan struct{})
-	go func() {
-		cancel()
-		for i := 0; i < len(services)-1; i++ {
-			<-exit
-		}
-		wait <- struct{}{}
-	}()
+// GraphQLServerConfig configures the graphql-server. Zero values keep the
+// defaults of the binary
+type GraphQLServerConfig struct {
+	Host            string
+	Port            int
+	HealthcheckPort int
 
-	select {
-	case <-wait:
-		logger.Info.Println("main: all services were shutdown")
-	case <-time.After(DefaultServiceTimeout):
-		logger.Warning.Println("main: exited after timeout")
+	ProcessConfig
+}
+
+// NewGraphQLServer creates the service that runs the graphql-server
+func NewGraphQLServer(config GraphQLServerConfig) Service {
+	host, port := "127.0.0.1", DefaultGraphQLPort
+	var args []string
+	if config.Host != "" {
+		host = config.Host
+		args = append(args, "--graphql-host", config.Host)
+	}
+	if config.Port != 0 {
+		port = config.Port
+		args = append(args, "--graphql-port", strconv.Itoa(config.Port))
 	}
+	if config.HealthcheckPort != 0 {
+		args = append(args, "--healthcheck-port", strconv.Itoa(config.HealthcheckPort))
+	}
+	opts := []CommandOption{
+		WithArgs(args...),
+		WithGracePeriod(5 * time.Second),
+		WithProbe(HttpProbe{
+			URL: fmt.Sprintf("http://%v/graphql", probeAddress(host, port)),
+		}),
+		WithPort("graphql", port, ""),
+	}
+	if config.HealthcheckPort != 0 {
+		opts = append(opts, WithPort("healthcheck", config.HealthcheckPort, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("graphql-server", "cartesi-rollups-graphql-server", opts...)
 }
 
-var (
-	GraphQLServer Service = simpleService{
-		serviceName: "graphql-server",
-		binaryName:  "cartesi-rollups-graphql-server",
+// IndexerConfig configures the indexer. Zero values keep the defaults of the
+// binary
+type IndexerConfig struct {
+	HealthcheckPort int
+
+	ProcessConfig
+}
+
+// NewIndexer creates the service that runs the indexer
+func NewIndexer(config IndexerConfig) Service {
+	var args []string
+	if config.HealthcheckPort != 0 {
+		args = append(args, "--healthcheck-port", strconv.Itoa(config.HealthcheckPort))
 	}
-	Indexer Service = simpleService{
-		serviceName: "indexer",
-		binaryName:  "cartesi-rollups-indexer",
+	opts := []CommandOption{
+		WithArgs(args...),
 	}
+	if config.HealthcheckPort != 0 {
+		opts = append(opts, WithPort("healthcheck", config.HealthcheckPort, ""))
+	}
+	opts = append(opts, config.ProcessConfig.options()...)
+	return NewCommandService("indexer", "cartesi-rollups-indexer", opts...)
+}
+
+// probeAddress returns the address used to probe a server listening on the
+// host and port. Servers listening on all interfaces are probed on loopback
+func probeAddress(host string, port int) string {
+	return net.JoinHostPort(probeHost(host), strconv.Itoa(port))
+}
+
+// Services with the default configuration
+//
+// Deprecated: use the constructors, such as [NewGraphQLServer], which
+// configure the services
+var (
+	GraphQLServer = NewGraphQLServer(GraphQLServerConfig{})
+	Indexer       = NewIndexer(IndexerConfig{})
 )
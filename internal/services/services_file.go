@@ -0,0 +1,392 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ErrInvalidServicesFile is returned when a file of service definitions
+// cannot be read or describes an invalid service
+var ErrInvalidServicesFile = errors.New("invalid services file")
+
+// ServicesFile is the format of a TOML file that defines extra services, such
+// as sidecars that share the lifecycle of the node. Each [[service]] table is
+// a [ServiceDefinition], whose arguments and environment may refer to the
+// variables of the [variables] table or of the environment of the node as
+// ${NAME} (see [WithVariables]):
+//
+//	[variables]
+//	EXPORTER_ADDRESS = "127.0.0.1:9100"
+//
+//	[[service]]
+//	name = "exporter"
+//	binary = "node-exporter"
+//	args = ["--web.listen-address=${EXPORTER_ADDRESS}"]
+//	env = { EXPORTER_LOG = "info" }
+//	stop_signal = "SIGINT"
+//	stop_timeout = "5s"
+//	restart = "on-failure"
+//	probe = { http = "http://127.0.0.1:9100/metrics" }
+//	liveness = { http = "http://127.0.0.1:9100/metrics", interval = "30s" }
+//	pre_stop = { command = ["node-exporter-drain"], timeout = "2s" }
+type ServicesFile struct {
+	Variables map[string]string   `toml:"variables"`
+	Services  []ServiceDefinition `toml:"service"`
+}
+
+// ServiceDefinition defines a command service. Only the name and the binary
+// are required
+type ServiceDefinition struct {
+	Name   string            `toml:"name"`
+	Binary string            `toml:"binary"`
+	Args   []string          `toml:"args,omitempty"`
+	Env    map[string]string `toml:"env,omitempty"`
+
+	// Dir is the working directory of the process
+	Dir string `toml:"dir,omitempty"`
+
+	// StopSignal is the name of the signal that stops the process, such as
+	// SIGINT. The default is SIGTERM
+	StopSignal string `toml:"stop_signal,omitempty"`
+
+	// StopTimeout is how long to wait for the process to exit after the stop
+	// signal, in the format accepted by [time.ParseDuration]
+	StopTimeout string `toml:"stop_timeout,omitempty"`
+
+	// StartRetry is how long to retry the start of the process while its
+	// binary is unavailable, in the format accepted by [time.ParseDuration]
+	// (see [WithStartRetry])
+	StartRetry string `toml:"start_retry,omitempty"`
+
+	// Restart is the restart policy, one of never, on-failure, and always.
+	// The default follows the policy of Run
+	Restart string `toml:"restart,omitempty"`
+
+	// Probe is the readiness probe of the service, if it has one
+	Probe *ProbeDefinition `toml:"probe,omitempty"`
+
+	// Liveness is the liveness check of the service, if it has one
+	Liveness *LivenessDefinition `toml:"liveness,omitempty"`
+
+	// PreStop is the pre-stop hook of the service, if it has one
+	PreStop *PreStopDefinition `toml:"pre_stop,omitempty"`
+
+	// Variables are the ones of the file, which the references in the
+	// arguments and the environment look up before the environment of the
+	// node
+	Variables map[string]string `toml:"-"`
+}
+
+// ProbeDefinition defines a readiness probe, which is either a TCP probe or
+// an HTTP probe
+type ProbeDefinition struct {
+	// TCP is the host and port that accept connections once the service is
+	// ready, such as 127.0.0.1:9100
+	TCP string `toml:"tcp,omitempty"`
+
+	// HTTP is the URL whose GET requests return 200 once the service is ready
+	HTTP string `toml:"http,omitempty"`
+
+	// Timeout of each attempt, in the format accepted by
+	// [time.ParseDuration]. The default is DefaultProbeTimeout
+	Timeout string `toml:"timeout,omitempty"`
+}
+
+// LivenessDefinition defines the liveness check of a service (see
+// [Liveness]). Its probe is defined like the readiness probe, and its timeout
+// bounds each check
+type LivenessDefinition struct {
+	ProbeDefinition
+
+	// Interval is the time between two checks, in the format accepted by
+	// [time.ParseDuration]. The default is DefaultLivenessInterval
+	Interval string `toml:"interval,omitempty"`
+
+	// FailureThreshold is how many consecutive checks must fail for the
+	// service to be stopped. The default is DefaultLivenessThreshold
+	FailureThreshold int `toml:"failure_threshold,omitempty"`
+}
+
+// PreStopDefinition defines the pre-stop hook of a service (see
+// [WithPreStop]), which is either an HTTP request or a command
+type PreStopDefinition struct {
+	// HTTP is the URL that receives the request
+	HTTP string `toml:"http,omitempty"`
+
+	// Method of the request. The default is POST
+	Method string `toml:"method,omitempty"`
+
+	// Command is the binary and the arguments of the command
+	Command []string `toml:"command,omitempty"`
+
+	// Timeout of the hook, in the format accepted by [time.ParseDuration].
+	// The default is DefaultPreStopTimeout
+	Timeout string `toml:"timeout,omitempty"`
+}
+
+// serviceKeys, probeKeys, livenessKeys, and preStopKeys are the keys of the
+// tables of the file
+var (
+	serviceKeys = []string{"name", "binary", "args", "env", "dir", "stop_signal",
+		"stop_timeout", "start_retry", "restart", "probe", "liveness", "pre_stop"}
+	probeKeys    = []string{"tcp", "http", "timeout"}
+	livenessKeys = []string{"tcp", "http", "timeout", "interval", "failure_threshold"}
+	preStopKeys  = []string{"http", "method", "command", "timeout"}
+)
+
+// ParseServicesFile parses the definitions of a file. Unknown keys are
+// rejected, so typos do not go unnoticed, and the error names the entry
+func ParseServicesFile(data []byte) ([]ServiceDefinition, error) {
+	var file ServicesFile
+	metadata, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServicesFile, err)
+	}
+	var problems []error
+	for _, key := range metadata.Undecoded() {
+		// the unknown keys of the entries are reported below, with the entry
+		if key[0] != "service" {
+			problems = append(problems, fmt.Errorf("unknown key %v", key))
+		}
+	}
+	var raw struct {
+		Services []map[string]any `toml:"service"`
+	}
+	if _, err := toml.Decode(string(data), &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServicesFile, err)
+	}
+	for i, entry := range raw.Services {
+		subject := entrySubject(i, file.Services[i].Name)
+		for _, key := range unknownKeys(entry, serviceKeys) {
+			problems = append(problems, fmt.Errorf("%v: unknown key %v", subject, key))
+		}
+		if probe, ok := entry["probe"].(map[string]any); ok {
+			for _, key := range unknownKeys(probe, probeKeys) {
+				problems = append(problems, fmt.Errorf("%v: unknown key probe.%v", subject, key))
+			}
+		}
+		if liveness, ok := entry["liveness"].(map[string]any); ok {
+			for _, key := range unknownKeys(liveness, livenessKeys) {
+				problems = append(problems,
+					fmt.Errorf("%v: unknown key liveness.%v", subject, key))
+			}
+		}
+		if preStop, ok := entry["pre_stop"].(map[string]any); ok {
+			for _, key := range unknownKeys(preStop, preStopKeys) {
+				problems = append(problems,
+					fmt.Errorf("%v: unknown key pre_stop.%v", subject, key))
+			}
+		}
+	}
+	if err := joinProblems(problems); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServicesFile, err)
+	}
+	for i := range file.Services {
+		file.Services[i].Variables = file.Variables
+	}
+	return file.Services, nil
+}
+
+// unknownKeys returns the keys of the table that are not known, sorted
+func unknownKeys(table map[string]any, known []string) []string {
+	var unknown []string
+	for key := range table {
+		if !slices.Contains(known, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// entrySubject names an entry of the file in the errors
+func entrySubject(index int, name string) string {
+	if name == "" {
+		return fmt.Sprintf("entry %v", index+1)
+	}
+	return fmt.Sprintf("entry %v (service '%v')", index+1, name)
+}
+
+// NewService creates the command service of the definition
+func (d ServiceDefinition) NewService() (Service, error) {
+	if d.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	if d.Binary == "" {
+		return nil, errors.New("missing binary")
+	}
+	opts := []CommandOption{WithArgs(d.Args...), WithEnv(d.Env), WithVariables(d.Variables)}
+	if d.Dir != "" {
+		opts = append(opts, WithDir(d.Dir))
+	}
+	if d.StopSignal != "" {
+		signal, ok := stopSignals[d.StopSignal]
+		if !ok {
+			return nil, fmt.Errorf("unknown stop_signal %q", d.StopSignal)
+		}
+		opts = append(opts, WithStopSignal(signal))
+	}
+	if d.StopTimeout != "" {
+		timeout, err := time.ParseDuration(d.StopTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stop_timeout: %w", err)
+		}
+		opts = append(opts, WithGracePeriod(timeout))
+	}
+	if d.StartRetry != "" {
+		deadline, err := time.ParseDuration(d.StartRetry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start_retry: %w", err)
+		}
+		opts = append(opts, WithStartRetry(deadline))
+	}
+	if d.Probe != nil {
+		probe, err := d.Probe.probe()
+		if err != nil {
+			return nil, fmt.Errorf("invalid probe: %w", err)
+		}
+		opts = append(opts, WithProbe(probe))
+	}
+	if d.PreStop != nil {
+		hook := PreStopHook{URL: d.PreStop.HTTP, Method: d.PreStop.Method,
+			Command: d.PreStop.Command}
+		if d.PreStop.Timeout != "" {
+			timeout, err := time.ParseDuration(d.PreStop.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pre_stop timeout: %w", err)
+			}
+			hook.Timeout = timeout
+		}
+		opts = append(opts, WithPreStop(hook))
+	}
+	var service Service = NewCommandService(d.Name, d.Binary, opts...)
+	if d.Liveness != nil {
+		config, err := d.Liveness.config()
+		if err != nil {
+			return nil, fmt.Errorf("invalid liveness: %w", err)
+		}
+		service = Liveness(service, config)
+	}
+	if d.Restart != "" {
+		policy, err := parseRestartPolicy(d.Restart)
+		if err != nil {
+			return nil, err
+		}
+		service = Restart(service, policy)
+	}
+	return service, nil
+}
+
+// probe returns the readiness probe of the definition
+func (d ProbeDefinition) probe() (Readiness, error) {
+	var timeout time.Duration
+	if d.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(d.Timeout); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+	}
+	switch {
+	case d.TCP != "" && d.HTTP != "":
+		return nil, errors.New("set either tcp or http")
+	case d.TCP != "":
+		host, port, err := net.SplitHostPort(d.TCP)
+		if err != nil {
+			return nil, err
+		}
+		number, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %v", port)
+		}
+		return TcpPortProbe{Host: host, Port: number, Timeout: timeout}, nil
+	case d.HTTP != "":
+		return HttpProbe{URL: d.HTTP, Timeout: timeout}, nil
+	default:
+		return nil, errors.New("missing tcp or http")
+	}
+}
+
+// config returns the liveness config of the definition
+func (d LivenessDefinition) config() (LivenessConfig, error) {
+	probe, err := d.probe()
+	if err != nil {
+		return LivenessConfig{}, err
+	}
+	if d.FailureThreshold < 0 {
+		return LivenessConfig{}, errors.New("negative failure_threshold")
+	}
+	config := LivenessConfig{Probe: probe, FailureThreshold: d.FailureThreshold}
+	if d.Timeout != "" {
+		// the probe already checked the timeout
+		config.Timeout, _ = time.ParseDuration(d.Timeout)
+	}
+	if d.Interval != "" {
+		if config.Interval, err = time.ParseDuration(d.Interval); err != nil {
+			return LivenessConfig{}, fmt.Errorf("invalid interval: %w", err)
+		}
+	}
+	return config, nil
+}
+
+// parseRestartPolicy parses the name of a restart policy
+func parseRestartPolicy(name string) (RestartPolicy, error) {
+	for _, policy := range []RestartPolicy{RestartNever, RestartOnFailure, RestartAlways} {
+		if policy.String() == name {
+			return policy, nil
+		}
+	}
+	return RestartDefault, fmt.Errorf("unknown restart policy %q, expected never, on-failure, "+
+		"or always", name)
+}
+
+// LoadServicesFile reads the definitions of the file at the path and returns
+// the built-in services followed by the services of the file, which start
+// after them. The services of the file cannot reuse the name of another
+// service. It returns [ErrInvalidServicesFile] with every problem it finds,
+// each naming its entry
+func LoadServicesFile(path string, builtin []Service) ([]Service, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidServicesFile, err)
+	}
+	definitions, err := ParseServicesFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	names := make(map[string]string, len(builtin)+len(definitions))
+	for _, service := range builtin {
+		names[service.String()] = "a built-in service"
+	}
+	list := slices.Clone(builtin)
+	var problems []error
+	for i, definition := range definitions {
+		subject := entrySubject(i, definition.Name)
+		if other, ok := names[definition.Name]; ok && definition.Name != "" {
+			problems = append(problems, fmt.Errorf("%v: the name is already used by %v",
+				subject, other))
+			continue
+		}
+		names[definition.Name] = entrySubject(i, "")
+		service, err := definition.NewService()
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%v: %w", subject, err))
+			continue
+		}
+		list = append(list, service)
+	}
+	if err := joinProblems(problems); err != nil {
+		return nil, fmt.Errorf("%v: %w: %w", path, ErrInvalidServicesFile, err)
+	}
+	return list, nil
+}
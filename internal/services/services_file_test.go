@@ -0,0 +1,227 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestServicesFile(t *testing.T) {
+
+	// writeFile writes the contents to a services file and returns its path
+	writeFile := func(t *testing.T, contents string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "services.toml")
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("it parses what it encodes", func(t *testing.T) {
+		file := ServicesFile{Services: []ServiceDefinition{{
+			Name:        "exporter",
+			Binary:      "node-exporter",
+			Args:        []string{"--web.listen-address=127.0.0.1:9100"},
+			Env:         map[string]string{"EXPORTER_LOG": "info"},
+			Dir:         "/var/lib/exporter",
+			StopSignal:  "SIGINT",
+			StopTimeout: "5s",
+			Restart:     "on-failure",
+			Probe:       &ProbeDefinition{HTTP: "http://127.0.0.1:9100/metrics", Timeout: "1s"},
+		}, {
+			Name:   "proxy",
+			Binary: "proxy",
+			Probe:  &ProbeDefinition{TCP: "127.0.0.1:8443"},
+			Liveness: &LivenessDefinition{
+				ProbeDefinition:  ProbeDefinition{TCP: "127.0.0.1:8443", Timeout: "2s"},
+				Interval:         "30s",
+				FailureThreshold: 5,
+			},
+		}}}
+		var encoded bytes.Buffer
+		if err := toml.NewEncoder(&encoded).Encode(file); err != nil {
+			t.Fatal(err)
+		}
+		definitions, err := ParseServicesFile(encoded.Bytes())
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !reflect.DeepEqual(definitions, file.Services) {
+			t.Fatalf("expected %+v, got %+v", file.Services, definitions)
+		}
+	})
+
+	t.Run("it creates the command services", func(t *testing.T) {
+		path := writeFile(t, `
+			[[service]]
+			name = "exporter"
+			binary = "node-exporter"
+			args = ["--log", "info"]
+			env = { EXPORTER_LOG = "info" }
+			dir = "/var/lib/exporter"
+			stop_signal = "SIGINT"
+			stop_timeout = "5s"
+			restart = "always"
+			probe = { tcp = "127.0.0.1:9100" }
+			liveness = { http = "http://127.0.0.1:9100/metrics", interval = "30s" }
+			pre_stop = { http = "http://127.0.0.1:9100/drain", timeout = "2s" }
+		`)
+		list, err := LoadServicesFile(path, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		spec := specOf(list[0])
+		if spec.Restart != RestartAlways {
+			t.Errorf("expected the restart policy always, got %v", spec.Restart)
+		}
+		liveness := LivenessConfig{
+			Probe:    HttpProbe{URL: "http://127.0.0.1:9100/metrics"},
+			Interval: 30 * time.Second,
+		}
+		if spec.Liveness == nil || !reflect.DeepEqual(*spec.Liveness, liveness) {
+			t.Errorf("expected the liveness %+v, got %+v", liveness, spec.Liveness)
+		}
+		service := spec.Service.(*simpleService)
+		cmd := service.command()
+		if !reflect.DeepEqual(cmd.Args, []string{"node-exporter", "--log", "info"}) {
+			t.Errorf("unexpected args %v", cmd.Args)
+		}
+		if cmd.Dir != "/var/lib/exporter" {
+			t.Errorf("unexpected dir %v", cmd.Dir)
+		}
+		if service.stopSignal != os.Interrupt || service.stopTimeout != 5*time.Second {
+			t.Errorf("unexpected stop %v after %v", service.stopSignal, service.stopTimeout)
+		}
+		hook := PreStopHook{URL: "http://127.0.0.1:9100/drain", Timeout: 2 * time.Second}
+		if service.preStop == nil || !reflect.DeepEqual(*service.preStop, hook) {
+			t.Errorf("expected the pre-stop hook %+v, got %+v", hook, service.preStop)
+		}
+		probe := TcpPortProbe{Host: "127.0.0.1", Port: 9100}
+		if service.probe != probe {
+			t.Errorf("expected the probe %+v, got %+v", probe, service.probe)
+		}
+	})
+
+	t.Run("it names the malformed entries", func(t *testing.T) {
+		cases := map[string]string{
+			`[[service]]
+			name = "a"
+			binary = "a"
+			stop_timeout = "soon"`: "entry 1 (service 'a'): invalid stop_timeout",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			[[service]]
+			binary = "b"`: "entry 2: missing name",
+			`[[service]]
+			name = "a"`: "entry 1 (service 'a'): missing binary",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			restart = "sometimes"`: `entry 1 (service 'a'): unknown restart policy "sometimes"`,
+			`[[service]]
+			name = "a"
+			binary = "a"
+			stop_signal = "SIGSTOP"`: `entry 1 (service 'a'): unknown stop_signal "SIGSTOP"`,
+			`[[service]]
+			name = "a"
+			binary = "a"
+			probe = { tcp = "127.0.0.1:1", http = "http://127.0.0.1:1" }`: "entry 1 (service " +
+				"'a'): invalid probe: set either tcp or http",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			arg = ["x"]`: "entry 1 (service 'a'): unknown key arg",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			probe = { url = "http://127.0.0.1:1" }`: "entry 1 (service 'a'): unknown key probe.url",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			liveness = { tcp = "127.0.0.1:1", period = "1s" }`: "entry 1 (service 'a'): " +
+				"unknown key liveness.period",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			liveness = { tcp = "127.0.0.1:1", interval = "often" }`: "entry 1 (service 'a'): " +
+				"invalid liveness: invalid interval",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			pre_stop = { http = "http://127.0.0.1:1", timeout = "soon" }`: "entry 1 (service " +
+				"'a'): invalid pre_stop timeout",
+			`[[services]]`: "unknown key services",
+			`[[service]]
+			name = "a"
+			binary = "a"
+			[[service]]
+			name = "a"
+			binary = "b"`: "entry 2 (service 'a'): the name is already used by entry 1",
+			`[[service]]
+			name = 1`: "toml: line 2",
+		}
+		for contents, expected := range cases {
+			_, err := LoadServicesFile(writeFile(t, contents), nil)
+			if !errors.Is(err, ErrInvalidServicesFile) || !strings.Contains(err.Error(), expected) {
+				t.Errorf("expected the error %q, got %v", expected, err)
+			}
+		}
+	})
+
+	t.Run("it rejects the names of the built-in services", func(t *testing.T) {
+		path := writeFile(t, `
+			[[service]]
+			name = "indexer"
+			binary = "my-indexer"
+		`)
+		builtin := []Service{testService{name: "indexer"}}
+		_, err := LoadServicesFile(path, builtin)
+		expected := "entry 1 (service 'indexer'): the name is already used by a built-in service"
+		if !errors.Is(err, ErrInvalidServicesFile) || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected the error %q, got %v", expected, err)
+		}
+	})
+
+	t.Run("it runs the declared services after the built-in ones", func(t *testing.T) {
+		setup()
+		path := writeFile(t, `
+			[[service]]
+			name = "sidecar"
+			binary = "sleep"
+			args = ["30"]
+			stop_timeout = "1s"
+		`)
+		node := testService{name: "node", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		list, err := LoadServicesFile(path, []Service{node})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		supervisor := NewSupervisor(list)
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		statuses := supervisor.Status()
+		if len(statuses) != 2 || statuses[1].Name != "sidecar" || statuses[1].PID == 0 {
+			t.Fatalf("expected the sidecar to be running, got %+v", statuses)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
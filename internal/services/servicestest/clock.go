@@ -0,0 +1,98 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// Package servicestest provides fake services and a controllable clock for
+// the tests of the programs that supervise their services with the services
+// package, so they do not depend on sleeps and real timeouts
+package servicestest
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitTimeout is how long the helpers wait for the code under test before
+// failing the test
+const waitTimeout = 5 * time.Second
+
+// Clock is a clock whose time only moves when the test advances it, firing
+// the waits that are due. It implements services.Clock, so it can be given to
+// the supervisor with services.WithClock
+type Clock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	pending []clockWait
+}
+
+type clockWait struct {
+	delay time.Duration
+	at    time.Time
+	ch    chan time.Time
+}
+
+// NewClock creates a clock that starts at the given time
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// After returns a channel that receives the time once the clock is advanced
+// past the delay
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.pending = append(c.pending, clockWait{delay: d, at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the time forward and fires the waits that are due
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.pending[:0]
+	for _, wait := range c.pending {
+		if wait.at.After(c.now) {
+			pending = append(pending, wait)
+			continue
+		}
+		wait.ch <- c.now
+	}
+	c.pending = pending
+}
+
+// WaitFor waits for the code under test to wait for the delay, so the test
+// only advances the clock once the wait is in place
+func (c *Clock) WaitFor(t testing.TB, delay time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(waitTimeout)
+	for !c.waiting(delay) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a wait of %v", delay)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waiting tells whether a wait of the delay is pending
+func (c *Clock) waiting(delay time.Duration) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, wait := range c.pending {
+		if wait.delay == delay {
+			return true
+		}
+	}
+	return false
+}
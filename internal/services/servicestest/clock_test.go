@@ -0,0 +1,54 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package servicestest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+
+	t.Run("it fires the waits once they are due", func(t *testing.T) {
+		clock := NewClock(time.Unix(0, 0))
+		short := clock.After(time.Second)
+		long := clock.After(time.Minute)
+		clock.Advance(time.Second)
+		select {
+		case now := <-short:
+			if !now.Equal(time.Unix(1, 0)) {
+				t.Fatalf("expected the time of the clock, got %v", now)
+			}
+		default:
+			t.Fatal("expected the short wait to fire")
+		}
+		select {
+		case <-long:
+			t.Fatal("expected the long wait to be pending")
+		default:
+		}
+		clock.Advance(time.Hour)
+		<-long
+		if now := clock.Now(); !now.Equal(time.Unix(3601, 0)) {
+			t.Fatalf("expected the advanced time, got %v", now)
+		}
+	})
+
+	t.Run("it fires the waits without delay immediately", func(t *testing.T) {
+		clock := NewClock(time.Unix(0, 0))
+		<-clock.After(0)
+	})
+
+	t.Run("it waits for a wait to be in place", func(t *testing.T) {
+		clock := NewClock(time.Unix(0, 0))
+		fired := make(chan struct{})
+		go func() {
+			<-clock.After(time.Minute)
+			close(fired)
+		}()
+		clock.WaitFor(t, time.Minute)
+		clock.Advance(time.Minute)
+		<-fired
+	})
+}
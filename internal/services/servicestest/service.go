@@ -0,0 +1,197 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package servicestest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ErrNotReady is returned by FakeService.Ready until the test makes the
+// service ready
+var ErrNotReady = errors.New("fake service is not ready")
+
+// FakeService is a service whose lifecycle is controlled by the test. Each
+// execution of Start blocks until the test makes it exit or, unless stops
+// are ignored, until its context is canceled. The service is not ready
+// until the test calls BecomeReady, and it is not ready again after each
+// restart. It implements services.Service and services.Readiness
+type FakeService struct {
+	name string
+
+	mutex      sync.Mutex
+	starts     int
+	running    bool
+	ready      bool
+	ignoreStop bool
+	exit       chan error
+	canceled   chan struct{}
+	changed    chan struct{}
+}
+
+// NewFakeService creates a fake service with the name
+func NewFakeService(name string) *FakeService {
+	return &FakeService{name: name, changed: make(chan struct{})}
+}
+
+func (s *FakeService) String() string {
+	return s.name
+}
+
+// Start blocks until the test calls Fail or ExitCleanly, or until the context
+// is canceled, in which case it returns nil unless stops are ignored
+func (s *FakeService) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	s.starts++
+	s.running = true
+	s.ready = false
+	exit := make(chan error, 1)
+	canceled := make(chan struct{})
+	s.exit, s.canceled = exit, canceled
+	s.notify()
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.running = false
+		s.ready = false
+		s.notify()
+		s.mutex.Unlock()
+	}()
+	select {
+	case err := <-exit:
+		return err
+	case <-ctx.Done():
+	}
+	close(canceled)
+	s.mutex.Lock()
+	ignoreStop := s.ignoreStop
+	s.mutex.Unlock()
+	if !ignoreStop {
+		return nil
+	}
+	return <-exit
+}
+
+// Ready returns ErrNotReady until the test calls BecomeReady
+func (s *FakeService) Ready(ctx context.Context) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.ready {
+		return ErrNotReady
+	}
+	return nil
+}
+
+// BecomeReady makes the running execution of the service ready
+func (s *FakeService) BecomeReady() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.running {
+		s.ready = true
+	}
+}
+
+// Fail makes the running execution of the service exit with the error
+func (s *FakeService) Fail(err error) {
+	s.finish(err)
+}
+
+// ExitCleanly makes the running execution of the service exit with no error
+func (s *FakeService) ExitCleanly() {
+	s.finish(nil)
+}
+
+// finish hands the error to the running execution, if it did not exit yet
+func (s *FakeService) finish(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return
+	}
+	select {
+	case s.exit <- err:
+	default:
+	}
+}
+
+// IgnoreStop makes the service keep running after its context is canceled,
+// until the test makes it exit, like a service that is stuck
+func (s *FakeService) IgnoreStop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ignoreStop = true
+}
+
+// Starts returns how many times the service was started
+func (s *FakeService) Starts() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.starts
+}
+
+// Running tells whether an execution of the service is running
+func (s *FakeService) Running() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.running
+}
+
+// Canceled returns a channel that is closed once the context of the running
+// execution is canceled, or nil if the service was never started
+func (s *FakeService) Canceled() <-chan struct{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.canceled
+}
+
+// WaitForStarts waits until the service was started the number of times and
+// its last execution is running
+func (s *FakeService) WaitForStarts(t testing.TB, count int) {
+	t.Helper()
+	s.waitUntil(t, func() bool { return s.starts >= count && s.running },
+		"expected %v starts of %v", count, s.name)
+}
+
+// WaitForExit waits until no execution of the service is running
+func (s *FakeService) WaitForExit(t testing.TB) {
+	t.Helper()
+	s.waitUntil(t, func() bool { return !s.running }, "expected %v to exit", s.name)
+}
+
+// waitUntil waits for the condition, which is checked with the lock held,
+// and fails the test with the message if it does not hold in time
+func (s *FakeService) waitUntil(
+	t testing.TB,
+	condition func() bool,
+	format string,
+	args ...any,
+) {
+	t.Helper()
+	timeout := time.NewTimer(waitTimeout)
+	defer timeout.Stop()
+	for {
+		s.mutex.Lock()
+		done, changed := condition(), s.changed
+		s.mutex.Unlock()
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			t.Fatalf(format, args...)
+		}
+	}
+}
+
+// notify wakes the goroutines waiting for a change. It is called with the
+// lock held
+func (s *FakeService) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
@@ -0,0 +1,92 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package servicestest
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFakeService(t *testing.T) {
+
+	// run starts the service in the background and returns its exit
+	run := func(ctx context.Context, service *FakeService) <-chan error {
+		exit := make(chan error, 1)
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+		return exit
+	}
+
+	t.Run("it is ready once the test makes it ready", func(t *testing.T) {
+		service := NewFakeService("indexer")
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		exit := run(ctx, service)
+		service.WaitForStarts(t, 1)
+		if err := service.Ready(ctx); !errors.Is(err, ErrNotReady) {
+			t.Fatalf("expected the service to not be ready, got %v", err)
+		}
+		service.BecomeReady()
+		if err := service.Ready(ctx); err != nil {
+			t.Fatalf("expected the service to be ready, got %v", err)
+		}
+		service.ExitCleanly()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := service.Ready(ctx); !errors.Is(err, ErrNotReady) {
+			t.Fatalf("expected the service to not be ready after it exited, got %v", err)
+		}
+	})
+
+	t.Run("it exits with the error of the test", func(t *testing.T) {
+		service := NewFakeService("indexer")
+		boom := errors.New("boom")
+		exit := run(context.Background(), service)
+		service.WaitForStarts(t, 1)
+		service.Fail(boom)
+		if err := <-exit; err != boom {
+			t.Fatalf("expected the error of the test, got %v", err)
+		}
+		exit = run(context.Background(), service)
+		service.WaitForStarts(t, 2)
+		service.ExitCleanly()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it stops when its context is canceled", func(t *testing.T) {
+		service := NewFakeService("indexer")
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := run(ctx, service)
+		service.WaitForStarts(t, 1)
+		cancel()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		<-service.Canceled()
+	})
+
+	t.Run("it ignores the stop until the test makes it exit", func(t *testing.T) {
+		service := NewFakeService("indexer")
+		service.IgnoreStop()
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := run(ctx, service)
+		service.WaitForStarts(t, 1)
+		canceled := service.Canceled()
+		cancel()
+		<-canceled
+		if !service.Running() {
+			t.Fatal("expected the service to keep running")
+		}
+		service.ExitCleanly()
+		service.WaitForExit(t)
+		if err := <-exit; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
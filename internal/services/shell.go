@@ -0,0 +1,32 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// NewShellService creates a service that runs the script with sh -c, such as
+// a pipeline that filters the output of a binary. The shell leads its own
+// process group, so the stop signal and the SIGKILL after the grace period
+// reach every process of the script, and whatever is left of the group is
+// killed once the shell exits. [WithoutProcessGroup] is ignored
+func NewShellService(name string, script string, opts ...CommandOption) Service {
+	opts = append(opts, WithArgs("-c", script))
+	s := NewCommandService(name, "sh", opts...).(*simpleService)
+	s.script = script
+	s.sharedProcessGroup = false
+	return s
+}
+
+// killSurvivors kills the processes the script left in its process group
+func (s *simpleService) killSurvivors(cmd *exec.Cmd, filter *logFilter) {
+	if killed := killGroup(cmd); killed {
+		msg := fmt.Sprintf("%v: killed the processes left by the script", s.String())
+		filter.log(logger.Debug, msg, "service", s.String(), "event", "killed")
+	}
+}
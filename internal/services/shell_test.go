@@ -0,0 +1,121 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestShellService(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test needs a POSIX shell")
+	}
+
+	// readPIDs waits for the script to write the count pids to the file
+	readPIDs := func(t *testing.T, path string, count int) []int {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			content, _ := os.ReadFile(path)
+			lines := strings.Fields(string(content))
+			if len(lines) == count {
+				pids := make([]int, count)
+				for i, line := range lines {
+					pids[i], _ = strconv.Atoi(line)
+				}
+				return pids
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v pids, got %q", count, content)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// waitForExit waits for the processes to exit
+	waitForExit := func(t *testing.T, pids []int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for _, pid := range pids {
+			for processIsAlive(pid) {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected the process %v to exit", pid)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	t.Run("it stops every process of the script", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Debug = log.New(&out, "DEBUG ", 0)
+		pids := filepath.Join(t.TempDir(), "pids")
+		script := fmt.Sprintf(`
+			sleep 600 & echo $! >> %[1]v
+			(trap '' TERM; exec sleep 600) & echo $! >> %[1]v
+			sleep 600 | cat & echo $! >> %[1]v
+			wait`, pids)
+		supervisor := NewSupervisor([]Service{NewShellService("pipeline", script)},
+			WithStopTimeout(5*time.Second))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		running := readPIDs(t, pids, 3)
+		start := time.Now()
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > DefaultStopTimeout {
+			t.Fatalf("expected the script to stop without waiting for SIGKILL, took %v",
+				elapsed)
+		}
+		waitForExit(t, running)
+		waitForLog(t, &out, "DEBUG pipeline: running the script "+script+"\n")
+	})
+
+	t.Run("it sends SIGKILL to every process of the script", func(t *testing.T) {
+		setup()
+		pids := filepath.Join(t.TempDir(), "pids")
+		script := fmt.Sprintf(`
+			trap '' TERM
+			sleep 600 & echo $! >> %[1]v
+			sleep 600 | cat & echo $! >> %[1]v
+			wait`, pids)
+		service := NewShellService("stubborn", script, WithGracePeriod(100*time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+		running := readPIDs(t, pids, 2)
+		cancel()
+		if err := <-exit; err != nil {
+			t.Fatalf("expected the killed script to exit without error, got %v", err)
+		}
+		waitForExit(t, running)
+	})
+
+	t.Run("it kills what the script leaves behind", func(t *testing.T) {
+		setup()
+		pids := filepath.Join(t.TempDir(), "pids")
+		script := fmt.Sprintf("sleep 600 & echo $! >> %v", pids)
+		service := NewShellService("forker", script)
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		waitForExit(t, readPIDs(t, pids, 1))
+	})
+}
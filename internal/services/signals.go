@@ -0,0 +1,165 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// errNotRunning is returned when a signal is sent to a service that is not
+// running, such as while it is restarted
+var errNotRunning = errors.New("the service is not running")
+
+// errNotSignaler is returned by Supervisor.SignalService when the service
+// does not implement [Signaler]
+var errNotSignaler = errors.New("the service does not accept signals")
+
+// ErrSignalNotAllowed is returned by ParseServiceSignal for the signals that
+// may not be sent to the services on request
+var ErrSignalNotAllowed = errors.New("the signal is not allowed")
+
+// Signaler is implemented by the services that can receive the signals the
+// node forwards to them, such as the services created by [NewCommandService]
+type Signaler interface {
+	// Signal sends the signal to the service. It returns an error if the
+	// service is not running
+	Signal(sig os.Signal) error
+}
+
+// WithSignalTargets makes Run forward the signals it receives, other than the
+// ones that stop the node, only to the services with the given names instead
+// of to all of them
+func WithSignalTargets(names ...string) RunOption {
+	return func(c *runConfig) {
+		c.signalTargets = make(map[string]bool, len(names))
+		for _, name := range names {
+			c.signalTargets[name] = true
+		}
+	}
+}
+
+// Signal forwards the signal to the running services that implement
+// [Signaler], like the node does with SIGHUP, SIGUSR1, and SIGUSR2. It does
+// nothing if the supervisor is not running
+func (s *Supervisor) Signal(sig os.Signal) {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return
+	}
+	select {
+	case s.signals <- sig:
+	case <-s.done:
+	}
+}
+
+// forward sends the signal to the running services that are targets of the
+// forwarded signals
+func (s *supervisor) forward(sig os.Signal) {
+	for i, spec := range s.specs {
+		name := spec.String()
+		targeted := s.config.signalTargets == nil || s.config.signalTargets[name]
+		signaler, ok := spec.Service.(Signaler)
+		if !s.running[i] || !targeted || !ok {
+			continue
+		}
+		if err := signaler.Signal(sig); err != nil {
+			msg := fmt.Sprintf("main: failed to forward %v to service '%v': %v", sig, name, err)
+			s.filters[i].log(logger.Debug, msg, "service", name, "event", "signal_failed",
+				"signal", sig.String(), "error", err)
+			continue
+		}
+		s.status.signaled(i, sig)
+		s.filters[i].log(logger.Debug, fmt.Sprintf("main: forwarded %v to service '%v'", sig,
+			name), "service", name, "event", "signal_forwarded", "signal", sig.String())
+	}
+}
+
+// ParseServiceSignal returns the signal with the name, with or without the SIG
+// prefix, such as QUIT or SIGUSR1, if it may be sent to the services on
+// request. Only the signals that ask a process for something without stopping
+// it are allowed, which are SIGQUIT, SIGUSR1, SIGUSR2, and SIGHUP on Unix, and
+// none on Windows
+func ParseServiceSignal(name string) (os.Signal, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig, ok := requestedSignals[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrSignalNotAllowed, name)
+	}
+	return sig, nil
+}
+
+// SignalService sends the signal to a single running service that implements
+// [Signaler], such as SIGQUIT to have a Go service dump the stacks of its
+// goroutines. The output of the service goes to the logs of the node like the
+// rest of its output. The signal is published in the events of the
+// supervisor, and the exit of a service that does not handle it is treated
+// like any other exit. SignalService returns [ErrServiceNotFound] when no
+// service has the name, and an error if the service is not running
+func (s *Supervisor) SignalService(ctx context.Context, name string, sig os.Signal) error {
+	s.mutex.Lock()
+	started := s.started
+	s.mutex.Unlock()
+	if !started {
+		return errors.New("supervisor was not started")
+	}
+	result := make(chan error, 1)
+	select {
+	case s.signaled <- signalRequest{name: name, signal: sig, result: result}:
+	case <-s.done:
+		return ErrStopped
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-result
+}
+
+// signalRequest asks the supervisor to send a signal to a service
+type signalRequest struct {
+	name   string
+	signal os.Signal
+	result chan<- error
+}
+
+// signalService sends the signal of the request to its service
+func (s *supervisor) signalService(request signalRequest) {
+	i := -1
+	for j := s.builtin; j < len(s.specs); j++ {
+		if !s.removed[j] && s.specs[j].String() == request.name {
+			i = j
+		}
+	}
+	var err error
+	if i < 0 {
+		err = fmt.Errorf("%w: '%v'", ErrServiceNotFound, request.name)
+	} else if signaler, ok := s.specs[i].Service.(Signaler); !ok {
+		err = fmt.Errorf("%w: '%v'", errNotSignaler, request.name)
+	} else if !s.running[i] {
+		err = fmt.Errorf("%w: '%v'", errNotRunning, request.name)
+	} else {
+		err = signaler.Signal(request.signal)
+	}
+	if err != nil {
+		logger.Log(logger.Warning, fmt.Sprintf("main: failed to send %v to service '%v': %v",
+			request.signal, request.name, err), "service", request.name, "event",
+			"signal_failed", "signal", request.signal.String(), "error", err)
+		request.result <- err
+		return
+	}
+	s.status.signaled(i, request.signal)
+	s.filters[i].log(logger.Info, fmt.Sprintf("main: sent %v to service '%v' on request",
+		request.signal, request.name), "service", request.name, "event", "signal_sent",
+		"signal", request.signal.String())
+	request.result <- nil
+}
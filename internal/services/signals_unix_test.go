@@ -0,0 +1,323 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestSignalForwarding(t *testing.T) {
+
+	// trapper creates a service that records the signals it receives to a
+	// file, returning the file
+	trapper := func(t *testing.T, name string) (Service, string) {
+		out := filepath.Join(t.TempDir(), "signals")
+		script := writeScript(t, `
+trap 'echo HUP >> "$OUT"' HUP
+trap 'echo USR1 >> "$OUT"' USR1
+trap 'echo USR2 >> "$OUT"' USR2
+touch "$OUT.ready"
+while true; do sleep 0.01; done
+`)
+		service := NewCommandService(name, script, WithEnv(map[string]string{"OUT": out}))
+		return service, out
+	}
+
+	// waitForTraps waits for the scripts to install their traps
+	waitForTraps := func(t *testing.T, outs ...string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for _, out := range outs {
+			for {
+				if _, err := os.Stat(out + ".ready"); err == nil {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("the script did not install its traps")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
+	// waitForSignals waits for the file to record the signals
+	waitForSignals := func(t *testing.T, out string, signals ...string) {
+		t.Helper()
+		want := strings.Join(signals, "\n") + "\n"
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			content, _ := os.ReadFile(out)
+			if string(content) == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the signals %q, got %q", want, content)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	t.Run("it forwards the signals of the node to the services", func(t *testing.T) {
+		setup()
+		first, firstOut := trapper(t, "first")
+		second, secondOut := trapper(t, "second")
+		supervisor := NewSupervisor([]Service{first, second})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		waitForTraps(t, firstOut, secondOut)
+
+		for _, signal := range []syscall.Signal{syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2} {
+			if err := signalPID(os.Getpid(), signal); err != nil {
+				t.Fatalf("failed to signal the node: %v", err)
+			}
+			// the shell runs the traps in the order the signals arrive
+			time.Sleep(50 * time.Millisecond)
+		}
+		waitForSignals(t, firstOut, "HUP", "USR1", "USR2")
+		waitForSignals(t, secondOut, "HUP", "USR1", "USR2")
+
+		select {
+		case <-supervisor.done:
+			t.Fatalf("expected the node to keep running, got %v", supervisor.Wait())
+		default:
+		}
+	})
+
+	t.Run("it forwards the signals only to the targets", func(t *testing.T) {
+		setup()
+		target, targetOut := trapper(t, "target")
+		other, otherOut := trapper(t, "other")
+		supervisor := NewSupervisor([]Service{target, other}, WithSignalTargets("target"))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		waitForTraps(t, targetOut, otherOut)
+
+		supervisor.Signal(syscall.SIGUSR1)
+		waitForSignals(t, targetOut, "USR1")
+		time.Sleep(50 * time.Millisecond)
+		if content, err := os.ReadFile(otherOut); err == nil {
+			t.Fatalf("expected the other service to receive no signals, got %q", content)
+		}
+	})
+
+	t.Run("it reloads the services on SIGHUP if there is a reloader", func(t *testing.T) {
+		setup()
+		var recorder reloadRecorder
+		reloaded := make(chan struct{})
+		reloader := WithReloader(func(ctx context.Context) ([]Service, error) {
+			defer close(reloaded)
+			return []Service{recorder.service("database", "v2")}, nil
+		})
+		supervisor := NewSupervisor([]Service{recorder.service("database", "v1")}, reloader)
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+
+		if err := signalPID(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatalf("failed to signal the node: %v", err)
+		}
+		<-reloaded
+		expected := []string{"start database", "stop database", "start database"}
+		deadline := time.Now().Add(2 * time.Second)
+		for !reflect.DeepEqual(recorder.recorded(), expected) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the steps %v, got %v", expected, recorder.recorded())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("it does not signal services that are not running", func(t *testing.T) {
+		setup()
+		service := NewCommandService("idle", writeScript(t, "exit 0")).(Signaler)
+		if err := service.Signal(syscall.SIGHUP); !errors.Is(err, errNotRunning) {
+			t.Fatalf("expected errNotRunning, got %v", err)
+		}
+	})
+}
+
+func TestSignalService(t *testing.T) {
+
+	// dumper creates a service that writes a recognizable line to stderr on
+	// SIGQUIT instead of exiting
+	dumper := func(t *testing.T, name string) (Service, string) {
+		ready := filepath.Join(t.TempDir(), "ready")
+		script := writeScript(t, `
+trap 'echo "goroutine dump of $NAME" >&2' QUIT
+touch "$READY"
+while true; do sleep 0.01; done
+`)
+		service := NewCommandService(name, script,
+			WithEnv(map[string]string{"NAME": name, "READY": ready}))
+		return service, ready
+	}
+
+	t.Run("it sends the signal to a single service", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		indexer, indexerReady := dumper(t, "indexer")
+		server, serverReady := dumper(t, "server")
+		supervisor := NewSupervisor([]Service{indexer, server})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		for _, ready := range []string{indexerReady, serverReady} {
+			waitForFileContent(t, ready, "")
+		}
+
+		err := supervisor.SignalService(context.Background(), "indexer", syscall.SIGQUIT)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		// the output goes through the logs of the node with the service prefix
+		waitForLog(t, &out, "WARN indexer | goroutine dump of indexer")
+		for event := range supervisor.Events() {
+			if event.Kind == EventSignalSent {
+				if event.Service != "indexer" || event.Signal != syscall.SIGQUIT {
+					t.Fatalf("expected SIGQUIT to be sent to the indexer, got %+v", event)
+				}
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		if strings.Contains(out.String(), "goroutine dump of server") {
+			t.Fatalf("expected the server to not be signaled, got %q", out.String())
+		}
+		waitForStates(t, supervisor, StateReady, StateReady)
+	})
+
+	t.Run("it fails for the services it cannot signal", func(t *testing.T) {
+		setup()
+		migrate := OneShot(NewCommandService("migrate", writeScript(t, "exit 0")))
+		indexer := testService{name: "indexer", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		supervisor := NewSupervisor([]Service{migrate, indexer})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		waitForStates(t, supervisor, StateExited, StateReady)
+
+		signal := func(name string) error {
+			return supervisor.SignalService(context.Background(), name, syscall.SIGQUIT)
+		}
+		if err := signal("unknown"); !errors.Is(err, ErrServiceNotFound) {
+			t.Fatalf("expected ErrServiceNotFound, got %v", err)
+		}
+		if err := signal("migrate"); !errors.Is(err, errNotRunning) {
+			t.Fatalf("expected errNotRunning, got %v", err)
+		}
+		if err := signal("indexer"); !errors.Is(err, errNotSignaler) {
+			t.Fatalf("expected errNotSignaler, got %v", err)
+		}
+	})
+
+	t.Run("it only allows the signals that do not stop the services", func(t *testing.T) {
+		for _, name := range []string{"QUIT", "sigquit", "USR1", "SIGUSR2", "hup"} {
+			if _, err := ParseServiceSignal(name); err != nil {
+				t.Errorf("expected %v to be allowed, got %v", name, err)
+			}
+		}
+		for _, name := range []string{"TERM", "SIGKILL", "INT", ""} {
+			if _, err := ParseServiceSignal(name); !errors.Is(err, ErrSignalNotAllowed) {
+				t.Errorf("expected %v to not be allowed, got %v", name, err)
+			}
+		}
+	})
+}
+
+func TestAdminSignal(t *testing.T) {
+	admin := newAdminService("", func() []ServiceStatus {
+		return []ServiceStatus{{Name: "indexer", State: StateReady}}
+	})
+	var sent []os.Signal
+	admin.signal = func(ctx context.Context, name string, sig os.Signal) error {
+		switch name {
+		case "indexer":
+			sent = append(sent, sig)
+			return nil
+		case "migrate":
+			return fmt.Errorf("%w: '%v'", errNotRunning, name)
+		default:
+			return fmt.Errorf("%w: '%v'", ErrServiceNotFound, name)
+		}
+	}
+	handler := admin.handler()
+
+	post := func(t *testing.T, method string, name string, signal string) (int, map[string]any) {
+		t.Helper()
+		path := "/services/" + name + "/signal?signal=" + signal
+		request := httptest.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var body map[string]any
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+		}
+		return recorder.Code, body
+	}
+
+	t.Run("it sends the signal and returns the status of the service", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "indexer", "QUIT")
+		if code != http.StatusOK || body["name"] != "indexer" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+		if len(sent) != 1 || sent[0] != syscall.SIGQUIT {
+			t.Fatalf("expected SIGQUIT to be sent, got %v", sent)
+		}
+	})
+
+	t.Run("it returns 400 for the signals that are not allowed", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "indexer", "KILL")
+		if code != http.StatusBadRequest || body["error"] != "the signal is not allowed: SIGKILL" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it returns 409 for the services that are not running", func(t *testing.T) {
+		if code, _ := post(t, http.MethodPost, "migrate", "USR1"); code != http.StatusConflict {
+			t.Fatalf("expected status 409, got %v", code)
+		}
+	})
+
+	t.Run("it returns 404 for unknown services", func(t *testing.T) {
+		code, body := post(t, http.MethodPost, "unknown", "HUP")
+		if code != http.StatusNotFound || body["error"] != "service 'unknown' not found" {
+			t.Fatalf("unexpected response %v: %v", code, body)
+		}
+	})
+
+	t.Run("it only accepts POST", func(t *testing.T) {
+		code, _ := post(t, http.MethodGet, "indexer", "QUIT")
+		if code != http.StatusMethodNotAllowed {
+			t.Fatalf("expected status 405, got %v", code)
+		}
+	})
+}
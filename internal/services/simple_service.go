@@ -0,0 +1,794 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// DefaultStopTimeout is how long a simpleService waits for its process to
+// exit after SIGTERM before sending SIGKILL
+const DefaultStopTimeout = 10 * time.Second
+
+// simpleService implements the context cancelation logic of the Service interface
+type simpleService struct {
+	serviceName string
+	binaryName  string
+	args        []string
+	env         map[string]string
+	cleanEnv    bool
+	requiredEnv []string
+	redacted    map[string]bool
+	dir         string
+
+	// propagated are the prefixes of the variables of the node copied to the
+	// environment of the process (see [WithPropagatedEnv])
+	propagated []string
+
+	// templated expands the references to the variables in the arguments
+	// and the environment (see [WithVariables])
+	templated bool
+	variables map[string]string
+
+	// templateErr has the references that could not be expanded
+	templateErr error
+
+	// redactedArgs are the indexes of the arguments that use the value of a
+	// redacted variable
+	redactedArgs map[int]bool
+
+	// stopSignal is sent to the process when the context is canceled. The
+	// default is SIGTERM
+	stopSignal os.Signal
+
+	// stopTimeout overrides DefaultStopTimeout when it is not zero
+	stopTimeout time.Duration
+
+	// startRetry is how long the start of the process is retried while its
+	// binary is unavailable (see [WithStartRetry])
+	startRetry time.Duration
+
+	// sharedProcessGroup keeps the process in the process group of the node,
+	// so only the process itself is signaled when the service stops
+	sharedProcessGroup bool
+
+	// rawOutput writes the output of the process straight to the output of
+	// the node instead of logging it
+	rawOutput bool
+
+	// repeatLimit suppresses repeated lines of output when it is set
+	repeatLimit *RepeatLimit
+
+	// outputLimit bounds the output of the process that is logged when it
+	// is set
+	outputLimit *OutputLimit
+
+	// capturePrecision is the precision of the time added to each line of
+	// output, which is not added when it is zero
+	capturePrecision time.Duration
+
+	// logFile is where the output of the process is written, if it is set
+	logFile *LogFileConfig
+
+	// limits are applied to the process before its binary runs
+	limits ResourceLimits
+
+	// credential is the user the process runs as, if it is set
+	credential *credential
+
+	// stdin is what the process reads from its stdin, which is the null
+	// device unless it is set or inherited from the node
+	stdin        io.Reader
+	inheritStdin bool
+
+	// listeners are bound by the node and passed to the process, and bound
+	// holds them once they are bound
+	listeners      []listenerConfig
+	listenersMutex sync.Mutex
+	bound          []*boundListener
+
+	// ports are declared by WithPort, and picked holds the numbers picked by
+	// the supervisor for the ones declared with zero
+	ports  []Port
+	picked pickedPorts
+
+	// probe checks whether the service is ready. The service is ready as soon
+	// as its process is spawned when there is no probe
+	probe Readiness
+
+	// preStop runs before the stop signal is sent, if it is set
+	preStop *PreStopHook
+
+	// script is the script run by a shell service (see NewShellService)
+	script string
+
+	running atomic.Bool
+	pid     atomic.Int64
+	process atomic.Pointer[os.Process]
+	usage   atomic.Pointer[ResourceUsage]
+	version atomic.Pointer[binaryVersion]
+}
+
+// A CommandOption configures a service created by NewCommandService
+type CommandOption func(*simpleService)
+
+// NewCommandService creates a service that runs the binary, which is looked up
+// in the PATH if it does not contain a path separator
+func NewCommandService(name string, binary string, opts ...CommandOption) Service {
+	s := &simpleService{serviceName: name, binaryName: binary}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.templated {
+		s.templateErr = s.expandTemplates()
+	}
+	return s
+}
+
+// NewOneShotCommand creates a one-shot service that runs the binary with the
+// arguments (see [OneShot])
+func NewOneShotCommand(name string, binary string, args ...string) Service {
+	return OneShot(NewCommandService(name, binary, WithArgs(args...)))
+}
+
+// WithArgs sets the command-line arguments passed to the binary
+func WithArgs(args ...string) CommandOption {
+	return func(s *simpleService) {
+		s.args = args
+	}
+}
+
+// WithEnv adds variables to the environment of the process, which otherwise
+// inherits the environment of the node. The given values take precedence
+func WithEnv(env map[string]string) CommandOption {
+	return func(s *simpleService) {
+		s.env = env
+	}
+}
+
+// WithCleanEnv makes the process start with only the variables set by
+// WithEnv instead of inheriting the environment of the node
+func WithCleanEnv() CommandOption {
+	return func(s *simpleService) {
+		s.cleanEnv = true
+	}
+}
+
+// DefaultPropagatedEnv are the prefixes of the variables copied to the
+// environment of the services of the node, which read their configuration
+// from them
+var DefaultPropagatedEnv = []string{"CARTESI_"}
+
+// WithPropagatedEnv copies the variables of the node whose names start with
+// one of the prefixes to the environment of the process, even when it starts
+// from a clean environment (see [WithCleanEnv]). The variables set by WithEnv
+// take precedence
+func WithPropagatedEnv(prefixes ...string) CommandOption {
+	return func(s *simpleService) {
+		s.propagated = prefixes
+	}
+}
+
+// WithRequiredEnv declares variables that must be set in the environment of
+// the process, either by WithEnv or by the environment of the node, for the
+// service to pass its validation
+func WithRequiredEnv(keys ...string) CommandOption {
+	return func(s *simpleService) {
+		s.requiredEnv = append(s.requiredEnv, keys...)
+	}
+}
+
+// WithRedactedEnv hides the values of the given variables, such as database
+// passwords, when the environment of the process is logged
+func WithRedactedEnv(keys ...string) CommandOption {
+	return func(s *simpleService) {
+		if s.redacted == nil {
+			s.redacted = make(map[string]bool)
+		}
+		for _, key := range keys {
+			s.redacted[key] = true
+		}
+	}
+}
+
+// WithDir sets the working directory of the process
+func WithDir(dir string) CommandOption {
+	return func(s *simpleService) {
+		s.dir = dir
+	}
+}
+
+// WithStopSignal sets the signal sent to the process to stop it. The default
+// is SIGTERM. It has no effect on Windows, where the process is sent a
+// CTRL_BREAK_EVENT instead
+func WithStopSignal(signal os.Signal) CommandOption {
+	return func(s *simpleService) {
+		s.stopSignal = signal
+	}
+}
+
+// WithGracePeriod sets how long to wait for the process to exit after the
+// stop signal before sending SIGKILL. The default is [DefaultStopTimeout]
+func WithGracePeriod(timeout time.Duration) CommandOption {
+	return func(s *simpleService) {
+		s.stopTimeout = timeout
+	}
+}
+
+// WithoutProcessGroup makes the service signal only its own process instead
+// of its whole process group, for binaries that manage their own children
+func WithoutProcessGroup() CommandOption {
+	return func(s *simpleService) {
+		s.sharedProcessGroup = true
+	}
+}
+
+// WithStdin feeds the reader to the stdin of the process, such as a secret
+// that should not be passed in the environment. A reader that is also an
+// [io.Seeker] is rewound whenever the process starts, so it is fed again when
+// the service is restarted; other readers are only read once
+func WithStdin(stdin io.Reader) CommandOption {
+	return func(s *simpleService) {
+		s.stdin = stdin
+		s.inheritStdin = false
+	}
+}
+
+// WithInheritedStdin makes the process read from the stdin of the node. By
+// default, it reads from the null device, so it never blocks reading from the
+// terminal the node was started from
+func WithInheritedStdin() CommandOption {
+	return func(s *simpleService) {
+		s.stdin = nil
+		s.inheritStdin = true
+	}
+}
+
+// WithRawOutput writes the output of the process straight to the stdout and
+// stderr of the node, without going through the logger
+func WithRawOutput() CommandOption {
+	return func(s *simpleService) {
+		s.rawOutput = true
+	}
+}
+
+// WithRepeatLimit suppresses lines of output that repeat the previous line
+// too many times in a row, logging how many were suppressed instead. Distinct
+// lines are always logged
+func WithRepeatLimit(limit RepeatLimit) CommandOption {
+	return func(s *simpleService) {
+		s.repeatLimit = &limit
+	}
+}
+
+// WithOutputLimit truncates the lines of output of the process that are
+// longer than the limit and drops the output over its budget, logging how
+// many bytes were dropped instead
+func WithOutputLimit(limit OutputLimit) CommandOption {
+	return func(s *simpleService) {
+		s.outputLimit = &limit
+	}
+}
+
+// WithCaptureTimestamps prefixes each line of output of the process with the
+// time the supervisor read it, in UTC and with the precision, such as
+// time.Millisecond, so the lines of services with different formats can be
+// put in order. In the JSON format, the time is the captured_at field
+// instead. The time is taken once per line, when its newline is read. The
+// output goes through pipes that the processes may buffer, so the order of
+// the times is exact for the lines of the same pipe, but only a best effort
+// between the stdout and stderr of a process or between services
+func WithCaptureTimestamps(precision time.Duration) CommandOption {
+	return func(s *simpleService) {
+		s.capturePrecision = precision
+	}
+}
+
+// WithLogFile writes the output of the process to a file in the directory of
+// the config, named after the service, instead of the console
+func WithLogFile(config LogFileConfig) CommandOption {
+	return func(s *simpleService) {
+		s.logFile = &config
+	}
+}
+
+// WithProbe sets the readiness probe of the service
+func WithProbe(probe Readiness) CommandOption {
+	return func(s *simpleService) {
+		s.probe = probe
+	}
+}
+
+// command builds the command that runs the service
+func (s *simpleService) command() *exec.Cmd {
+	cmd := exec.Command(s.binaryName, s.args...)
+	if s.rawOutput {
+		cmd.Stderr = os.Stderr
+		cmd.Stdout = os.Stdout
+	} else {
+		stderr := newLineWriter(logger.Warning, s.serviceName)
+		stdout := newLineWriter(logger.Info, s.serviceName)
+		if s.repeatLimit != nil {
+			stderr.repeats = newRepeatFilter(*s.repeatLimit, realClock{})
+			stdout.repeats = newRepeatFilter(*s.repeatLimit, realClock{})
+		}
+		if s.outputLimit != nil {
+			limitOutput(*s.outputLimit, realClock{}, stderr, stdout)
+		}
+		if s.capturePrecision > 0 {
+			captureTimestamps(s.capturePrecision, realClock{}, stderr, stdout)
+		}
+		cmd.Stderr, cmd.Stdout = stderr, stdout
+		cmd.WaitDelay = outputWaitDelay
+	}
+	// a nil stdin reads from the null device
+	if s.inheritStdin {
+		cmd.Stdin = os.Stdin
+	} else if s.stdin != nil {
+		cmd.Stdin = s.stdin
+	}
+	cmd.Dir = s.dir
+	if !s.sharedProcessGroup {
+		newProcessGroup(cmd)
+	}
+	if s.cleanEnv {
+		cmd.Env = []string{}
+		propagated := s.propagatedEnv()
+		for _, key := range sortedKeys(propagated) {
+			cmd.Env = append(cmd.Env, key+"="+propagated[key])
+		}
+	} else if len(s.env) > 0 {
+		cmd.Env = os.Environ()
+	}
+	for _, key := range s.envKeys() {
+		cmd.Env = append(cmd.Env, key+"="+s.env[key])
+	}
+	if env := s.portEnv(); len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	return cmd
+}
+
+// envKeys returns the keys of the variables set by WithEnv in a stable order
+func (s *simpleService) envKeys() []string {
+	return sortedKeys(s.env)
+}
+
+// sortedKeys returns the keys of the variables in a stable order
+func sortedKeys(env map[string]string) []string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// propagatedEnv returns the variables of the node copied by WithPropagatedEnv
+// that are not set by WithEnv
+func (s *simpleService) propagatedEnv() map[string]string {
+	env := make(map[string]string)
+	for _, entry := range os.Environ() {
+		key, value, _ := strings.Cut(entry, "=")
+		if _, ok := s.env[key]; !ok && s.propagates(key) {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+// propagates tells whether the variable of the node is copied by
+// WithPropagatedEnv
+func (s *simpleService) propagates(key string) bool {
+	for _, prefix := range s.propagated {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// secretMarkers are the parts of the names of the variables that look like
+// secrets, whose values are never logged
+var secretMarkers = []string{"PASSWORD", "SECRET", "KEY", "MNEMONIC"}
+
+// looksSecret tells whether the name of the variable looks like a secret
+func looksSecret(key string) bool {
+	key = strings.ToUpper(key)
+	for _, marker := range secretMarkers {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// envForLog describes the environment set for the process, which are the
+// variables of WithEnv and the ones copied to a clean environment, hiding the
+// values of the redacted variables and of the ones that look like secrets
+func (s *simpleService) envForLog() string {
+	env := maps.Clone(s.env)
+	if s.cleanEnv {
+		if env == nil {
+			env = make(map[string]string)
+		}
+		maps.Copy(env, s.propagatedEnv())
+	}
+	vars := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		if s.redacted[key] || looksSecret(key) {
+			value = "<redacted>"
+		}
+		vars = append(vars, key+"="+value)
+	}
+	description := "inherited environment"
+	if s.cleanEnv {
+		description = "clean environment"
+	}
+	if len(vars) > 0 {
+		description += " with " + strings.Join(vars, " ")
+	}
+	return description
+}
+
+// argsForLog returns the arguments of the command, hiding the ones that use a
+// redacted variable
+func (s *simpleService) argsForLog(args []string) []string {
+	if len(s.redactedArgs) == 0 {
+		return args
+	}
+	args = slices.Clone(args)
+	for i := range s.redactedArgs {
+		// the first argument is the binary
+		if i+1 < len(args) {
+			args[i+1] = "<redacted>"
+		}
+	}
+	return args
+}
+
+// stdinForLog describes what the process reads from its stdin
+func (s *simpleService) stdinForLog() string {
+	switch {
+	case s.inheritStdin:
+		return "the stdin of the node"
+	case s.stdin != nil:
+		return fmt.Sprintf("a %T", s.stdin)
+	default:
+		return os.DevNull
+	}
+}
+
+func (s *simpleService) Start(ctx context.Context) error {
+	// do not spawn the process when the node is already shutting down
+	if err := ctx.Err(); err != nil {
+		return nil
+	}
+	if s.templateErr != nil {
+		return s.templateErr
+	}
+	filter := logFilterFrom(ctx)
+	cmd := s.command()
+	if err := s.setCredential(cmd); err != nil {
+		return err
+	}
+	if seeker, ok := s.stdin.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind the stdin: %w", err)
+		}
+	}
+	if err := s.passListeners(cmd, filter); err != nil {
+		return err
+	}
+	filterOutput(filter, cmd.Stdout, cmd.Stderr)
+	colorOutput(ctx, cmd.Stdout, cmd.Stderr)
+	if s.logFile != nil {
+		file, err := openRotatingFile(*s.logFile, s.serviceName)
+		if err != nil {
+			return fmt.Errorf("failed to open the log file: %w", err)
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				msg := fmt.Sprintf("%v: failed to close %v: %v", s.String(), file.path, err)
+				filter.log(logger.Warning, msg)
+			}
+		}()
+		cmd.Stdout, cmd.Stderr = s.teeOutput(cmd.Stdout, file), s.teeOutput(cmd.Stderr, file)
+	}
+	if s.script != "" {
+		filter.log(logger.Debug, fmt.Sprintf("%v: running the script %v", s.String(),
+			s.script))
+	} else {
+		filter.log(logger.Debug, fmt.Sprintf("%v: running %v", s.String(),
+			commandLine(s.argsForLog(cmd.Args))))
+	}
+	filter.log(logger.Debug, fmt.Sprintf("%v: using %v", s.String(), s.envForLog()))
+	filter.log(logger.Debug, fmt.Sprintf("%v: reading stdin from %v", s.String(),
+		s.stdinForLog()))
+	if !s.limits.empty() {
+		filter.log(logger.Info, fmt.Sprintf("%v: limiting the %v", s.String(), s.limits),
+			"service", s.String(), "event", "limited")
+	}
+	if s.credential != nil {
+		filter.log(logger.Info, fmt.Sprintf("%v: running as %v", s.String(), s.credential),
+			"service", s.String(), "event", "credential")
+	}
+	cmd, err := s.startRetrying(ctx, cmd, filter)
+	if err != nil {
+		if cmd.Process != nil {
+			_ = killProcess(cmd, !s.sharedProcessGroup)
+			_ = cmd.Wait()
+		}
+		if errors.Is(err, errStartCanceled) {
+			return nil
+		}
+		return err
+	}
+	startedAt := time.Now()
+	s.running.Store(true)
+	s.pid.Store(int64(cmd.Process.Pid))
+	s.process.Store(cmd.Process)
+	defer func() {
+		s.running.Store(false)
+		s.pid.Store(0)
+		s.process.Store(nil)
+	}()
+
+	stopSignal := s.stopSignal
+	if stopSignal == nil {
+		stopSignal = defaultStopSignal
+	}
+	// the goroutine that stops the process must never outlive it
+	exited := make(chan struct{})
+	stopperDone := make(chan struct{})
+	var signaled, killed atomic.Bool
+	go func() {
+		defer close(stopperDone)
+		select {
+		case <-ctx.Done():
+		case <-exited:
+			return
+		}
+		filter.log(logger.Debug, fmt.Sprintf("%v: %v", s.String(), ctx.Err()))
+		s.runPreStop(ctx, filter)
+		select {
+		case <-exited:
+			return
+		default:
+		}
+		signaled.Store(true)
+		filter.log(logger.Debug, fmt.Sprintf("%v: sending %v", s.String(), stopSignal),
+			"service", s.String(), "event", "signaled", "signal", stopSignal.String())
+		addServiceEvent(ctx, "signal_sent", s.String(),
+			attribute.String("signal", stopSignal.String()))
+		publishSignal(ctx, stopSignal)
+		fellBack, err := terminateProcess(cmd, stopSignal, !s.sharedProcessGroup)
+		if err != nil {
+			msg := "%v: failed to send %v to %v"
+			filter.log(logger.Error, fmt.Sprintf(msg, s.String(), stopSignal, s.binaryName))
+		}
+		if fellBack {
+			killed.Store(true)
+			msg := "%v: %v could not receive %v; killed it instead"
+			filter.log(logger.Warning, fmt.Sprintf(msg, s.String(), s.binaryName, stopSignal),
+				"service", s.String(), "event", "killed")
+			publishSignal(ctx, syscall.SIGKILL)
+			return
+		}
+
+		stopTimeout := s.stopTimeout
+		if stopTimeout == 0 {
+			stopTimeout = DefaultStopTimeout
+		}
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			killed.Store(true)
+			msg := "%v: %v did not stop after %v; sending SIGKILL"
+			filter.log(logger.Warning, fmt.Sprintf(msg, s.String(), s.binaryName, stopTimeout),
+				"service", s.String(), "event", "killed")
+			addServiceEvent(ctx, "signal_sent", s.String(),
+				attribute.String("signal", syscall.SIGKILL.String()))
+			publishSignal(ctx, syscall.SIGKILL)
+			if err := killProcess(cmd, !s.sharedProcessGroup); err != nil {
+				msg := "%v: failed to send SIGKILL to %v"
+				filter.log(logger.Error, fmt.Sprintf(msg, s.String(), s.binaryName))
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	s.usage.Store(processUsage(cmd.ProcessState))
+	flushOutput(cmd.Stdout, cmd.Stderr)
+	if errors.Is(err, exec.ErrWaitDelay) {
+		msg := "%v: the output of %v was still open after it exited"
+		filter.log(logger.Warning, fmt.Sprintf(msg, s.String(), s.binaryName))
+		err = nil
+	}
+	close(exited)
+	<-stopperDone
+	if s.script != "" {
+		s.killSurvivors(cmd, filter)
+	}
+	if killed.Load() {
+		return nil
+	}
+	if err != nil && !(signaled.Load() && stoppedBy(cmd.ProcessState, stopSignal)) {
+		return newExitError(s.serviceName, cmd.ProcessState, time.Since(startedAt), err)
+	}
+	return nil
+}
+
+// teeOutput makes the output written to the console also go to the log file.
+// The output only goes to the file unless the config asks for the console
+func (s *simpleService) teeOutput(console io.Writer, file *rotatingFile) io.Writer {
+	if !s.logFile.Console {
+		return teeWriter{file: file}
+	}
+	return teeWriter{console: console, file: file}
+}
+
+// Validate checks that the binary of the service exists and is executable,
+// that its required variables are set, that it may run as its user, and that
+// its probe and its pre-stop hook are well-formed. It also binds the
+// listeners of the service, which are kept until the supervisor releases the
+// service
+func (s *simpleService) Validate() error {
+	var problems []error
+	// the binary may become available while the start is retried
+	if _, err := exec.LookPath(s.binaryName); err != nil && s.startRetry <= 0 {
+		problems = append(problems, fmt.Errorf("missing binary: %w", err))
+	}
+	if s.templateErr != nil {
+		problems = append(problems, s.templateErr)
+	}
+	for _, key := range s.requiredEnv {
+		if _, ok := s.env[key]; ok {
+			continue
+		}
+		if _, ok := os.LookupEnv(key); !ok || (s.cleanEnv && !s.propagates(key)) {
+			problems = append(problems, fmt.Errorf("missing variable %v", key))
+		}
+	}
+	if err := checkLimits(s.limits); err != nil {
+		problems = append(problems, err)
+	}
+	if err := s.checkCredential(); err != nil {
+		problems = append(problems, err)
+	}
+	if err := s.bindListeners(); err != nil {
+		problems = append(problems, err)
+	}
+	if validator, ok := s.probe.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid probe: %w", err))
+		}
+	}
+	if s.preStop != nil {
+		if err := s.preStop.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid pre-stop hook: %w", err))
+		}
+	}
+	return joinProblems(problems)
+}
+
+// Ready only checks the probe after the process is spawned, so a stale
+// process from a previous run cannot make the service look ready
+func (s *simpleService) Ready(ctx context.Context) error {
+	if !s.running.Load() {
+		return errors.New("process is not running")
+	}
+	if s.probe == nil {
+		return nil
+	}
+	return s.probe.Ready(ctx)
+}
+
+// Signal sends the signal to the process of the service, which must be
+// running
+func (s *simpleService) Signal(sig os.Signal) error {
+	process := s.process.Load()
+	if process == nil {
+		return errNotRunning
+	}
+	return process.Signal(sig)
+}
+
+// PID returns the id of the process while it runs
+func (s *simpleService) PID() int {
+	return int(s.pid.Load())
+}
+
+// lastUsage returns the resource usage of the last time the process exited
+func (s *simpleService) lastUsage() *ResourceUsage {
+	return s.usage.Load()
+}
+
+func (s *simpleService) String() string {
+	return s.serviceName
+}
+
+// Fingerprint describes the command and the options of the service
+func (s *simpleService) Fingerprint() string {
+	fingerprint := fmt.Sprintf("%q %q %q %v %v %q %v %q %v %v %v %v", s.serviceName,
+		s.binaryName, s.args, s.env, s.cleanEnv, s.requiredEnv, s.redacted, s.dir, s.stopSignal,
+		s.stopTimeout, s.sharedProcessGroup, s.rawOutput)
+	if len(s.propagated) > 0 {
+		fingerprint += fmt.Sprintf(" propagated env %q", s.propagated)
+	}
+	if s.startRetry > 0 {
+		fingerprint += fmt.Sprintf(" start retry %v", s.startRetry)
+	}
+	if !s.limits.empty() {
+		fingerprint += fmt.Sprintf(" %+v", s.limits)
+	}
+	if s.credential != nil {
+		fingerprint += fmt.Sprintf(" %v", s.credential)
+	}
+	if len(s.listeners) > 0 {
+		fingerprint += fmt.Sprintf(" %v", s.listeners)
+	}
+	if len(s.ports) > 0 {
+		fingerprint += fmt.Sprintf(" %+v", s.ports)
+	}
+	if s.inheritStdin {
+		fingerprint += " inherited stdin"
+	} else if s.stdin != nil {
+		fingerprint += fmt.Sprintf(" stdin %T %p", s.stdin, s.stdin)
+	}
+	if s.repeatLimit != nil {
+		fingerprint += fmt.Sprintf(" %+v", *s.repeatLimit)
+	}
+	if s.outputLimit != nil {
+		fingerprint += fmt.Sprintf(" %+v", *s.outputLimit)
+	}
+	if s.capturePrecision > 0 {
+		fingerprint += fmt.Sprintf(" timestamps %v", s.capturePrecision)
+	}
+	if s.logFile != nil {
+		fingerprint += fmt.Sprintf(" %+v", *s.logFile)
+	}
+	if s.probe != nil {
+		fingerprint += fmt.Sprintf(" %T %+v", s.probe, s.probe)
+	}
+	if s.preStop != nil {
+		fingerprint += fmt.Sprintf(" %+v", *s.preStop)
+	}
+	return fingerprint
+}
+
+// commandLine formats the arguments of a command for logging, quoting the ones
+// that would be ambiguous otherwise. The arguments are never interpreted by a
+// shell
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
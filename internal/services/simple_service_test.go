@@ -4,10 +4,17 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -24,7 +31,7 @@ func TestSimpleService(t *testing.T) {
 
 	t.Run("it stops when the context is cancelled", func(t *testing.T) {
 		setup()
-		service := simpleService{
+		service := &simpleService{
 			serviceName: "graphql-server",
 			binaryName:  "cartesi-rollups-graphql-server",
 		}
@@ -32,21 +39,435 @@ func TestSimpleService(t *testing.T) {
 		exit := make(chan error)
 
 		go func() {
-			if err := service.Start(ctx); err != nil {
-				exit <- err
-			}
+			exit <- service.Start(ctx)
 		}()
 
 		<-time.After(100 * time.Millisecond)
 		cancel()
 
-		err := <-exit
-		exitError, ok := err.(*exec.ExitError)
-		if !ok || !assertExitErrorWasCausedBy(exitError, syscall.SIGTERM) {
+		if err := <-exit; err != nil {
 			t.Logf("service exited for the wrong reason: %v", err)
 			t.FailNow()
 		}
 	})
+
+	t.Run("it exits successfully when stopped by its stop signal", func(t *testing.T) {
+		setup()
+		marker := filepath.Join(t.TempDir(), "marker")
+		service := &simpleService{
+			serviceName: "sigint-only",
+			binaryName: writeScript(t, fmt.Sprintf(`
+				trap '' TERM
+				trap 'kill -KILL $!; trap - INT; kill -INT $$' INT
+				sleep 600 &
+				echo started > %v
+				wait
+			`, marker)),
+			stopSignal:  syscall.SIGINT,
+			stopTimeout: 5 * time.Second,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+
+		waitForFileContent(t, marker, "started\n")
+		start := time.Now()
+		cancel()
+
+		if err := <-exit; err != nil {
+			t.Fatalf("expected the service to exit successfully, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the service to stop on SIGINT, took %v", elapsed)
+		}
+	})
+
+	t.Run("it fails when the process is killed by someone else", func(t *testing.T) {
+		setup()
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		service := &simpleService{
+			serviceName: "victim",
+			binaryName:  writeScript(t, fmt.Sprintf("echo $$ > %v; exec sleep 600", pidFile)),
+		}
+		exit := make(chan error)
+
+		go func() {
+			exit <- service.Start(context.Background())
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		var pid int
+		for pid == 0 && time.Now().Before(deadline) {
+			content, _ := os.ReadFile(pidFile)
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := signalPID(pid, syscall.SIGTERM); err != nil {
+			t.Fatalf("failed to kill the process: %v", err)
+		}
+
+		err := <-exit
+		var exitError *exec.ExitError
+		if !errors.As(err, &exitError) || !assertExitErrorWasCausedBy(exitError, syscall.SIGTERM) {
+			t.Fatalf("service exited for the wrong reason: %v", err)
+		}
+	})
+
+	t.Run("it does not start when the context is already canceled", func(t *testing.T) {
+		setup()
+		marker := filepath.Join(t.TempDir(), "marker")
+		service := &simpleService{
+			serviceName: "late",
+			binaryName:  writeScript(t, fmt.Sprintf("echo started > %v", marker)),
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := service.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := os.Stat(marker); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected the process not to run, got %v", err)
+		}
+	})
+
+	t.Run("it stops when the context is canceled right after starting", func(t *testing.T) {
+		setup()
+		for i := 0; i < 20; i++ {
+			service := NewCommandService("sleeper", "sleep", WithArgs("600"))
+			ctx, cancel := context.WithCancel(context.Background())
+			exit := make(chan error)
+
+			go func() {
+				exit <- service.Start(ctx)
+			}()
+			cancel()
+
+			select {
+			case err := <-exit:
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the service did not stop")
+			}
+		}
+	})
+
+	t.Run("it logs the output of the process", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		service := &simpleService{
+			serviceName: "talker",
+			binaryName:  writeScript(t, "echo hello; printf world"),
+		}
+
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := "INFO talker | hello\nINFO talker | world\n"
+		if out.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, out.String())
+		}
+	})
+
+	t.Run("it does not wait for children holding its output", func(t *testing.T) {
+		setup()
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		t.Cleanup(func() {
+			content, _ := os.ReadFile(pidFile)
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+				_ = signalPID(pid, syscall.SIGKILL)
+			}
+		})
+		service := &simpleService{
+			serviceName: "forker",
+			binaryName:  writeScript(t, fmt.Sprintf("sleep 600 & echo $! > %v", pidFile)),
+		}
+
+		start := time.Now()
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > outputWaitDelay+time.Second {
+			t.Fatalf("expected start to return after the process exited, took %v", elapsed)
+		}
+	})
+
+	t.Run("it is ready according to its probe", func(t *testing.T) {
+		probeErr := errors.New("not ready")
+		service := &simpleService{
+			serviceName: "probed",
+			probe:       readinessFunc(func(ctx context.Context) error { return nil }),
+		}
+		if err := service.Ready(context.Background()); err == nil {
+			t.Fatal("expected the service to not be ready before the process is spawned")
+		}
+		service.running.Store(true)
+		if err := service.Ready(context.Background()); err != nil {
+			t.Fatalf("expected the service to be ready, got %v", err)
+		}
+		service.probe = readinessFunc(func(ctx context.Context) error { return probeErr })
+		if err := service.Ready(context.Background()); err != probeErr {
+			t.Fatalf("expected the probe error, got %v", err)
+		}
+		service.probe = nil
+		if err := service.Ready(context.Background()); err != nil {
+			t.Fatalf("expected a service without probe to be ready, got %v", err)
+		}
+	})
+
+	t.Run("it sends SIGKILL after the stop timeout", func(t *testing.T) {
+		setup()
+		service := &simpleService{
+			serviceName: "stubborn",
+			binaryName:  writeStubbornScript(t),
+			stopTimeout: 100 * time.Millisecond,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		exit := make(chan error)
+
+		go func() {
+			exit <- service.Start(ctx)
+		}()
+
+		<-time.After(100 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-exit:
+			if err != nil {
+				t.Fatalf("expected the killed service to exit without error, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("service did not exit after the stop timeout")
+		}
+	})
+}
+
+// readinessFunc adapts a function to the Readiness interface
+type readinessFunc func(ctx context.Context) error
+
+func (f readinessFunc) Ready(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestNewCommandService(t *testing.T) {
+	t.Setenv("CARTESI_TEST_INHERITED", "inherited")
+	service := NewCommandService(
+		"indexer",
+		"/opt/cartesi/bin/cartesi-rollups-indexer",
+		WithArgs("--poll-interval", "5s"),
+		WithEnv(map[string]string{"POSTGRES_DB": "indexer", "CARTESI_TEST_INHERITED": "new"}),
+		WithDir("/var/lib/cartesi"),
+		WithStopSignal(syscall.SIGINT),
+	).(*simpleService)
+
+	cmd := service.command()
+	if cmd.Path != "/opt/cartesi/bin/cartesi-rollups-indexer" {
+		t.Errorf("unexpected path %v", cmd.Path)
+	}
+	expectedArgs := []string{"/opt/cartesi/bin/cartesi-rollups-indexer", "--poll-interval", "5s"}
+	if !reflect.DeepEqual(cmd.Args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, cmd.Args)
+	}
+	if cmd.Dir != "/var/lib/cartesi" {
+		t.Errorf("unexpected dir %v", cmd.Dir)
+	}
+	expectedEnv := append(os.Environ(), "CARTESI_TEST_INHERITED=new", "POSTGRES_DB=indexer")
+	if !reflect.DeepEqual(cmd.Env, expectedEnv) {
+		t.Errorf("expected env %v, got %v", expectedEnv, cmd.Env)
+	}
+	if service.stopSignal != syscall.SIGINT {
+		t.Errorf("unexpected stop signal %v", service.stopSignal)
+	}
+	if _, ok := cmd.Stdout.(*lineWriter); !ok {
+		t.Errorf("expected the output to be logged, got %T", cmd.Stdout)
+	}
+}
+
+func TestCommandServiceRawOutput(t *testing.T) {
+	service := NewCommandService("indexer", "cartesi-rollups-indexer",
+		WithRawOutput()).(*simpleService)
+
+	cmd := service.command()
+	if cmd.Stdout != os.Stdout || cmd.Stderr != os.Stderr {
+		t.Errorf("expected the output to go to the streams of the node")
+	}
+}
+
+func TestCommandServiceEnv(t *testing.T) {
+	env := map[string]string{"POSTGRES_DB": "indexer", "POSTGRES_PASSWORD": "secret"}
+
+	t.Run("it can start from a clean environment", func(t *testing.T) {
+		service := NewCommandService("indexer", "cartesi-rollups-indexer",
+			WithEnv(env), WithCleanEnv()).(*simpleService)
+		expected := []string{"POSTGRES_DB=indexer", "POSTGRES_PASSWORD=secret"}
+		if cmdEnv := service.command().Env; !reflect.DeepEqual(cmdEnv, expected) {
+			t.Errorf("expected env %v, got %v", expected, cmdEnv)
+		}
+	})
+
+	t.Run("it inherits the environment when no variables are set", func(t *testing.T) {
+		service := NewCommandService("indexer", "cartesi-rollups-indexer").(*simpleService)
+		if cmdEnv := service.command().Env; cmdEnv != nil {
+			t.Errorf("expected the environment to be inherited, got %v", cmdEnv)
+		}
+	})
+
+	t.Run("it redacts secrets in the logs", func(t *testing.T) {
+		service := NewCommandService("indexer", "cartesi-rollups-indexer",
+			WithEnv(env), WithRedactedEnv("POSTGRES_PASSWORD")).(*simpleService)
+		expected := "inherited environment with POSTGRES_DB=indexer POSTGRES_PASSWORD=<redacted>"
+		if description := service.envForLog(); description != expected {
+			t.Errorf("expected %q, got %q", expected, description)
+		}
+	})
+
+	t.Run("it propagates the prefixed variables to a clean environment", func(t *testing.T) {
+		t.Setenv("CARTESI_TEST_CHAIN_ID", "31337")
+		t.Setenv("CARTESI_TEST_AUTH_MNEMONIC", "test test junk")
+		t.Setenv("CARTESI_TEST_LOG_LEVEL", "debug")
+		t.Setenv("CARTESITEST", "other")
+		service := NewCommandService("indexer", "cartesi-rollups-indexer",
+			WithEnv(map[string]string{"CARTESI_TEST_LOG_LEVEL": "info"}),
+			WithCleanEnv(), WithRequiredEnv("CARTESI_TEST_CHAIN_ID"),
+			WithPropagatedEnv("CARTESI_TEST_")).(*simpleService)
+		expected := []string{
+			"CARTESI_TEST_AUTH_MNEMONIC=test test junk",
+			"CARTESI_TEST_CHAIN_ID=31337",
+			"CARTESI_TEST_LOG_LEVEL=info",
+		}
+		if cmdEnv := service.command().Env; !reflect.DeepEqual(cmdEnv, expected) {
+			t.Errorf("expected env %v, got %v", expected, cmdEnv)
+		}
+		description := "clean environment with CARTESI_TEST_AUTH_MNEMONIC=<redacted> " +
+			"CARTESI_TEST_CHAIN_ID=31337 CARTESI_TEST_LOG_LEVEL=info"
+		if got := service.envForLog(); got != description {
+			t.Errorf("expected %q, got %q", description, got)
+		}
+		if err := service.Validate(); err != nil && strings.Contains(err.Error(),
+			"missing variable") {
+			t.Errorf("expected the propagated variable to be required, got %v", err)
+		}
+	})
+
+	t.Run("it propagates the variables of the node to its services", func(t *testing.T) {
+		indexer := NewIndexer(IndexerConfig{}).(*simpleService)
+		if !reflect.DeepEqual(indexer.propagated, DefaultPropagatedEnv) {
+			t.Errorf("expected the default prefixes, got %v", indexer.propagated)
+		}
+		none := ProcessConfig{PropagatedEnv: []string{}}
+		indexer = NewIndexer(IndexerConfig{ProcessConfig: none}).(*simpleService)
+		if len(indexer.propagated) != 0 {
+			t.Errorf("expected no prefixes, got %v", indexer.propagated)
+		}
+	})
+
+	t.Run("it redacts the variables that look like secrets in the logs", func(t *testing.T) {
+		service := NewCommandService("indexer", "cartesi-rollups-indexer",
+			WithEnv(map[string]string{"AUTH_PRIVATE_KEY": "0x01", "CHAIN_ID": "1",
+				"db_password": "postgres", "JWT_SECRET": "jwt"})).(*simpleService)
+		expected := "inherited environment with AUTH_PRIVATE_KEY=<redacted> CHAIN_ID=1 " +
+			"JWT_SECRET=<redacted> db_password=<redacted>"
+		if description := service.envForLog(); description != expected {
+			t.Errorf("expected %q, got %q", expected, description)
+		}
+	})
+}
+
+func TestCommandServiceStdin(t *testing.T) {
+
+	// reader creates a service that tells what it read from its stdin by its
+	// exit code
+	reader := func(opts ...CommandOption) Service {
+		opts = append(opts,
+			WithArgs("-test.run=^TestHelperProcess$"),
+			WithEnv(map[string]string{"SERVICES_HELPER_PROCESS": "stdin"}))
+		return NewCommandService("reader", os.Args[0], opts...)
+	}
+
+	// exitCode returns the exit code of the error of the service
+	exitCode := func(err error) int {
+		var exitErr *ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode
+		}
+		return 0
+	}
+
+	t.Run("it closes the stdin by default", func(t *testing.T) {
+		setup()
+		err := reader().Start(context.Background())
+		if code := exitCode(err); code != 3 {
+			t.Fatalf("expected the process to read nothing, got %v", err)
+		}
+	})
+
+	t.Run("it feeds the reader to the stdin", func(t *testing.T) {
+		setup()
+		service := reader(WithStdin(strings.NewReader("secret")))
+		for run := 1; run <= 2; run++ {
+			if err := service.Start(context.Background()); err != nil {
+				t.Fatalf("expected run %v to read the secret, got %v", run, err)
+			}
+		}
+	})
+
+	t.Run("it inherits the stdin of the node", func(t *testing.T) {
+		service := reader(WithStdin(strings.NewReader("secret")), WithInheritedStdin())
+		if cmd := service.(*simpleService).command(); cmd.Stdin != os.Stdin {
+			t.Fatalf("expected the stdin of the node, got %v", cmd.Stdin)
+		}
+	})
+
+	t.Run("it logs where the stdin comes from", func(t *testing.T) {
+		cases := map[string]CommandOption{
+			os.DevNull:              WithCleanEnv(),
+			"the stdin of the node": WithInheritedStdin(),
+			"a *strings.Reader":     WithStdin(strings.NewReader("secret")),
+		}
+		for expected, opt := range cases {
+			service := reader(opt).(*simpleService)
+			if description := service.stdinForLog(); description != expected {
+				t.Errorf("expected %q, got %q", expected, description)
+			}
+		}
+	})
+}
+
+func TestNewGraphQLServer(t *testing.T) {
+	service := NewGraphQLServer(GraphQLServerConfig{
+		Host:            "0.0.0.0",
+		Port:            4001,
+		HealthcheckPort: 8081,
+	}).(*simpleService)
+
+	expectedArgs := []string{
+		"cartesi-rollups-graphql-server",
+		"--graphql-host", "0.0.0.0",
+		"--graphql-port", "4001",
+		"--healthcheck-port", "8081",
+	}
+	if args := service.command().Args; !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, args)
+	}
+	if probe := service.probe.(HttpProbe); probe.URL != "http://127.0.0.1:4001/graphql" {
+		t.Errorf("unexpected probe URL %v", probe.URL)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	args := []string{"indexer", "--name", "two words", "", `say "hi"`}
+	expected := `indexer --name "two words" "" "say \"hi\""`
+	if line := commandLine(args); line != expected {
+		t.Errorf("expected %v, got %v", expected, line)
+	}
 }
 
 func setRustBinariesPath() {
@@ -0,0 +1,88 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// startRetryBackoff is the delay between two attempts to start a process
+// whose binary is unavailable
+var startRetryBackoff = Backoff{
+	Initial: 100 * time.Millisecond,
+	Max:     time.Second,
+	Reset:   time.Hour,
+}
+
+// errStartCanceled is returned by startRetrying when the context is canceled
+// before the process could start
+var errStartCanceled = errors.New("the start was canceled")
+
+// WithStartRetry retries the start of the process for up to deadline while
+// its binary is missing or busy, such as when the binary is on a volume that
+// is mounted after the node starts. Unlike a restart (see [Restart]), the
+// process never ran, so the attempts do not count as failures of the service.
+// The validation of the service does not require the binary then
+func WithStartRetry(deadline time.Duration) CommandOption {
+	return func(s *simpleService) {
+		s.startRetry = deadline
+	}
+}
+
+// retryableStart tells whether the start failed because the binary is not
+// available yet
+func retryableStart(err error) bool {
+	return errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, syscall.ETXTBSY)
+}
+
+// startRetrying starts the command, retrying while its binary is unavailable
+// and the deadline of WithStartRetry has not passed. It returns the command
+// that was last started, which is a copy of cmd when the start was retried
+func (s *simpleService) startRetrying(ctx context.Context, cmd *exec.Cmd,
+	filter *logFilter) (*exec.Cmd, error) {
+	deadline := time.Now().Add(s.startRetry)
+	var delays backoff
+	for attempt := 1; ; attempt++ {
+		err := startLimited(cmd, s.limits)
+		if err == nil || s.startRetry <= 0 || !retryableStart(err) {
+			return cmd, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return cmd, fmt.Errorf("failed to start after retrying for %v: %w", s.startRetry,
+				err)
+		}
+		delay := min(delays.next(startRetryBackoff, 0), remaining)
+		msg := "%v: failed to start %v on attempt %v: %v; retrying in %v"
+		filter.log(logger.Warning, fmt.Sprintf(msg, s.String(), s.binaryName, attempt, err,
+			delay), "service", s.String(), "event", "start_retry", "attempt", attempt)
+		select {
+		case <-ctx.Done():
+			return cmd, errStartCanceled
+		case <-time.After(delay):
+		}
+		cmd = renewCommand(cmd, s.binaryName)
+	}
+}
+
+// renewCommand returns a copy of the command that failed to start, looking up
+// its binary again, since a command cannot be started twice
+func renewCommand(cmd *exec.Cmd, name string) *exec.Cmd {
+	renewed := exec.Command(name)
+	renewed.Args = cmd.Args
+	renewed.Env, renewed.Dir = cmd.Env, cmd.Dir
+	renewed.Stdin, renewed.Stdout, renewed.Stderr = cmd.Stdin, cmd.Stdout, cmd.Stderr
+	renewed.ExtraFiles, renewed.SysProcAttr = cmd.ExtraFiles, cmd.SysProcAttr
+	renewed.WaitDelay = cmd.WaitDelay
+	return renewed
+}
@@ -0,0 +1,107 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestStartRetry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test needs a POSIX shell")
+	}
+
+	t.Run("it starts the binary once it is available", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		dir := t.TempDir()
+		t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		service := NewCommandService("indexer", "cartesi-test-mounted-indexer",
+			WithStartRetry(10*time.Second))
+		if err := Verify([]Service{service}); err != nil {
+			t.Fatalf("expected the missing binary to pass the validation, got %v", err)
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- service.Start(context.Background())
+		}()
+		waitForLog(t, &out, "on attempt 2")
+		// the binary is renamed into place so it is never started half-written
+		binary := filepath.Join(dir, "cartesi-test-mounted-indexer")
+		if err := os.Rename(writeScript(t, "exit 0"), binary); err != nil {
+			t.Fatalf("failed to mount the binary: %v", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("expected the service to start eventually, got %v", err)
+		}
+		if !strings.Contains(out.String(), "indexer: failed to start "+
+			"cartesi-test-mounted-indexer on attempt 1") {
+			t.Fatalf("expected the attempts to be logged, got %q", out.String())
+		}
+	})
+
+	t.Run("it gives up after the deadline", func(t *testing.T) {
+		setup()
+		missing := filepath.Join(t.TempDir(), "indexer")
+		service := NewCommandService("indexer", missing, WithStartRetry(300*time.Millisecond))
+		start := time.Now()
+		err := service.Start(context.Background())
+		if !errors.Is(err, fs.ErrNotExist) ||
+			!strings.Contains(err.Error(), "failed to start after retrying for 300ms") {
+			t.Fatalf("expected the service to fail, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+			t.Fatalf("expected the start to be retried until the deadline, took %v", elapsed)
+		}
+	})
+
+	t.Run("it does not retry without the option", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		service := NewCommandService("indexer", filepath.Join(t.TempDir(), "indexer"))
+		if err := service.Start(context.Background()); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the service to fail, got %v", err)
+		}
+		if out.String() != "" {
+			t.Fatalf("expected no retries, got %q", out.String())
+		}
+	})
+
+	t.Run("it stops retrying when the context is canceled", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		service := NewCommandService("indexer", filepath.Join(t.TempDir(), "indexer"),
+			WithStartRetry(time.Minute))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- service.Start(ctx)
+		}()
+		waitForLog(t, &out, "on attempt 1")
+		cancel()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the service to stop retrying")
+		}
+	})
+}
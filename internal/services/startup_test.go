@@ -0,0 +1,115 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"github.com/cartesi/rollups-node/internal/services/servicestest"
+)
+
+func TestStartupTimeout(t *testing.T) {
+
+	t.Run("it stops the node when the services are not ready in time", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Error = log.New(&out, "ERROR ", 0)
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		database := servicestest.NewFakeService("database")
+		indexer := servicestest.NewFakeService("indexer")
+		graphql := servicestest.NewFakeService("graphql-server")
+		supervisor := NewSupervisor([]Service{database, indexer, graphql}, WithClock(clock),
+			WithStartupTimeout(5*time.Minute), WithStartStagger(time.Minute))
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		database.WaitForStarts(t, 1)
+		database.BecomeReady()
+		// the timeout covers the stagger between the starts
+		clock.WaitFor(t, time.Minute)
+		clock.Advance(time.Minute)
+		indexer.WaitForStarts(t, 1)
+		clock.WaitFor(t, 5*time.Minute)
+		clock.Advance(4 * time.Minute)
+
+		err := <-started
+		if !errors.Is(err, ErrStartupTimeout) {
+			t.Fatalf("expected the startup to time out, got %v", err)
+		}
+		expected := "service 'indexer' was not ready: the startup timed out after 5m0s; " +
+			"service 'graphql-server' was not started: the startup timed out after 5m0s"
+		if err.Error() != expected {
+			t.Fatalf("expected %q, got %q", expected, err.Error())
+		}
+		if graphql.Starts() != 0 || indexer.Running() || database.Running() {
+			t.Fatal("expected the services to be stopped without starting the last one")
+		}
+		cause := supervisor.ShutdownCause()
+		if cause == nil || cause.Reason != ReasonStartupTimeout {
+			t.Fatalf("expected the timeout to begin the shutdown, got %+v", cause)
+		}
+		if !strings.Contains(out.String(), "main: the startup timed out after 5m0s; "+
+			"services not ready: indexer, graphql-server (not started)") {
+			t.Fatalf("expected the services that are not ready to be logged, got %q",
+				out.String())
+		}
+		if code := NodeExitCode(err); code != ExitStartupTimeout {
+			t.Fatalf("expected the exit code of the timeout, got %v", code)
+		}
+	})
+
+	t.Run("it keeps the node running once the services are ready", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{indexer}, WithClock(clock),
+			WithStartupTimeout(time.Minute))
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		indexer.WaitForStarts(t, 1)
+		indexer.BecomeReady()
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		clock.Advance(time.Hour)
+		time.Sleep(10 * time.Millisecond)
+		if !indexer.Running() || supervisor.ShutdownCause() != nil {
+			t.Fatal("expected the node to keep running after the startup")
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it does not bound the startup without a timeout", func(t *testing.T) {
+		setup()
+		clock := servicestest.NewClock(time.Unix(0, 0))
+		indexer := servicestest.NewFakeService("indexer")
+		supervisor := NewSupervisor([]Service{indexer}, WithClock(clock),
+			WithStartupTimeout(0))
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		indexer.WaitForStarts(t, 1)
+		clock.Advance(24 * time.Hour)
+		time.Sleep(10 * time.Millisecond)
+		indexer.BecomeReady()
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,622 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ServiceState is the stage of the lifecycle of a supervised service
+type ServiceState string
+
+const (
+	// StatePending services wait for their dependencies to be ready
+	StatePending ServiceState = "pending"
+
+	// StateStarting services were started but are not ready yet
+	StateStarting ServiceState = "starting"
+
+	// StateReady services became ready after being started
+	StateReady ServiceState = "ready"
+
+	// StateRunning services were restarted after a failure. Their readiness
+	// is not checked again
+	StateRunning ServiceState = "running"
+
+	// StateStopping services were asked to stop and did not exit yet
+	StateStopping ServiceState = "stopping"
+
+	// StateExited services exited successfully
+	StateExited ServiceState = "exited"
+
+	// StateFailed services exited with an error. They may still be restarted
+	StateFailed ServiceState = "failed"
+)
+
+// done reports whether the service is not running in this state
+func (s ServiceState) done() bool {
+	return s == StateExited || s == StateFailed
+}
+
+// A Process is a service backed by a process of the operating system
+type Process interface {
+	// PID returns the id of the process, or zero if it is not running
+	PID() int
+}
+
+// ServiceStatus describes what a supervised service is doing
+type ServiceStatus struct {
+	Name  string
+	State ServiceState
+
+	// Optional is set for the services marked with [Optional] and Fatal for
+	// the ones marked with [Fatal]
+	Optional bool
+	Fatal    bool
+
+	// OneShot is set for the services marked with [OneShot]
+	OneShot bool
+
+	// Since is the time of the last transition of the state
+	Since time.Time
+
+	// StartedAt is when the service was last started or restarted
+	StartedAt time.Time
+
+	// PID is the id of the process of the service, if it is a running
+	// [Process]
+	PID int
+
+	// RSS is the resident set size of the process of the service, in bytes,
+	// as last sampled while it runs (see [WithUsageSampling]). It is zero if
+	// it was not sampled
+	RSS int64
+
+	// Usage is the resource usage of the process of the service the last time
+	// it exited, if it is a [Process]
+	Usage *ResourceUsage
+
+	// Ports are the ports the service binds, if it is a [PortUser], with the
+	// numbers picked by the supervisor
+	Ports []Port
+
+	// Address is the address the service listens on while it runs, if it is
+	// an [HttpService]
+	Address string
+
+	// Binary is the absolute path of the binary of the service and Version is
+	// the version it printed, or unknown, if they were detected (see
+	// [WithBinaryVersions])
+	Binary  string
+	Version string
+
+	// LastError is the last error of the service, including readiness
+	// errors. It is kept after the service recovers
+	LastError error
+
+	// Restarts is how many times the service was restarted after exiting or on
+	// request (see [Supervisor.RestartService])
+	Restarts int
+
+	// Restart is the restart policy that applies to the service
+	Restart RestartPolicy
+
+	// Restarting is set while the service waits to be restarted after it
+	// exited
+	Restarting bool
+
+	// Degraded is how long the service waited to be restarted in total,
+	// including the current wait, while the other services kept running
+	// without it (see [WithRestartOnFailure])
+	Degraded time.Duration
+
+	// degradedSince is when the current wait to be restarted began
+	degradedSince time.Time
+
+	// Liveness is set for the services with liveness checks (see [Liveness]).
+	// LivenessFailures is how many checks the service failed in a row, and
+	// Unresponsive is how many times it was stopped for failing them
+	Liveness         bool
+	LivenessFailures int
+	Unresponsive     int
+
+	// TriggeredShutdown is set for the service whose exit, or whose failure
+	// to become ready, began the shutdown (see [ShutdownCause])
+	TriggeredShutdown bool
+
+	// ExitCode is the exit code of the last time the service exited. Like in
+	// a shell, it is 128 plus the number of the signal for a process that
+	// was killed, and 1 for other errors
+	ExitCode int
+
+	// ExitReason classifies the last time the service exited
+	ExitReason ExitReason
+
+	// StopError is the error of Stop the last time the service, a [Stopper],
+	// was stopped, which was then stopped by canceling its context
+	StopError error
+
+	// Exited is set once the service exited at least once
+	Exited bool
+
+	// killed is set once the service was sent SIGKILL since it last started
+	killed bool
+
+	// ReadyAfter is how long the service took to become ready
+	ReadyAfter time.Duration
+
+	// Dependency is the status of the dependency of a [MonitorService], once
+	// it was checked
+	Dependency *DependencyStatus
+
+	// Members is the status of the members of a [Group]
+	Members []ServiceStatus
+}
+
+// statusBoard keeps the status of the services of a supervisor. It is
+// updated where the transitions are logged and may be read concurrently
+type statusBoard struct {
+	mutex    sync.Mutex
+	clock    Clock
+	services []Service
+	statuses []ServiceStatus
+	removed  []bool
+	events   *eventStream
+
+	// ready is set once all services became ready
+	ready bool
+
+	// cause is what began the shutdown, once it began
+	cause *ShutdownCause
+
+	// marker is the file that exists while the node is ready, if any
+	marker *readyMarker
+}
+
+func newStatusBoard(specs []ServiceSpec, clock Clock, events *eventStream) *statusBoard {
+	now := clock.Now()
+	services := make([]Service, len(specs))
+	statuses := make([]ServiceStatus, len(specs))
+	for i, spec := range specs {
+		services[i] = spec.Service
+		statuses[i] = pendingStatus(spec, now)
+	}
+	return &statusBoard{
+		clock:    clock,
+		services: services,
+		statuses: statuses,
+		removed:  make([]bool, len(specs)),
+		events:   events,
+	}
+}
+
+// pendingStatus returns the status of a service that was not started yet
+func pendingStatus(spec ServiceSpec, now time.Time) ServiceStatus {
+	return ServiceStatus{
+		Name:     spec.String(),
+		State:    StatePending,
+		Optional: spec.Optional,
+		Fatal:    spec.Fatal,
+		OneShot:  spec.OneShot,
+		Restart:  spec.Restart,
+		Liveness: spec.Liveness != nil,
+		Since:    now,
+	}
+}
+
+// add adds the status of a service added by a reload
+func (b *statusBoard) add(spec ServiceSpec) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.updateMarker()
+	b.services = append(b.services, spec.Service)
+	b.statuses = append(b.statuses, pendingStatus(spec, b.clock.Now()))
+	b.removed = append(b.removed, false)
+}
+
+// replace resets the status of the service at index i, whose definition was
+// changed by a reload
+func (b *statusBoard) replace(i int, spec ServiceSpec) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.updateMarker()
+	b.services[i] = spec.Service
+	b.statuses[i] = pendingStatus(spec, b.clock.Now())
+	b.removed[i] = false
+}
+
+// remove hides the status of the service at index i, which was removed by a
+// reload
+func (b *statusBoard) remove(i int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.updateMarker()
+	b.removed[i] = true
+}
+
+// set changes the state of the service at index i, recording err if it is
+// not nil, and publishes the transition. Services that are done only leave
+// that state when restarted or started again, so a late readiness or stop
+// does not hide that they exited
+func (b *statusBoard) set(i int, state ServiceState, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.updateMarker()
+	status := &b.statuses[i]
+	// any transition ends the wait for a restart, including the shutdown
+	if !status.degradedSince.IsZero() {
+		status.Degraded += b.clock.Now().Sub(status.degradedSince)
+		status.degradedSince = time.Time{}
+	}
+	restarted := state == StateRunning || state == StateStarting
+	if status.State.done() && !restarted && !state.done() {
+		return
+	}
+	if state == StateRunning && status.State.done() {
+		status.Restarts++
+	}
+	if status.State != state {
+		event := ServiceEvent{
+			Service: status.Name,
+			Kind:    eventKinds[state],
+			From:    status.State,
+			To:      state,
+			Time:    b.clock.Now(),
+			Err:     err,
+		}
+		if state.done() {
+			event.ExitReason = status.ExitReason
+		}
+		b.events.publish(event)
+		status.State = state
+		status.Since = b.clock.Now()
+		status.Restarting = false
+		if state == StateStarting || state == StateRunning {
+			status.LivenessFailures = 0
+			status.killed = false
+		}
+		if state == StateStarting || state == StateRunning {
+			status.StartedAt = status.Since
+		}
+		if state == StateStarting {
+			status.StopError = nil
+		}
+		if state == StateReady {
+			status.ReadyAfter = status.Since.Sub(status.StartedAt)
+		}
+		if state.done() {
+			status.RSS = 0
+			status.Exited = true
+			status.ExitCode = exitCode(err)
+		}
+	}
+	if err != nil {
+		status.LastError = err
+	}
+}
+
+// markReady records that all services became ready. It returns false if they
+// already were
+func (b *statusBoard) markReady() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	defer b.updateMarker()
+	ready := b.ready
+	b.ready = true
+	return !ready
+}
+
+// isReady reports whether all services became ready at some point
+func (b *statusBoard) isReady() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.ready
+}
+
+// setCause records what began the shutdown and flags the service that
+// began it, if any
+func (b *statusBoard) setCause(cause ShutdownCause) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.cause = &cause
+	b.updateMarker()
+	for i := range b.statuses {
+		if cause.Service != "" && b.statuses[i].Name == cause.Service && !b.removed[i] {
+			b.statuses[i].TriggeredShutdown = true
+		}
+	}
+}
+
+// setMarker makes the board keep the ready marker up to date
+func (b *statusBoard) setMarker(marker *readyMarker) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.marker = marker
+	b.updateMarker()
+}
+
+// updateMarker creates the ready marker while the node is ready, which is
+// once all services became ready, until the shutdown begins or a critical
+// service is no longer healthy. The caller must hold the mutex
+func (b *statusBoard) updateMarker() {
+	if b.marker == nil {
+		return
+	}
+	ready := b.ready && b.cause == nil
+	for i, status := range b.statuses {
+		ready = ready && (b.removed[i] || healthy(status))
+	}
+	b.marker.update(ready, b.clock.Now())
+}
+
+// removeMarker removes the ready marker once the supervisor is done
+func (b *statusBoard) removeMarker() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.marker.update(false, b.clock.Now())
+	b.marker = nil
+}
+
+// shutdownCause returns a copy of what began the shutdown, if it began
+func (b *statusBoard) shutdownCause() *ShutdownCause {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.cause == nil {
+		return nil
+	}
+	cause := *b.cause
+	return &cause
+}
+
+// exitCode returns the exit code of a service that exited with err
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	var serviceExit *ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr):
+		status, ok := exitErr.Sys().(syscall.WaitStatus)
+		if ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	case errors.As(err, &serviceExit) && serviceExit.ExitCode > 0:
+		// containers report their exit codes like a shell
+		return serviceExit.ExitCode
+	default:
+		return 1
+	}
+}
+
+// publish publishes an event of the service at index i that does not change
+// its state
+func (b *statusBoard) publish(i int, kind EventKind, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := b.statuses[i]
+	if kind == EventRestartScheduled {
+		b.statuses[i].Restarting = true
+		b.statuses[i].degradedSince = b.clock.Now()
+	}
+	b.events.publish(ServiceEvent{
+		Service: status.Name,
+		Kind:    kind,
+		From:    status.State,
+		To:      status.State,
+		Time:    b.clock.Now(),
+		Err:     err,
+	})
+}
+
+// signaled publishes that the service at index i was sent the signal
+func (b *statusBoard) signaled(i int, sig os.Signal) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if sig == syscall.SIGKILL {
+		b.statuses[i].killed = true
+	}
+	status := b.statuses[i]
+	b.events.publish(ServiceEvent{
+		Service: status.Name,
+		Kind:    EventSignalSent,
+		From:    status.State,
+		To:      status.State,
+		Time:    b.clock.Now(),
+		Signal:  sig,
+	})
+}
+
+// livenessFailed records how many liveness checks the service at index i
+// failed in a row, publishing the failure if there is one
+func (b *statusBoard) livenessFailed(i int, failures int, err error) {
+	b.mutex.Lock()
+	b.statuses[i].LivenessFailures = failures
+	b.mutex.Unlock()
+	if err != nil {
+		b.publish(i, EventLivenessFailed, err)
+	}
+}
+
+// unresponsive records that the service at index i is stopped for failing
+// its liveness checks
+func (b *statusBoard) unresponsive(i int, err error) {
+	b.mutex.Lock()
+	b.statuses[i].Unresponsive++
+	b.statuses[i].LastError = err
+	b.mutex.Unlock()
+	b.publish(i, EventUnresponsive, err)
+}
+
+// restarted counts a restart of the service at index i that was requested
+// through [Supervisor.RestartService]
+func (b *statusBoard) restarted(i int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.statuses[i].Restarts++
+}
+
+// exited records that the service at index i exited with err for the reason
+func (b *statusBoard) exited(i int, reason ExitReason, err error) {
+	b.mutex.Lock()
+	b.statuses[i].ExitReason = reason
+	b.mutex.Unlock()
+	if err != nil {
+		b.set(i, StateFailed, err)
+	} else {
+		b.set(i, StateExited, nil)
+	}
+}
+
+// stopFailed records the error of Stop of the service at index i
+func (b *statusBoard) stopFailed(i int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.statuses[i].StopError = err
+}
+
+// wasKilled reports whether the service at index i was sent SIGKILL since it
+// last started
+func (b *statusBoard) wasKilled(i int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.statuses[i].killed
+}
+
+// state returns the state of the service at index i
+func (b *statusBoard) state(i int) ServiceState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.statuses[i].State
+}
+
+// fail records the error of the service at index i without changing its
+// state
+func (b *statusBoard) fail(i int, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.statuses[i].LastError = err
+}
+
+// snapshot returns a copy of the statuses of the services that were not
+// removed
+func (b *statusBoard) snapshot() []ServiceStatus {
+	b.mutex.Lock()
+	now := b.clock.Now()
+	services := make([]Service, 0, len(b.services))
+	statuses := make([]ServiceStatus, 0, len(b.statuses))
+	for i, status := range b.statuses {
+		if !status.degradedSince.IsZero() {
+			status.Degraded += now.Sub(status.degradedSince)
+		}
+		if !b.removed[i] {
+			services = append(services, b.services[i])
+			statuses = append(statuses, status)
+		}
+	}
+	b.mutex.Unlock()
+	for i, service := range services {
+		if process, ok := service.(Process); ok && !statuses[i].State.done() {
+			statuses[i].PID = process.PID()
+		}
+		if reporter, ok := service.(usageReporter); ok {
+			statuses[i].Usage = reporter.lastUsage()
+		}
+		if reporter, ok := service.(versionReporter); ok {
+			if version := reporter.binaryVersion(); version != nil {
+				statuses[i].Binary = version.path
+				statuses[i].Version = version.version
+			}
+		}
+		if user, ok := service.(PortUser); ok {
+			statuses[i].Ports = user.Ports()
+		}
+		if reporter, ok := service.(addressReporter); ok && !statuses[i].State.done() {
+			if addr := reporter.Addr(); addr != nil {
+				statuses[i].Address = addr.String()
+			}
+		}
+		if monitor, ok := service.(*MonitorService); ok {
+			statuses[i].Dependency = monitor.Dependency()
+		}
+		if group, ok := service.(*Group); ok {
+			statuses[i].Members = group.Status()
+		}
+	}
+	return statuses
+}
+
+// serviceStatus updates the status of a single service
+type serviceStatus struct {
+	board *statusBoard
+	index int
+}
+
+func (s serviceStatus) set(state ServiceState, err error) {
+	s.board.set(s.index, state, err)
+}
+
+func (s serviceStatus) publish(kind EventKind, err error) {
+	s.board.publish(s.index, kind, err)
+}
+
+func (s serviceStatus) signaled(sig os.Signal) {
+	s.board.signaled(s.index, sig)
+}
+
+func (s serviceStatus) exited(reason ExitReason, err error) {
+	s.board.exited(s.index, reason, err)
+}
+
+func (s serviceStatus) wasKilled() bool {
+	return s.board.wasKilled(s.index)
+}
+
+func (s serviceStatus) state() ServiceState {
+	return s.board.state(s.index)
+}
+
+func (s serviceStatus) livenessFailed(failures int, err error) {
+	s.board.livenessFailed(s.index, failures, err)
+}
+
+func (s serviceStatus) unresponsive(err error) {
+	s.board.unresponsive(s.index, err)
+}
+
+type serviceStatusKey struct{}
+
+// withServiceStatus returns a context that carries the status of the service
+// started with it, so the service can publish its own events
+func withServiceStatus(ctx context.Context, status serviceStatus) context.Context {
+	return context.WithValue(ctx, serviceStatusKey{}, status)
+}
+
+// publishSignal publishes that the service started with ctx was sent the
+// signal. It does nothing for the services started outside a supervisor
+func publishSignal(ctx context.Context, sig os.Signal) {
+	if status, ok := ctx.Value(serviceStatusKey{}).(serviceStatus); ok {
+		status.signaled(sig)
+	}
+}
+
+type statusBoardKey struct{}
+
+// withStatusBoard returns a context that carries the status board of the
+// supervisor, so the built-in services can report on the other ones
+func withStatusBoard(ctx context.Context, board *statusBoard) context.Context {
+	return context.WithValue(ctx, statusBoardKey{}, board)
+}
+
+// statusBoardFrom returns the status board carried by the context, if any
+func statusBoardFrom(ctx context.Context) *statusBoard {
+	board, _ := ctx.Value(statusBoardKey{}).(*statusBoard)
+	return board
+}
@@ -0,0 +1,188 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSupervisorStatus(t *testing.T) {
+
+	t.Run("it reports the state of the services", func(t *testing.T) {
+		setup()
+		ready := make(chan struct{})
+		stop := make(chan struct{})
+		first := testService{name: "first", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			<-stop
+			return nil
+		}}
+		second := readyTestService{
+			testService: testService{name: "second", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			ready: func(ctx context.Context) error {
+				select {
+				case <-ready:
+					return nil
+				default:
+					return errors.New("not ready")
+				}
+			},
+		}
+		third := DependsOn(testService{name: "third", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}, "second")
+		supervisor := NewSupervisor([]Service{first, second, third})
+		if status := supervisor.Status(); status != nil {
+			t.Fatalf("expected no status before Start, got %v", status)
+		}
+
+		go func() { _ = supervisor.Start(context.Background()) }()
+		waitForStates(t, supervisor, StateReady, StateStarting, StatePending)
+
+		close(ready)
+		waitForStates(t, supervisor, StateReady, StateReady, StateReady)
+
+		go func() { _ = supervisor.Stop(context.Background()) }()
+		waitForStates(t, supervisor, StateStopping, StateExited, StateExited)
+
+		close(stop)
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		for _, status := range supervisor.Status() {
+			if status.State != StateExited || status.Since.IsZero() || status.LastError != nil {
+				t.Errorf("unexpected status %+v", status)
+			}
+		}
+	})
+
+	t.Run("it reports the restarts and the last error", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		attempts := 0
+		flaky := testService{name: "flaky", start: func(ctx context.Context) error {
+			attempts++
+			if attempts <= 2 {
+				return boom
+			}
+			<-ctx.Done()
+			return nil
+		}}
+		backoff := Backoff{Initial: time.Millisecond, Max: time.Millisecond, Reset: time.Minute}
+		supervisor := NewSupervisor([]Service{flaky}, WithRestartOnFailure(backoff))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background())
+
+		waitForStates(t, supervisor, StateRunning)
+		deadline := time.Now().Add(time.Second)
+		for supervisor.Status()[0].Restarts != 2 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected 2 restarts, got %+v", supervisor.Status()[0])
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if status := supervisor.Status()[0]; !errors.Is(status.LastError, boom) {
+			t.Fatalf("expected the last error to be kept, got %v", status.LastError)
+		}
+	})
+
+	t.Run("it reports the services that failed", func(t *testing.T) {
+		setup()
+		boom := errors.New("boom")
+		failing := testService{name: "failing", start: func(ctx context.Context) error {
+			return boom
+		}}
+		supervisor := NewSupervisor([]Service{failing})
+		_ = supervisor.Start(context.Background())
+
+		if err := supervisor.Wait(); !errors.Is(err, boom) {
+			t.Fatalf("expected the error of the service, got %v", err)
+		}
+		status := supervisor.Status()[0]
+		if status.State != StateFailed || !errors.Is(status.LastError, boom) {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	})
+
+	t.Run("it reports the exit code of the services", func(t *testing.T) {
+		setup()
+		failing := &simpleService{serviceName: "failing", binaryName: writeScript(t, "exit 3")}
+		supervisor := NewSupervisor([]Service{failing})
+		_ = supervisor.Start(context.Background())
+		_ = supervisor.Wait()
+
+		status := supervisor.Status()[0]
+		if !status.Exited || status.ExitCode != 3 {
+			t.Fatalf("expected exit code 3, got %+v", status)
+		}
+	})
+
+	t.Run("it can be read while the services start and stop", func(t *testing.T) {
+		setup()
+		var list []Service
+		for _, name := range []string{"a", "b", "c", "d"} {
+			list = append(list, testService{name: name, start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}})
+		}
+		supervisor := NewSupervisor(list)
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					for _, status := range supervisor.Status() {
+						_ = status.State
+					}
+				}
+			}
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		close(done)
+		wg.Wait()
+	})
+}
+
+// waitForStates waits for the services of the supervisor to be in the given
+// states, failing the test after a second
+func waitForStates(t *testing.T, supervisor *Supervisor, states ...ServiceState) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		statuses := supervisor.Status()
+		matches := len(statuses) == len(states)
+		for i := 0; matches && i < len(states); i++ {
+			matches = statuses[i].State == states[i]
+		}
+		if matches {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the states %v, got %+v", states, statuses)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,92 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// ErrStopFailed is wrapped by the error of Run for each [Stopper] whose Stop
+// failed or did not return before its deadline
+var ErrStopFailed = errors.New("failed to stop")
+
+// Stopper is implemented by the services that have their own shutdown
+// protocol, such as flushing their buffers or closing their pools in order.
+// At the shutdown, the supervisor calls Stop instead of canceling the context
+// of Start, and only cancels it once Stop returns. The context of Stop has
+// the deadline of the step of the service, bounded by what is left of the
+// shutdown (see [WithStopStepTimeout]). When Stop fails or does not return by
+// then, the failure is logged and kept apart from the errors of Start, and
+// the context of Start is canceled as for any other service
+type Stopper interface {
+	// Stop asks the service to stop and waits until Start is about to return
+	// or ctx is done. It is called while Start runs, or between its restarts
+	Stop(ctx context.Context) error
+}
+
+// serviceStop reports that Stop of the service at the given index in the list
+// passed to Run returned
+type serviceStop struct {
+	index int
+	err   error
+}
+
+// stopService asks the service at index i to stop. A [Stopper] is asked
+// through Stop first, whose result is sent to results unless the shutdown
+// finished, while any other service is canceled at once
+func (s *supervisor) stopService(i int, results chan<- serviceStop, finished <-chan struct{}) {
+	stopper, ok := s.specs[i].Service.(Stopper)
+	if !ok {
+		s.cancels[i]()
+		return
+	}
+	timeout := s.config.stopStepTimeout
+	if shutdown, ok := s.deadline.remaining(); ok && shutdown < timeout {
+		timeout = shutdown
+	}
+	ctx := withLogFilter(context.WithoutCancel(s.servicesCtx), s.filters[i])
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		defer cancel()
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- callStop(ctx, stopper)
+		}()
+		var err error
+		select {
+		case err = <-stopped:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		select {
+		case results <- serviceStop{index: i, err: err}:
+		case <-finished:
+		}
+	}()
+}
+
+// handleStop cancels the context of the service once its Stop returned, which
+// only releases what is left of a service that stopped. The failure of Stop
+// is kept as the error of the service and in its status
+func (s *supervisor) handleStop(e serviceStop) {
+	if e.err != nil {
+		name := s.specs[e.index].String()
+		err := fmt.Errorf("service '%v' %w: %w", name, ErrStopFailed, e.err)
+		s.recordError(e.index, err)
+		s.status.stopFailed(e.index, e.err)
+		s.filters[e.index].log(logger.Warning, fmt.Sprintf("main: %v; canceling it", err),
+			"service", name, "event", "stop_failed", "error", e.err)
+	}
+	s.cancels[e.index]()
+}
+
+// callStop calls Stop, returning a panic as a [PanicError]
+func callStop(ctx context.Context, stopper Stopper) (err error) {
+	defer recoverPanic(&err)
+	return stopper.Stop(ctx)
+}
@@ -0,0 +1,180 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// stopperService is a test service with its own shutdown protocol
+type stopperService struct {
+	testService
+	stop func(ctx context.Context) error
+}
+
+func (s stopperService) Stop(ctx context.Context) error {
+	return s.stop(ctx)
+}
+
+func TestStopper(t *testing.T) {
+
+	t.Run("it calls Stop before canceling the context", func(t *testing.T) {
+		setup()
+		contexts := make(chan context.Context, 1)
+		flushed := make(chan struct{})
+		var canceled bool
+		var budget time.Duration
+		service := stopperService{
+			testService: testService{name: "writer", start: func(ctx context.Context) error {
+				contexts <- ctx
+				<-flushed
+				return nil
+			}},
+			stop: func(ctx context.Context) error {
+				canceled = (<-contexts).Err() != nil
+				deadline, _ := ctx.Deadline()
+				budget = time.Until(deadline)
+				close(flushed)
+				return nil
+			},
+		}
+		supervisor := NewSupervisor([]Service{service}, WithStopTimeout(time.Minute),
+			WithStopStepTimeout(time.Hour))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if canceled {
+			t.Fatal("expected the context to be canceled after Stop")
+		}
+		if budget <= 0 || budget > time.Minute {
+			t.Fatalf("expected the deadline of the shutdown, got %v", budget)
+		}
+		if status := supervisor.Status()[0]; status.ExitReason != ExitReasonCanceled {
+			t.Fatalf("expected the service to be canceled, got %v", status.ExitReason)
+		}
+	})
+
+	t.Run("it cancels the context when Stop fails", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		boom := errors.New("boom")
+		service := stopperService{
+			testService: testService{name: "writer", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			stop: func(ctx context.Context) error { return boom },
+		}
+		supervisor := NewSupervisor([]Service{service})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		err := supervisor.Stop(context.Background())
+		if !errors.Is(err, ErrStopFailed) || !errors.Is(err, boom) ||
+			err.Error() != "service 'writer' failed to stop: boom" {
+			t.Fatalf("expected the failure of Stop, got %v", err)
+		}
+		if status := supervisor.Status()[0]; !errors.Is(status.StopError, boom) ||
+			status.LastError != nil {
+			t.Fatalf("expected the failure of Stop apart from the exit, got %+v", status)
+		}
+		waitForLog(t, &out, "service 'writer' failed to stop: boom; canceling it")
+		waitForLog(t, &out, "exits of the services: writer canceled (stop failed: boom)")
+	})
+
+	t.Run("it cancels the context when Stop does not return in time", func(t *testing.T) {
+		setup()
+		release := make(chan struct{})
+		defer close(release)
+		service := stopperService{
+			testService: testService{name: "writer", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}},
+			stop: func(ctx context.Context) error {
+				<-release
+				return nil
+			},
+		}
+		supervisor := NewSupervisor([]Service{service}, WithStopTimeout(time.Minute),
+			WithStopStepTimeout(50*time.Millisecond))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		start := time.Now()
+		err := supervisor.Stop(context.Background())
+		if !errors.Is(err, ErrStopFailed) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected Stop to time out, got %v", err)
+		}
+		if errors.Is(err, ErrStopTimeout) {
+			t.Fatalf("expected the service to stop once canceled, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("expected the fallback after the step timeout, got %v", elapsed)
+		}
+	})
+
+	t.Run("it recovers from a panic in Stop", func(t *testing.T) {
+		setup()
+		service := stopperService{
+			testService: testService{name: "writer", start: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+			stop: func(ctx context.Context) error { panic("nil pool") },
+		}
+		supervisor := NewSupervisor([]Service{service})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		err := supervisor.Stop(context.Background())
+		if !errors.Is(err, ErrStopFailed) || !errors.Is(err, ErrPanic) ||
+			!strings.Contains(err.Error(), "nil pool") {
+			t.Fatalf("expected the panic of Stop, got %v", err)
+		}
+	})
+
+	t.Run("it does not restart a service that returns once stopped", func(t *testing.T) {
+		setup()
+		starts := make(chan struct{}, 2)
+		stopped := make(chan struct{})
+		service := stopperService{
+			testService: testService{name: "writer", start: func(ctx context.Context) error {
+				starts <- struct{}{}
+				select {
+				case <-stopped:
+				case <-ctx.Done():
+				}
+				return nil
+			}},
+			stop: func(ctx context.Context) error {
+				close(stopped)
+				time.Sleep(20 * time.Millisecond)
+				return nil
+			},
+		}
+		supervisor := NewSupervisor([]Service{Restart(service, RestartAlways)})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(starts) != 1 {
+			t.Fatalf("expected a single start, got %v", len(starts))
+		}
+	})
+}
@@ -0,0 +1,1481 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A RunOption changes the default behavior of Run
+type RunOption func(*runConfig)
+
+type runConfig struct {
+	stopTimeout     time.Duration
+	stopStepTimeout time.Duration
+	stopProgress    time.Duration
+	parallelStop    bool
+	readyTimeout    time.Duration
+	startupTimeout  time.Duration
+	startStagger    time.Duration
+	maxStarting     int
+	restart         *Backoff
+	crashLoop       crashLoopLimit
+	onAllReady      func()
+	readyMarker     string
+	hooks           []Hooks
+	hookTimeout     time.Duration
+	events          *eventStream
+	group           bool
+	signalTargets   map[string]bool
+	reloader        func(ctx context.Context) ([]Service, error)
+	usageInterval   time.Duration
+	heartbeat       time.Duration
+	adminAddress    string
+	skipValidation  bool
+	versionTimeout  time.Duration
+	tracerProvider  trace.TracerProvider
+	clock           Clock
+	journal         *JournalConfig
+	instanceLock    string
+}
+
+// WithStopTimeout sets how long Run waits for the services to stop after the
+// shutdown begins. The default is [DefaultServiceTimeout]
+func WithStopTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.stopTimeout = timeout
+	}
+}
+
+// WithStopStepTimeout sets how long Run waits for each service to stop before
+// moving on to the services it depends on. The shutdown as a whole is still
+// bounded by the stop timeout. The default is [DefaultStopTimeout]
+func WithStopStepTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.stopStepTimeout = timeout
+	}
+}
+
+// DefaultStopProgressInterval is how often Run logs the services that are
+// still stopping during the shutdown by default
+const DefaultStopProgressInterval = 3 * time.Second
+
+// WithStopProgressInterval sets how long Run waits after the shutdown begins
+// to log the services that did not stop yet, with how long it has been
+// waiting for them, and how often it logs them again. Zero disables the logs.
+// The default is [DefaultStopProgressInterval]
+func WithStopProgressInterval(interval time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.stopProgress = interval
+	}
+}
+
+// WithParallelStop makes Run stop all services at once instead of stopping
+// them in the reverse order of their dependencies
+func WithParallelStop() RunOption {
+	return func(c *runConfig) {
+		c.parallelStop = true
+	}
+}
+
+// WithReadyTimeout sets how long Run waits for each service to become ready
+// during the startup, unless the service overrides it. When a service does
+// not become ready in time, Run stops all services and returns
+// [ErrReadyTimeout]. The default is [DefaultReadyTimeout]
+func WithReadyTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.readyTimeout = timeout
+	}
+}
+
+// WithStartupTimeout bounds how long Run waits for all services to become
+// ready, covering the whole startup, including the services that wait for
+// their dependencies or for the stagger (see [WithStartStagger]). When the
+// services are not all ready in time, Run logs the ones that are not, stops
+// all services, and returns [ErrStartupTimeout]. The startup is not bounded
+// when the timeout is zero, which is the default
+func WithStartupTimeout(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.startupTimeout = timeout
+	}
+}
+
+// WithOnAllReady registers a function that Run calls once, after all services
+// became ready for the first time
+func WithOnAllReady(fn func()) RunOption {
+	return func(c *runConfig) {
+		c.onAllReady = fn
+	}
+}
+
+// WithAdminServer makes Run start an admin server that serves the status of
+// the services on the address (see [NewAdminService]). The server is an
+// optional service that comes before the other ones. An empty address means
+// [DefaultAdminAddress]
+func WithAdminServer(address string) RunOption {
+	return func(c *runConfig) {
+		c.adminAddress = address
+		if address == "" {
+			c.adminAddress = DefaultAdminAddress
+		}
+	}
+}
+
+// WithStartStagger makes Run wait for the delay between two launches of
+// services, on top of their dependencies, so they do not all compete for the
+// CPU and the database at once. By default, the services are started as soon
+// as their dependencies are ready
+func WithStartStagger(delay time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.startStagger = delay
+	}
+}
+
+// WithMaxStarting limits how many services may be starting at once, that is,
+// started but not ready yet. Zero, the default, means there is no limit
+func WithMaxStarting(limit int) RunOption {
+	return func(c *runConfig) {
+		c.maxStarting = limit
+	}
+}
+
+// WithRestartOnFailure makes Run restart the services that exit with an error
+// in place, keeping the other services running, instead of stopping the node.
+// The delay between restarts follows the given backoff. The node still stops
+// when a [Fatal] service exits and when a service crash loops (see
+// [WithCrashLoopLimit]), and the shutdown never waits for a pending restart.
+// The time each service spends waiting to be restarted is in its status (see
+// [ServiceStatus.Degraded]). By default, services are not restarted unless
+// they have their own [RestartPolicy]
+func WithRestartOnFailure(backoff Backoff) RunOption {
+	return func(c *runConfig) {
+		c.restart = &backoff
+	}
+}
+
+// WithCrashLoopLimit changes how many times a service may be restarted within
+// the window before Run considers it to be crash looping, stops the node and
+// returns [ErrCrashLoop]. The default is 5 restarts in 2 minutes. A limit of
+// zero disables the detection
+func WithCrashLoopLimit(restarts int, window time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.crashLoop = crashLoopLimit{restarts: restarts, window: window}
+	}
+}
+
+// WithClock replaces the clock Run uses for the shutdown timeouts, the
+// restart backoff, and the other delays of the supervision. The default is
+// the clock of the time package
+func WithClock(clock Clock) RunOption {
+	return func(c *runConfig) {
+		c.clock = clock
+	}
+}
+
+// The Run function serves as a very simple supervisor: it will validate the
+// services provided to it (see [Validator]) and start all of them, each one
+// after the services it depends on are ready (see [ServiceSpec] and
+// [Readiness]). Then it will run until the first critical service finishes
+// (see [Optional]) or until the context is canceled or the node receives
+// SIGINT or SIGTERM. Next it will try to stop the remaining services, each one
+// after the services that depend on it, or timeout if they take too long. A
+// second signal received during the shutdown forces the node to exit
+// immediately.
+//
+// When NOTIFY_SOCKET is set, as it is for systemd units of Type=notify, Run
+// notifies the service manager once all services are ready and when the
+// shutdown begins, along with a summary of the states of the services. If the
+// watchdog of the unit is enabled with WATCHDOG_USEC, Run also pings it while
+// it runs.
+//
+// A service that panics in Start or Ready fails like any other service: the
+// panic is returned as a [PanicError], whose message includes the stack of
+// the panic, and the other services are stopped.
+//
+// On Unix, the node forwards SIGHUP, SIGUSR1, and SIGUSR2 to the running
+// services that implement [Signaler], such as commands, so they can reload
+// their configuration or rotate their logs without a restart. The signals do
+// not stop the node. See [WithSignalTargets] to forward them to only some of
+// the services.
+//
+// Run returns nil if all services exited successfully. Otherwise, it returns
+// an error that wraps the terminal error of each service that failed,
+// including the ones that failed while they were stopped, the ones whose
+// Stop failed (see [Stopper]), and the ones that did not stop before the
+// timeout (see [ErrStopTimeout]), so each of them can be inspected with
+// [errors.Is] and [errors.As]. Its message lists them in the order of the
+// services
+func Run(ctx context.Context, services []Service, opts ...RunOption) error {
+	supervisor := NewSupervisor(services, opts...)
+	if err := supervisor.Start(ctx); err != nil {
+		return err
+	}
+	return supervisor.Wait()
+}
+
+// ErrStopped is returned by Supervisor.Start after Supervisor.Stop was called
+var ErrStopped = errors.New("supervisor was stopped")
+
+// ErrStopTimeout is wrapped by the error of Run for each service that was
+// still running when the stop timeout expired
+var ErrStopTimeout = errors.New("did not stop in time")
+
+// ErrStartupTimeout is wrapped by the error of Run for each service that was
+// not ready when the startup timeout expired (see [WithStartupTimeout])
+var ErrStartupTimeout = errors.New("the startup timed out")
+
+// ErrNeverReady is returned by Supervisor.ReadyErr when the supervisor
+// finished before all services were ready
+var ErrNeverReady = errors.New("the supervisor finished before the services were ready")
+
+// Supervisor runs the services like [Run] without blocking the caller. It is
+// safe to call its methods from multiple goroutines
+type Supervisor struct {
+	services []Service
+	opts     []RunOption
+
+	mutex    sync.Mutex
+	started  bool
+	stopped  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	signals  chan os.Signal
+	reloads  chan reloadRequest
+	restarts chan restartRequest
+	rollings chan chan<- rollingResult
+	signaled chan signalRequest
+	done     chan struct{}
+	err      error
+	status   *statusBoard
+	events   *eventStream
+	lock     *instanceLock
+
+	allReady  chan struct{}
+	readyOnce sync.Once
+	readyErr  error
+}
+
+// NewSupervisor creates a supervisor for the services. The options are the
+// same as the ones of [Run]
+func NewSupervisor(services []Service, opts ...RunOption) *Supervisor {
+	return &Supervisor{
+		services: services,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		signals:  make(chan os.Signal, 1),
+		reloads:  make(chan reloadRequest),
+		restarts: make(chan restartRequest),
+		rollings: make(chan chan<- rollingResult),
+		signaled: make(chan signalRequest),
+		done:     make(chan struct{}),
+		events:   newEventStream(DefaultEventBuffer),
+		allReady: make(chan struct{}),
+	}
+}
+
+// Start starts the services in the background and returns once all of them
+// are ready. The supervisor keeps running until ctx is canceled, Stop is
+// called, or a critical service exits. If it finishes before the services are
+// ready, Start returns its error, which may be nil. Start may only be called
+// once, and not after Stop
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		return ErrStopped
+	}
+	if s.started {
+		s.mutex.Unlock()
+		return errors.New("supervisor was already started")
+	}
+	s.started = true
+	s.mutex.Unlock()
+
+	supervisor, err := s.prepare()
+	if err != nil {
+		s.finish(err)
+		return err
+	}
+	s.mutex.Lock()
+	s.status = supervisor.status
+	s.mutex.Unlock()
+	supervisor.onReady = func() { s.closeReady(nil) }
+	supervisor.stop = s.stop
+	supervisor.signals = s.signals
+	supervisor.reloads = s.reloads
+	supervisor.restarts = s.restarts
+	supervisor.rollingRestarts = s.rollings
+	supervisor.signalRequests = s.signaled
+	go func() {
+		s.finish(supervisor.run(ctx))
+	}()
+	<-s.allReady
+	if s.readyErr != nil {
+		return s.err
+	}
+	return nil
+}
+
+// prepare validates the services and creates the supervisor that runs them
+func (s *Supervisor) prepare() (*supervisor, error) {
+	if err := checkServices(s.services); err != nil {
+		return nil, err
+	}
+	config := runConfig{
+		stopTimeout:     DefaultServiceTimeout,
+		stopStepTimeout: DefaultStopTimeout,
+		stopProgress:    DefaultStopProgressInterval,
+		readyTimeout:    DefaultReadyTimeout,
+		hookTimeout:     DefaultHookTimeout,
+		crashLoop:       defaultCrashLoopLimit,
+		clock:           realClock{},
+		events:          s.events,
+	}
+	for _, opt := range s.opts {
+		opt(&config)
+	}
+	if config.instanceLock != "" {
+		lock, err := acquireInstanceLock(config.instanceLock)
+		if errors.Is(err, ErrInstanceLocked) {
+			return nil, err
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to acquire the instance lock: %w", err)
+		}
+		s.lock = lock
+	}
+	if config.journal != nil {
+		journal, err := openJournal(*config.journal)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the journal: %w", err)
+		}
+		s.events.record(journal)
+	}
+	services := s.services
+	var status *statusBoard
+	if config.adminAddress != "" {
+		admin := newAdminService(config.adminAddress, func() []ServiceStatus {
+			return status.snapshot()
+		})
+		admin.restart = s.RestartService
+		admin.rollingRestart = s.RollingRestart
+		admin.signal = s.SignalService
+		services = append([]Service{Optional(admin)}, services...)
+	}
+	specs := make([]ServiceSpec, len(services))
+	for i, service := range services {
+		specs[i] = specOf(service)
+		specs[i].Restart = config.restartPolicy(specs[i])
+	}
+	deps, err := resolveDependencies(specs)
+	if err != nil {
+		return nil, err
+	}
+	if err := assignPorts(specs); err != nil {
+		return nil, err
+	}
+	if !config.skipValidation {
+		if err := validateServices(specs); err != nil {
+			if !config.group {
+				releaseServices(specs)
+			}
+			return nil, err
+		}
+	}
+	if config.versionTimeout > 0 {
+		logBinaryVersions(specs, config.versionTimeout)
+	}
+	supervisor := newSupervisor(specs, deps, &config)
+	supervisor.builtin = len(services) - len(s.services)
+	status = supervisor.status
+	return supervisor, nil
+}
+
+func (s *Supervisor) finish(err error) {
+	s.err = err
+	if err != nil {
+		s.closeReady(fmt.Errorf("%w: %w", ErrNeverReady, err))
+	} else {
+		s.closeReady(ErrNeverReady)
+	}
+	s.events.publish(ServiceEvent{Kind: EventShutdownCompleted, Time: time.Now(), Err: err})
+	s.events.close()
+	if err := s.lock.release(); err != nil {
+		msg := fmt.Sprintf("main: failed to release the instance lock %v: %v", s.lock.path, err)
+		logger.Log(logger.Warning, msg, "event", "instance_lock_error", "error", err)
+	}
+	close(s.done)
+}
+
+// Stop begins the shutdown of the services and waits for it to finish or for
+// ctx to be done, in which case it returns the error of ctx. Otherwise, it
+// returns the same error as Wait. Calling Stop before Start finishes stops the
+// services that were started, and calling it before Start prevents the
+// supervisor from starting
+func (s *Supervisor) Stop(ctx context.Context) error {
+	s.mutex.Lock()
+	s.stopped = true
+	if !s.started {
+		s.started = true
+		s.finish(nil)
+	}
+	s.mutex.Unlock()
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns a snapshot of the status of the services, in the order they
+// were given to NewSupervisor after the admin server, if it is enabled. It
+// returns nil before Start is called
+func (s *Supervisor) Status() []ServiceStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	return s.status.snapshot()
+}
+
+// ShutdownCause returns what began the shutdown of the services, or nil
+// before it begins and when the services finished on their own
+func (s *Supervisor) ShutdownCause() *ShutdownCause {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	return s.status.shutdownCause()
+}
+
+// Events returns a channel of the transitions of the services and of the
+// supervisor itself, in the order they happened. The channel is closed after
+// [EventShutdownCompleted], and it is shared by all the callers of Events.
+//
+// The channel holds [DefaultEventBuffer] events. The supervisor never waits
+// for the consumers: when the channel is full, the oldest event is dropped to
+// make room for the new one (see [Supervisor.DroppedEvents])
+func (s *Supervisor) Events() <-chan ServiceEvent {
+	return s.events.events
+}
+
+// DroppedEvents returns how many events were dropped because the consumers of
+// [Supervisor.Events] fell behind
+func (s *Supervisor) DroppedEvents() uint64 {
+	return s.events.droppedEvents()
+}
+
+// ready reports whether all services became ready
+func (s *Supervisor) ready() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.status != nil && s.status.isReady()
+}
+
+// Ready returns a channel that is closed once all services are ready for the
+// first time, or once the supervisor finishes before that, in which case
+// ReadyErr tells why. The channel is closed exactly once and never reopens:
+// the services that restart or that are added by a reload afterwards are not
+// waited for, and neither are they when they become ready again
+func (s *Supervisor) Ready() <-chan struct{} {
+	return s.allReady
+}
+
+// ReadyErr returns nil while the channel of Ready is open and after all
+// services became ready. When the supervisor finished before the services
+// were ready, it returns [ErrNeverReady], wrapping the error of Wait, if any
+func (s *Supervisor) ReadyErr() error {
+	select {
+	case <-s.allReady:
+		return s.readyErr
+	default:
+		return nil
+	}
+}
+
+// closeReady closes the channel of Ready, unless it was closed already, with
+// the error of ReadyErr
+func (s *Supervisor) closeReady(err error) {
+	s.readyOnce.Do(func() {
+		s.readyErr = err
+		close(s.allReady)
+	})
+}
+
+// Wait blocks until the supervisor finishes and returns its error, as
+// described in [Run]
+func (s *Supervisor) Wait() error {
+	<-s.done
+	return s.err
+}
+
+// supervisor keeps the state of a single Run call. It is only accessed by the
+// goroutine that called Run
+type supervisor struct {
+	config     *runConfig
+	specs      []ServiceSpec
+	deps       [][]int
+	dependents [][]int
+
+	// each service has its own context, so they can be stopped one at a time
+	// regardless of how the supervisor context is canceled
+	servicesCtx  context.Context
+	startedAt    time.Time
+	cancels      []context.CancelFunc
+	readyCancels []context.CancelFunc
+
+	// lastStart is when the last service was started, and staggered fires
+	// when the next one may be started, if the startup is staggered
+	lastStart time.Time
+	staggered <-chan time.Time
+
+	// startupExpired fires when the startup timeout expires, until all
+	// services are ready
+	startupExpired <-chan time.Time
+
+	// deadline is when the shutdown must finish, and outerDeadline is the
+	// deadline of the supervisor of the group, if the services are members
+	deadline      shutdownDeadline
+	outerDeadline *shutdownDeadline
+
+	filtersMutex   sync.Mutex // filters are read by reportDroppedLogs
+	filters        []*logFilter
+	status         *statusBoard
+	notifier       *notifier
+	tracer         trace.Tracer
+	startSpans     []trace.Span // until the services are ready
+	started        []bool
+	settled        []bool // ready, or exited before becoming ready
+	removed        []bool // by a reload
+	generations    []int  // of each start, to ignore stale readiness checks
+	running        map[int]bool
+	exit           chan serviceExit
+	ready          chan serviceReady
+	errs           map[int]error // the terminal error of each service, by index
+	exitedOptional []string
+
+	// cause is what began the shutdown, once it began
+	cause *ShutdownCause
+
+	// onReady is called once all services are ready, and closing stop
+	// begins the shutdown
+	onReady func()
+	stop    <-chan struct{}
+
+	// signals receives the signals to forward to the services
+	signals chan os.Signal
+
+	// reloads receives the new definitions of the services, and reloading is
+	// the reload being applied, if any. The first builtin services were added
+	// by the supervisor itself and are never reloaded
+	reloads   chan reloadRequest
+	reloading *reload
+	builtin   int
+
+	// restarts receives the requests to restart a service, and restarting
+	// are the restarts in progress, by the index of their service.
+	// rollingRestarts receives the requests to restart all services, and
+	// rolling is the rolling restart in progress, if any
+	restarts        chan restartRequest
+	restarting      map[int]*restartRequest
+	rollingRestarts chan chan<- rollingResult
+	rolling         *rollingRestart
+
+	// signalRequests receives the requests to send a signal to a service
+	signalRequests chan signalRequest
+}
+
+func newSupervisor(specs []ServiceSpec, deps [][]int, config *runConfig) *supervisor {
+	filters := make([]*logFilter, len(specs))
+	for i, spec := range specs {
+		filters[i] = newLogFilter(spec.String(), spec.LogLevel)
+	}
+	return &supervisor{
+		config:       config,
+		specs:        specs,
+		deps:         deps,
+		dependents:   dependentsOf(deps),
+		cancels:      make([]context.CancelFunc, len(specs)),
+		readyCancels: make([]context.CancelFunc, len(specs)),
+		filters:      filters,
+		status:       newStatusBoard(specs, config.clock, config.events),
+		tracer:       config.tracer(),
+		startSpans:   make([]trace.Span, len(specs)),
+		started:      make([]bool, len(specs)),
+		settled:      make([]bool, len(specs)),
+		removed:      make([]bool, len(specs)),
+		generations:  make([]int, len(specs)),
+		running:      make(map[int]bool, len(specs)),
+		errs:         make(map[int]error),
+		restarting:   make(map[int]*restartRequest),
+		exit:         make(chan serviceExit, len(specs)),
+		ready:        make(chan serviceReady, len(specs)),
+	}
+}
+
+// dependentsOf returns the dependents of each service given its dependencies
+func dependentsOf(deps [][]int) [][]int {
+	dependents := make([][]int, len(deps))
+	for i, serviceDeps := range deps {
+		for _, dep := range serviceDeps {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+	return dependents
+}
+
+func (s *supervisor) run(ctx context.Context) (err error) {
+	ctx, span := s.tracer.Start(ctx, "supervisor.run")
+	defer func() {
+		for i := range s.specs {
+			s.endStartSpan(i, nil)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	// stop the services when the node is interrupted or terminated, and
+	// forward them the other signals, unless they are the members of a group,
+	// whose supervisor does both instead
+	signalCtx, stopSignals := ctx, func() {}
+	if !s.config.group {
+		signalCtx, stopSignals = signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+		if s.signals != nil && len(forwardedSignals) > 0 {
+			signal.Notify(s.signals, forwardedSignals...)
+			defer signal.Stop(s.signals)
+		}
+	}
+	defer stopSignals()
+
+	// the members of a group are released by the group instead, so they keep
+	// their resources while it restarts
+	if !s.config.group {
+		defer func() {
+			releaseServices(s.specs)
+		}()
+	}
+
+	servicesCtx, cancelServices := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelServices()
+	s.outerDeadline = shutdownDeadlineFrom(ctx)
+	s.servicesCtx = withShutdownDeadline(servicesCtx, &s.deadline)
+	s.startedAt = s.config.clock.Now()
+	defer s.reportDroppedLogs()()
+	if !s.config.group {
+		notifier, notifyErr := newNotifier()
+		if notifyErr != nil {
+			logger.Log(logger.Warning, fmt.Sprintf("main: %v", notifyErr),
+				"event", "notify_failed", "error", notifyErr)
+		}
+		s.notifier = notifier
+	}
+	defer s.notifier.close()
+	if s.config.readyMarker != "" && !s.config.group {
+		s.status.setMarker(newReadyMarker(s.config.readyMarker))
+		defer s.status.removeMarker()
+	}
+	defer s.pingWatchdog()()
+	defer s.sampleUsage()()
+	stopHeartbeat := s.heartbeat()
+	defer stopHeartbeat()
+	defer func() {
+		for _, cancelReady := range s.readyCancels {
+			if cancelReady != nil {
+				cancelReady()
+			}
+		}
+	}()
+
+	// wait for the first critical service to exit, for a service to not
+	// become ready in time, or for the context to be canceled
+	s.logLegend()
+	if s.config.startupTimeout > 0 {
+		s.startupExpired = s.config.clock.After(s.config.startupTimeout)
+	}
+	s.startEligible()
+wait:
+	for len(s.running) > 0 || s.pendingStart() {
+		select {
+		case e := <-s.exit:
+			if s.stoppedToRestart(e.index) {
+				s.restartedExit(e)
+				continue
+			}
+			if s.reloading.replacing(e.index) {
+				s.replacedExit(e)
+				continue
+			}
+			if s.specs[e.index].OneShot && e.err == nil {
+				s.complete(e.index)
+				continue
+			}
+			if s.specs[e.index].Optional {
+				delete(s.running, e.index)
+				name := s.specs[e.index].String()
+				s.exitedOptional = append(s.exitedOptional, name)
+				msg := "main: optional service '%v' exited; keeping the other services running"
+				s.filters[e.index].log(logger.Warning, fmt.Sprintf(msg, name),
+					"service", name, "event", "exited", "optional", true)
+				s.endStartSpan(e.index, errExitedBeforeReady)
+				s.readyCancels[e.index]()
+				s.runExitHooks(e.index, e.err)
+				if s.specs[e.index].OneShot {
+					s.settle(e.index)
+				}
+				continue
+			}
+			// the cause is captured before any other service is stopped
+			reason := ReasonFailed
+			if e.err == nil {
+				reason = ReasonExited
+			}
+			s.beginShutdown(ShutdownCause{Reason: reason, Service: s.specs[e.index].String(),
+				Err: e.err})
+			s.handleExit(e)
+			break wait
+		case r := <-s.ready:
+			if r.generation != s.generations[r.index] {
+				continue
+			}
+			// optional services that exit before becoming ready do not stop
+			// the startup
+			s.endStartSpan(r.index, r.err)
+			if s.running[r.index] {
+				name, filter := s.specs[r.index].String(), s.filters[r.index]
+				if r.err != nil {
+					s.status.fail(r.index, r.err)
+					msg := fmt.Sprintf("main: service '%v' did not become ready: %v", name, r.err)
+					filter.log(logger.Error, msg, "service", name, "event", "not_ready",
+						"error", r.err)
+					err := fmt.Errorf("service '%v' did not become ready: %w", name, r.err)
+					s.recordError(r.index, err)
+					s.failRestart(r.index, err)
+					s.beginShutdown(ShutdownCause{Reason: ReasonNotReady, Service: name,
+						Err: r.err})
+					break wait
+				}
+				s.status.set(r.index, StateReady, nil)
+				filter.log(logger.Info, fmt.Sprintf("main: service '%v' is ready", name),
+					"service", name, "event", "ready")
+				s.runReadyHooks(r.index)
+			}
+			s.settle(r.index)
+		case sig := <-s.signals:
+			if sig == syscall.SIGHUP && s.config.reloader != nil {
+				go s.load()
+				continue
+			}
+			s.forward(sig)
+		case request := <-s.reloads:
+			s.beginReload(request)
+		case request := <-s.restarts:
+			s.beginRestart(request)
+		case result := <-s.rollingRestarts:
+			s.beginRollingRestart(result)
+		case request := <-s.signalRequests:
+			s.signalService(request)
+		case <-s.staggered:
+			s.staggered = nil
+			s.startEligible()
+		case <-s.startupExpired:
+			s.expireStartup()
+			break wait
+		case <-s.stop:
+			logger.Log(logger.Info, "main: stop requested", "event", "stop_requested")
+			s.beginShutdown(ShutdownCause{Reason: ReasonStopped})
+			break wait
+		case <-signalCtx.Done():
+			if ctx.Err() == nil {
+				logger.Log(logger.Info, "main: received termination signal", "event", "signaled")
+				span.AddEvent("signaled")
+				defer forceExitOnSignal()()
+				stopSignals()
+				s.beginShutdown(ShutdownCause{Reason: ReasonSignaled})
+			} else {
+				logger.Log(logger.Info, fmt.Sprintf("main: %v", ctx.Err()),
+					"event", "canceled", "error", ctx.Err())
+				s.beginShutdown(ShutdownCause{Reason: ReasonCanceled, Err: ctx.Err()})
+			}
+			break wait
+		}
+	}
+	s.abortReload()
+	s.abortRestarts()
+	stopHeartbeat()
+	defer func() {
+		if s.cause == nil {
+			return
+		}
+		if err != nil {
+			err = &ShutdownError{Cause: *s.cause, Err: err}
+		}
+		s.logCause()
+	}()
+	if len(s.exitedOptional) > 0 {
+		defer func() {
+			msg := "main: optional services that exited before the shutdown: %v"
+			logger.Log(logger.Info, fmt.Sprintf(msg, strings.Join(s.exitedOptional, ", ")),
+				"services", s.exitedOptional)
+		}()
+	}
+
+	s.notify("STOPPING=1")
+	started := ServiceEvent{Kind: EventShutdownStarted, Time: s.config.clock.Now()}
+	if s.cause != nil {
+		started.Service, started.Err = s.cause.Service, s.cause.Err
+	}
+	s.config.events.publish(started)
+	return s.shutdown()
+}
+
+// expireStartup fails the services that are not ready when the startup
+// timeout expires, and begins the shutdown
+func (s *supervisor) expireStartup() {
+	timeout := s.config.startupTimeout
+	var pending []string
+	for i, spec := range s.specs {
+		if s.settled[i] || s.removed[i] {
+			continue
+		}
+		name := spec.String()
+		if !s.started[i] {
+			pending = append(pending, name+" (not started)")
+			s.recordError(i, fmt.Errorf("service '%v' was not started: %w after %v", name,
+				ErrStartupTimeout, timeout))
+			continue
+		}
+		pending = append(pending, name)
+		err := fmt.Errorf("service '%v' was not ready: %w after %v", name, ErrStartupTimeout,
+			timeout)
+		if s.running[i] {
+			s.status.fail(i, err)
+		}
+		s.recordError(i, err)
+	}
+	msg := fmt.Sprintf("main: the startup timed out after %v; services not ready: %v", timeout,
+		strings.Join(pending, ", "))
+	logger.Log(logger.Error, msg, "event", "startup_timeout", "services", pending)
+	s.beginShutdown(ShutdownCause{Reason: ReasonStartupTimeout,
+		Err: fmt.Errorf("%w after %v", ErrStartupTimeout, timeout)})
+}
+
+// beginShutdown records what began the shutdown
+func (s *supervisor) beginShutdown(cause ShutdownCause) {
+	cause.Time = s.config.clock.Now()
+	s.cause = &cause
+	s.status.setCause(cause)
+}
+
+// logCause logs what began the shutdown once it is over, so it is not lost
+// among the exits of the services. The members of a group leave it to the
+// group
+func (s *supervisor) logCause() {
+	if s.config.group {
+		return
+	}
+	level := logger.Info
+	switch s.cause.Reason {
+	case ReasonFailed, ReasonNotReady, ReasonStartupTimeout:
+		level = logger.Error
+	case ReasonExited:
+		level = logger.Warning
+	}
+	kv := []any{"event", "shutdown_cause", "reason", s.cause.Reason}
+	if s.cause.Service != "" {
+		kv = append(kv, "service", s.cause.Service)
+	}
+	if s.cause.Err != nil {
+		kv = append(kv, "error", s.cause.Err)
+	}
+	logger.Log(level, highlight(fmt.Sprintf("main: shutdown initiated by: %v", s.cause)), kv...)
+}
+
+// notify sends the assignments to the service manager along with a summary of
+// the states of the services
+func (s *supervisor) notify(assignments ...string) {
+	assignments = append(assignments, "STATUS="+statusSummary(s.status.snapshot()))
+	if err := s.notifier.notify(assignments...); err != nil {
+		logger.Log(logger.Debug, fmt.Sprintf("main: failed to notify the service manager: %v",
+			err), "event", "notify_failed", "error", err)
+	}
+}
+
+// pingWatchdog pings the watchdog of the service manager at half of its
+// interval, if it is enabled. It returns a function that stops the pings
+func (s *supervisor) pingWatchdog() func() {
+	if s.notifier == nil || s.notifier.watchdog == 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(s.notifier.watchdog / 2)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				s.notify("WATCHDOG=1")
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// settle records that the service is ready or that it exited without
+// stopping the startup, so the services that depend on it may start
+func (s *supervisor) settle(i int) {
+	s.settled[i] = true
+	if s.reloading != nil {
+		delete(s.reloading.pending, i)
+		defer s.checkReload()
+	}
+	defer s.checkRestart(i)
+	s.startEligible()
+	if s.allReady() && s.status.markReady() {
+		s.startupExpired = nil
+		elapsed := s.config.clock.Now().Sub(s.startedAt).Round(time.Millisecond)
+		msg := highlight(fmt.Sprintf("main: all services are ready in %v", elapsed))
+		logger.Log(logger.Info, msg, "event", "all_ready", "elapsed", elapsed)
+		s.notify("READY=1")
+		if s.config.onAllReady != nil {
+			s.config.onAllReady()
+		}
+		if s.onReady != nil {
+			s.onReady()
+			s.onReady = nil
+		}
+	} else {
+		s.notify()
+	}
+}
+
+// complete handles the successful exit of a one-shot service, which counts as
+// its readiness
+func (s *supervisor) complete(i int) {
+	name := s.specs[i].String()
+	delete(s.running, i)
+	s.endStartSpan(i, nil)
+	s.filters[i].log(logger.Info, fmt.Sprintf("main: one-shot service '%v' completed", name),
+		"service", name, "event", "completed")
+	s.runExitHooks(i, nil)
+	s.settle(i)
+}
+
+// startEligible starts the services whose dependencies are all ready, as far
+// as the stagger and the limit of services starting at once allow. When the
+// stagger holds a service back, it is started when staggered fires
+func (s *supervisor) startEligible() {
+	for i := range s.specs {
+		if s.started[i] {
+			continue
+		}
+		eligible := true
+		for _, dep := range s.deps[i] {
+			eligible = eligible && s.settled[dep] && !s.reloading.replacing(dep)
+		}
+		if !eligible {
+			continue
+		}
+		if limit := s.config.maxStarting; limit > 0 && s.starting() >= limit {
+			return
+		}
+		now := s.config.clock.Now()
+		if stagger := s.config.startStagger; stagger > 0 && !s.lastStart.IsZero() {
+			if wait := stagger - now.Sub(s.lastStart); wait > 0 {
+				if s.staggered == nil {
+					s.staggered = s.config.clock.After(wait)
+				}
+				return
+			}
+		}
+		s.lastStart = now
+		s.start(i)
+	}
+}
+
+// starting returns how many services were started but are not ready yet
+func (s *supervisor) starting() int {
+	starting := 0
+	for i := range s.specs {
+		if s.started[i] && !s.settled[i] && s.running[i] {
+			starting++
+		}
+	}
+	return starting
+}
+
+// allReady reports whether all services became ready. Optional services that
+// exited before becoming ready are ignored
+func (s *supervisor) allReady() bool {
+	for _, settled := range s.settled {
+		if !settled {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingStart reports whether there are services that were not started yet
+func (s *supervisor) pendingStart() bool {
+	for _, started := range s.started {
+		if !started {
+			return true
+		}
+	}
+	return false
+}
+
+// start starts the service and waits for its readiness in the background
+func (s *supervisor) start(i int) {
+	spec := s.specs[i]
+	name := spec.String()
+	s.started[i] = true
+	s.running[i] = true
+	s.generations[i]++
+	generation := s.generations[i]
+	s.status.set(i, StateStarting, nil)
+	s.runStartHooks(i)
+	s.filters[i].log(logger.Info, fmt.Sprintf("main: starting service '%v'", name),
+		"service", name, "event", "started")
+	_, s.startSpans[i] = s.tracer.Start(s.servicesCtx, "service.start",
+		trace.WithAttributes(attribute.String("service", name)))
+	status := serviceStatus{board: s.status, index: i}
+	serviceCtx := withStatusBoard(withLogFilter(s.servicesCtx, s.filters[i]), s.status)
+	serviceCtx = withServiceStatus(serviceCtx, status)
+	serviceCtx, cancelService := context.WithCancel(serviceCtx)
+	s.cancels[i] = cancelService
+	go func() {
+		err := runService(serviceCtx, spec, s.config, status)
+		s.exit <- serviceExit{index: i, err: err}
+	}()
+	if spec.OneShot {
+		s.readyCancels[i] = func() {}
+		return
+	}
+	readyTimeout := s.config.readyTimeout
+	if spec.ReadyTimeout != 0 {
+		readyTimeout = spec.ReadyTimeout
+	}
+	readyCtx, cancelReady := context.WithTimeout(serviceCtx, readyTimeout)
+	s.readyCancels[i] = cancelReady
+	go func() {
+		err := waitReady(readyCtx, spec.Service)
+		if err != nil && errors.Is(readyCtx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %v: %w", ErrReadyTimeout, readyTimeout, err)
+		}
+		s.ready <- serviceReady{index: i, generation: generation, err: err}
+	}()
+}
+
+// reportDroppedLogs periodically logs how many entries about each service
+// were dropped because of its log level. It returns a function that stops the
+// reports after a last one
+func (s *supervisor) reportDroppedLogs() func() {
+	report := func() {
+		s.filtersMutex.Lock()
+		defer s.filtersMutex.Unlock()
+		for _, filter := range s.filters {
+			filter.report()
+		}
+	}
+	ticker := time.NewTicker(logSummaryInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				report()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		report()
+	}
+}
+
+// setFilter replaces the log filter of the service at index i, appending it
+// if the service was added by a reload. The entries dropped by the previous
+// filter are reported first
+func (s *supervisor) setFilter(i int, filter *logFilter) {
+	s.filtersMutex.Lock()
+	defer s.filtersMutex.Unlock()
+	if i == len(s.filters) {
+		s.filters = append(s.filters, filter)
+		return
+	}
+	s.filters[i].report()
+	s.filters[i] = filter
+}
+
+// errExitedBeforeReady ends the span of the startup of a service that exited
+// before becoming ready
+var errExitedBeforeReady = errors.New("exited before becoming ready")
+
+// endStartSpan ends the span of the startup of the service, if it is still
+// open, recording err on it
+func (s *supervisor) endStartSpan(i int, err error) {
+	span := s.startSpans[i]
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+	s.startSpans[i] = nil
+}
+
+// handleExit keeps the error of the service, if it failed, and calls its exit
+// hooks
+func (s *supervisor) handleExit(e serviceExit) {
+	delete(s.running, e.index)
+	s.endStartSpan(e.index, errExitedBeforeReady)
+	if e.err != nil {
+		s.recordError(e.index, serviceError(s.specs[e.index].String(), e.err))
+	}
+	s.runExitHooks(e.index, e.err)
+}
+
+// recordError keeps the terminal error of the service at index i, unless it
+// already has one, such as when it is stopped for not becoming ready
+func (s *supervisor) recordError(i int, err error) {
+	if _, ok := s.errs[i]; !ok {
+		s.errs[i] = err
+	}
+}
+
+// err returns the terminal errors of the services that failed, in the order
+// of the services, joined into one that wraps each of them. It is nil when
+// every service exited successfully
+func (s *supervisor) err() error {
+	indexes := make([]int, 0, len(s.errs))
+	for i := range s.errs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	errs := make([]error, len(indexes))
+	for j, i := range indexes {
+		errs[j] = s.errs[i]
+	}
+	return joinProblems(errs)
+}
+
+// shutdown sends the stop message to the running services and waits for them
+// to finish or timeout. Each service is stopped after the services that depend
+// on it have stopped or failed to stop within the step timeout
+func (s *supervisor) shutdown() error {
+	stopTimeout := s.config.stopTimeout
+	if outer, ok := s.outerDeadline.remaining(); ok {
+		stopTimeout = max(min(stopTimeout, outer), 0)
+	}
+	clock := s.config.clock
+	shutdownStart := clock.Now()
+	s.deadline.set(clock, stopTimeout)
+	timeout := clock.After(stopTimeout)
+	var progress <-chan time.Time
+	if s.config.stopProgress > 0 {
+		progress = clock.After(s.config.stopProgress)
+	}
+	stopping := make([]bool, len(s.specs))
+	skipped := make([]bool, len(s.specs))
+	stoppingSince := make([]time.Time, len(s.specs))
+	stepExpired := make(chan int, len(s.specs))
+	stopped := make(chan serviceStop, len(s.specs))
+	// the step timers are abandoned once the shutdown is over
+	finished := make(chan struct{})
+	defer close(finished)
+
+	stopEligible := func() {
+		for i := range s.specs {
+			if !s.running[i] || stopping[i] {
+				continue
+			}
+			eligible := true
+			for _, dependent := range s.dependents[i] {
+				if s.running[dependent] && !skipped[dependent] && !s.config.parallelStop {
+					eligible = false
+				}
+			}
+			if !eligible {
+				continue
+			}
+			i := i
+			name := s.specs[i].String()
+			s.filters[i].log(logger.Info, fmt.Sprintf("main: stopping service '%v'", name),
+				"service", name, "event", "stopping")
+			s.status.set(i, StateStopping, nil)
+			stopping[i] = true
+			stoppingSince[i] = clock.Now()
+			s.stopService(i, stopped, finished)
+			step := clock.After(s.config.stopStepTimeout)
+			go func() {
+				select {
+				case <-step:
+					stepExpired <- i
+				case <-finished:
+				}
+			}()
+		}
+	}
+
+	stopEligible()
+	for len(s.running) > 0 {
+		select {
+		case e := <-s.exit:
+			s.handleExit(e)
+			if stopping[e.index] {
+				elapsed := clock.Now().Sub(stoppingSince[e.index]).Round(time.Millisecond)
+				name := s.specs[e.index].String()
+				msg := fmt.Sprintf("main: service '%v' stopped in %v", name, elapsed)
+				s.filters[e.index].log(logger.Info, msg, "service", name, "event", "stopped",
+					"elapsed", elapsed)
+			}
+			stopEligible()
+		case e := <-stopped:
+			s.handleStop(e)
+		case i := <-stepExpired:
+			if s.running[i] {
+				name := s.specs[i].String()
+				msg := "main: service '%v' did not stop in %v; stopping the next services"
+				s.filters[i].log(logger.Warning, fmt.Sprintf(msg, name, s.config.stopStepTimeout),
+					"service", name, "event", "stop_step_timeout")
+				skipped[i] = true
+				stopEligible()
+			}
+		case <-progress:
+			progress = clock.After(s.config.stopProgress)
+			elapsed := clock.Now().Sub(shutdownStart).Round(time.Second)
+			pending := s.runningNames()
+			msg := fmt.Sprintf("main: waiting %v for services to stop: %v", elapsed,
+				strings.Join(pending, ", "))
+			logger.Log(logger.Info, msg, "event", "stop_pending", "services", pending,
+				"elapsed", elapsed)
+		case <-timeout:
+			pending := s.runningNames()
+			for i, spec := range s.specs {
+				if s.running[i] {
+					s.recordError(i, fmt.Errorf("service '%v' %w (%v)", spec.String(),
+						ErrStopTimeout, stopTimeout))
+				}
+			}
+			msg := "main: exited after timeout of %v; abandoned services: %v"
+			logger.Log(logger.Warning, fmt.Sprintf(msg, stopTimeout, strings.Join(pending, ", ")),
+				"event", "stop_timeout", "services", pending)
+			go s.logLateExits(len(pending), lateExitWindow)
+			s.logExits()
+			return s.err()
+		}
+	}
+	logger.Log(logger.Info, highlight("main: all services were shutdown"), "event", "shutdown")
+	s.logExits()
+	return s.err()
+}
+
+// logExits summarizes why each service that exited last did so (see
+// [ExitReason]). The members of a group leave it to the group
+func (s *supervisor) logExits() {
+	if s.config.group {
+		return
+	}
+	var exits []string
+	for _, status := range s.status.snapshot() {
+		if status.Exited {
+			exit := fmt.Sprintf("%v %v", status.Name, status.ExitReason)
+			if status.StopError != nil {
+				exit = fmt.Sprintf("%v (stop failed: %v)", exit, status.StopError)
+			}
+			exits = append(exits, exit)
+		}
+	}
+	if len(exits) == 0 {
+		return
+	}
+	logger.Log(logger.Info, "main: exits of the services: "+strings.Join(exits, ", "),
+		"event", "exits", "exits", exits)
+}
+
+// runningNames returns the names of the services that are running, in their
+// order
+func (s *supervisor) runningNames() []string {
+	var names []string
+	for i, spec := range s.specs {
+		if s.running[i] {
+			names = append(names, spec.String())
+		}
+	}
+	return names
+}
+
+// lateExitWindow is how long the services that did not stop before the
+// timeout are waited for after Run returns, so their exits are logged
+const lateExitWindow = time.Minute
+
+// logLateExits logs the exits of the services that were still running when
+// the shutdown timed out, until all of them exited or the window is over. The
+// exit channel is buffered, so the services never block on it after that
+func (s *supervisor) logLateExits(pending int, window time.Duration) {
+	timeout := time.NewTimer(window)
+	defer timeout.Stop()
+	for ; pending > 0; pending-- {
+		select {
+		case e := <-s.exit:
+			name := s.specs[e.index].String()
+			msg := fmt.Sprintf("main: service '%v' exited after the shutdown timeout", name)
+			if e.err != nil {
+				msg = fmt.Sprintf("%v: %v", msg, e.err)
+			}
+			s.filters[e.index].log(logger.Warning, msg, "service", name, "event", "late_exit")
+		case <-timeout.C:
+			return
+		}
+	}
+}
+
+// runService starts the service and, if restarts are enabled, starts it again
+// every time it fails until the context is canceled or the service starts
+// crash looping. It returns the error of the last execution
+func runService(
+	ctx context.Context,
+	service Service,
+	config *runConfig,
+	status serviceStatus,
+) error {
+	var backoff backoff
+	var detector crashLoopDetector
+	filter := logFilterFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		name := service.String()
+		startedAt := config.clock.Now()
+		attemptCtx, stopAttempt := context.WithCancel(ctx)
+		watched := watchLiveness(attemptCtx, specOf(service).Liveness, config.clock, status,
+			name, stopAttempt)
+		err := startService(attemptCtx, service)
+		stopAttempt()
+		if unresponsive := watched(); unresponsive != nil {
+			err = unresponsive
+		}
+		// a Stopper may return before its context is canceled
+		stopping := ctx.Err() != nil || status.state() == StateStopping
+		reason := classifyExit(stopping, status.wasKilled(), err)
+		status.exited(reason, err)
+		if err != nil {
+			addServiceEvent(ctx, "exited", name, attribute.String("error", err.Error()),
+				attribute.String("exit_reason", string(reason)))
+			msg := "main: " + serviceError(name, err).Error()
+			filter.log(logger.Error, msg, "service", name, "event", "exited", "error", err,
+				"exit_reason", reason)
+		} else {
+			addServiceEvent(ctx, "exited", name, attribute.String("exit_reason", string(reason)))
+			msg := fmt.Sprintf("main: service '%v' exited successfully", name)
+			filter.log(logger.Info, msg, "service", name, "event", "exited",
+				"exit_reason", reason)
+		}
+		if !specOf(service).Restart.restarts(err) || stopping {
+			return err
+		}
+
+		now := config.clock.Now()
+		uptime := now.Sub(startedAt)
+		if uptime >= config.backoff().Reset {
+			detector.reset()
+		}
+		if !detector.allow(config.crashLoop, now) {
+			msg := fmt.Sprintf("main: service '%v' is crash looping; giving up", name)
+			loopErr := fmt.Errorf("%w: restarted %v times in %v", ErrCrashLoop,
+				config.crashLoop.restarts, config.crashLoop.window)
+			if err != nil {
+				loopErr = fmt.Errorf("%w: %w", loopErr, err)
+			}
+			status.set(StateFailed, loopErr)
+			filter.log(logger.Error, msg, "service", name, "event", "crash_loop")
+			return loopErr
+		}
+		delay := backoff.next(config.backoff(), uptime)
+		status.publish(EventRestartScheduled, err)
+		msg := "main: restarting service '%v' in %v (attempt %v)"
+		filter.log(logger.Warning, fmt.Sprintf(msg, name, delay, attempt+1),
+			"service", name, "event", "restart_scheduled", "delay", delay, "attempt", attempt+1)
+		select {
+		case <-config.clock.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+		status.set(StateRunning, nil)
+		addServiceEvent(ctx, "restarted", name, attribute.Int("attempt", attempt+1))
+		filter.log(logger.Info, fmt.Sprintf("main: restarting service '%v'", name),
+			"service", name, "event", "restarted", "attempt", attempt+1)
+	}
+}
+
+// serviceReady reports whether the service at the given index in the list
+// passed to Run became ready
+type serviceReady struct {
+	index      int
+	generation int
+	err        error
+}
+
+// serviceExit reports that the service at the given index in the list passed
+// to Run has exited
+type serviceExit struct {
+	index int
+	err   error
+}
+
+// forceExitOnSignal makes the node exit immediately with ExitForced if it
+// receives SIGINT or SIGTERM. It returns a function that removes the
+// handler
+func forceExitOnSignal() func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			msg := fmt.Sprintf("main: received %v during shutdown; forcing exit", sig)
+			logger.Log(logger.Error, msg, "event", "signaled", "signal", sig.String())
+			os.Exit(ExitForced)
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
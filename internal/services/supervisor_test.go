@@ -0,0 +1,674 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestRun(t *testing.T) {
+
+	t.Run("it forwards SIGTERM to the services when the node is signaled", func(t *testing.T) {
+		setup()
+		marker := filepath.Join(t.TempDir(), "marker")
+		t.Setenv("MARKER", marker)
+		service := &simpleService{
+			serviceName: "sleeper",
+			binaryName: writeScript(t, `
+				trap 'kill $!; echo terminated > "$MARKER"; exit 0' TERM
+				sleep 600 &
+				echo started > "$MARKER"
+				wait
+			`),
+		}
+
+		done := make(chan struct{})
+		go func() {
+			Run(context.Background(), []Service{service})
+			close(done)
+		}()
+		waitForFileContent(t, marker, "started\n")
+
+		if err := signalPID(os.Getpid(), syscall.SIGTERM); err != nil {
+			t.Fatalf("failed to signal the test process: %v", err)
+		}
+
+		select {
+		case <-done:
+		case <-time.After(DefaultServiceTimeout):
+			t.Fatal("run did not return before the timeout")
+		}
+		waitForFileContent(t, marker, "terminated\n")
+	})
+
+	t.Run("it returns an error when there are no services", func(t *testing.T) {
+		setup()
+		if err := Run(context.Background(), nil); !errors.Is(err, ErrNoServices) {
+			t.Fatalf("expected no services to be an error, got %v", err)
+		}
+	})
+
+	t.Run("it returns the error of the first service that fails", func(t *testing.T) {
+		setup()
+		failing := &simpleService{
+			serviceName: "failing",
+			binaryName:  writeScript(t, "exit 3"),
+		}
+		sleeper := &simpleService{
+			serviceName: "sleeper",
+			binaryName:  writeScript(t, "trap 'kill $!; exit 0' TERM; sleep 600 & wait"),
+		}
+
+		err := Run(context.Background(), []Service{failing, sleeper})
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+			t.Fatalf("expected exit status 3, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "failing") {
+			t.Fatalf("expected the error to name the failing service, got %v", err)
+		}
+	})
+
+	t.Run("it returns the errors of all the services that fail", func(t *testing.T) {
+		setup()
+		errFirst := errors.New("first failure")
+		errStop := &ExitError{Service: "database", ExitCode: 4}
+		database := testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return errStop
+		}}
+		clean := testService{name: "clean", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		failing := testService{name: "failing", start: func(ctx context.Context) error {
+			return errFirst
+		}}
+
+		err := Run(context.Background(), []Service{database, clean, failing})
+		var exitErr *ExitError
+		if !errors.Is(err, errFirst) || !errors.As(err, &exitErr) || exitErr.ExitCode != 4 {
+			t.Fatalf("expected both failures, got %v", err)
+		}
+		expected := "service 'database' exited with code 4 after running for 0s; " +
+			"service 'failing' exited with error: first failure"
+		if err.Error() != expected {
+			t.Fatalf("expected the failures in the order of the services, got %q", err)
+		}
+	})
+
+	t.Run("it returns the services that did not stop in time", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		release := make(chan struct{})
+		stubborn := testService{name: "stubborn", start: func(ctx context.Context) error {
+			<-release
+			return nil
+		}}
+		failing := testService{name: "failing", start: func(ctx context.Context) error {
+			return errors.New("boom")
+		}}
+
+		err := Run(context.Background(), []Service{stubborn, failing},
+			WithStopTimeout(50*time.Millisecond))
+		close(release)
+		if !errors.Is(err, ErrStopTimeout) || !strings.Contains(err.Error(), "boom") {
+			t.Fatalf("expected the timeout and the failure, got %v", err)
+		}
+		waitForLog(t, &out, "service 'stubborn' exited after the shutdown timeout")
+	})
+
+	t.Run("it keeps running when an optional service exits", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		optionalExited := make(chan struct{})
+		optional := testService{
+			name: "optional",
+			start: func(ctx context.Context) error {
+				close(optionalExited)
+				return errors.New("optional failure")
+			},
+		}
+		criticalStopped := false
+		critical := testService{
+			name: "critical",
+			start: func(ctx context.Context) error {
+				<-optionalExited
+				<-time.After(50 * time.Millisecond)
+				if ctx.Err() != nil {
+					return errors.New("stopped because of the optional service")
+				}
+				cancel()
+				<-ctx.Done()
+				criticalStopped = true
+				return nil
+			},
+		}
+
+		err := Run(ctx, []Service{Optional(optional), critical})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if !criticalStopped {
+			t.Fatal("expected the critical service to be stopped by the cancelation")
+		}
+	})
+
+	t.Run("it stops the services in the reverse order they were started", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		var stopped []string
+		newService := func(name string) Service {
+			return testService{
+				name: name,
+				start: func(serviceCtx context.Context) error {
+					if name == "third" {
+						cancel()
+					}
+					<-serviceCtx.Done()
+					mu.Lock()
+					defer mu.Unlock()
+					stopped = append(stopped, name)
+					return nil
+				},
+			}
+		}
+		services := []Service{newService("first"), newService("second"), newService("third")}
+
+		if err := Run(ctx, services); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expected := []string{"third", "second", "first"}
+		if !reflect.DeepEqual(stopped, expected) {
+			t.Fatalf("expected services to stop in the order %v, got %v", expected, stopped)
+		}
+	})
+
+	t.Run("it returns when the services stop before the timeout", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		sleeper := &simpleService{
+			serviceName: "sleeper",
+			binaryName:  writeScript(t, "trap 'kill $!; exit 0' TERM; sleep 600 & wait"),
+		}
+
+		start := time.Now()
+		err := Run(ctx, []Service{sleeper}, WithStopTimeout(5*time.Second))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected run to return right after the cancelation, took %v", elapsed)
+		}
+	})
+
+	t.Run("it returns an error when the stop timeout expires", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Warning = log.New(&out, "WARN ", 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		stubborn := &simpleService{
+			serviceName: "stubborn",
+			binaryName:  writeStubbornScript(t),
+			stopTimeout: 300 * time.Millisecond,
+		}
+
+		start := time.Now()
+		err := Run(ctx, []Service{stubborn}, WithStopTimeout(200*time.Millisecond))
+		if err == nil || !strings.Contains(err.Error(), "stubborn") {
+			t.Fatalf("expected an error naming the stubborn service, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected run to return after the stop timeout, took %v", elapsed)
+		}
+		// the service is killed after its grace period, once Run returned
+		waitForLog(t, &out, "service 'stubborn' exited after the shutdown timeout")
+	})
+
+	t.Run("it logs the services that are still stopping", func(t *testing.T) {
+		setup()
+		var out lockedBuffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		logger.Warning = log.New(&out, "WARN ", 0)
+		release := make(chan struct{})
+		quick := testService{name: "quick", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+		slow := testService{name: "slow", start: func(ctx context.Context) error {
+			<-release
+			return nil
+		}}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		err := Run(ctx, []Service{slow, quick}, WithStopTimeout(200*time.Millisecond),
+			WithStopProgressInterval(50*time.Millisecond), WithParallelStop())
+		close(release)
+		if !errors.Is(err, ErrStopTimeout) || err.Error() != "service 'slow' did not stop in time "+
+			"(200ms)" {
+			t.Fatalf("expected the error to name the abandoned service, got %v", err)
+		}
+		for _, expected := range []string{
+			"INFO main: waiting 0s for services to stop: slow\n",
+			"WARN main: exited after timeout of 200ms; abandoned services: slow\n",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q in the log, got %q", expected, out.String())
+			}
+		}
+		waitForLog(t, &out, "service 'slow' exited after the shutdown timeout")
+	})
+
+	t.Run("it stops the children of the services", func(t *testing.T) {
+		setup()
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		service := NewCommandService("wrapper", "sh",
+			WithArgs("-c", fmt.Sprintf("sleep 600 & echo $! > %v; wait", pidFile)))
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- Run(ctx, []Service{service})
+		}()
+
+		var pid int
+		deadline := time.Now().Add(5 * time.Second)
+		for pid == 0 && time.Now().Before(deadline) {
+			content, _ := os.ReadFile(pidFile)
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(content)))
+			time.Sleep(10 * time.Millisecond)
+		}
+		if pid == 0 {
+			t.Fatal("the service did not spawn its child")
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		deadline = time.Now().Add(time.Second)
+		for processIsAlive(pid) {
+			if time.Now().After(deadline) {
+				_ = signalPID(pid, syscall.SIGKILL)
+				t.Fatalf("the child %v survived the service", pid)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
+
+func TestSupervisor(t *testing.T) {
+
+	// waiter is a service that runs until it is stopped
+	waiter := func(name string) testService {
+		return testService{name: name, start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}
+	}
+
+	t.Run("it runs in the background until it is stopped", func(t *testing.T) {
+		setup()
+		ready := make(chan struct{})
+		slow := readyTestService{
+			testService: waiter("slow"),
+			ready: func(ctx context.Context) error {
+				select {
+				case <-ready:
+					return nil
+				default:
+					return errors.New("not ready")
+				}
+			},
+		}
+		supervisor := NewSupervisor([]Service{slow, waiter("other")})
+
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		select {
+		case err := <-started:
+			t.Fatalf("expected Start to wait for the services, got %v", err)
+		case <-time.After(3 * readyPollInterval):
+		}
+		close(ready)
+		if err := <-started; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		waited := make(chan error)
+		go func() {
+			waited <- supervisor.Wait()
+		}()
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := <-waited; err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it finishes when a critical service exits", func(t *testing.T) {
+		setup()
+		exit := make(chan struct{})
+		boom := errors.New("boom")
+		failing := testService{name: "failing", start: func(ctx context.Context) error {
+			<-exit
+			return boom
+		}}
+		supervisor := NewSupervisor([]Service{failing, waiter("other")})
+
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		close(exit)
+		if err := supervisor.Wait(); !errors.Is(err, boom) {
+			t.Fatalf("expected the error of the service, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); !errors.Is(err, boom) {
+			t.Fatalf("expected Stop to return the same error, got %v", err)
+		}
+	})
+
+	t.Run("it can be stopped from multiple goroutines", func(t *testing.T) {
+		setup()
+		supervisor := NewSupervisor([]Service{waiter("first"), waiter("second")})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- supervisor.Stop(context.Background())
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("expected no error, got %v", err)
+			}
+		}
+	})
+
+	t.Run("it stops the started services when Stop is called during Start", func(t *testing.T) {
+		setup()
+		stopped := false
+		first := testService{name: "first", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			stopped = true
+			return nil
+		}}
+		never := readyTestService{
+			testService: waiter("never"),
+			ready:       func(ctx context.Context) error { return errors.New("not ready") },
+		}
+		supervisor := NewSupervisor([]Service{first, never})
+
+		started := make(chan error)
+		go func() {
+			started <- supervisor.Start(context.Background())
+		}()
+		time.Sleep(2 * readyPollInterval)
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := <-started; err != nil {
+			t.Fatalf("expected Start to return after the stop, got %v", err)
+		}
+		if !stopped {
+			t.Fatal("expected the started service to be stopped")
+		}
+	})
+
+	t.Run("it does not start after Stop", func(t *testing.T) {
+		setup()
+		supervisor := NewSupervisor([]Service{waiter("first")})
+
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Start(context.Background()); !errors.Is(err, ErrStopped) {
+			t.Fatalf("expected ErrStopped, got %v", err)
+		}
+		if err := supervisor.Wait(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it only waits for the shutdown until the context is done", func(t *testing.T) {
+		setup()
+		release := make(chan struct{})
+		stubborn := testService{name: "stubborn", start: func(ctx context.Context) error {
+			<-release
+			return nil
+		}}
+		supervisor := NewSupervisor([]Service{stubborn})
+		defer func() {
+			close(release)
+			_ = supervisor.Wait()
+		}()
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := supervisor.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the deadline to be exceeded, got %v", err)
+		}
+	})
+
+	t.Run("it can only be started once", func(t *testing.T) {
+		setup()
+		supervisor := NewSupervisor([]Service{waiter("first")})
+		defer supervisor.Stop(context.Background())
+
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Start(context.Background()); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestStartLimits(t *testing.T) {
+	// independent services that only depend on the first service, so they
+	// would all start at once without the limits
+	fanOut := func(start func(ctx context.Context) error, names ...string) []Service {
+		list := []Service{testService{name: "database", start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}}}
+		for _, name := range names {
+			list = append(list, DependsOn(testService{name: name, start: start}, "database"))
+		}
+		return list
+	}
+
+	t.Run("it waits for the stagger between launches", func(t *testing.T) {
+		setup()
+		var mutex sync.Mutex
+		var starts []time.Time
+		list := fanOut(func(ctx context.Context) error {
+			mutex.Lock()
+			starts = append(starts, time.Now())
+			mutex.Unlock()
+			<-ctx.Done()
+			return nil
+		}, "indexer", "dispatcher", "graphql-server")
+
+		stagger := 30 * time.Millisecond
+		supervisor := NewSupervisor(list, WithStartStagger(stagger))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(starts) != 3 {
+			t.Fatalf("expected 3 services to start, got %v", len(starts))
+		}
+		for i := 1; i < len(starts); i++ {
+			if gap := starts[i].Sub(starts[i-1]); gap < stagger-5*time.Millisecond {
+				t.Errorf("expected the launches to be %v apart, got %v", stagger, gap)
+			}
+		}
+	})
+
+	t.Run("it limits how many services start at once", func(t *testing.T) {
+		setup()
+		var starting, most atomic.Int32
+		service := func(name string) Service {
+			return DependsOn(readyTestService{
+				testService: testService{name: name, start: func(ctx context.Context) error {
+					if n := starting.Add(1); n > most.Load() {
+						most.Store(n)
+					}
+					<-ctx.Done()
+					return nil
+				}},
+				ready: func(ctx context.Context) error {
+					time.Sleep(10 * time.Millisecond)
+					starting.Add(-1)
+					return nil
+				},
+			}, "database")
+		}
+		list := fanOut(nil)
+		list = append(list, service("indexer"), service("dispatcher"), service("graphql-server"))
+
+		supervisor := NewSupervisor(list, WithMaxStarting(1))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if most.Load() != 1 {
+			t.Fatalf("expected one service to start at a time, got %v", most.Load())
+		}
+	})
+
+	t.Run("it aborts the remaining launches when canceled", func(t *testing.T) {
+		setup()
+		ctx, cancel := context.WithCancel(context.Background())
+		var started atomic.Int32
+		list := fanOut(func(ctx context.Context) error {
+			started.Add(1)
+			<-ctx.Done()
+			return nil
+		}, "indexer", "dispatcher")
+
+		supervisor := NewSupervisor(list, WithStartStagger(time.Hour))
+		go func() {
+			// cancel once the first service is ready and the others wait
+			for statuses := supervisor.Status(); len(statuses) == 0 ||
+				statuses[0].State != StateReady; statuses = supervisor.Status() {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+		}()
+		start := time.Now()
+		if err := supervisor.Start(ctx); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected the startup to be aborted, but it took %v", elapsed)
+		}
+		if started.Load() != 0 {
+			t.Fatalf("expected no other launch, got %v", started.Load())
+		}
+		if status := supervisor.Status()[0]; status.State != StateExited {
+			t.Fatalf("expected the first service to be stopped, got %+v", status)
+		}
+	})
+}
+
+// testService is a service whose behavior is defined by the test
+type testService struct {
+	name  string
+	start func(ctx context.Context) error
+}
+
+func (s testService) Start(ctx context.Context) error {
+	return s.start(ctx)
+}
+
+func (s testService) String() string {
+	return s.name
+}
+
+// writeScript creates an executable shell script with the given body and
+// returns its path
+func writeScript(t *testing.T, body string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+	return path
+}
+
+// writeStubbornScript creates a script that ignores SIGTERM. The process is
+// killed when the test finishes
+func writeStubbornScript(t *testing.T) string {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	t.Cleanup(func() {
+		if content, err := os.ReadFile(pidFile); err == nil {
+			if pid, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+				_ = signalPID(pid, syscall.SIGKILL)
+			}
+		}
+	})
+	return writeScript(t, fmt.Sprintf(`
+		trap '' TERM
+		echo $$ > %v
+		while true; do sleep 0.1; done
+	`, pidFile))
+}
+
+// waitForFileContent waits until the file at path has the expected content
+func waitForFileContent(t *testing.T, path string, expected string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if content, err := os.ReadFile(path); err == nil && string(content) == expected {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	content, _ := os.ReadFile(path)
+	t.Fatalf("expected %q in %v, got %q", expected, path, content)
+}
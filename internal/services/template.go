@@ -0,0 +1,167 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUndefinedVariable is returned by the validation of a service whose
+// arguments or environment refer to a variable that is not defined
+var ErrUndefinedVariable = errors.New("undefined variable")
+
+// WithVariables expands the references to variables, written as ${NAME}, in
+// the arguments and in the values of the environment of the process, such as
+// a database URL shared by several services. The variables are looked up in
+// vars and then in the environment of the node. The values of vars may refer
+// to other variables themselves, while the ones of the environment are taken
+// as they are. Use $$ for a literal dollar. A reference to a variable that is
+// not defined fails the validation of the service. The arguments and the
+// variables that use the value of a redacted variable (see [WithRedactedEnv])
+// are also redacted
+func WithVariables(vars map[string]string) CommandOption {
+	return func(s *simpleService) {
+		s.templated = true
+		s.variables = vars
+	}
+}
+
+// templateVariables resolves the variables of the references
+type templateVariables struct {
+	vars      map[string]string
+	resolved  map[string]string
+	resolving map[string]bool
+
+	// uses are the names of the variables each value of vars refers to,
+	// directly or not
+	uses map[string][]string
+}
+
+func newTemplateVariables(vars map[string]string) *templateVariables {
+	return &templateVariables{
+		vars:      vars,
+		resolved:  make(map[string]string),
+		resolving: make(map[string]bool),
+		uses:      make(map[string][]string),
+	}
+}
+
+// lookup returns the value of the variable, expanding the references of the
+// values of vars
+func (v *templateVariables) lookup(name string) (string, error) {
+	if value, ok := v.resolved[name]; ok {
+		return value, nil
+	}
+	template, ok := v.vars[name]
+	if !ok {
+		if value, ok := os.LookupEnv(name); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("%w ${%v}", ErrUndefinedVariable, name)
+	}
+	if v.resolving[name] {
+		return "", fmt.Errorf("variable ${%v} refers to itself", name)
+	}
+	v.resolving[name] = true
+	defer delete(v.resolving, name)
+	value, uses, err := v.expand(template)
+	if err != nil {
+		return "", fmt.Errorf("in ${%v}: %w", name, err)
+	}
+	v.resolved[name], v.uses[name] = value, uses
+	return value, nil
+}
+
+// expand expands the references of the text. It also returns the names of the
+// variables the text refers to, directly or through other variables
+func (v *templateVariables) expand(text string) (string, []string, error) {
+	var result strings.Builder
+	var names []string
+	for {
+		i := strings.IndexByte(text, '$')
+		if i == -1 || i == len(text)-1 {
+			result.WriteString(text)
+			return result.String(), names, nil
+		}
+		result.WriteString(text[:i])
+		switch text[i+1] {
+		case '$':
+			result.WriteByte('$')
+			text = text[i+2:]
+		case '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end == -1 {
+				return "", nil, fmt.Errorf("unterminated reference %q", text[i:])
+			}
+			name := text[i+2 : i+end]
+			if name == "" {
+				return "", nil, errors.New("empty reference ${}")
+			}
+			value, err := v.lookup(name)
+			if err != nil {
+				return "", nil, err
+			}
+			result.WriteString(value)
+			names = append(append(names, name), v.uses[name]...)
+			text = text[i+end+1:]
+		default:
+			// a dollar that is not a reference is kept, as in $HOME
+			result.WriteByte('$')
+			text = text[i+1:]
+		}
+	}
+}
+
+// expandTemplates expands the references of the arguments and of the
+// environment, redacting the ones that use a redacted variable. It returns
+// every reference that cannot be expanded, naming its field
+func (s *simpleService) expandTemplates() error {
+	vars := newTemplateVariables(s.variables)
+	var problems []error
+	redacts := func(names []string) bool {
+		for _, name := range names {
+			if s.redacted[name] {
+				return true
+			}
+		}
+		return false
+	}
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		value, names, err := vars.expand(arg)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("args[%v]: %w", i, err))
+			continue
+		}
+		args[i] = value
+		if redacts(names) {
+			if s.redactedArgs == nil {
+				s.redactedArgs = make(map[int]bool)
+			}
+			s.redactedArgs[i] = true
+		}
+	}
+	env := make(map[string]string, len(s.env))
+	for _, key := range s.envKeys() {
+		value, names, err := vars.expand(s.env[key])
+		if err != nil {
+			problems = append(problems, fmt.Errorf("env %v: %w", key, err))
+			continue
+		}
+		env[key] = value
+		if redacts(names) {
+			if s.redacted == nil {
+				s.redacted = make(map[string]bool)
+			}
+			s.redacted[key] = true
+		}
+	}
+	// the maps of the options may be shared with other services, so they are
+	// replaced instead of changed
+	s.args, s.env = args, env
+	return joinProblems(problems)
+}
@@ -0,0 +1,109 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+// The recorder is a service for the integration tests of the services
+// package. It appends when it starts, the signals it receives, and when it
+// exits to a journal that the services of a test share, so the order of the
+// lines is the order of the events. It exits on its own after a delay or when
+// it receives SIGUSR1, and dumps its goroutines to stderr on SIGQUIT without
+// exiting
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+var (
+	name       = flag.String("name", "recorder", "name of the service in the journal")
+	journal    = flag.String("journal", "journal", "path of the journal")
+	ready      = flag.String("ready", "", "file created once the service is ready")
+	exitAfter  = flag.Duration("exit-after", 0, "exit on its own after the delay")
+	exitCode   = flag.Int("exit-code", 0, "code of the exit on its own or on SIGUSR1")
+	ignoreTerm = flag.Bool("ignore-term", false, "keep running after SIGTERM and SIGINT")
+	stopDelay  = flag.Duration("stop-delay", 0, "time taken to exit after SIGTERM or SIGINT")
+)
+
+// record appends the event to the journal with a single write, which is
+// atomic for the small lines of the journal and keeps the order of the events
+// of concurrent services
+func record(event string, detail string) {
+	file, err := os.OpenFile(*journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open the journal: %v\n", err)
+		os.Exit(100)
+	}
+	defer file.Close()
+	line := fmt.Sprintf("%v %v %v %v %v\n", time.Now().UnixNano(), event, *name, os.Getpid(),
+		detail)
+	if _, err := file.WriteString(line); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write the journal: %v\n", err)
+		os.Exit(100)
+	}
+}
+
+func exit(code int) {
+	if *ready != "" {
+		_ = os.Remove(*ready)
+	}
+	record("exit", fmt.Sprint(code))
+	os.Exit(code)
+}
+
+// dumpGoroutines writes the stacks of the goroutines to stderr, like the Go
+// runtime does on SIGQUIT
+func dumpGoroutines() {
+	stacks := make([]byte, 1<<16)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	fmt.Fprintf(os.Stderr, "SIGQUIT: goroutine dump of %v\n%s\n", *name, stacks)
+}
+
+func main() {
+	flag.Parse()
+	record("start", "-")
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1,
+		syscall.SIGQUIT)
+	if *ready != "" {
+		if err := os.WriteFile(*ready, nil, 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to create the ready file: %v\n", err)
+			os.Exit(100)
+		}
+	}
+	var exited <-chan time.Time
+	if *exitAfter > 0 {
+		exited = time.After(*exitAfter)
+	}
+	for {
+		select {
+		case sig := <-signals:
+			names := map[os.Signal]string{
+				syscall.SIGTERM: "TERM",
+				syscall.SIGINT:  "INT",
+				syscall.SIGHUP:  "HUP",
+				syscall.SIGUSR1: "USR1",
+				syscall.SIGQUIT: "QUIT",
+			}
+			record("signal", names[sig])
+			if sig == syscall.SIGQUIT {
+				dumpGoroutines()
+				continue
+			}
+			if sig == syscall.SIGUSR1 {
+				exit(*exitCode)
+			}
+			if sig == syscall.SIGHUP || *ignoreTerm {
+				continue
+			}
+			time.Sleep(*stopDelay)
+			exit(0)
+		case <-exited:
+			exit(*exitCode)
+		}
+	}
+}
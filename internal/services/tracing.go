@@ -0,0 +1,51 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the name of the instrumentation of the supervisor
+const tracerName = "github.com/cartesi/rollups-node/internal/services"
+
+// WithTracerProvider sets the provider of the tracer Run uses to trace the
+// lifecycle of the services. A run is traced by a span that has a child span
+// per service, covering its startup until it becomes ready, and events for
+// the signals, restarts, and exits of the services. The default is the global
+// provider of OpenTelemetry, which does nothing unless it is set
+func WithTracerProvider(provider trace.TracerProvider) RunOption {
+	return func(c *runConfig) {
+		c.tracerProvider = provider
+	}
+}
+
+// tracer returns the tracer of the supervisor
+func (c *runConfig) tracer() trace.Tracer {
+	provider := c.tracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// addServiceEvent adds an event about the service to the span of the
+// supervisor carried by the context
+func addServiceEvent(
+	ctx context.Context,
+	event string,
+	service string,
+	attrs ...attribute.KeyValue,
+) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	attrs = append(attrs, attribute.String("service", service))
+	span.AddEvent(event, trace.WithAttributes(attrs...))
+}
@@ -0,0 +1,92 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRunTracing(t *testing.T) {
+	setup()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	sleeper := &simpleService{
+		serviceName: "sleeper",
+		binaryName:  writeScript(t, "trap 'kill $!; exit 0' TERM; sleep 600 & wait"),
+	}
+	failing := readyTestService{
+		testService: testService{name: "failing", start: func(ctx context.Context) error {
+			return errors.New("boom")
+		}},
+		ready: func(ctx context.Context) error { return errors.New("not ready") },
+	}
+
+	if err := Run(context.Background(), []Service{sleeper, failing},
+		WithTracerProvider(provider)); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	spans := exporter.GetSpans()
+	var root tracetest.SpanStub
+	starts := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		switch span.Name {
+		case "supervisor.run":
+			root = span
+		case "service.start":
+			starts[attributeOf(span.Attributes, "service")] = span
+		}
+	}
+	if root.Name == "" || len(starts) != 2 {
+		t.Fatalf("expected a root span and 2 start spans, got %+v", spans)
+	}
+	for name, span := range starts {
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("expected the span of %v to be a child of the root span", name)
+		}
+	}
+	if starts["sleeper"].Status.Code == codes.Error {
+		t.Errorf("expected the startup of the sleeper to succeed")
+	}
+	if starts["failing"].Status.Code != codes.Error {
+		t.Errorf("expected the startup of the failing service to fail")
+	}
+	if root.Status.Code != codes.Error {
+		t.Errorf("expected the run to fail, got %+v", root.Status)
+	}
+
+	events := map[string]map[string]string{}
+	for _, event := range root.Events {
+		attrs := map[string]string{}
+		for _, attr := range event.Attributes {
+			attrs[string(attr.Key)] = attr.Value.Emit()
+		}
+		events[event.Name+" "+attrs["service"]] = attrs
+	}
+	if attrs, ok := events["exited failing"]; !ok || attrs["error"] != "boom" {
+		t.Errorf("expected the exit of the failing service with its error, got %v", events)
+	}
+	if attrs, ok := events["signal_sent sleeper"]; !ok || attrs["signal"] != "terminated" {
+		t.Errorf("expected the sleeper to be sent SIGTERM, got %v", events)
+	}
+	if _, ok := events["exited sleeper"]; !ok {
+		t.Errorf("expected the exit of the sleeper, got %v", events)
+	}
+}
+
+func attributeOf(attrs []attribute.KeyValue, key string) string {
+	for _, attr := range attrs {
+		if string(attr.Key) == key {
+			return attr.Value.Emit()
+		}
+	}
+	return ""
+}
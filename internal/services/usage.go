@@ -0,0 +1,130 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// errRSSUnsupported is returned when the memory of the processes cannot be
+// sampled on this platform
+var errRSSUnsupported = errors.New("sampling the memory of processes is not supported")
+
+// ResourceUsage is the resources used by the process of a service until it
+// exited
+type ResourceUsage struct {
+	// UserTime and SystemTime are the CPU time the process spent in user and
+	// in kernel mode
+	UserTime   time.Duration
+	SystemTime time.Duration
+
+	// MaxRSS is the peak resident set size of the process, in bytes. It is
+	// zero on Windows
+	MaxRSS int64
+}
+
+// processUsage returns the resource usage of the process that exited, or nil
+// if it was not waited for
+func processUsage(state *os.ProcessState) *ResourceUsage {
+	if state == nil {
+		return nil
+	}
+	return &ResourceUsage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		MaxRSS:     maxRSS(state),
+	}
+}
+
+// usageReporter is a service that reports the resource usage of its process
+type usageReporter interface {
+	// lastUsage returns the resource usage of the last time the process
+	// exited, or nil if it never did
+	lastUsage() *ResourceUsage
+}
+
+// WithUsageSampling makes Run sample the resident set size of the processes
+// of the services at the interval, so it shows up in their status (see
+// [ServiceStatus.RSS]). Sampling is only supported on Linux and does nothing
+// elsewhere
+func WithUsageSampling(interval time.Duration) RunOption {
+	return func(c *runConfig) {
+		c.usageInterval = interval
+	}
+}
+
+// sampleUsage samples the memory of the processes of the services at the
+// interval of the config, if it is set. It returns a function that stops the
+// sampling
+func (s *supervisor) sampleUsage() func() {
+	if s.config.usageInterval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(s.config.usageInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.status.sampleRSS(); err != nil {
+					msg := fmt.Sprintf("main: %v on %v", err, runtime.GOOS)
+					logger.Log(logger.Debug, msg, "event", "sampling_unsupported")
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// sampleRSS records the resident set size of the processes of the services
+// that are running. It only fails if this platform cannot sample them
+func (b *statusBoard) sampleRSS() error {
+	type sample struct {
+		index int
+		pid   int
+	}
+	b.mutex.Lock()
+	var samples []sample
+	for i, service := range b.services {
+		process, ok := service.(Process)
+		if !ok || b.removed[i] || b.statuses[i].State.done() {
+			continue
+		}
+		if pid := process.PID(); pid != 0 {
+			samples = append(samples, sample{index: i, pid: pid})
+		}
+	}
+	b.mutex.Unlock()
+
+	for _, sample := range samples {
+		rss, err := readRSS(sample.pid)
+		if errors.Is(err, errRSSUnsupported) {
+			return err
+		}
+		if err != nil {
+			continue // the process exited in the meantime
+		}
+		b.mutex.Lock()
+		if !b.statuses[sample.index].State.done() {
+			b.statuses[sample.index].RSS = rss
+		}
+		b.mutex.Unlock()
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+//go:build !linux
+
+package services
+
+// readRSS fails, since only Linux has /proc/<pid>/statm
+func readRSS(pid int) (int64, error) {
+	return 0, errRSSUnsupported
+}
@@ -0,0 +1,123 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResourceUsage(t *testing.T) {
+
+	t.Run("it records the usage of the process when it exits", func(t *testing.T) {
+		setup()
+		service := &simpleService{serviceName: "migrator", binaryName: writeScript(t, "exit 0")}
+		if service.lastUsage() != nil {
+			t.Fatalf("expected no usage before the process runs")
+		}
+		if err := service.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		usage := service.lastUsage()
+		if usage == nil || usage.UserTime < 0 || usage.SystemTime < 0 {
+			t.Fatalf("unexpected usage %+v", usage)
+		}
+		if runtime.GOOS == "linux" && usage.MaxRSS <= 0 {
+			t.Fatalf("expected the peak memory of the process, got %+v", usage)
+		}
+	})
+
+	t.Run("it shows the usage in the status", func(t *testing.T) {
+		setup()
+		migrator := OneShot(NewCommandService("migrator", writeScript(t, "exit 0")))
+		supervisor := NewSupervisor([]Service{migrator})
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		defer supervisor.Stop(context.Background()) //nolint:errcheck
+		if status := supervisor.Status()[0]; status.Usage == nil {
+			t.Fatalf("expected the usage in the status, got %+v", status)
+		}
+	})
+
+	t.Run("it samples the memory of the running processes", func(t *testing.T) {
+		setup()
+		if runtime.GOOS != "linux" {
+			t.Skip("only Linux supports sampling")
+		}
+		sleeper := NewCommandService("sleeper", writeScript(t, "exec sleep 10"))
+		supervisor := NewSupervisor([]Service{sleeper}, WithUsageSampling(10*time.Millisecond))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for supervisor.Status()[0].RSS == 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected the memory to be sampled")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if status := supervisor.Status()[0]; status.RSS != 0 {
+			t.Fatalf("expected the memory of the exited process to be cleared, got %v",
+				status.RSS)
+		}
+	})
+
+	t.Run("it reads the memory of a process", func(t *testing.T) {
+		rss, err := readRSS(os.Getpid())
+		if runtime.GOOS != "linux" {
+			if !errors.Is(err, errRSSUnsupported) {
+				t.Fatalf("expected errRSSUnsupported, got %v", err)
+			}
+			return
+		}
+		if err != nil || rss <= 0 {
+			t.Fatalf("expected the memory of the test, got %v, %v", rss, err)
+		}
+	})
+
+	t.Run("it exports the usage as metrics", func(t *testing.T) {
+		collector := statusCollector{status: func() []ServiceStatus {
+			return []ServiceStatus{
+				{Name: "indexer", State: StateReady, RSS: 4096},
+				{Name: "migrator", State: StateExited, Usage: &ResourceUsage{
+					UserTime:   1500 * time.Millisecond,
+					SystemTime: 250 * time.Millisecond,
+					MaxRSS:     8192,
+				}},
+			}
+		}}
+		expected := `
+# HELP rollups_service_last_exit_cpu_seconds The CPU time of the last run of the service.
+# TYPE rollups_service_last_exit_cpu_seconds gauge
+rollups_service_last_exit_cpu_seconds{mode="system",service="migrator"} 0.25
+rollups_service_last_exit_cpu_seconds{mode="user",service="migrator"} 1.5
+# HELP rollups_service_last_exit_max_resident_memory_bytes The peak resident memory of the last run.
+# TYPE rollups_service_last_exit_max_resident_memory_bytes gauge
+rollups_service_last_exit_max_resident_memory_bytes{service="migrator"} 8192
+# HELP rollups_service_resident_memory_bytes The resident memory of the service, as last sampled.
+# TYPE rollups_service_resident_memory_bytes gauge
+rollups_service_resident_memory_bytes{service="indexer"} 4096
+`
+		names := []string{
+			"rollups_service_last_exit_cpu_seconds",
+			"rollups_service_last_exit_max_resident_memory_bytes",
+			"rollups_service_resident_memory_bytes",
+		}
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected), names...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
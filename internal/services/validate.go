@@ -0,0 +1,197 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidServices is returned by Run when some services cannot be started,
+// such as when their binaries are missing. Run does not start any service
+// when it returns this error
+var ErrInvalidServices = errors.New("invalid services")
+
+// ErrNoServices is returned by Run when it is given no services
+var ErrNoServices = errors.New("there are no services to run")
+
+// ErrNilService is wrapped by the error of Run for each service that is nil
+var ErrNilService = errors.New("nil service")
+
+// ErrDuplicateName is wrapped by the error of Run for each name shared by
+// several services, as a [DuplicateNameError]
+var ErrDuplicateName = errors.New("duplicate service name")
+
+// DuplicateNameError is the error of a name shared by several services, which
+// would make their logs and their dependencies ambiguous
+type DuplicateNameError struct {
+	Name string
+}
+
+func (e *DuplicateNameError) Error() string {
+	return fmt.Sprintf("%v '%v'", ErrDuplicateName, e.Name)
+}
+
+func (e *DuplicateNameError) Is(target error) bool {
+	return target == ErrDuplicateName
+}
+
+// Validator is implemented by services that can check whether they can be
+// started before Run starts any service
+type Validator interface {
+	// Validate returns an error describing why the service cannot be
+	// started. It must not have side effects, other than acquiring the
+	// resources the service keeps across its runs, such as its listeners
+	Validate() error
+}
+
+// WithoutValidation makes Run skip the validation of the services before the
+// startup, for setups where their binaries only appear after the node starts
+func WithoutValidation() RunOption {
+	return func(c *runConfig) {
+		c.skipValidation = true
+	}
+}
+
+// Verify checks that the services can be run without starting any of them:
+// that the dependencies between them are valid and that they pass their
+// validation (see [Validator]), which for command services checks their
+// binaries, the variables they require in their environment, and their
+// readiness probes, and that the ports they declare are free (see
+// [PortUser]). It returns an [ErrInvalidServices] error that lists every
+// problem, in the order of the services
+func Verify(services []Service) error {
+	if len(services) == 0 {
+		return ErrNoServices
+	}
+	problems := &validationError{}
+	specs := problems.check(services)
+	if len(problems.problems) == 0 {
+		if _, err := resolveDependencies(specs); err != nil {
+			problems.add("", err)
+		}
+	}
+	problems.validate(specs)
+	problems.checkPorts(specs, nil)
+	return problems.orNil()
+}
+
+// checkServices checks that there are services, that none of them is nil, and
+// that each one has its own name, before any of them is started. It returns
+// [ErrNoServices] or an [ErrInvalidServices] error that lists every problem
+func checkServices(services []Service) error {
+	if len(services) == 0 {
+		return ErrNoServices
+	}
+	problems := &validationError{}
+	problems.check(services)
+	return problems.orNil()
+}
+
+// validateServices validates the services that implement [Validator] and the
+// ports of the services that implement [PortUser]. It returns an error listing
+// every service that failed the validation
+func validateServices(specs []ServiceSpec) error {
+	problems := &validationError{}
+	problems.validate(specs)
+	problems.checkPorts(specs, nil)
+	return problems.orNil()
+}
+
+// validationError lists the problems that make the services invalid. It is an
+// ErrInvalidServices that also wraps the error of each problem
+type validationError struct {
+	problems []string
+	errs     []error
+}
+
+// add adds a problem of the subject, which may be empty for the problems of
+// the services as a whole
+func (e *validationError) add(subject string, err error) {
+	problem := err.Error()
+	if subject != "" {
+		problem = fmt.Sprintf("%v: %v", subject, err)
+	}
+	e.problems = append(e.problems, problem)
+	e.errs = append(e.errs, err)
+}
+
+// check adds the problems of the services that are nil or that share their
+// names, and returns the specs of the services that are not nil
+func (e *validationError) check(services []Service) []ServiceSpec {
+	specs := make([]ServiceSpec, 0, len(services))
+	names := make(map[string]int, len(services))
+	for i, service := range services {
+		if service == nil {
+			e.add(fmt.Sprintf("service #%v", i), ErrNilService)
+			continue
+		}
+		spec := specOf(service)
+		specs = append(specs, spec)
+		// each name shared by several services is reported once
+		names[spec.String()]++
+		if names[spec.String()] == 2 {
+			e.add("", &DuplicateNameError{Name: spec.String()})
+		}
+	}
+	return specs
+}
+
+// validate adds the problems of the services that fail their validation
+func (e *validationError) validate(specs []ServiceSpec) {
+	for _, spec := range specs {
+		validator, ok := spec.Service.(Validator)
+		if !ok {
+			continue
+		}
+		if err := validator.Validate(); err != nil {
+			e.add(fmt.Sprintf("service '%v'", spec.String()), err)
+		}
+	}
+}
+
+// orNil returns the error if there are problems and nil otherwise
+func (e *validationError) orNil() error {
+	if len(e.problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrInvalidServices, strings.Join(e.problems, "; "))
+}
+
+func (e *validationError) Unwrap() []error {
+	return append([]error{ErrInvalidServices}, e.errs...)
+}
+
+// joinProblems joins the errors into one that lists them separated by
+// semicolons, or returns nil if there are no errors
+func joinProblems(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return problemsError(errs)
+	}
+}
+
+// problemsError is a list of problems of a single service
+type problemsError []error
+
+func (e problemsError) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e problemsError) Unwrap() []error {
+	return e
+}
@@ -0,0 +1,238 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+
+	t.Run("it lists every missing binary and starts nothing", func(t *testing.T) {
+		setup()
+		var started atomic.Bool
+		service := testService{name: "first", start: func(ctx context.Context) error {
+			started.Store(true)
+			<-ctx.Done()
+			return nil
+		}}
+		missing := filepath.Join(t.TempDir(), "missing")
+		list := []Service{
+			service,
+			&simpleService{serviceName: "indexer", binaryName: "cartesi-rollups-missing-indexer"},
+			Optional(&simpleService{serviceName: "other", binaryName: missing}),
+		}
+
+		err := Run(context.Background(), list)
+		if !errors.Is(err, ErrInvalidServices) || !errors.Is(err, exec.ErrNotFound) {
+			t.Fatalf("expected the services to be invalid, got %v", err)
+		}
+		for _, name := range []string{"'indexer'", "cartesi-rollups-missing-indexer", missing} {
+			if !strings.Contains(err.Error(), name) {
+				t.Errorf("expected the error to mention %v, got %v", name, err)
+			}
+		}
+		if started.Load() {
+			t.Fatal("expected no service to be started")
+		}
+	})
+
+	t.Run("it validates the services that implement Validator", func(t *testing.T) {
+		setup()
+		boom := errors.New("missing configuration")
+		service := validatingTestService{
+			testService: testService{name: "dispatcher", start: func(ctx context.Context) error {
+				t.Error("expected the service to not be started")
+				return nil
+			}},
+			validate: func() error { return boom },
+		}
+
+		err := Run(context.Background(), []Service{DependsOn(service)})
+		if !errors.Is(err, ErrInvalidServices) || !errors.Is(err, boom) {
+			t.Fatalf("expected the error of the validation, got %v", err)
+		}
+		expected := "invalid services: service 'dispatcher': missing configuration"
+		if err.Error() != expected {
+			t.Fatalf("expected %q, got %q", expected, err.Error())
+		}
+	})
+
+	t.Run("it accepts the binaries that exist", func(t *testing.T) {
+		service := &simpleService{serviceName: "script", binaryName: writeScript(t, "exit 0")}
+		if err := service.Validate(); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it can skip the validation", func(t *testing.T) {
+		setup()
+		missing := &simpleService{serviceName: "indexer", binaryName: "cartesi-rollups-missing"}
+
+		err := Run(context.Background(), []Service{missing}, WithoutValidation())
+		if errors.Is(err, ErrInvalidServices) || !errors.Is(err, exec.ErrNotFound) {
+			t.Fatalf("expected the service to fail to start, got %v", err)
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+
+	t.Run("it lists every problem without starting the services", func(t *testing.T) {
+		t.Setenv("CARTESI_TEST_TOKEN", "secret")
+		never := func(ctx context.Context) error {
+			t.Error("expected the service to not be started")
+			return nil
+		}
+		first := NewCommandService("first", writeScript(t, "exit 0"),
+			WithRequiredEnv("CARTESI_TEST_TOKEN", "CARTESI_TEST_MISSING"),
+			WithProbe(HttpProbe{URL: "localhost:4000/graphql"}))
+		second := NewCommandService("second", "cartesi-rollups-missing",
+			WithProbe(TcpPortProbe{Port: 70000}))
+		list := []Service{
+			DependsOn(first, "third"),
+			second,
+			DependsOn(testService{name: "third", start: never}, "first"),
+		}
+
+		err := Verify(list)
+		if !errors.Is(err, ErrInvalidServices) || !errors.Is(err, ErrDependencyCycle) {
+			t.Fatalf("expected the services to be invalid, got %v", err)
+		}
+		expected := "invalid services: " +
+			"dependency cycle: first -> third -> first; " +
+			"service 'first': missing variable CARTESI_TEST_MISSING; " +
+			"invalid probe: invalid URL localhost:4000/graphql: " +
+			"the scheme must be http or https; " +
+			"service 'second': missing binary: exec: \"cartesi-rollups-missing\": " +
+			"executable file not found in $PATH; invalid probe: invalid port 70000"
+		if err.Error() != expected {
+			t.Fatalf("expected %q, got %q", expected, err.Error())
+		}
+		if again := Verify(list); again.Error() != err.Error() {
+			t.Fatalf("expected the same problems, got %q", again.Error())
+		}
+	})
+
+	t.Run("it reports the services that are nil", func(t *testing.T) {
+		err := Verify([]Service{testService{name: "first"}, nil})
+		if !errors.Is(err, ErrInvalidServices) || !strings.Contains(err.Error(), "service #1") {
+			t.Fatalf("expected the nil service to be reported, got %v", err)
+		}
+		if err := Verify(nil); err == nil {
+			t.Fatal("expected an error without services")
+		}
+	})
+
+	t.Run("it accepts valid services", func(t *testing.T) {
+		t.Setenv("CARTESI_TEST_TOKEN", "secret")
+		service := NewCommandService("graphql-server", writeScript(t, "exit 0"),
+			WithEnv(map[string]string{"CARTESI_TEST_ENDPOINT": "postgres://"}),
+			WithRequiredEnv("CARTESI_TEST_TOKEN", "CARTESI_TEST_ENDPOINT"),
+			WithProbe(HttpProbe{URL: "http://127.0.0.1:4000/graphql"}))
+		if err := Verify([]Service{service, testService{name: "other"}}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("it does not inherit the required variables in a clean environment", func(t *testing.T) {
+		t.Setenv("CARTESI_TEST_TOKEN", "secret")
+		service := NewCommandService("indexer", writeScript(t, "exit 0"), WithCleanEnv(),
+			WithRequiredEnv("CARTESI_TEST_TOKEN"))
+		err := Verify([]Service{service})
+		if err == nil || !strings.Contains(err.Error(), "missing variable CARTESI_TEST_TOKEN") {
+			t.Fatalf("expected the variable to be missing, got %v", err)
+		}
+	})
+}
+
+func TestCheckServices(t *testing.T) {
+
+	// named creates a service that must never be started
+	named := func(t *testing.T, name string) Service {
+		return testService{name: name, start: func(ctx context.Context) error {
+			t.Errorf("expected %v to not be started", name)
+			return nil
+		}}
+	}
+
+	t.Run("it rejects the invalid lists of services before starting them", func(t *testing.T) {
+		setup()
+		indexer, dispatcher := named(t, "indexer"), named(t, "dispatcher")
+		for _, test := range []struct {
+			services []Service
+			errs     []error
+			expected string
+		}{{
+			services: nil,
+			errs:     []error{ErrNoServices},
+			expected: "there are no services to run",
+		}, {
+			services: []Service{},
+			errs:     []error{ErrNoServices},
+			expected: "there are no services to run",
+		}, {
+			services: []Service{nil},
+			errs:     []error{ErrInvalidServices, ErrNilService},
+			expected: "invalid services: service #0: nil service",
+		}, {
+			services: []Service{indexer, dispatcher, indexer},
+			errs:     []error{ErrInvalidServices, ErrDuplicateName},
+			expected: "invalid services: duplicate service name 'indexer'",
+		}, {
+			services: []Service{indexer, nil, indexer, dispatcher, indexer, nil, dispatcher},
+			errs:     []error{ErrInvalidServices, ErrNilService, ErrDuplicateName},
+			expected: "invalid services: service #1: nil service; " +
+				"duplicate service name 'indexer'; service #5: nil service; " +
+				"duplicate service name 'dispatcher'",
+		}, {
+			services: []Service{Optional(indexer), DependsOn(indexer, "dispatcher"), dispatcher},
+			errs:     []error{ErrInvalidServices, ErrDuplicateName},
+			expected: "invalid services: duplicate service name 'indexer'",
+		}} {
+			err := Run(context.Background(), test.services)
+			for _, target := range test.errs {
+				if !errors.Is(err, target) {
+					t.Errorf("expected %v to be %v", err, target)
+				}
+			}
+			if err == nil || err.Error() != test.expected {
+				t.Errorf("expected %q, got %v", test.expected, err)
+			}
+			if err := Verify(test.services); err == nil || err.Error() != test.expected {
+				t.Errorf("expected Verify to return %q, got %v", test.expected, err)
+			}
+		}
+	})
+
+	t.Run("it names the services that share a name", func(t *testing.T) {
+		err := checkServices([]Service{named(t, "indexer"), named(t, "indexer")})
+		var duplicate *DuplicateNameError
+		if !errors.As(err, &duplicate) || duplicate.Name != "indexer" {
+			t.Fatalf("expected the name to be reported, got %v", err)
+		}
+	})
+
+	t.Run("it accepts the services with distinct names", func(t *testing.T) {
+		err := checkServices([]Service{named(t, "indexer"), named(t, "dispatcher")})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+}
+
+type validatingTestService struct {
+	testService
+	validate func() error
+}
+
+func (s validatingTestService) Validate() error {
+	return s.validate()
+}
@@ -0,0 +1,120 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+// DefaultVersionTimeout is how long the binary of a service may take to print
+// its version by default
+const DefaultVersionTimeout = 2 * time.Second
+
+// unknownVersion is the version of the binaries that do not print one
+const unknownVersion = "unknown"
+
+// WithBinaryVersions makes Run log the absolute path and the version of the
+// binary of each command service before starting them, and report them in
+// the status of the services. The version is the first line printed by the
+// binary when it runs with --version, or unknown if it fails, prints nothing,
+// or does not exit before the timeout. The default timeout is
+// [DefaultVersionTimeout]
+func WithBinaryVersions(timeout time.Duration) RunOption {
+	return func(c *runConfig) {
+		if timeout == 0 {
+			timeout = DefaultVersionTimeout
+		}
+		c.versionTimeout = timeout
+	}
+}
+
+// binaryVersion is the binary of a command service and its version
+type binaryVersion struct {
+	path    string
+	version string
+}
+
+// versionReporter is a service that reports the binary it runs and its
+// version
+type versionReporter interface {
+	binaryVersion() *binaryVersion
+}
+
+// detectVersion finds the binary of the service and asks for its version,
+// which it keeps for the status of the service
+func (s *simpleService) detectVersion(ctx context.Context, timeout time.Duration) *binaryVersion {
+	detected := &binaryVersion{path: s.binaryName, version: unknownVersion}
+	defer s.version.Store(detected)
+	path, err := exec.LookPath(s.binaryName)
+	if err != nil {
+		return detected
+	}
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	detected.path = path
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, "--version")
+	cmd.Env = s.command().Env
+	cmd.Dir = s.dir
+	cmd.WaitDelay = timeout
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Run(); err != nil {
+		return detected
+	}
+	scanner := bufio.NewScanner(&output)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			detected.version = line
+			break
+		}
+	}
+	return detected
+}
+
+func (s *simpleService) binaryVersion() *binaryVersion {
+	return s.version.Load()
+}
+
+// logBinaryVersions detects the versions of the binaries of the command
+// services at once and logs them in the order of the services
+func logBinaryVersions(specs []ServiceSpec, timeout time.Duration) {
+	versions := make([]*binaryVersion, len(specs))
+	var wg sync.WaitGroup
+	for i, spec := range specs {
+		service, ok := spec.Service.(*simpleService)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, service *simpleService) {
+			defer wg.Done()
+			versions[i] = service.detectVersion(context.Background(), timeout)
+		}(i, service)
+	}
+	wg.Wait()
+	for i, version := range versions {
+		if version == nil {
+			continue
+		}
+		name := specs[i].String()
+		msg := fmt.Sprintf("main: service '%v' runs %v version %v", name, version.path,
+			version.version)
+		logger.Log(logger.Info, msg, "service", name, "event", "version",
+			"binary", version.path, "version", version.version)
+	}
+}
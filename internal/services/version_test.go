@@ -0,0 +1,88 @@
+// (c) Cartesi and individual authors (see AUTHORS)
+// SPDX-License-Identifier: Apache-2.0 (see LICENSE)
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cartesi/rollups-node/internal/logger"
+)
+
+func TestBinaryVersions(t *testing.T) {
+
+	t.Run("it detects the first line of the version", func(t *testing.T) {
+		script := writeScript(t, `[ "$1" = --version ] || exit 1
+echo
+echo "tool 1.2.3"
+echo "built today"`)
+		service := NewCommandService("tool", script).(*simpleService)
+		detected := service.detectVersion(context.Background(), time.Second)
+		if detected.version != "tool 1.2.3" || detected.path != script {
+			t.Fatalf("unexpected version %+v", detected)
+		}
+		if !filepath.IsAbs(service.binaryVersion().path) {
+			t.Fatalf("expected an absolute path, got %v", service.binaryVersion().path)
+		}
+	})
+
+	t.Run("it degrades to unknown", func(t *testing.T) {
+		cases := map[string]string{
+			"without the flag": writeScript(t, `echo "unknown flag $1" >&2; exit 2`),
+			"without a line":   writeScript(t, `exit 0`),
+			"hanging":          writeScript(t, `exec sleep 30`),
+			"missing":          "cartesi-rollups-missing",
+		}
+		for description, binary := range cases {
+			service := NewCommandService("tool", binary).(*simpleService)
+			start := time.Now()
+			detected := service.detectVersion(context.Background(), 100*time.Millisecond)
+			if detected.version != unknownVersion {
+				t.Errorf("%v: expected an unknown version, got %+v", description, detected)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("%v: expected the timeout to apply, took %v", description, elapsed)
+			}
+		}
+	})
+
+	t.Run("it logs and reports the versions at startup", func(t *testing.T) {
+		setup()
+		var out bytes.Buffer
+		logger.Info = log.New(&out, "INFO ", 0)
+		versioned := writeScript(t, `[ "$1" = --version ] && echo "tool 1.2.3" && exit 0
+exec sleep 30`)
+		unversioned := writeScript(t, `exec sleep 30`)
+		supervisor := NewSupervisor([]Service{
+			NewCommandService("versioned", versioned),
+			NewCommandService("unversioned", unversioned),
+		}, WithBinaryVersions(100*time.Millisecond))
+		if err := supervisor.Start(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		statuses := supervisor.Status()
+		if err := supervisor.Stop(context.Background()); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if statuses[0].Version != "tool 1.2.3" || statuses[0].Binary != versioned {
+			t.Errorf("unexpected status %+v", statuses[0])
+		}
+		if statuses[1].Version != unknownVersion || statuses[1].Binary != unversioned {
+			t.Errorf("unexpected status %+v", statuses[1])
+		}
+		for _, expected := range []string{
+			"main: service 'versioned' runs " + versioned + " version tool 1.2.3",
+			"main: service 'unversioned' runs " + unversioned + " version unknown",
+		} {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("expected %q in the log, got %q", expected, out.String())
+			}
+		}
+	})
+}